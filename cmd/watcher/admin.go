@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AdminServer 提供仅监听本地的运维端点，供 preStop hook 等调用
+type AdminServer struct {
+	server  *http.Server
+	watcher *Watcher
+}
+
+func NewAdminServer(watcher *Watcher, addr string, auth *tokenReviewAuthorizer) *AdminServer {
+	mux := http.NewServeMux()
+	as := &AdminServer{watcher: watcher}
+
+	mux.HandleFunc("/drain", auth.wrap(as.handleDrain))
+	mux.HandleFunc("/audit", auth.wrap(as.handleAudit))
+	mux.HandleFunc("/webhook/config", auth.wrap(as.handleWebhookConfig))
+	mux.HandleFunc("/secrets/rotate", auth.wrap(as.handleSecretRotate))
+	mux.HandleFunc("/sync/plan", auth.wrap(as.handleSyncPlan))
+	mux.HandleFunc("/sync/apply", auth.wrap(as.handleSyncApply))
+	mux.HandleFunc("/resync", auth.wrap(as.handleResync))
+	if watcher.config.debugState {
+		mux.HandleFunc("/debug/state", auth.wrap(as.handleDebugState))
+	}
+
+	as.server = &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+	return as
+}
+
+func (as *AdminServer) Start() error {
+	slog.Info("Starting admin server", "addr", as.server.Addr)
+	if err := as.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (as *AdminServer) Stop() error {
+	return as.server.Shutdown(context.Background())
+}
+
+type drainStatus struct {
+	Draining bool  `json:"draining"`
+	Pending  int64 `json:"pending"`
+	Drained  bool  `json:"drained"`
+}
+
+// handleDrain GET 查询排空状态；POST 停止接收新事件，可选 ?wait=<duration> 阻塞等待排空。
+// 排空完成返回 200，否则返回 503，便于 preStop hook 直接用 curl -f 判断。
+func (as *AdminServer) handleDrain(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		as.watcher.startDrain()
+
+		if waitParam := r.URL.Query().Get("wait"); waitParam != "" {
+			wait, err := time.ParseDuration(waitParam)
+			if err != nil {
+				http.Error(w, "invalid wait duration", http.StatusBadRequest)
+				return
+			}
+			as.watcher.waitDrained(r.Context(), wait)
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pending := as.watcher.pending.Load()
+	status := drainStatus{
+		Draining: as.watcher.draining.Load(),
+		Pending:  pending,
+		Drained:  as.watcher.draining.Load() && pending == 0,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !status.Drained {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleAudit 对集群中所有 route 执行一次全量冲突审计，返回 JSON 报告
+func (as *AdminServer) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	report, err := runRouteAudit(r.Context(), as.watcher.client, as.watcher.clientset, as.watcher.policies.get(), as.watcher.schemas.get(), as.watcher.routeKeys, as.watcher.config.tlsSecretNamespaces)
+	if err != nil {
+		slog.Error("Route audit failed", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+type resyncResult struct {
+	syncSummary
+	Error string `json:"error,omitempty"`
+}
+
+// handleResync 立即执行一次全量同步并返回各类资源的同步结果。
+// 有失败时返回 500；排空期间返回 503；已有全量同步在进行时返回 409，不排队等待。
+func (as *AdminServer) handleResync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if as.watcher.draining.Load() {
+		http.Error(w, "watcher is draining", http.StatusServiceUnavailable)
+		return
+	}
+	if !as.watcher.reconcileMu.TryLock() {
+		http.Error(w, "a full resync is already running", http.StatusConflict)
+		return
+	}
+	defer as.watcher.reconcileMu.Unlock()
+
+	slog.Info("Manual full resync requested")
+	summary, err := as.watcher.runReconcile(reconcileManual)
+	result := resyncResult{syncSummary: summary}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// startDrain 停止接收新的 watch 事件，已在处理中的事件会继续完成，尚未到期的合并事件交给 retryQueue
+func (w *Watcher) startDrain() {
+	if w.draining.CompareAndSwap(false, true) {
+		flushed := w.debouncer.flush(w)
+		slog.Info("Draining: no longer accepting new events", "pending", w.pending.Load(), "debouncedToRetryQueue", flushed)
+	}
+}
+
+// errPushesStopped 表示排空已完成，不再向 OpenResty 推送
+var errPushesStopped = errors.New("drained, no longer pushing to OpenResty")
+
+// pushGate 跟踪进行中的推送。close 之后 begin 返回 false，不会在 Wait 期间再调用 WaitGroup.Add
+type pushGate struct {
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// begin 登记一次推送，gate 已关闭时返回 false，调用方不应推送
+func (g *pushGate) begin() bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.closed {
+		return false
+	}
+	g.wg.Add(1)
+	return true
+}
+
+func (g *pushGate) done() {
+	g.wg.Done()
+}
+
+// close 拒绝之后的推送，返回在所有已登记的推送结束后关闭的 channel
+func (g *pushGate) close() <-chan struct{} {
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
+// beginEvent 在未开始排空时登记一个待处理的变更，返回 false 表示已开始排空，调用方应放弃该变更，
+// 由新 Pod 启动时的全量同步覆盖。先增加 pending 再检查 draining，waitDrained 不会漏掉已通过检查的变更。
+// 返回 true 时调用方处理完成后需调用 endEvent
+func (w *Watcher) beginEvent() bool {
+	w.pending.Add(1)
+	if w.draining.Load() {
+		w.pending.Add(-1)
+		return false
+	}
+	return true
+}
+
+func (w *Watcher) endEvent() {
+	w.pending.Add(-1)
+}
+
+// waitInflight 关闭推送 gate 并等待所有进行中的 notifyOpenresty 调用返回，超时返回 false。
+// 应在 waitDrained 之后调用；之后开始的推送（如超时仍未处理完的事件）直接返回 errPushesStopped。
+func (w *Watcher) waitInflight(timeout time.Duration) bool {
+	done := w.inflight.close()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	select {
+	case <-done:
+		return true
+	case <-deadline.C:
+		slog.Warn("Timed out waiting for in-flight pushes to OpenResty", "timeout", timeout.String())
+		return false
+	}
+}
+
+// waitDrained 等待所有处理中的事件完成，超时或 ctx 取消时返回 false
+func (w *Watcher) waitDrained(ctx context.Context, timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if w.pending.Load() == 0 {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-deadline.C:
+			slog.Warn("Drain timed out", "timeout", timeout.String(), "pending", w.pending.Load())
+			return false
+		case <-ticker.C:
+		}
+	}
+}
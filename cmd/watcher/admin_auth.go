@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/kubernetes"
+)
+
+// tokenCacheMaxEntries 限制缓存的 token 数量，超过时先清理过期条目，仍然超过则清空
+const tokenCacheMaxEntries = 1024
+
+// tokenReviewAuthorizer 使用 TokenReview 校验运维端点请求携带的 Bearer token。
+// 每次 TokenReview 有独立的超时，超时、限流、5xx 等临时错误最多重试 retries 次；
+// 校验通过的 token 会缓存一小段时间，避免每个请求都访问 apiserver。
+// 重试耗尽后拒绝请求（fail-closed）；通过认证的用户还必须在 allowedUsers 中。
+type tokenReviewAuthorizer struct {
+	clientset    kubernetes.Interface
+	timeout      time.Duration
+	retries      int
+	backoff      time.Duration
+	ttl          time.Duration
+	allowedUsers map[string]bool
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]tokenCacheEntry
+}
+
+type tokenCacheEntry struct {
+	username string
+	expires  time.Time
+}
+
+// adminAuthorizerFromEnv 根据 ADMIN_AUTH_MODE 创建运维端点的鉴权器，未启用（默认 none）时返回 nil。
+// clientset 由调用方在创建 Watcher 后设置
+func adminAuthorizerFromEnv() (*tokenReviewAuthorizer, error) {
+	switch mode := getEnvOrDefault("ADMIN_AUTH_MODE", "none"); mode {
+	case "none":
+		return nil, nil
+	case "tokenreview":
+	default:
+		return nil, fmt.Errorf("invalid ADMIN_AUTH_MODE %q, must be none or tokenreview", mode)
+	}
+
+	timeout, err := time.ParseDuration(getEnvOrDefault("ADMIN_AUTH_TIMEOUT", "3s"))
+	if err != nil || timeout <= 0 {
+		return nil, fmt.Errorf("invalid ADMIN_AUTH_TIMEOUT")
+	}
+	retries, err := strconv.Atoi(getEnvOrDefault("ADMIN_AUTH_RETRIES", "2"))
+	if err != nil || retries < 0 {
+		return nil, fmt.Errorf("invalid ADMIN_AUTH_RETRIES")
+	}
+	backoff, err := time.ParseDuration(getEnvOrDefault("ADMIN_AUTH_RETRY_BACKOFF", "200ms"))
+	if err != nil || backoff <= 0 {
+		return nil, fmt.Errorf("invalid ADMIN_AUTH_RETRY_BACKOFF")
+	}
+	ttl, err := time.ParseDuration(getEnvOrDefault("ADMIN_AUTH_CACHE_TTL", "30s"))
+	if err != nil || ttl < 0 {
+		return nil, fmt.Errorf("invalid ADMIN_AUTH_CACHE_TTL")
+	}
+
+	allowedUsers := make(map[string]bool)
+	for _, user := range strings.Split(getEnvOrDefault("ADMIN_AUTH_ALLOWED_USERS", ""), ",") {
+		if user = strings.TrimSpace(user); user != "" {
+			allowedUsers[user] = true
+		}
+	}
+	// 集群中任何 ServiceAccount 的 token 都能通过 TokenReview，没有白名单时鉴权形同虚设
+	if len(allowedUsers) == 0 {
+		return nil, fmt.Errorf("ADMIN_AUTH_ALLOWED_USERS is required when ADMIN_AUTH_MODE=tokenreview")
+	}
+
+	return &tokenReviewAuthorizer{
+		timeout:      timeout,
+		retries:      retries,
+		backoff:      backoff,
+		ttl:          ttl,
+		allowedUsers: allowedUsers,
+		cache:        make(map[[sha256.Size]byte]tokenCacheEntry),
+	}, nil
+}
+
+// authenticate 返回 token 对应的用户名
+func (a *tokenReviewAuthorizer) authenticate(ctx context.Context, token string) (string, error) {
+	key := sha256.Sum256([]byte(token))
+	now := time.Now()
+
+	a.mu.Lock()
+	if entry, ok := a.cache[key]; ok && now.Before(entry.expires) {
+		a.mu.Unlock()
+		return entry.username, nil
+	}
+	a.mu.Unlock()
+
+	review, err := a.review(ctx, token)
+	if err != nil {
+		return "", fmt.Errorf("token review failed: %v", err)
+	}
+	if !review.Status.Authenticated {
+		return "", fmt.Errorf("token not authenticated: %s", review.Status.Error)
+	}
+
+	username := review.Status.User.Username
+	if a.ttl > 0 {
+		a.mu.Lock()
+		if len(a.cache) >= tokenCacheMaxEntries {
+			for k, entry := range a.cache {
+				if !now.Before(entry.expires) {
+					delete(a.cache, k)
+				}
+			}
+			if len(a.cache) >= tokenCacheMaxEntries {
+				a.cache = make(map[[sha256.Size]byte]tokenCacheEntry)
+			}
+		}
+		a.cache[key] = tokenCacheEntry{username: username, expires: now.Add(a.ttl)}
+		a.mu.Unlock()
+	}
+	return username, nil
+}
+
+// review 创建 TokenReview，临时错误按指数退避重试，请求本身被取消时立即返回
+func (a *tokenReviewAuthorizer) review(ctx context.Context, token string) (*authenticationv1.TokenReview, error) {
+	delay := a.backoff
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, a.timeout)
+		review, err := a.clientset.AuthenticationV1().TokenReviews().Create(attemptCtx, &authenticationv1.TokenReview{
+			Spec: authenticationv1.TokenReviewSpec{Token: token},
+		}, metav1.CreateOptions{})
+		err = apiTimeoutError(attemptCtx, err, "creating TokenReview", a.timeout)
+		cancel()
+		if err == nil || attempt >= a.retries || !isTransientAPIError(err) {
+			return review, err
+		}
+
+		slog.Warn("TokenReview failed, retrying", "attempt", attempt+1, "error", err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// isTransientAPIError 判断 apiserver 错误是否可能在重试后消失：超时、限流、5xx 及连接错误
+func isTransientAPIError(err error) bool {
+	if apierrors.IsTimeout(err) || apierrors.IsServerTimeout(err) || apierrors.IsTooManyRequests(err) ||
+		apierrors.IsInternalError(err) || apierrors.IsServiceUnavailable(err) || apierrors.IsUnexpectedServerError(err) {
+		return true
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || utilnet.IsConnectionRefused(err) || utilnet.IsConnectionReset(err)
+}
+
+// wrap 为 handler 增加鉴权，a 为 nil 时不做任何检查
+func (a *tokenReviewAuthorizer) wrap(next http.HandlerFunc) http.HandlerFunc {
+	if a == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		username, err := a.authenticate(r.Context(), token)
+		if err != nil {
+			slog.Warn("Admin request rejected", "path", r.URL.Path, "error", err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !a.allowedUsers[username] {
+			slog.Warn("Admin request rejected, user is not allowed", "path", r.URL.Path, "user", username)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next(w, r)
+	}
+}
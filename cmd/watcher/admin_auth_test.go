@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestAdminAuthorizerFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    []string
+		wantNil bool
+		wantErr string
+	}{
+		{"disabled by default", nil, nil, true, ""},
+		{"invalid mode", map[string]string{"ADMIN_AUTH_MODE": "basic"}, nil, false, "invalid ADMIN_AUTH_MODE"},
+		{"tokenreview without allowed users", map[string]string{"ADMIN_AUTH_MODE": "tokenreview"}, nil, false, "ADMIN_AUTH_ALLOWED_USERS is required"},
+		{"blank allowed users", map[string]string{"ADMIN_AUTH_MODE": "tokenreview", "ADMIN_AUTH_ALLOWED_USERS": " , "}, nil, false, "ADMIN_AUTH_ALLOWED_USERS is required"},
+		{"allowed users", map[string]string{"ADMIN_AUTH_MODE": "tokenreview", "ADMIN_AUTH_ALLOWED_USERS": "alice, bob"}, []string{"alice", "bob"}, false, ""},
+		{"invalid timeout", map[string]string{"ADMIN_AUTH_MODE": "tokenreview", "ADMIN_AUTH_ALLOWED_USERS": "alice", "ADMIN_AUTH_TIMEOUT": "0s"}, nil, false, "invalid ADMIN_AUTH_TIMEOUT"},
+		{"invalid retries", map[string]string{"ADMIN_AUTH_MODE": "tokenreview", "ADMIN_AUTH_ALLOWED_USERS": "alice", "ADMIN_AUTH_RETRIES": "-1"}, nil, false, "invalid ADMIN_AUTH_RETRIES"},
+		{"invalid retry backoff", map[string]string{"ADMIN_AUTH_MODE": "tokenreview", "ADMIN_AUTH_ALLOWED_USERS": "alice", "ADMIN_AUTH_RETRY_BACKOFF": "soon"}, nil, false, "invalid ADMIN_AUTH_RETRY_BACKOFF"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			a, err := adminAuthorizerFromEnv()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (a == nil) != tt.wantNil {
+				t.Fatalf("authorizer = %v, wantNil %v", a, tt.wantNil)
+			}
+			for _, user := range tt.want {
+				if !a.allowedUsers[user] {
+					t.Errorf("user %s is not allowed", user)
+				}
+			}
+		})
+	}
+}
+
+// newTestAuthorizer 返回只认可 tokens 中 token（token -> 用户名）的鉴权器，reviews 统计 TokenReview 的次数
+func newTestAuthorizer(tokens map[string]string, reviewErr error, allowedUsers ...string) (*tokenReviewAuthorizer, *int) {
+	clientset := fake.NewSimpleClientset()
+	reviews := 0
+	clientset.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		reviews++
+		if reviewErr != nil {
+			return true, nil, reviewErr
+		}
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		if username, ok := tokens[review.Spec.Token]; ok {
+			review.Status = authenticationv1.TokenReviewStatus{Authenticated: true, User: authenticationv1.UserInfo{Username: username}}
+		}
+		return true, review, nil
+	})
+
+	a := &tokenReviewAuthorizer{
+		clientset:    clientset,
+		timeout:      time.Second,
+		retries:      2,
+		backoff:      time.Millisecond,
+		ttl:          time.Minute,
+		allowedUsers: make(map[string]bool),
+		cache:        make(map[[sha256.Size]byte]tokenCacheEntry),
+	}
+	for _, user := range allowedUsers {
+		a.allowedUsers[user] = true
+	}
+	return a, &reviews
+}
+
+func TestTokenReviewAuthorizerWrap(t *testing.T) {
+	tokens := map[string]string{"admin-token": "alice", "other-token": "mallory"}
+	tests := []struct {
+		name      string
+		header    string
+		reviewErr error
+		want      int
+	}{
+		{"allowed user", "Bearer admin-token", nil, http.StatusOK},
+		{"authenticated user not in allow-list", "Bearer other-token", nil, http.StatusForbidden},
+		{"unknown token", "Bearer bogus", nil, http.StatusUnauthorized},
+		{"missing header", "", nil, http.StatusUnauthorized},
+		{"not a bearer token", "Basic YWxpY2U6cHc=", nil, http.StatusUnauthorized},
+		{"token review failure", "Bearer admin-token", errors.New("apiserver unavailable"), http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _ := newTestAuthorizer(tokens, tt.reviewErr, "alice")
+			handler := a.wrap(func(w http.ResponseWriter, r *http.Request) {})
+
+			req := httptest.NewRequest(http.MethodPost, "/drain", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenReviewAuthorizerCache(t *testing.T) {
+	a, reviews := newTestAuthorizer(map[string]string{"admin-token": "alice"}, nil, "alice")
+	for i := 0; i < 3; i++ {
+		if username, err := a.authenticate(context.Background(), "admin-token"); err != nil || username != "alice" {
+			t.Fatalf("authenticate = (%q, %v)", username, err)
+		}
+	}
+	if *reviews != 1 {
+		t.Errorf("TokenReviews = %d, want 1 with the cache", *reviews)
+	}
+
+	// 未通过认证的 token 不缓存
+	for i := 0; i < 2; i++ {
+		a.authenticate(context.Background(), "bogus")
+	}
+	if *reviews != 3 {
+		t.Errorf("TokenReviews = %d, want 3", *reviews)
+	}
+}
+
+func TestTokenReviewAuthorizerRetry(t *testing.T) {
+	unavailable := apierrors.NewServiceUnavailable("etcd leader changed")
+	tests := []struct {
+		name        string
+		failures    int
+		err         error
+		wantReviews int
+		wantErr     bool
+	}{
+		{"transient error recovers", 2, unavailable, 3, false},
+		{"retries exhausted", 5, unavailable, 3, true},
+		{"rate limited", 1, apierrors.NewTooManyRequests("slow down", 1), 2, false},
+		{"forbidden is not retried", 5, apierrors.NewForbidden(authenticationv1.Resource("tokenreviews"), "", errors.New("denied")), 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, reviews := newTestAuthorizer(map[string]string{"admin-token": "alice"}, nil, "alice")
+			failures := 0
+			a.clientset.(*fake.Clientset).PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				if failures >= tt.failures {
+					return false, nil, nil
+				}
+				failures++
+				*reviews++
+				return true, nil, tt.err
+			})
+
+			username, err := a.authenticate(context.Background(), "admin-token")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("authenticate = %q, want error", username)
+				}
+			} else if err != nil || username != "alice" {
+				t.Fatalf("authenticate = (%q, %v)", username, err)
+			}
+			if *reviews != tt.wantReviews {
+				t.Errorf("TokenReviews = %d, want %d", *reviews, tt.wantReviews)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWaitInflightStopsLaterPushes(t *testing.T) {
+	stub := newOpenrestyStub()
+	w := newTestWatcher(t, stub)
+
+	// 登记一次进行中的推送，waitInflight 须等它结束
+	if !w.inflight.begin() {
+		t.Fatal("push gate is closed before draining")
+	}
+	finished := make(chan bool)
+	go func() { finished <- w.waitInflight(time.Second) }()
+	select {
+	case <-finished:
+		t.Fatal("waitInflight returned while a push was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	w.inflight.done()
+	if !<-finished {
+		t.Fatal("waitInflight timed out after the push finished")
+	}
+
+	// 之后开始的推送不再登记，也不会到达 OpenResty
+	if err := w.notifyOpenresty("POST", "/api/routes/update", testRoute(routeSpec("a.example.com"))); !errors.Is(err, errPushesStopped) {
+		t.Errorf("push after drain: err = %v, want errPushesStopped", err)
+	}
+	if posts := stub.posts(); len(posts) != 0 {
+		t.Errorf("pushes after drain = %v, want none", posts)
+	}
+}
+
+func TestPruneSecretsSkippedWhileDraining(t *testing.T) {
+	stub := newOpenrestyStub()
+	stub.setResponse("/api/secrets/list", []string{"web/stale"})
+	w := newTestWatcher(t, stub)
+	w.startDrain()
+
+	if err := w.pruneSecrets(); err != nil {
+		t.Fatal(err)
+	}
+	if deleted := deletedSecrets(t, stub, 0); len(deleted) != 0 {
+		t.Errorf("secrets pruned while draining: %v", deleted)
+	}
+	if pending := w.pending.Load(); pending != 0 {
+		t.Errorf("pending = %d after skipped prune, want 0", pending)
+	}
+}
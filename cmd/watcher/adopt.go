@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// hashCache 记录每个对象最近一次成功推送到 OpenResty 的内容哈希
+type hashCache struct {
+	mu     sync.Mutex
+	hashes map[string]string // kind/namespace/name -> hash
+}
+
+func newHashCache() *hashCache {
+	return &hashCache{hashes: make(map[string]string)}
+}
+
+func (c *hashCache) set(key, hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hashes[key] = hash
+}
+
+func (c *hashCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.hashes, key)
+}
+
+// objectHash 计算对象中 OpenResty 关心的内容的哈希（name、namespace、spec 以及 Secret 的 data）。
+// resourceVersion、status 等字段不参与计算，因此只更新 status 不会改变哈希。
+func objectHash(obj *unstructured.Unstructured) string {
+	content := map[string]interface{}{
+		"kind":      obj.GetKind(),
+		"name":      obj.GetName(),
+		"namespace": obj.GetNamespace(),
+		"spec":      obj.Object["spec"],
+		"data":      obj.Object["data"],
+	}
+	// encoding/json 对 map 的 key 排序，输出是确定的
+	data, err := json.Marshal(content)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hashCacheKey 返回对象在 hashCache 中的 key
+func hashCacheKey(obj *unstructured.Unstructured) string {
+	return obj.GetKind() + "/" + objectKey(obj)
+}
+
+// fetchAdoptableHashes 获取 OpenResty 当前持有的 route/upstream 哈希（namespace/name -> hash）
+func (w *Watcher) fetchAdoptableHashes() (routes, upstreams map[string]string, err error) {
+	if err := w.fetchOpenresty("/api/routes/list", &routes); err != nil {
+		return nil, nil, err
+	}
+	if err := w.fetchOpenresty("/api/upstreams/list", &upstreams); err != nil {
+		return nil, nil, err
+	}
+	return routes, upstreams, nil
+}
+
+// adoptIfUnchanged 在 adopt 模式下判断 OpenResty 中已有相同内容，若是则直接记入缓存并跳过推送
+func (w *Watcher) adoptIfUnchanged(remote map[string]string, obj *unstructured.Unstructured) bool {
+	if remote == nil {
+		return false
+	}
+	hash := objectHash(obj)
+	if hash == "" || remote[objectKey(obj)] != hash {
+		return false
+	}
+	w.hashes.set(hashCacheKey(obj), hash)
+	w.maxAge.schedule(hashCacheKey(obj))
+	return true
+}
+
+// seedEpoch 从 OpenResty 读取已应用的 epoch 作为起点，避免 watcher 重启后 epoch 回退导致永久不一致
+func (w *Watcher) seedEpoch() {
+	var status epochStatus
+	if err := w.fetchOpenresty("/api/epoch", &status); err != nil {
+		slog.Warn("Failed to fetch OpenResty epoch, starting from 0", "error", err)
+		return
+	}
+	w.epoch.Store(status.Epoch)
+	w.ackedEpoch.Store(status.Epoch)
+	if status.Epoch > 0 {
+		slog.Info("Resuming from OpenResty epoch", "epoch", status.Epoch)
+	}
+}
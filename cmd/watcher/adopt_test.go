@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestObjectHash(t *testing.T) {
+	base := func() *unstructured.Unstructured {
+		return testRoute(map[string]interface{}{"hosts": []interface{}{"a.example.com"}})
+	}
+	baseHash := objectHash(base())
+
+	tests := []struct {
+		name    string
+		mutate  func(*unstructured.Unstructured)
+		changed bool
+	}{
+		{"resourceVersion", func(o *unstructured.Unstructured) { o.SetResourceVersion("42") }, false},
+		{"status", func(o *unstructured.Unstructured) { o.Object["status"] = map[string]interface{}{"synced": true} }, false},
+		{"labels", func(o *unstructured.Unstructured) { o.SetLabels(map[string]string{"a": "b"}) }, false},
+		{"spec", func(o *unstructured.Unstructured) {
+			unstructured.SetNestedStringSlice(o.Object, []string{"b.example.com"}, "spec", "hosts")
+		}, true},
+		{"name", func(o *unstructured.Unstructured) { o.SetName("other") }, true},
+		{"namespace", func(o *unstructured.Unstructured) { o.SetNamespace("other") }, true},
+		{"kind", func(o *unstructured.Unstructured) { o.SetKind("OSSProxyUpstream") }, true},
+		{"data", func(o *unstructured.Unstructured) { o.Object["data"] = map[string]interface{}{"k": "v"} }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := base()
+			tt.mutate(obj)
+			if changed := objectHash(obj) != baseHash; changed != tt.changed {
+				t.Errorf("hash changed = %v, want %v", changed, tt.changed)
+			}
+		})
+	}
+}
+
+func TestAdoptIfUnchanged(t *testing.T) {
+	route := testRoute(map[string]interface{}{"hosts": []interface{}{"a.example.com"}})
+	hash := objectHash(route)
+
+	tests := []struct {
+		name   string
+		remote map[string]string
+		want   bool
+	}{
+		{"adopt disabled", nil, false},
+		{"not held", map[string]string{}, false},
+		{"different content", map[string]string{"web/r": "stale"}, false},
+		{"same content", map[string]string{"web/r": hash}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWatcher(t, newOpenrestyStub())
+			if got := w.adoptIfUnchanged(tt.remote, route); got != tt.want {
+				t.Fatalf("adoptIfUnchanged = %v, want %v", got, tt.want)
+			}
+			_, cached := w.hashes.hashes[hashCacheKey(route)]
+			if cached != tt.want {
+				t.Errorf("hash cached = %v, want %v", cached, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeedEpoch(t *testing.T) {
+	stub := newOpenrestyStub()
+	stub.setResponse("/api/epoch", epochStatus{Epoch: 41})
+	w := newTestWatcher(t, stub)
+
+	w.seedEpoch()
+	if got := w.nextEpoch(); got != 42 {
+		t.Errorf("nextEpoch after seeding = %d, want 42", got)
+	}
+	if got := w.ackedEpoch.Load(); got != 41 {
+		t.Errorf("ackedEpoch = %d, want 41", got)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// apiKeyStore 保存访问 OpenResty 内部 API 的密钥。OpenResty 每次请求都会重新读取密钥文件，
+// 因此密钥文件被替换后 watcher 也需要跟着重新加载，否则推送会被拒绝。
+//
+// watcher 只向一个 OpenResty（OPENRESTY_API_BASE）推送，没有多后端的 fan-out，
+// 因此只有一个密钥文件。
+type apiKeyStore struct {
+	path     string
+	interval time.Duration
+	current  atomic.Value // string
+}
+
+// apiKeyFile 由 entrypoint 生成，nginx.conf 中 /api/ 的鉴权读取同一个文件
+const apiKeyFile = "/tmp/api.key"
+
+// newAPIKeyStore 读取密钥文件（OPENRESTY_API_KEY_FILE，默认为 entrypoint 生成的文件，集群外运行时可以指向本地文件），
+// 文件不存在或为空时返回错误
+func newAPIKeyStore(interval time.Duration) (*apiKeyStore, error) {
+	return loadKeyFile(getEnvOrDefault("OPENRESTY_API_KEY_FILE", apiKeyFile), interval)
+}
+
+// loadKeyFile 读取一个密钥文件并返回按 interval 重新加载的 apiKeyStore
+func loadKeyFile(path string, interval time.Duration) (*apiKeyStore, error) {
+	ks := &apiKeyStore{
+		path:     path,
+		interval: interval,
+	}
+	if _, err := ks.reload(); err != nil {
+		return nil, err
+	}
+	slog.Info("Loaded key", "path", ks.path, "key", maskSecret(ks.get()))
+	return ks, nil
+}
+
+func (ks *apiKeyStore) get() string {
+	key, _ := ks.current.Load().(string)
+	return key
+}
+
+// reload 重新读取密钥文件，内容变化时替换当前密钥；读取失败或为空时保留旧密钥
+func (ks *apiKeyStore) reload() (bool, error) {
+	data, err := os.ReadFile(ks.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read key from %s: %v", ks.path, err)
+	}
+	key := string(bytes.TrimSpace(data))
+	if key == "" {
+		return false, fmt.Errorf("key in %s is empty", ks.path)
+	}
+	if key == ks.get() {
+		return false, nil
+	}
+	ks.current.Store(key)
+	return true, nil
+}
+
+// watch 周期性检查密钥文件是否变化
+func (ks *apiKeyStore) watch(done <-chan struct{}) {
+	ticker := time.NewTicker(ks.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			changed, err := ks.reload()
+			if err != nil {
+				slog.Error("Key reload failed, keeping previous key", "path", ks.path, "error", err)
+				continue
+			}
+			if changed {
+				slog.Info("Reloaded key", "path", ks.path, "key", maskSecret(ks.get()))
+			}
+		}
+	}
+}
+
+// reloadKeysOnUnauthorized 在 OpenResty 返回 401 时立即重新读取密钥文件，不必等到下一次定期检查。
+// 密钥轮换时 OpenResty 已经在使用新密钥，这样只有正在进行的请求会失败，重试即使用新密钥
+func (w *Watcher) reloadKeysOnUnauthorized(statusCode int) {
+	if statusCode != http.StatusUnauthorized {
+		return
+	}
+	stores := []*apiKeyStore{w.apiKey}
+	if w.signer != nil && w.signer.key != w.apiKey {
+		stores = append(stores, w.signer.key)
+	}
+	for _, ks := range stores {
+		changed, err := ks.reload()
+		if err != nil {
+			slog.Error("Key reload after 401 failed, keeping previous key", "path", ks.path, "error", err)
+			continue
+		}
+		if changed {
+			slog.Info("Reloaded key after 401", "path", ks.path, "key", maskSecret(ks.get()))
+		}
+	}
+}
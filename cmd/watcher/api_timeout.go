@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// apiContext 返回访问 apiserver 用的 context，从 w.ctx 派生并带有 KUBE_API_TIMEOUT 超时，
+// 避免 apiserver 无响应时同步或退出被无限期阻塞
+func (w *Watcher) apiContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(w.ctx, w.config.apiTimeout)
+}
+
+// apiContext 返回 webhook 访问 apiserver 用的 context，带有 WEBHOOK_API_TIMEOUT 超时。
+// apiserver 等待 webhook 响应的时间有限，超时后直接按失败处理，不能让单次查询耗尽整个预算。
+func (ws *WebhookServer) apiContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), ws.watcher.config.webhookAPITimeout)
+}
+
+// getObject 带超时地从 apiserver 读取单个 route/upstream
+func (w *Watcher) getObject(gvr schema.GroupVersionResource, namespace, name string) (*unstructured.Unstructured, error) {
+	ctx, cancel := w.apiContext()
+	defer cancel()
+	obj, err := w.client.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	return obj, apiTimeoutError(ctx, err, "getting "+gvr.Resource, w.config.apiTimeout)
+}
+
+// listObjectsWithTimeout 带超时地从 apiserver 列出监听范围内的对象，见 listObjects
+func (w *Watcher) listObjectsWithTimeout(gvr schema.GroupVersionResource) ([]unstructured.Unstructured, error) {
+	ctx, cancel := w.apiContext()
+	defer cancel()
+	items, err := w.listObjects(ctx, gvr)
+	return items, apiTimeoutError(ctx, err, "listing "+gvr.Resource, w.config.apiTimeout)
+}
+
+// apiTimeoutError 在 ctx 因超时结束时，将 err 替换为说明操作及超时时长的错误
+func apiTimeoutError(ctx context.Context, err error, operation string, timeout time.Duration) error {
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s timed out after %s: %w", operation, timeout, context.DeadlineExceeded)
+	}
+	return err
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// auditFinding 是全量审计发现的一个问题
+type auditFinding struct {
+	Kind    string   `json:"kind"`
+	Host    string   `json:"host,omitempty"`
+	Routes  []string `json:"routes"`
+	Message string   `json:"message"`
+}
+
+// auditReport 是全量审计的结果，Conflicts 为需要清理的问题，Warnings 仅供参考
+type auditReport struct {
+	RoutesScanned int            `json:"routesScanned"`
+	Conflicts     []auditFinding `json:"conflicts"`
+	Warnings      []auditFinding `json:"warnings"`
+}
+
+// runRouteAudit 列出集群中所有 route，并复用 webhook 的校验逻辑检查在 webhook 启用前可能已存在的冲突
+func runRouteAudit(ctx context.Context, client dynamic.Interface, clientset kubernetes.Interface, policy *webhookPolicy, schema *jsonSchema, keyConfig *routeKeyConfig, tlsSecretNamespaces map[string]bool) (*auditReport, error) {
+	routes, err := client.Resource(routeGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routes: %v", err)
+	}
+
+	report := &auditReport{
+		RoutesScanned: len(routes.Items),
+		Conflicts:     []auditFinding{},
+		Warnings:      []auditFinding{},
+	}
+
+	// 跨 route 的域名冲突，按 route key 判断
+	allKeys := collectRouteKeys(routes.Items, keyConfig, nil)
+	keyNames := make([]string, 0, len(allKeys))
+	for key := range allKeys {
+		keyNames = append(keyNames, key)
+	}
+	sort.Strings(keyNames)
+	for _, key := range keyNames {
+		owners := uniqueStrings(allKeys[key])
+		if len(owners) > 1 {
+			report.Conflicts = append(report.Conflicts, auditFinding{
+				Kind:    "duplicate-host",
+				Host:    key,
+				Routes:  owners,
+				Message: fmt.Sprintf("%s is used by %d routes", describeRouteKey(key), len(owners)),
+			})
+		}
+	}
+
+	// 单个 route 的检查
+	for i := range routes.Items {
+		route := &routes.Items[i]
+		key := fmt.Sprintf("%s/%s", route.GetNamespace(), route.GetName())
+		hosts, _, _ := unstructured.NestedStringSlice(route.Object, "spec", "hosts")
+
+		for _, host := range uniqueStrings(duplicateHostsWithin(hosts)) {
+			report.Conflicts = append(report.Conflicts, auditFinding{
+				Kind:    "duplicate-host-within-route",
+				Host:    host,
+				Routes:  []string{key},
+				Message: fmt.Sprintf("host '%s' is listed more than once", host),
+			})
+		}
+
+		if err := checkDuplicatePaths(route); err != nil {
+			report.Conflicts = append(report.Conflicts, auditFinding{
+				Kind:    "duplicate-path-within-route",
+				Routes:  []string{key},
+				Message: err.Error(),
+			})
+		}
+
+		for _, v := range routeSpecValidators {
+			if err := v.validate(route); err != nil {
+				report.Conflicts = append(report.Conflicts, auditFinding{
+					Kind:    "invalid-spec",
+					Routes:  []string{key},
+					Message: err.Error(),
+				})
+			}
+		}
+
+		if schema != nil {
+			for _, e := range schema.validate(route.Object) {
+				report.Conflicts = append(report.Conflicts, auditFinding{
+					Kind:    "schema",
+					Routes:  []string{key},
+					Message: fmt.Sprintf("%s: %s", e.field, e.message),
+				})
+			}
+		}
+
+		if policy != nil {
+			if err := policy.checkHosts(hosts, route.GetNamespace()); err != nil {
+				report.Conflicts = append(report.Conflicts, auditFinding{
+					Kind:    "policy",
+					Routes:  []string{key},
+					Message: err.Error(),
+				})
+			}
+		}
+
+		warnings, err := checkRouteTLS(ctx, clientset, route, hosts, tlsSecretNamespaces)
+		if err != nil {
+			report.Conflicts = append(report.Conflicts, auditFinding{
+				Kind:    "tls",
+				Routes:  []string{key},
+				Message: err.Error(),
+			})
+		}
+		for _, warning := range warnings {
+			report.Warnings = append(report.Warnings, auditFinding{
+				Kind:    "tls",
+				Routes:  []string{key},
+				Message: warning,
+			})
+		}
+	}
+
+	return report, nil
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var result []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// runAuditCommand 实现 `crd-watcher audit` 子命令：输出 JSON 报告，存在冲突时以非零状态退出
+func runAuditCommand() int {
+	client, clientset, err := newKubeClients()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit: %v\n", err)
+		return 2
+	}
+
+	policies, err := newPolicyStore()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit: failed to load webhook policy: %v\n", err)
+		return 2
+	}
+
+	schemas, err := newRouteSchemaStore()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit: failed to load route schema: %v\n", err)
+		return 2
+	}
+
+	keyConfig, err := routeKeyConfigFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit: %v\n", err)
+		return 2
+	}
+
+	report, err := runRouteAudit(context.Background(), client, clientset, policies.get(), schemas.get(), keyConfig, tlsSecretNamespacesFromEnv())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit: %v\n", err)
+		return 2
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+
+	if len(report.Conflicts) > 0 {
+		var kinds []string
+		for _, c := range report.Conflicts {
+			kinds = append(kinds, c.Kind)
+		}
+		fmt.Fprintf(os.Stderr, "audit: %d conflicts found (%s)\n", len(report.Conflicts), strings.Join(uniqueStrings(kinds), ", "))
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// errBulkUnsupported 表示 OpenResty 的 Lua 版本较旧，没有批量推送接口
+var errBulkUnsupported = errors.New("bulk update endpoint not supported by OpenResty")
+
+// bulkItem 是批量推送请求中的一项，hash 与 routeKeys 对应逐个推送时的 X-Object-Hash 与 X-Route-Keys
+type bulkItem struct {
+	Object    *unstructured.Unstructured `json:"object"`
+	Hash      string                     `json:"hash"`
+	RouteKeys string                     `json:"routeKeys,omitempty"`
+}
+
+// bulkResult 是 OpenResty 对批量请求中每一项的处理结果，与请求中的项一一对应
+type bulkResult struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// syncConcurrencyFromEnv 读取 SYNC_CONCURRENCY（默认 4）
+func syncConcurrencyFromEnv() (int, error) {
+	concurrency, err := strconv.Atoi(getEnvOrDefault("SYNC_CONCURRENCY", "4"))
+	if err != nil || concurrency < 1 {
+		return 0, fmt.Errorf("invalid SYNC_CONCURRENCY")
+	}
+	return concurrency, nil
+}
+
+// bulkUpdate 在全量同步时将 objs 批量推送到 updatePath 对应的 bulk-update 接口，返回与 objs 一一对应的错误。
+// 请求按 maxPayloadBytes 分批；单个对象已超限、OpenResty 不支持批量接口（返回 404）或整批请求失败时，
+// 退回到 updatePath 逐个推送。各批请求和逐个推送以 syncConcurrency 的并发度并行，每个对象只推送一次。
+func (w *Watcher) bulkUpdate(updatePath string, objs []*unstructured.Unstructured) []error {
+	errs := make([]error, len(objs))
+	bulkPath := strings.TrimSuffix(updatePath, "/update") + "/bulk-update"
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, w.syncConcurrency)
+	run := func(fn func()) {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn()
+		}()
+	}
+	pushOne := func(i int) {
+		run(func() { errs[i] = w.notifyOpenresty("POST", updatePath, objs[i]) })
+	}
+
+	var (
+		batch   []int
+		encoded [][]byte
+		hashes  []string
+		size    int
+	)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		indexes, payloads, objHashes := batch, encoded, hashes
+		run(func() { w.pushBatch(updatePath, bulkPath, objs, indexes, payloads, objHashes, errs) })
+		batch, encoded, hashes, size = nil, nil, nil, 0
+	}
+
+	for i, obj := range objs {
+		if w.dryRun || w.bulkUnsupported.Load() || w.oversize.rejected(obj) {
+			pushOne(i)
+			continue
+		}
+
+		item := bulkItem{Object: obj, Hash: objectHash(obj)}
+		if obj.GetKind() == "OSSProxyRoute" {
+			item.RouteKeys = strings.Join(w.routeKeys.keys(obj), ",")
+		}
+		data, err := json.Marshal(item)
+		if err != nil {
+			errs[i] = fmt.Errorf("failed to marshal object: %v", err)
+			continue
+		}
+		// 单独成批也会超限的对象交给逐个推送，由其记录过大状态
+		if len(data)+2 > w.maxPayloadBytes {
+			pushOne(i)
+			continue
+		}
+		// 数组的方括号与逗号
+		if size+len(data)+len(batch)+2 > w.maxPayloadBytes {
+			flush()
+		}
+		batch = append(batch, i)
+		encoded = append(encoded, data)
+		hashes = append(hashes, item.Hash)
+		size += len(data)
+	}
+	flush()
+	wg.Wait()
+
+	return errs
+}
+
+// pushBatch 推送一批对象并将结果写入 errs，batch 为这批对象在 objs 中的下标
+func (w *Watcher) pushBatch(updatePath, bulkPath string, objs []*unstructured.Unstructured, batch []int, encoded [][]byte, hashes []string, errs []error) {
+	if !w.inflight.begin() {
+		for _, i := range batch {
+			errs[i] = errPushesStopped
+		}
+		return
+	}
+	defer w.inflight.done()
+
+	var body bytes.Buffer
+	body.WriteByte('[')
+	body.Write(bytes.Join(encoded, []byte(",")))
+	body.WriteByte(']')
+
+	results, err := w.postBulk(bulkPath, body.Bytes())
+	if err == nil && len(results) != len(batch) {
+		err = fmt.Errorf("expected %d results, got %d", len(batch), len(results))
+	}
+	if err != nil {
+		if errors.Is(err, errBulkUnsupported) {
+			slog.Warn("OpenResty does not support bulk sync, falling back to per-object sync", "path", bulkPath)
+			w.bulkUnsupported.Store(true)
+		} else {
+			slog.Warn("Bulk sync failed, falling back to per-object sync", "path", bulkPath, "objects", len(batch), "error", err)
+		}
+		for _, i := range batch {
+			errs[i] = w.notifyOpenresty("POST", updatePath, objs[i])
+		}
+		return
+	}
+
+	for n, i := range batch {
+		obj := objs[i]
+		if results[n].OK {
+			w.hashes.set(hashCacheKey(obj), hashes[n])
+			w.maxAge.schedule(hashCacheKey(obj))
+			w.clearOversize(obj)
+			w.metrics.pushes.inc(pushSuccess)
+		} else {
+			slog.Warn("OpenResty rejected object in bulk update", append(objectLogAttrs(syncResource(bulkPath), obj.GetNamespace(), obj.GetName()),
+				"reason", results[n].Error, "payload", describeObject(obj))...)
+			errs[i] = fmt.Errorf("OpenResty rejected %s %s: %s", obj.GetKind(), objectKey(obj), results[n].Error)
+			w.metrics.pushes.inc(pushFailure)
+		}
+		w.recordSync(updatePath, errs[i])
+		w.events.emit(updatePath, obj, errs[i])
+	}
+	slog.Info("Bulk synced objects", "path", bulkPath, "objects", len(batch))
+}
+
+// postBulk 发送一次批量请求并解析逐项结果，每个批次是一个单独的 trace
+func (w *Watcher) postBulk(path string, body []byte) (_ []bulkResult, err error) {
+	span := w.tracer.start(nil, "POST "+path, spanKindClient)
+	span.setAttr("ossfe.resource", syncResource(path))
+	span.setAttr("http.request.method", "POST")
+	span.setAttr("url.path", path)
+	defer func() { span.finish(err) }()
+
+	req, err := http.NewRequestWithContext(w.ctx, "POST", w.openresty.url(path), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	w.authorize(req, path, body)
+	span.inject(req)
+	epoch := w.nextEpoch()
+	req.Header.Set("X-Sync-Epoch", strconv.FormatUint(epoch, 10))
+
+	// 一批对象的处理时间长于单个对象
+	resp, err := w.openresty.do(req, 30*time.Second)
+	if err != nil {
+		return nil, &openrestyTransportError{Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errBulkUnsupported
+	}
+	if resp.StatusCode != http.StatusOK {
+		w.reloadKeysOnUnauthorized(resp.StatusCode)
+		return nil, newOpenrestyStatusError(resp)
+	}
+	w.ackEpoch(epoch)
+
+	var out struct {
+		Results []bulkResult `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+	return out.Results, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// maxVaryQueryParams 为 spec.cache.varyQuery 的条目上限
+const maxVaryQueryParams = 20
+
+// queryParamNamePattern 限定查询参数名为 URL 中无需编码的字符，OpenResty 按原样比较参数名
+var queryParamNamePattern = regexp.MustCompile(`^[A-Za-z0-9._~-]+$`)
+
+// validateCacheVaryQuery 校验 spec.cache.varyQuery：参数名非空、只含 URL 非保留字符且不重复。
+// 空列表合法，表示忽略所有查询参数。
+func validateCacheVaryQuery(route *unstructured.Unstructured) error {
+	params, found, err := unstructured.NestedStringSlice(route.Object, "spec", "cache", "varyQuery")
+	if err != nil {
+		return fmt.Errorf("spec.cache.varyQuery must be a list of strings: %v", err)
+	}
+	if !found {
+		return nil
+	}
+	if len(params) > maxVaryQueryParams {
+		return fmt.Errorf("spec.cache.varyQuery must not have more than %d entries, got %d", maxVaryQueryParams, len(params))
+	}
+
+	seen := make(map[string]bool, len(params))
+	for _, param := range params {
+		if !queryParamNamePattern.MatchString(param) {
+			return fmt.Errorf("spec.cache.varyQuery entry '%s' must be a non-empty query parameter name of letters, digits, '.', '_', '~' or '-'", param)
+		}
+		if seen[param] {
+			return fmt.Errorf("spec.cache.varyQuery entry '%s' is duplicated", param)
+		}
+		seen[param] = true
+	}
+	return nil
+}
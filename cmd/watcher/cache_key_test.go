@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateCacheVaryQuery(t *testing.T) {
+	tooMany := make([]interface{}, maxVaryQueryParams+1)
+	for i := range tooMany {
+		tooMany[i] = strings.Repeat("p", i+1)
+	}
+
+	tests := []struct {
+		name    string
+		cache   interface{}
+		wantErr string
+	}{
+		{"unset", nil, ""},
+		{"empty list ignores all parameters", map[string]interface{}{"varyQuery": []interface{}{}}, ""},
+		{"valid", map[string]interface{}{"varyQuery": []interface{}{"v", "lang", "x-ver_1.0~"}}, ""},
+		{"not a list", map[string]interface{}{"varyQuery": "v"}, "must be a list of strings"},
+		{"empty name", map[string]interface{}{"varyQuery": []interface{}{""}}, "must be a non-empty query parameter name"},
+		{"reserved character", map[string]interface{}{"varyQuery": []interface{}{"a&b"}}, "must be a non-empty query parameter name"},
+		{"duplicated", map[string]interface{}{"varyQuery": []interface{}{"v", "v"}}, "is duplicated"},
+		{"too many", map[string]interface{}{"varyQuery": tooMany}, "must not have more than"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := map[string]interface{}{}
+			if tt.cache != nil {
+				spec["cache"] = tt.cache
+			}
+			err := validateCacheVaryQuery(testRoute(spec))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
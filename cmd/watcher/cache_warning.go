@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// cacheWarnings 检查 route 的缓存配置是否可能无效，只返回 warning，不拒绝请求
+func (ws *WebhookServer) cacheWarnings(route *unstructured.Unstructured) []string {
+	cache, _, _ := unstructured.NestedMap(route.Object, "spec", "cache")
+	if enabled, found, _ := unstructured.NestedBool(cache, "enabled"); found && !enabled {
+		return nil
+	}
+
+	var warnings []string
+
+	// 所有 max-age 都为 0 时缓存等同于关闭
+	allZero := true
+	for _, field := range []string{"maxAge", "htmlMaxAge", "staticMaxAge"} {
+		if value, found, _ := unstructured.NestedInt64(cache, field); !found || value > 0 {
+			allZero = false
+			break
+		}
+	}
+	if allZero {
+		warnings = append(warnings, "spec.cache is enabled but maxAge, htmlMaxAge and staticMaxAge are all 0, responses will not be cached; set spec.cache.enabled: false to make this explicit")
+	}
+
+	// upstream 声明会返回 no-cache 类响应头时，除非设置了 ignoreUpstreamHeaders，下游缓存可能仍然不生效
+	if ignore, _, _ := unstructured.NestedBool(cache, "ignoreUpstreamHeaders"); ignore {
+		return warnings
+	}
+	upstreamKey, ok := routeUpstreamKey(route)
+	if !ok {
+		return warnings
+	}
+	namespace, name := splitObjectKey(upstreamKey)
+	ctx, cancel := ws.apiContext()
+	defer cancel()
+	upstream, err := ws.watcher.client.Resource(upstreamGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			slog.Error("Failed to get upstream for cache check", append(objectLogAttrs("upstreams", namespace, name), "error", err)...)
+		}
+		return warnings
+	}
+	if noCache, _, _ := unstructured.NestedBool(upstream.Object, "spec", "noCacheHeaders"); noCache {
+		warnings = append(warnings, fmt.Sprintf("upstream %s declares noCacheHeaders, its Expires/Pragma headers may make spec.cache ineffective; set spec.cache.ignoreUpstreamHeaders: true to drop them", upstreamKey))
+	}
+	return warnings
+}
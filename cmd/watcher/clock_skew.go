@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// clockSkewProbe 比较 watcher 与 OpenResty 的时钟。幂等键、HMAC 签名等依赖双方时钟大致一致，
+// 时钟漂移会导致难以排查的静默失败。
+type clockSkewProbe struct {
+	threshold time.Duration
+	interval  time.Duration
+	// now 为 watcher 侧的时钟，便于替换
+	now func() time.Time
+}
+
+// clockSkewProbeFromEnv 读取 OPENRESTY_CLOCK_SKEW_THRESHOLD（默认 2s）和
+// OPENRESTY_CLOCK_CHECK_INTERVAL（默认 1m，为 0 时只在启动时检查一次）
+func clockSkewProbeFromEnv() (*clockSkewProbe, error) {
+	threshold, err := time.ParseDuration(getEnvOrDefault("OPENRESTY_CLOCK_SKEW_THRESHOLD", "2s"))
+	if err != nil || threshold <= 0 {
+		return nil, fmt.Errorf("invalid OPENRESTY_CLOCK_SKEW_THRESHOLD")
+	}
+	interval, err := time.ParseDuration(getEnvOrDefault("OPENRESTY_CLOCK_CHECK_INTERVAL", "1m"))
+	if err != nil || interval < 0 {
+		return nil, fmt.Errorf("invalid OPENRESTY_CLOCK_CHECK_INTERVAL")
+	}
+	return &clockSkewProbe{threshold: threshold, interval: interval, now: time.Now}, nil
+}
+
+// measureSkew 返回 OpenResty 时钟减去 watcher 时钟的差值。
+// 以请求发出与收到响应的中点作为 OpenResty 取时间的时刻，抵消请求耗时的影响。
+func (w *Watcher) measureSkew() (time.Duration, error) {
+	probe := w.clockProbe
+
+	sent := probe.now()
+	var status epochStatus
+	if err := w.fetchOpenresty("/api/epoch", &status); err != nil {
+		return 0, err
+	}
+	received := probe.now()
+
+	if status.Now <= 0 {
+		return 0, fmt.Errorf("OpenResty did not report its time")
+	}
+	remote := time.Unix(0, int64(status.Now*float64(time.Second)))
+	midpoint := sent.Add(received.Sub(sent) / 2)
+	return remote.Sub(midpoint), nil
+}
+
+// checkClockSkew 测量一次时钟差，更新指标，超过阈值时输出警告
+func (w *Watcher) checkClockSkew() {
+	skew, err := w.measureSkew()
+	if err != nil {
+		slog.Error("Failed to measure clock skew with OpenResty", "error", err)
+		return
+	}
+
+	w.metrics.clockSkew.set(skew.Seconds())
+	if math.Abs(float64(skew)) > float64(w.clockProbe.threshold) {
+		slog.Warn("Clock skew between watcher and OpenResty exceeds threshold, idempotency keys and request signing may fail",
+			"skew", skew, "threshold", w.clockProbe.threshold)
+	}
+}
+
+// monitorClockSkew 在启动时检查一次时钟差，之后按 interval 周期性检查
+func (w *Watcher) monitorClockSkew() {
+	w.checkClockSkew()
+	if w.clockProbe.interval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(w.clockProbe.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+			w.checkClockSkew()
+		}
+	}
+}
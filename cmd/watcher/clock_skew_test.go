@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMeasureSkew(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	tests := []struct {
+		name     string
+		remote   float64
+		elapsed  time.Duration
+		want     time.Duration
+		wantErr  bool
+		noStatus bool
+	}{
+		{"in sync", 1700000000.5, time.Second, 0, false, false},
+		{"remote ahead", 1700000003.5, time.Second, 3 * time.Second, false, false},
+		{"remote behind", 1699999998, 0, -2 * time.Second, false, false},
+		{"time not reported", 0, 0, 0, true, false},
+		{"endpoint unavailable", 0, 0, 0, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newOpenrestyStub()
+			if !tt.noStatus {
+				stub.setResponse("/api/epoch", map[string]interface{}{"epoch": 1, "now": tt.remote})
+			}
+			w := newTestWatcher(t, stub)
+			// 第一次调用为发出请求的时刻，第二次为收到响应的时刻
+			calls := 0
+			w.clockProbe = &clockSkewProbe{threshold: time.Second, now: func() time.Time {
+				calls++
+				if calls == 1 {
+					return base
+				}
+				return base.Add(tt.elapsed)
+			}}
+
+			skew, err := w.measureSkew()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (skew-tt.want).Abs() > time.Millisecond {
+				t.Errorf("skew = %s, want %s", skew, tt.want)
+			}
+		})
+	}
+}
+
+func TestClockSkewProbeFromEnv(t *testing.T) {
+	tests := []struct {
+		threshold string
+		interval  string
+		wantErr   bool
+	}{
+		{"", "", false},
+		{"500ms", "0", false},
+		{"0", "", true},
+		{"", "-1s", true},
+		{"soon", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.threshold+"/"+tt.interval, func(t *testing.T) {
+			if tt.threshold != "" {
+				t.Setenv("OPENRESTY_CLOCK_SKEW_THRESHOLD", tt.threshold)
+			}
+			if tt.interval != "" {
+				t.Setenv("OPENRESTY_CLOCK_CHECK_INTERVAL", tt.interval)
+			}
+			if _, err := clockSkewProbeFromEnv(); (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const cloudEventTypePrefix = "tech.imvictor.ossfe."
+
+// cloudEvent 是 CloudEvents 1.0 structured mode 的 JSON 表示
+type cloudEvent struct {
+	SpecVersion     string         `json:"specversion"`
+	ID              string         `json:"id"`
+	Source          string         `json:"source"`
+	Type            string         `json:"type"`
+	Subject         string         `json:"subject"`
+	Time            string         `json:"time"`
+	DataContentType string         `json:"datacontenttype"`
+	Result          string         `json:"result"`
+	Data            cloudEventData `json:"data"`
+}
+
+// cloudEventData 只包含对象标识和同步结果，不包含 spec，避免把凭据发送到外部
+type cloudEventData struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Action    string `json:"action"`
+	Error     string `json:"error,omitempty"`
+}
+
+// cloudEventEmitter 将同步结果异步投递到 CloudEvents sink。
+// 投递是 best-effort 的：队列满时直接丢弃，发送失败不重试，不会阻塞同步流程。
+type cloudEventEmitter struct {
+	sinkURL string
+	source  string
+	queue   chan cloudEvent
+	client  *http.Client
+	dropped atomic.Int64
+}
+
+// newCloudEventEmitter 根据环境变量创建 emitter，未配置 CLOUDEVENTS_SINK_URL 时返回 nil
+func newCloudEventEmitter() (*cloudEventEmitter, error) {
+	sinkURL := os.Getenv("CLOUDEVENTS_SINK_URL")
+	if sinkURL == "" {
+		return nil, nil
+	}
+
+	queueSize, err := strconv.Atoi(getEnvOrDefault("CLOUDEVENTS_QUEUE_SIZE", "1000"))
+	if err != nil || queueSize <= 0 {
+		return nil, fmt.Errorf("invalid CLOUDEVENTS_QUEUE_SIZE")
+	}
+
+	timeout, err := time.ParseDuration(getEnvOrDefault("CLOUDEVENTS_TIMEOUT", "3s"))
+	if err != nil || timeout <= 0 {
+		return nil, fmt.Errorf("invalid CLOUDEVENTS_TIMEOUT")
+	}
+
+	source := os.Getenv("CLOUDEVENTS_SOURCE")
+	if source == "" {
+		source = "/oss-fe-proxy/crd-watcher"
+		if podName := os.Getenv("POD_NAME"); podName != "" {
+			source += "/" + podName
+		}
+	}
+
+	slog.Info("CloudEvents enabled", "sink", sinkURL, "source", source)
+	return &cloudEventEmitter{
+		sinkURL: sinkURL,
+		source:  source,
+		queue:   make(chan cloudEvent, queueSize),
+		client:  &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// emit 将一次推送结果加入发送队列。path 形如 /api/routes/update，err 为推送结果
+func (e *cloudEventEmitter) emit(path string, obj *unstructured.Unstructured, err error) {
+	if e == nil {
+		return
+	}
+
+	resource, action := parseSyncPath(path)
+	event := cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              newEventID(),
+		Source:          e.source,
+		Subject:         objectKey(obj),
+		Time:            time.Now().UTC().Format(time.RFC3339Nano),
+		DataContentType: "application/json",
+		Data: cloudEventData{
+			Kind:      obj.GetKind(),
+			Namespace: obj.GetNamespace(),
+			Name:      obj.GetName(),
+			Action:    action,
+		},
+	}
+	if err != nil {
+		event.Type = cloudEventTypePrefix + "sync.failed"
+		event.Result = "failure"
+		event.Data.Error = err.Error()
+	} else {
+		event.Type = cloudEventTypePrefix + resource + "." + action + "d"
+		event.Result = "success"
+	}
+
+	select {
+	case e.queue <- event:
+	default:
+		if dropped := e.dropped.Add(1); dropped%100 == 1 {
+			slog.Warn("CloudEvents queue full, dropping events", "dropped", dropped)
+		}
+	}
+}
+
+// run 消费发送队列，直到 stop 关闭
+func (e *cloudEventEmitter) run(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case event := <-e.queue:
+			if err := e.send(event); err != nil {
+				slog.Error("Failed to deliver CloudEvent", "type", event.Type, "subject", event.Subject, "error", err)
+			}
+		}
+	}
+}
+
+func (e *cloudEventEmitter) send(event cloudEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", e.sinkURL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/cloudevents+json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("sink returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// parseSyncPath 将 /api/routes/update 解析为 ("route", "update")
+func parseSyncPath(path string) (resource, action string) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 3 {
+		return "unknown", path
+	}
+	return strings.TrimSuffix(parts[1], "s"), parts[2]
+}
+
+func newEventID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	return hex.EncodeToString(buf)
+}
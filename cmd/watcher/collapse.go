@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// maxCollapseLockTimeout 为 spec.collapseRequests.lockTimeout 的上限（秒），
+// 过长的等待会让请求在 upstream 缓慢时长时间挂起
+const maxCollapseLockTimeout = 60
+
+// validateCollapseRequests 校验 spec.collapseRequests：enabled 为布尔值，lockTimeout 为 1-60 秒
+func validateCollapseRequests(route *unstructured.Unstructured) error {
+	collapse, found, err := unstructured.NestedMap(route.Object, "spec", "collapseRequests")
+	if err != nil {
+		return fmt.Errorf("spec.collapseRequests must be an object: %v", err)
+	}
+	if !found {
+		return nil
+	}
+
+	if _, _, err := unstructured.NestedBool(collapse, "enabled"); err != nil {
+		return fmt.Errorf("spec.collapseRequests.enabled must be a boolean: %v", err)
+	}
+
+	lockTimeout, found, err := unstructured.NestedInt64(collapse, "lockTimeout")
+	if err != nil {
+		return fmt.Errorf("spec.collapseRequests.lockTimeout must be an integer: %v", err)
+	}
+	if found && (lockTimeout < 1 || lockTimeout > maxCollapseLockTimeout) {
+		return fmt.Errorf("spec.collapseRequests.lockTimeout must be between 1 and %d seconds, got %d", maxCollapseLockTimeout, lockTimeout)
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// supportedCompressionAlgorithms 为 OpenResty 支持的压缩算法（Accept-Encoding 中的取值）
+var supportedCompressionAlgorithms = map[string]bool{
+	"gzip": true,
+	"br":   true,
+}
+
+// validateCompression 校验 spec.compression：algorithms 只能是 gzip/br 且不重复，
+// minSize 不能为负，types 为不带参数的 MIME 类型或 type/* 通配
+func validateCompression(route *unstructured.Unstructured) error {
+	compression, found, err := unstructured.NestedMap(route.Object, "spec", "compression")
+	if err != nil {
+		return fmt.Errorf("spec.compression must be an object: %v", err)
+	}
+	if !found {
+		return nil
+	}
+
+	if _, _, err := unstructured.NestedBool(compression, "enabled"); err != nil {
+		return fmt.Errorf("spec.compression.enabled must be a boolean: %v", err)
+	}
+
+	var problems []string
+
+	algorithms, found, err := unstructured.NestedStringSlice(compression, "algorithms")
+	if err != nil {
+		return fmt.Errorf("spec.compression.algorithms must be a list of strings: %v", err)
+	}
+	if found && len(algorithms) == 0 {
+		problems = append(problems, "algorithms must not be empty")
+	}
+	seen := make(map[string]bool)
+	for _, algorithm := range algorithms {
+		if !supportedCompressionAlgorithms[algorithm] {
+			problems = append(problems, fmt.Sprintf("unknown algorithm %q (supported: gzip, br)", algorithm))
+			continue
+		}
+		if seen[algorithm] {
+			problems = append(problems, fmt.Sprintf("algorithm %q is listed more than once", algorithm))
+		}
+		seen[algorithm] = true
+	}
+
+	minSize, found, err := unstructured.NestedInt64(compression, "minSize")
+	if err != nil {
+		return fmt.Errorf("spec.compression.minSize must be an integer: %v", err)
+	}
+	if found && minSize < 0 {
+		problems = append(problems, fmt.Sprintf("minSize must not be negative, got %d", minSize))
+	}
+
+	types, _, err := unstructured.NestedStringSlice(compression, "types")
+	if err != nil {
+		return fmt.Errorf("spec.compression.types must be a list of strings: %v", err)
+	}
+	for _, value := range types {
+		if err := validateCompressionType(value); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid compression: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validateCompressionType 允许 text/css 这样的 MIME 类型或 text/* 通配，不允许参数
+func validateCompressionType(value string) error {
+	candidate := value
+	if kind, ok := strings.CutSuffix(value, "/*"); ok {
+		candidate = kind + "/x"
+	}
+	mediaType, params, err := mime.ParseMediaType(candidate)
+	if err != nil || len(params) > 0 || validateMIMEType(mediaType) != nil {
+		return fmt.Errorf("invalid type %q: expected type/subtype or type/*", value)
+	}
+	return nil
+}
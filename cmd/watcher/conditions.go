@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// syncedConditionType 表示对象是否已成功推送到 OpenResty
+	syncedConditionType = "Synced"
+	// readyConditionType 表示 upstream 是否可用（对象及其凭据均已推送）
+	readyConditionType = "Ready"
+)
+
+// hasCondition 判断对象 status 中指定类型的 condition 是否已是指定的 reason
+func hasCondition(obj *unstructured.Unstructured, conditionType, reason string) bool {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if ok && condition["type"] == conditionType && condition["reason"] == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// setCondition 更新 route/upstream 的指定 condition，保留其他类型的 condition，其他类型的对象以及分片模式下不由本 Pod 负责的对象忽略。
+// status 与 reason 均未变化时不发起请求，避免 status 更新触发的 watch 事件反复写入。
+func (w *Watcher) setCondition(obj *unstructured.Unstructured, conditionType, status, reason, message string) {
+	var gvr schema.GroupVersionResource
+	switch obj.GetKind() {
+	case "OSSProxyRoute":
+		gvr = routeGVR
+	case "OSSProxyUpstream":
+		gvr = upstreamGVR
+	default:
+		return
+	}
+	if !w.ownsObject(obj) {
+		return
+	}
+
+	existing, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	conditions, changed := mergeCondition(existing, conditionType, status, reason, message)
+	if !changed {
+		return
+	}
+
+	// merge patch 会整体替换 conditions 数组，因此需要带上其他类型的 condition
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": conditions,
+		},
+	})
+	if err != nil {
+		slog.Error("Failed to build status patch", append(objectLogAttrs(kindLogResource(obj.GetKind()), obj.GetNamespace(), obj.GetName()), "error", err)...)
+		return
+	}
+
+	namespace := obj.GetNamespace()
+	if namespace == "" {
+		namespace = "default"
+	}
+	ctx, cancel := w.apiContext()
+	defer cancel()
+	_, err = w.client.Resource(gvr).Namespace(namespace).Patch(ctx, obj.GetName(), types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+	if err = apiTimeoutError(ctx, err, "patching status", w.config.apiTimeout); err != nil {
+		slog.Error("Failed to update condition", append(objectLogAttrs(kindLogResource(obj.GetKind()), namespace, obj.GetName()), "condition", conditionType, "error", err)...)
+	}
+}
+
+// mergeCondition 用指定的 condition 替换 conditions 中同类型的一项，返回新的列表以及是否有变化。
+// status 与 reason 均未变化时视为没有变化；status 未变时保留原来的 lastTransitionTime。
+func mergeCondition(existing []interface{}, conditionType, status, reason, message string) ([]interface{}, bool) {
+	conditions := make([]interface{}, 0, len(existing)+1)
+	transitionTime := time.Now().UTC().Format(time.RFC3339)
+	for _, c := range existing {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["type"] != conditionType {
+			conditions = append(conditions, c)
+			continue
+		}
+		if condition["status"] == status {
+			if condition["reason"] == reason {
+				return existing, false
+			}
+			if t, ok := condition["lastTransitionTime"].(string); ok {
+				transitionTime = t
+			}
+		}
+	}
+	conditions = append(conditions, map[string]interface{}{
+		"type":               conditionType,
+		"status":             status,
+		"reason":             reason,
+		"message":            message,
+		"lastTransitionTime": transitionTime,
+	})
+	return conditions, true
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// watcherConfig 为启动时从环境变量解析并校验过的配置
+type watcherConfig struct {
+	openresty *openrestyAPI
+	shards    *shardManager
+	retry     *retryPolicy
+	events    *cloudEventEmitter
+	tracer    *tracer
+
+	syncOrder            string
+	startupMode          string
+	openrestyWaitTimeout time.Duration
+	// openrestyWaitMaxInterval 为等待 OpenResty 就绪时两次探测的最长间隔
+	openrestyWaitMaxInterval time.Duration
+	// openrestyHealthInterval 为初始同步后探测 OpenResty 可达性的间隔，0 表示不探测；
+	// 连续失败 openrestyHealthFailureThreshold 次后视为不可达
+	openrestyHealthInterval         time.Duration
+	openrestyHealthFailureThreshold int
+	// epochGrace 为初始同步后不因 epoch 不一致关闭 readiness 的时间，epochCheckInterval 为检查间隔
+	epochGrace         time.Duration
+	epochCheckInterval time.Duration
+	// debounceInterval 为合并同一 route/upstream 连续更新的窗口，0 表示不合并
+	debounceInterval time.Duration
+
+	secretSyncConcurrency int
+	syncConcurrency       int
+	secretFailurePolicy   string
+	tlsMissingPolicy      string
+	routeKeys             *routeKeyConfig
+	clockProbe            *clockSkewProbe
+	retryQueue            *retryQueue
+	resync                time.Duration
+	watchNamespaces       []string
+	watchSelector         *watchSelector
+	syncQueue             *syncQueue
+	maxAge                *maxAgeResync
+	upstreamStats         *upstreamStatsPoller
+	maxPayloadBytes       int
+	reconciler            *driftReconciler
+
+	// tlsSecretNamespaces 为 route 可以跨命名空间引用 TLS Secret 的命名空间
+	tlsSecretNamespaces map[string]bool
+
+	// apiTimeout 为同步过程中单次 apiserver 请求的超时，webhookAPITimeout 为 webhook 中的超时
+	apiTimeout        time.Duration
+	webhookAPITimeout time.Duration
+	// webhookAdmittedTTL 为放行的 route 在 informer 缓存中出现之前参与域名重复检查的最长时间
+	webhookAdmittedTTL time.Duration
+	// webhookSecretRefCheck 为检查 upstream 引用的 secret 是否存在的方式：enforce、warn 或 off
+	webhookSecretRefCheck string
+
+	webhookEnabled bool
+	webhookPort    int
+	createLimiter  *namespaceRateLimiter
+	// webhookUpstreamDeletePolicy 为删除仍被引用的 upstream 时的处理方式：block 或 warn
+	webhookUpstreamDeletePolicy    string
+	webhookIgnoreTerminatingRoutes bool
+	// policies 与 schemas 为 webhook 的域名策略和自定义 route schema，未配置文件时为 nil
+	policies *policyStore
+	schemas  *routeSchemaStore
+
+	metricsPort int
+	probePort   int
+	adminAddr   string
+	// adminAuth 为运维端点的鉴权器，ADMIN_AUTH_MODE=none 时为 nil；clientset 在创建 Watcher 时设置
+	adminAuth       *tokenReviewAuthorizer
+	debugState      bool
+	shutdownTimeout time.Duration
+
+	adoptOnStartup   bool
+	gcOnStartup      bool
+	dryRun           bool
+	deleteNotFoundOK bool
+	// routeFinalizer 为 true 时为 route 加上 finalizer，确认 OpenResty 删除后才允许 route 被删除
+	routeFinalizer bool
+
+	// apiKeyReloadInterval 为检查内部 API 密钥文件是否变化的间隔
+	apiKeyReloadInterval time.Duration
+
+	// payloadSigning 为 true 时对推送内容做 HMAC 签名，payloadSigningKeyFile 为空表示复用 API 密钥
+	payloadSigning        bool
+	payloadSigningKeyFile string
+}
+
+// loadConfig 解析并校验全部环境变量。遇到无效值不会立即返回，而是继续检查其余设置，
+// 最后把所有错误合并返回，以便一次修正所有拼写错误
+func loadConfig() (*watcherConfig, error) {
+	cfg := &watcherConfig{}
+	var errs []error
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	var err error
+	cfg.openresty, err = openrestyAPIFromEnv()
+	check(err)
+	cfg.shards, err = newShardManager()
+	if err != nil {
+		check(fmt.Errorf("failed to configure sharding: %v", err))
+	}
+	cfg.retry, err = newRetryPolicy()
+	if err != nil {
+		check(fmt.Errorf("failed to configure retry policy: %v", err))
+	}
+	cfg.events, err = newCloudEventEmitter()
+	if err != nil {
+		check(fmt.Errorf("failed to configure CloudEvents: %v", err))
+	}
+	cfg.tracer, err = newTracerFromEnv()
+	if err != nil {
+		check(fmt.Errorf("failed to configure tracing: %v", err))
+	}
+
+	cfg.syncOrder = getEnvOrDefault("SYNC_ORDER", syncOrderUpstreamsFirst)
+	if cfg.syncOrder != syncOrderUpstreamsFirst && cfg.syncOrder != syncOrderRoutesFirst {
+		check(fmt.Errorf("invalid SYNC_ORDER %q, must be %q or %q", cfg.syncOrder, syncOrderUpstreamsFirst, syncOrderRoutesFirst))
+	}
+	cfg.startupMode = getEnvOrDefault("OPENRESTY_STARTUP_MODE", startupModeWait)
+	if cfg.startupMode != startupModeWait && cfg.startupMode != startupModeBuffer {
+		check(fmt.Errorf("invalid OPENRESTY_STARTUP_MODE %q, must be %q or %q", cfg.startupMode, startupModeWait, startupModeBuffer))
+	}
+	cfg.openrestyWaitTimeout, err = positiveDurationFromEnv("OPENRESTY_WAIT_TIMEOUT", "30s")
+	check(err)
+	cfg.openrestyWaitMaxInterval, err = positiveDurationFromEnv("OPENRESTY_WAIT_MAX_INTERVAL", "5s")
+	check(err)
+	healthInterval := getEnvOrDefault("OPENRESTY_HEALTH_CHECK_INTERVAL", "10s")
+	if cfg.openrestyHealthInterval, err = time.ParseDuration(healthInterval); err != nil || cfg.openrestyHealthInterval < 0 {
+		check(fmt.Errorf("invalid OPENRESTY_HEALTH_CHECK_INTERVAL %q, must be a non-negative duration", healthInterval))
+	}
+	epochGrace := getEnvOrDefault("OPENRESTY_EPOCH_GRACE", "15s")
+	if cfg.epochGrace, err = time.ParseDuration(epochGrace); err != nil || cfg.epochGrace < 0 {
+		check(fmt.Errorf("invalid OPENRESTY_EPOCH_GRACE %q, must be a non-negative duration", epochGrace))
+	}
+	cfg.epochCheckInterval, err = positiveDurationFromEnv("OPENRESTY_EPOCH_CHECK_INTERVAL", "5s")
+	check(err)
+	debounceInterval := getEnvOrDefault("DEBOUNCE_INTERVAL", "250ms")
+	if cfg.debounceInterval, err = time.ParseDuration(debounceInterval); err != nil || cfg.debounceInterval < 0 {
+		check(fmt.Errorf("invalid DEBOUNCE_INTERVAL %q, must be a non-negative duration", debounceInterval))
+	}
+	healthThreshold := getEnvOrDefault("OPENRESTY_HEALTH_FAILURE_THRESHOLD", "3")
+	if cfg.openrestyHealthFailureThreshold, err = strconv.Atoi(healthThreshold); err != nil || cfg.openrestyHealthFailureThreshold <= 0 {
+		check(fmt.Errorf("invalid OPENRESTY_HEALTH_FAILURE_THRESHOLD %q, must be a positive integer", healthThreshold))
+	}
+
+	cfg.secretSyncConcurrency, err = secretSyncConcurrencyFromEnv()
+	check(err)
+	cfg.syncConcurrency, err = syncConcurrencyFromEnv()
+	check(err)
+	cfg.secretFailurePolicy, err = secretFailurePolicyFromEnv()
+	check(err)
+	cfg.tlsMissingPolicy, err = tlsMissingPolicyFromEnv()
+	check(err)
+	cfg.tlsSecretNamespaces = tlsSecretNamespacesFromEnv()
+	cfg.routeKeys, err = routeKeyConfigFromEnv()
+	check(err)
+	cfg.clockProbe, err = clockSkewProbeFromEnv()
+	check(err)
+	cfg.retryQueue, err = retryQueueFromEnv()
+	check(err)
+	if cfg.retryQueue != nil && cfg.retryQueue.configMap != "" && cfg.shards != nil && cfg.shards.enabled {
+		check(fmt.Errorf("RETRY_QUEUE_CONFIGMAP cannot be used with SHARDING_ENABLED=true"))
+	}
+	cfg.resync, err = informerResyncFromEnv()
+	check(err)
+	cfg.watchNamespaces = watchNamespacesFromEnv()
+	cfg.watchSelector, err = watchSelectorFromEnv()
+	check(err)
+	cfg.syncQueue, err = syncQueueFromEnv()
+	check(err)
+	cfg.maxAge, err = maxAgeResyncFromEnv()
+	check(err)
+	cfg.upstreamStats, err = upstreamStatsPollerFromEnv()
+	check(err)
+	cfg.maxPayloadBytes, err = maxPayloadBytesFromEnv()
+	check(err)
+	cfg.reconciler, err = driftReconcilerFromEnv()
+	check(err)
+
+	cfg.apiTimeout, err = positiveDurationFromEnv("KUBE_API_TIMEOUT", "10s")
+	check(err)
+	cfg.webhookAPITimeout, err = positiveDurationFromEnv("WEBHOOK_API_TIMEOUT", "2s")
+	check(err)
+	cfg.webhookAdmittedTTL, err = positiveDurationFromEnv("WEBHOOK_ADMITTED_ROUTE_TTL", "10s")
+	check(err)
+	cfg.webhookSecretRefCheck = getEnvOrDefault("WEBHOOK_SECRET_REF_CHECK", ruleWarn)
+	if cfg.webhookSecretRefCheck != ruleEnforce && cfg.webhookSecretRefCheck != ruleWarn && cfg.webhookSecretRefCheck != ruleOff {
+		check(fmt.Errorf("invalid WEBHOOK_SECRET_REF_CHECK %q, must be %q, %q or %q", cfg.webhookSecretRefCheck, ruleEnforce, ruleWarn, ruleOff))
+	}
+
+	cfg.webhookEnabled = os.Getenv("WEBHOOK_ENABLED") == "true"
+	if cfg.webhookEnabled {
+		cfg.webhookPort, err = portFromEnv("WEBHOOK_PORT", "8443")
+		check(err)
+		cfg.createLimiter, err = namespaceRateLimiterFromEnv()
+		if err != nil {
+			check(fmt.Errorf("failed to configure webhook rate limit: %v", err))
+		}
+		cfg.webhookUpstreamDeletePolicy, err = upstreamDeletePolicyFromEnv()
+		check(err)
+		cfg.webhookIgnoreTerminatingRoutes, err = boolFromEnv("WEBHOOK_IGNORE_TERMINATING_ROUTES", "false")
+		check(err)
+		// 策略文件与 route schema 无效时拒绝启动
+		cfg.policies, err = newPolicyStore()
+		if err != nil {
+			check(fmt.Errorf("failed to load webhook policy: %v", err))
+		}
+		cfg.schemas, err = newRouteSchemaStore()
+		if err != nil {
+			check(fmt.Errorf("failed to load route schema: %v", err))
+		}
+	}
+
+	cfg.metricsPort, err = portFromEnv("METRICS_PORT", "9090")
+	check(err)
+	cfg.probePort, err = portFromEnv("HEALTH_PROBE_PORT", "8081")
+	check(err)
+	cfg.adminAddr = getEnvOrDefault("ADMIN_ADDR", "127.0.0.1:9182")
+	cfg.adminAuth, err = adminAuthorizerFromEnv()
+	if err != nil {
+		check(fmt.Errorf("failed to configure admin authorization: %v", err))
+	}
+	cfg.debugState, err = boolFromEnv("DEBUG_STATE_ENABLED", "false")
+	check(err)
+	cfg.shutdownTimeout, err = positiveDurationFromEnv("SHUTDOWN_TIMEOUT", getEnvOrDefault("SHUTDOWN_DRAIN_TIMEOUT", "20s"))
+	check(err)
+
+	cfg.adoptOnStartup, err = boolFromEnv("ADOPT_EXISTING_STATE", "false")
+	check(err)
+	// PRUNE_ON_SYNC 与 STARTUP_GC_ENABLED 等价，任一为 true 即启用
+	cfg.gcOnStartup, err = boolFromEnv("STARTUP_GC_ENABLED", "false")
+	check(err)
+	pruneOnSync, err := boolFromEnv("PRUNE_ON_SYNC", "false")
+	check(err)
+	cfg.gcOnStartup = cfg.gcOnStartup || pruneOnSync
+	cfg.dryRun, err = boolFromEnv("DRY_RUN", "false")
+	check(err)
+	cfg.deleteNotFoundOK, err = boolFromEnv("OPENRESTY_DELETE_NOT_FOUND_OK", "true")
+	check(err)
+	cfg.routeFinalizer, err = boolFromEnv("ROUTE_FINALIZER_ENABLED", "false")
+	check(err)
+	cfg.apiKeyReloadInterval, err = positiveDurationFromEnv("OPENRESTY_API_KEY_RELOAD_INTERVAL", "10s")
+	check(err)
+	cfg.payloadSigning, err = boolFromEnv("PAYLOAD_SIGNING", "false")
+	check(err)
+	cfg.payloadSigningKeyFile = getEnvOrDefault("PAYLOAD_SIGNING_KEY_FILE", "")
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return cfg, nil
+}
+
+// portFromEnv 读取 1-65535 之间的端口号
+func portFromEnv(key, defaultValue string) (int, error) {
+	value := getEnvOrDefault(key, defaultValue)
+	port, err := strconv.Atoi(value)
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, fmt.Errorf("invalid %s %q, must be a port number", key, value)
+	}
+	return port, nil
+}
+
+// positiveDurationFromEnv 读取大于 0 的时长
+func positiveDurationFromEnv(key, defaultValue string) (time.Duration, error) {
+	value := getEnvOrDefault(key, defaultValue)
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s %q, must be a positive duration", key, value)
+	}
+	return d, nil
+}
+
+// boolFromEnv 读取 true 或 false，其它取值视为错误而不是静默当作 false
+func boolFromEnv(key, defaultValue string) (bool, error) {
+	value := getEnvOrDefault(key, defaultValue)
+	switch value {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid %s %q, must be true or false", key, value)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// isOpenrestyConflict 表示 OpenResty 以 409 拒绝了推送，通常是它已持有更新的版本
+func isOpenrestyConflict(err error) bool {
+	var statusErr *openrestyStatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusConflict
+}
+
+// retryAfterConflict 在推送 route/upstream 收到 409 后从 apiserver 重新读取对象，用最新版本再推送一次。
+// 返回 nil 表示放弃该事件：对象已被删除（由随后的删除事件处理），或再次冲突（已记录 SyncConflict Warning Event），
+// 这两种情况都不应进入重试队列反复推送。读取失败时返回原对象和原错误，按普通失败处理。
+func (w *Watcher) retryAfterConflict(parent *span, resourceType, endpoint string, obj *unstructured.Unstructured, conflictErr error) (*unstructured.Unstructured, error) {
+	attrs := objectLogAttrs(resourceType, obj.GetNamespace(), obj.GetName())
+
+	ctx, cancel := w.apiContext()
+	latest, err := w.client.Resource(resourceGVR(resourceType)).Namespace(obj.GetNamespace()).Get(ctx, obj.GetName(), metav1.GetOptions{})
+	err = apiTimeoutError(ctx, err, "getting object after conflict", w.config.apiTimeout)
+	cancel()
+	if apierrors.IsNotFound(err) {
+		slog.Info("Object was deleted after OpenResty reported a conflict, dropping update", attrs...)
+		return nil, nil
+	}
+	if err != nil {
+		slog.Warn("Failed to re-fetch object after OpenResty reported a conflict", append(attrs, "error", err)...)
+		return obj, conflictErr
+	}
+
+	slog.Info("OpenResty reported a conflict, retrying once with the latest version", append(attrs,
+		"resourceVersion", obj.GetResourceVersion(), "latestResourceVersion", latest.GetResourceVersion())...)
+	err = w.notifyOpenrestyTraced(parent, "POST", endpoint, latest)
+	if !isOpenrestyConflict(err) {
+		return latest, err
+	}
+
+	slog.Warn("OpenResty still reports a conflict, dropping update", append(attrs, "error", err)...)
+	w.recordWarningEvent(latest, syncConflictReason,
+		fmt.Sprintf("OpenResty rejected the update with HTTP 409 after retrying with resourceVersion %s, dropping it until the object changes: %v", latest.GetResourceVersion(), err))
+	w.setSyncStatus(latest, err)
+	return nil, nil
+}
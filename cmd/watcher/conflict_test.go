@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestHandleEventConflict(t *testing.T) {
+	tests := []struct {
+		name       string
+		exists     bool
+		wantPushes int
+		wantEvent  bool
+	}{
+		// 以最新版本重试一次，仍冲突则放弃并记录 SyncConflict
+		{"still conflicting", true, 2, true},
+		// 对象已被删除时直接放弃，由删除事件处理
+		{"deleted meanwhile", false, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newOpenrestyStub()
+			stub.setStatus("/api/routes/update", http.StatusConflict)
+			w := newTestWatcher(t, stub)
+			route := testRoute(routeSpec("a.example.com"))
+			if tt.exists {
+				createTestObject(t, w, routeGVR, route)
+			}
+
+			if err := w.handleEvent(watch.Event{Type: watch.Modified, Object: route}, "routes"); err != nil {
+				t.Fatalf("dropped conflict must not be retried, got %v", err)
+			}
+			if n := len(stub.posts()); n != tt.wantPushes {
+				t.Errorf("pushes = %d, want %d", n, tt.wantPushes)
+			}
+			// OpenResty 不记录被拒绝推送的 epoch，watcher 也不能确认，否则 epoch gate 会误判推送丢失
+			if acked := w.ackedEpoch.Load(); acked != 0 {
+				t.Errorf("ackedEpoch = %d after rejected pushes, want 0", acked)
+			}
+
+			recorder := w.recorder.(*record.FakeRecorder)
+			var events []string
+			for len(recorder.Events) > 0 {
+				events = append(events, <-recorder.Events)
+			}
+			gotEvent := false
+			for _, event := range events {
+				gotEvent = gotEvent || strings.Contains(event, syncConflictReason)
+			}
+			if gotEvent != tt.wantEvent {
+				t.Errorf("events = %v, want SyncConflict %v", events, tt.wantEvent)
+			}
+		})
+	}
+}
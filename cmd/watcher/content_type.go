@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// extensionPattern 允许带或不带前导点的扩展名，例如 wasm、.wasm、tar.gz
+var extensionPattern = regexp.MustCompile(`^\.?[A-Za-z0-9][A-Za-z0-9_-]*(\.[A-Za-z0-9_-]+)*$`)
+
+// validateContentTypeOverrides 校验 spec.contentTypeOverrides（扩展名 -> MIME 类型）
+func validateContentTypeOverrides(route *unstructured.Unstructured) error {
+	overrides, found, err := unstructured.NestedStringMap(route.Object, "spec", "contentTypeOverrides")
+	if err != nil {
+		return fmt.Errorf("spec.contentTypeOverrides must be a map of extension to MIME type: %v", err)
+	}
+	if !found {
+		return nil
+	}
+
+	extensions := make([]string, 0, len(overrides))
+	for ext := range overrides {
+		extensions = append(extensions, ext)
+	}
+	sort.Strings(extensions)
+
+	var problems []string
+	seen := make(map[string]string)
+	for _, ext := range extensions {
+		if !extensionPattern.MatchString(ext) {
+			problems = append(problems, fmt.Sprintf("invalid extension %q", ext))
+			continue
+		}
+
+		normalized := strings.ToLower(strings.TrimPrefix(ext, "."))
+		if other, dup := seen[normalized]; dup {
+			problems = append(problems, fmt.Sprintf("extensions %q and %q refer to the same extension", other, ext))
+			continue
+		}
+		seen[normalized] = ext
+
+		if err := validateMIMEType(overrides[ext]); err != nil {
+			problems = append(problems, fmt.Sprintf("extension %q: %v", ext, err))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid contentTypeOverrides: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validateMIMEType 要求 type/subtype 形式，可以带参数，例如 text/html; charset=utf-8
+func validateMIMEType(value string) error {
+	mediaType, _, err := mime.ParseMediaType(value)
+	if err != nil {
+		return fmt.Errorf("invalid MIME type %q: %v", value, err)
+	}
+	kind, subtype, ok := strings.Cut(mediaType, "/")
+	if !ok || kind == "" || subtype == "" || kind == "*" || subtype == "*" {
+		return fmt.Errorf("invalid MIME type %q: expected type/subtype", value)
+	}
+	return nil
+}
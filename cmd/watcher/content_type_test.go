@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateContentTypeOverrides(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides interface{}
+		wantErr   string
+	}{
+		{"unset", nil, ""},
+		{"valid", map[string]interface{}{"wasm": "application/wasm", ".tar.gz": "application/gzip", "html": "text/html; charset=utf-8"}, ""},
+		{"not a map", []interface{}{"wasm"}, "must be a map"},
+		{"bad extension", map[string]interface{}{"a/b": "text/plain"}, `invalid extension "a/b"`},
+		{"duplicate after normalization", map[string]interface{}{".WASM": "application/wasm", "wasm": "application/wasm"}, "refer to the same extension"},
+		{"missing subtype", map[string]interface{}{"txt": "text"}, "invalid MIME type"},
+		{"wildcard subtype", map[string]interface{}{"txt": "text/*"}, "expected type/subtype"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := map[string]interface{}{}
+			if tt.overrides != nil {
+				spec["contentTypeOverrides"] = tt.overrides
+			}
+			err := validateContentTypeOverrides(testRoute(spec))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
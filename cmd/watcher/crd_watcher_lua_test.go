@@ -0,0 +1,124 @@
+package main
+
+import (
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// crdWatcherEpochHarness 在模拟的 ngx 环境中加载 lua/crd_watcher.lua，并用协程模拟多个 worker 同时调用 record_epoch。
+// 共享字典的 get 之后会让出执行权，使其他 worker 插入到读取与写入之间；exclusive_lock 为 false 时
+// resty.lock 不做互斥，用于确认该交错确实会在没有锁时丢失较大的 epoch
+const crdWatcherEpochHarness = `
+local data = {}
+local crd_cache = {
+    get = function(self, key)
+        local value = data[key]
+        coroutine.yield()
+        return value
+    end,
+    set = function(self, key, value)
+        data[key] = value
+        return true
+    end,
+    add = function(self, key, value)
+        if data[key] ~= nil then
+            return false, "exists"
+        end
+        data[key] = value
+        return true
+    end,
+}
+
+ngx = {
+    shared = { crd_cache = crd_cache, crd_locks = {} },
+    log = function() end,
+    ERR = "error", WARN = "warn", INFO = "info",
+}
+
+local held = {}
+package.preload["cjson"] = function() return {} end
+package.preload["resty.lock"] = function()
+    return {
+        new = function(_, dict_name)
+            if dict_name ~= "crd_locks" then
+                return nil, "no such shared dict: " .. tostring(dict_name)
+            end
+            local lock = {}
+            function lock:lock(key)
+                while exclusive_lock and held[key] do
+                    coroutine.yield()
+                end
+                held[key] = true
+                self.key = key
+                return 0
+            end
+            function lock:unlock()
+                held[self.key] = nil
+                return 1
+            end
+            return lock
+        end,
+    }
+end
+
+package.path = "../../lua/?.lua;" .. package.path
+local crd_watcher = require "crd_watcher"
+
+local workers = {}
+for i, epoch in ipairs(epochs) do
+    workers[i] = coroutine.create(function() crd_watcher.record_epoch(epoch) end)
+end
+local running = true
+while running do
+    running = false
+    for _, worker in ipairs(workers) do
+        if coroutine.status(worker) ~= "dead" then
+            local ok, err = coroutine.resume(worker)
+            if not ok then
+                error(err)
+            end
+            running = true
+        end
+    end
+end
+
+final_epoch = data["epoch"]
+`
+
+func TestRecordEpochKeepsMaximumAcrossWorkers(t *testing.T) {
+	tests := []struct {
+		name      string
+		exclusive bool
+		epochs    []int
+		want      int
+	}{
+		{"larger epoch first", true, []int{5, 3}, 5},
+		{"smaller epoch first", true, []int{3, 5}, 5},
+		{"many workers", true, []int{4, 9, 1, 7, 2}, 9},
+		// 对照：没有互斥时同样的交错会让较小的 epoch 覆盖较大的
+		{"without the lock", false, []int{5, 3}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			L := lua.NewState()
+			defer L.Close()
+
+			epochs := L.NewTable()
+			for _, epoch := range tt.epochs {
+				epochs.Append(lua.LNumber(epoch))
+			}
+			L.SetGlobal("epochs", epochs)
+			L.SetGlobal("exclusive_lock", lua.LBool(tt.exclusive))
+
+			if err := L.DoString(crdWatcherEpochHarness); err != nil {
+				t.Fatal(err)
+			}
+			got, ok := L.GetGlobal("final_epoch").(lua.LNumber)
+			if !ok || int(got) != tt.want {
+				t.Errorf("epoch = %v, want %d", L.GetGlobal("final_epoch"), tt.want)
+			}
+		})
+	}
+}
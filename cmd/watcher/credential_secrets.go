@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+)
+
+// newCredentialSecretInformer 创建监听 upstream 凭据 Secret 的 informer。凭据 Secret 没有固定的类型，
+// 因此默认监听所有 Secret；CREDENTIAL_SECRET_LABEL_SELECTOR 可以缩小范围。缓存中只保留 stripSecretData
+// 处理后的元数据，凭据的值只在推送被引用的 Secret 时从 apiserver 读取。
+func newCredentialSecretInformer(client dynamic.Interface, resync time.Duration, namespace string, selector labels.Selector) (dynamicinformer.DynamicSharedInformerFactory, informers.GenericInformer) {
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, resync, namespace, func(opts *metav1.ListOptions) {
+		if !selector.Empty() {
+			opts.LabelSelector = selector.String()
+		}
+	})
+	return factory, factory.ForResource(secretGVR)
+}
+
+// stripSecretData 是凭据 Secret informer 的 transform：只保留事件处理需要的元数据，并把 data 替换为摘要。
+// 这样 informer 缓存中不会保存任何 Secret 的值（包括未被引用的 Secret），data 变化仍能被 contentChanged 识别。
+// managedFields 和 last-applied-configuration 注解可能包含明文的值，一并丢弃。
+func stripSecretData(obj interface{}) (interface{}, error) {
+	secret, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return obj, nil
+	}
+	stripped := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	stripped.SetAPIVersion(secret.GetAPIVersion())
+	stripped.SetKind(secret.GetKind())
+	stripped.SetNamespace(secret.GetNamespace())
+	stripped.SetName(secret.GetName())
+	stripped.SetUID(secret.GetUID())
+	stripped.SetResourceVersion(secret.GetResourceVersion())
+	stripped.SetLabels(secret.GetLabels())
+	stripped.SetDeletionTimestamp(secret.GetDeletionTimestamp())
+	if secretType, found, _ := unstructured.NestedString(secret.Object, "type"); found {
+		stripped.Object["type"] = secretType
+	}
+
+	// encoding/json 对 map 的 key 排序，摘要是确定的
+	data, err := json.Marshal(secret.Object["data"])
+	if err != nil {
+		return nil, fmt.Errorf("failed to digest secret %s: %v", objectKey(secret), err)
+	}
+	sum := sha256.Sum256(data)
+	stripped.Object["data"] = map[string]interface{}{"sha256": hex.EncodeToString(sum[:])}
+	return stripped, nil
+}
+
+// handleCredentialSecretEvent 在被 upstream 引用的 Secret 变化时重新推送该 Secret，并重新同步所有引用它的 upstream，
+// 使凭据轮换无需修改 upstream 即可生效。未被引用的 Secret 直接忽略。
+func (w *Watcher) handleCredentialSecretEvent(event watch.Event, secret *unstructured.Unstructured) error {
+	secretKey := objectKey(secret)
+	upstreams := w.secrets.upstreamsFor(secretKey)
+	if len(upstreams) == 0 {
+		return nil
+	}
+
+	switch event.Type {
+	case watch.Added, watch.Modified:
+	case watch.Deleted:
+		// OpenResty 继续使用已推送的凭据，直到 upstream 改为引用其他 Secret
+		slog.Warn("Referenced secret was deleted, OpenResty keeps the last synced credentials", append(objectLogAttrs("secrets", secret.GetNamespace(), secret.GetName()), "upstreams", upstreams)...)
+		return nil
+	default:
+		return nil
+	}
+
+	slog.Info("Secret changed, re-syncing upstreams", append(objectLogAttrs("secrets", secret.GetNamespace(), secret.GetName()), "upstreams", len(upstreams))...)
+	result, err := w.rotateSecret(secret.GetNamespace(), secret.GetName())
+	if err != nil {
+		return err
+	}
+	if len(result.Failed) > 0 {
+		return fmt.Errorf("failed to re-sync upstreams %v after secret %s changed", result.Failed, secretKey)
+	}
+	return nil
+}
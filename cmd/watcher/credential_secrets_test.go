@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestStripSecretData(t *testing.T) {
+	secret := func(value string) *unstructured.Unstructured {
+		s := toUnstructured(t, testSecret("web", "creds", map[string][]byte{"accessKeySecret": []byte(value)}), "v1", "Secret")
+		s.SetLabels(map[string]string{"app": "oss"})
+		s.SetAnnotations(map[string]string{"kubectl.kubernetes.io/last-applied-configuration": `{"data":{"accessKeySecret":"` + value + `"}}`})
+		return s
+	}
+
+	obj, err := stripSecretData(secret("s3cr3t"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stripped := obj.(*unstructured.Unstructured)
+	if objectKey(stripped) != "web/creds" || stripped.GetLabels()["app"] != "oss" || stripped.Object["type"] != "Opaque" {
+		t.Errorf("metadata not kept: %v", stripped.Object)
+	}
+	if content, _ := stripped.MarshalJSON(); strings.Contains(string(content), "s3cr3t") || strings.Contains(string(content), "czNjcjN0") {
+		t.Errorf("stripped secret still holds the value: %s", content)
+	}
+
+	// data 变化后摘要不同，contentChanged 仍能识别
+	rotated, err := stripSecretData(secret("rotated"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if objectHash(stripped) == objectHash(rotated.(*unstructured.Unstructured)) {
+		t.Error("digest did not change with the data")
+	}
+
+	// tombstone 等其他对象原样返回
+	if got, _ := stripSecretData("other"); got != "other" {
+		t.Errorf("non-unstructured object was changed: %v", got)
+	}
+}
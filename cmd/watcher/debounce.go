@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// errDebouncedAtDrain 是排空时仍在合并窗口内的事件记录到 retryQueue 的原因
+var errDebouncedAtDrain = errors.New("update was still debounced when draining started")
+
+// eventDebouncer 合并同一 route/upstream 在短时间内的多次新增/更新事件：第一个事件到达后等待 interval，
+// 期间到达的事件只替换待处理的对象，到期后只推送最新版本，避免控制器连续修改对象时逐个推送给 OpenResty。
+//
+// 删除事件不会被合并：它会丢弃该对象尚未到期的更新并立即处理。同一对象的处理按事件到达的顺序串行执行，
+// 正在推送的更新完成之前，随后的删除只排队等待，不会先于它到达 OpenResty。
+type eventDebouncer struct {
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*debouncedEvent
+	// busy 中的对象正在处理，queued 为它们之后按顺序等待处理的事件
+	busy   map[string]bool
+	queued map[string][]func()
+}
+
+type debouncedEvent struct {
+	resourceType string
+	eventType    watch.EventType
+	obj          interface{}
+	timer        *time.Timer
+}
+
+func newEventDebouncer(interval time.Duration) *eventDebouncer {
+	return &eventDebouncer{
+		interval: interval,
+		pending:  make(map[string]*debouncedEvent),
+		busy:     make(map[string]bool),
+		queued:   make(map[string][]func()),
+	}
+}
+
+// debounceKey 返回事件对象的 resourceType/namespace/name，无法识别对象时返回空字符串
+func debounceKey(resourceType string, obj interface{}) string {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return ""
+	}
+	return resourceType + "/" + objectKey(u)
+}
+
+// dispatch 处理 informer 投递的事件。route/upstream 的新增和更新按 interval 合并，其余事件直接处理
+func (d *eventDebouncer) dispatch(w *Watcher, eventType watch.EventType, obj interface{}, resourceType string) {
+	key := debounceKey(resourceType, obj)
+	if d.interval <= 0 || key == "" || (resourceType != "routes" && resourceType != "upstreams") {
+		w.dispatchEvent(eventType, obj, resourceType)
+		return
+	}
+
+	run := func(eventType watch.EventType, obj interface{}) func() {
+		return func() { w.dispatchEvent(eventType, obj, resourceType) }
+	}
+
+	d.mu.Lock()
+	if eventType == watch.Deleted {
+		if e, ok := d.pending[key]; ok {
+			e.timer.Stop()
+			delete(d.pending, key)
+		}
+		fn := run(eventType, obj)
+		runNow := d.enqueueLocked(key, fn)
+		d.mu.Unlock()
+		if runNow {
+			d.drain(key, fn)
+		}
+		return
+	}
+
+	if e, ok := d.pending[key]; ok {
+		// 新增后紧接着的更新仍按新增处理，两者推送的内容相同
+		if e.eventType != watch.Added {
+			e.eventType = eventType
+		}
+		e.obj = obj
+		d.mu.Unlock()
+		return
+	}
+	e := &debouncedEvent{resourceType: resourceType, eventType: eventType, obj: obj}
+	e.timer = time.AfterFunc(d.interval, func() {
+		d.mu.Lock()
+		// 到期前已被删除事件取消
+		if d.pending[key] != e {
+			d.mu.Unlock()
+			return
+		}
+		delete(d.pending, key)
+		fn := run(e.eventType, e.obj)
+		runNow := d.enqueueLocked(key, fn)
+		d.mu.Unlock()
+		if runNow {
+			d.drain(key, fn)
+		}
+	})
+	d.pending[key] = e
+	d.mu.Unlock()
+}
+
+// flush 取消所有尚未到期的合并事件并交给 retryQueue，返回交出的数量。排空开始后到期的事件会被 dispatchEvent 丢弃，
+// 记录到 retryQueue 后随队列持久化，由新 Pod 继续处理，不必等待下一次全量同步
+func (d *eventDebouncer) flush(w *Watcher) int {
+	d.mu.Lock()
+	pending := d.pending
+	d.pending = make(map[string]*debouncedEvent)
+	for _, e := range pending {
+		e.timer.Stop()
+	}
+	d.mu.Unlock()
+
+	for _, e := range pending {
+		w.retryQueue.record(e.resourceType, e.eventType, e.obj.(*unstructured.Unstructured), errDebouncedAtDrain)
+	}
+	return len(pending)
+}
+
+// enqueueLocked 在对象空闲时将其标记为处理中并返回 true，由调用方立即执行 fn；否则将 fn 排在处理中的事件之后
+func (d *eventDebouncer) enqueueLocked(key string, fn func()) bool {
+	if d.busy[key] {
+		d.queued[key] = append(d.queued[key], fn)
+		return false
+	}
+	d.busy[key] = true
+	return true
+}
+
+// drain 执行 fn 以及在此期间排队的同一对象的事件，全部完成后将对象标记为空闲
+func (d *eventDebouncer) drain(key string, fn func()) {
+	for fn != nil {
+		fn()
+
+		d.mu.Lock()
+		if next := d.queued[key]; len(next) > 0 {
+			fn = next[0]
+			if len(next) == 1 {
+				delete(d.queued, key)
+			} else {
+				d.queued[key] = next[1:]
+			}
+		} else {
+			fn = nil
+			delete(d.busy, key)
+		}
+		d.mu.Unlock()
+	}
+}
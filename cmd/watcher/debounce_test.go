@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestDebouncerFlushOnDrain(t *testing.T) {
+	stub := newOpenrestyStub()
+	w := newTestWatcher(t, stub)
+	w.retryQueue = newTestRetryQueue(10)
+	w.debouncer = newEventDebouncer(time.Hour)
+	close(w.informers.initialSynced)
+
+	route := testRoute(routeSpec("a.example.com"))
+	w.debouncer.dispatch(w, watch.Added, route, "routes")
+	w.debouncer.dispatch(w, watch.Modified, route, "routes")
+	upstream := testUpstream("web", "u", "", "")
+	w.debouncer.dispatch(w, watch.Modified, &upstream, "upstreams")
+
+	w.startDrain()
+
+	entries := w.retryQueue.snapshot()
+	got := make(map[string]bool)
+	for _, entry := range entries {
+		got[entry.key()] = entry.Deleted
+	}
+	if len(got) != 2 {
+		t.Fatalf("retry queue = %v, want the route and the upstream", entries)
+	}
+	for _, key := range []string{"routes/web/r", "upstreams/web/u"} {
+		if deleted, ok := got[key]; !ok || deleted {
+			t.Errorf("retry queue entry %s = (deleted %v, found %v), want an update", key, deleted, ok)
+		}
+	}
+	if len(w.debouncer.pending) != 0 {
+		t.Errorf("%d debounced events left after draining", len(w.debouncer.pending))
+	}
+	if n := len(stub.posts()); n != 0 {
+		t.Errorf("pushed %d times while draining", n)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// debugObject 为 /debug/state 中的一个 route/upstream。desiredHash 为当前 spec 的内容哈希，
+// pushedHash 为最近一次成功推送的哈希，两者不一致说明该对象还未同步到 OpenResty
+type debugObject struct {
+	Key             string   `json:"key"`
+	ResourceVersion string   `json:"resourceVersion"`
+	Generation      int64    `json:"generation"`
+	Hosts           []string `json:"hosts,omitempty"`
+	Upstream        string   `json:"upstream,omitempty"`
+	Secret          string   `json:"secret,omitempty"`
+	DesiredHash     string   `json:"desiredHash"`
+	PushedHash      string   `json:"pushedHash,omitempty"`
+}
+
+// debugState 是 watcher 认为的期望状态：informer 缓存中的全部对象以及 secret 到 upstream 的依赖关系
+type debugState struct {
+	Routes             []debugObject       `json:"routes"`
+	Upstreams          []debugObject       `json:"upstreams"`
+	SecretDependencies map[string][]string `json:"secretDependencies"`
+	// TLSWaiting 为 TLS Secret key -> 因其不存在而暂缓推送的 route
+	TLSWaiting map[string][]string `json:"tlsWaiting"`
+}
+
+// get 返回 key 最近一次成功推送的哈希
+func (c *hashCache) get(key string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hashes[key]
+}
+
+// snapshot 返回 secret key -> 引用它的 upstream key 的副本，upstream 按字典序排列
+func (idx *secretIndex) snapshot() map[string][]string {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	result := make(map[string][]string, len(idx.secretToUpstreams))
+	for secretKey, refs := range idx.secretToUpstreams {
+		upstreams := make([]string, 0, len(refs))
+		for key := range refs {
+			upstreams = append(upstreams, key)
+		}
+		sort.Strings(upstreams)
+		result[secretKey] = upstreams
+	}
+	return result
+}
+
+// snapshot 返回 secret key -> 等待它的 route key 的副本，route 按字典序排列
+func (l *tlsWaitList) snapshot() map[string][]string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := make(map[string][]string, len(l.waiting))
+	for secretKey, routes := range l.waiting {
+		keys := make([]string, 0, len(routes))
+		for key := range routes {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		result[secretKey] = keys
+	}
+	return result
+}
+
+func (w *Watcher) debugObjects(objs []unstructured.Unstructured) []debugObject {
+	result := make([]debugObject, 0, len(objs))
+	for i := range objs {
+		obj := &objs[i]
+		item := debugObject{
+			Key:             objectKey(obj),
+			ResourceVersion: obj.GetResourceVersion(),
+			Generation:      obj.GetGeneration(),
+			DesiredHash:     objectHash(obj),
+			PushedHash:      w.hashes.get(hashCacheKey(obj)),
+		}
+		if obj.GetKind() == "OSSProxyRoute" {
+			item.Hosts, _, _ = unstructured.NestedStringSlice(obj.Object, "spec", "hosts")
+			item.Upstream, _ = routeUpstreamKey(obj)
+		} else if namespace, name, found, _ := upstreamSecretRef(obj); found {
+			item.Secret = namespace + "/" + name
+		}
+		result = append(result, item)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result
+}
+
+// handleDebugState 输出 watcher 当前认为的期望状态，用于排查 OpenResty 与 CR 不一致的问题。
+// 只在 DEBUG_STATE_ENABLED=true 时注册，与其他运维端点一样只监听本地
+func (as *AdminServer) handleDebugState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	routes, err := as.watcher.informers.cachedRoutes()
+	if err != nil {
+		slog.Error("Failed to list cached routes", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	upstreams, err := as.watcher.informers.cachedUpstreams()
+	if err != nil {
+		slog.Error("Failed to list cached upstreams", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	state := debugState{
+		Routes:             as.watcher.debugObjects(routes),
+		Upstreams:          as.watcher.debugObjects(upstreams),
+		SecretDependencies: as.watcher.secrets.snapshot(),
+		TLSWaiting:         as.watcher.tlsWaiting.snapshot(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
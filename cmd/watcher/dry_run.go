@@ -0,0 +1,19 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// logDryRun 记录 dry-run 模式下本应发给 OpenResty 的请求：方法、路径和脱敏后的载荷摘要
+func (w *Watcher) logDryRun(method, path string, obj *unstructured.Unstructured) {
+	attrs := append(objectLogAttrs(syncResource(path), obj.GetNamespace(), obj.GetName()),
+		"method", method, "path", path, "generation", obj.GetGeneration())
+	if data, err := json.Marshal(obj); err == nil {
+		attrs = append(attrs, "payloadBytes", len(data), "hash", objectHash(obj))
+	}
+	attrs = append(attrs, "payload", describeObject(obj))
+	slog.Info("Dry run: would push to OpenResty", attrs...)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// startEnvtestWatcher 启动 envtest 提供的 kube-apiserver 与 etcd 并安装 crds/ 下的 CRD，
+// 返回连接该 API server、推送到 stub 的 watcher。需要 setup-envtest 下载的二进制，未设置 KUBEBUILDER_ASSETS 时跳过
+func startEnvtestWatcher(t *testing.T, stub *openrestyStub) *Watcher {
+	t.Helper()
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS is not set; run with KUBEBUILDER_ASSETS=$(setup-envtest use -p path 1.28.x)")
+	}
+
+	env := &envtest.Environment{
+		CRDDirectoryPaths:     []string{"../../crds"},
+		ErrorIfCRDPathMissing: true,
+	}
+	cfg, err := env.Start()
+	if err != nil {
+		t.Fatalf("failed to start envtest: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := env.Stop(); err != nil {
+			t.Errorf("failed to stop envtest: %v", err)
+		}
+	})
+
+	client, clientset, err := newKubeClientsForConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// newTestWatcher 的 Cleanup 晚于 env.Stop 注册，先停止 informer 再停止 API server
+	w := newTestWatcher(t, stub)
+	w.client, w.clientset = client, clientset
+	w.informers = newWatcherInformers(client, 0, nil, &watchSelector{label: labels.Everything(), field: fields.Everything(), credentials: labels.Everything()})
+	return w
+}
+
+// envtestUpstream 返回能通过 CRD schema 校验的 upstream
+func envtestUpstream(namespace, name, secretName string) *unstructured.Unstructured {
+	upstream := testUpstream(namespace, name, "", secretName)
+	unstructured.SetNestedField(upstream.Object, "oss", "spec", "provider")
+	unstructured.SetNestedField(upstream.Object, "oss-cn-hangzhou", "spec", "region")
+	return &upstream
+}
+
+// TestEnvtestSyncFlow 与 TestSyncFlow 覆盖相同的流程，但对象经过真实 API server 的 schema 校验、默认值、
+// status 子资源与 watch，能发现 fake client 掩盖的问题
+func TestEnvtestSyncFlow(t *testing.T) {
+	stub := newOpenrestyStub()
+	w := startEnvtestWatcher(t, stub)
+	ctx := context.Background()
+
+	if _, err := w.clientset.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "web"}}, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	secret := testSecret("web", "creds", map[string][]byte{"access-key-id": []byte("id"), "secret-access-key": []byte("v1")})
+	if _, err := w.clientset.CoreV1().Secrets("web").Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	createTestObject(t, w, upstreamGVR, envtestUpstream("web", "u", "creds"))
+	route := testRoute(routeSpec("a.example.com"))
+	unstructured.SetNestedMap(route.Object, map[string]interface{}{"name": "u"}, "spec", "upstreamRef")
+	createTestObject(t, w, routeGVR, route)
+
+	startTestWatcher(t, w)
+	waitForPushes(t, stub, 0,
+		"/api/secrets/update web/creds",
+		"/api/upstreams/update web/u",
+		"/api/routes/update web/r",
+	)
+
+	routes := w.client.Resource(routeGVR).Namespace("web")
+	t.Run("status", func(t *testing.T) {
+		current, err := routes.Get(ctx, "r", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !hasCondition(current, syncedConditionType, syncedReason) {
+			t.Errorf("status = %v, want Synced condition", current.Object["status"])
+		}
+		generation, _, _ := unstructured.NestedInt64(current.Object, "status", "observedGeneration")
+		if generation != current.GetGeneration() {
+			t.Errorf("observedGeneration = %d, want %d", generation, current.GetGeneration())
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		from := len(stub.posts())
+		current, err := routes.Get(ctx, "r", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		unstructured.SetNestedStringSlice(current.Object, []string{"a.example.com", "c.example.com"}, "spec", "hosts")
+		if _, err := routes.Update(ctx, current, metav1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		posts := waitForPushes(t, stub, from, "/api/routes/update web/r")
+		spec := posts[len(posts)-1].body["spec"].(map[string]interface{})
+		if !reflect.DeepEqual(spec["hosts"], []interface{}{"a.example.com", "c.example.com"}) {
+			t.Errorf("pushed hosts = %v", spec["hosts"])
+		}
+	})
+
+	t.Run("secret cascade", func(t *testing.T) {
+		from := len(stub.posts())
+		current, err := w.clientset.CoreV1().Secrets("web").Get(ctx, "creds", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		current.Data["secret-access-key"] = []byte("v2")
+		if _, err := w.clientset.CoreV1().Secrets("web").Update(ctx, current, metav1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		waitForPushes(t, stub, from, "/api/secrets/update web/creds", "/api/upstreams/update web/u")
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		from := len(stub.posts())
+		if err := routes.Delete(ctx, "r", metav1.DeleteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		waitForPushes(t, stub, from, "/api/routes/delete web/r")
+		if err := w.client.Resource(upstreamGVR).Namespace("web").Delete(ctx, "u", metav1.DeleteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		waitForPushes(t, stub, from, "/api/routes/delete web/r", "/api/upstreams/delete web/u")
+	})
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// epochStatus 是 OpenResty /api/epoch 的响应
+type epochStatus struct {
+	Epoch uint64  `json:"epoch"`
+	Ready bool    `json:"ready"`
+	Now   float64 `json:"now"` // OpenResty 当前时间（Unix 秒，毫秒精度）
+	// Instance 在 OpenResty 启动时生成，重启后变化，用于检测内存中的配置是否已丢失
+	Instance string `json:"instance"`
+}
+
+// epochGate 比较 OpenResty 已确认（返回成功）的最大 epoch 与 OpenResty 当前记录的 epoch，
+// 后者更小说明已确认的推送丢失（例如 OpenResty 重启），此时关闭 OpenResty 的 readiness。
+// 被拒绝（包括 OpenResty 以 409 拒绝的过时版本，它同样不记录其 epoch）、未得到响应或被放弃的推送不会被确认，不影响比较。
+// 启动后的 grace 窗口内只记录日志，不做 gating，避免正常启动收敛过程中的 readiness 抖动。
+type epochGate struct {
+	grace    time.Duration
+	interval time.Duration
+	start    time.Time
+	closed   bool
+	expired  bool
+}
+
+// newEpochGate 使用 loadConfig 校验过的 OPENRESTY_EPOCH_GRACE 与 OPENRESTY_EPOCH_CHECK_INTERVAL
+func newEpochGate(grace, interval time.Duration) *epochGate {
+	return &epochGate{grace: grace, interval: interval}
+}
+
+// nextEpoch 为一次推送分配新的 epoch
+func (w *Watcher) nextEpoch() uint64 {
+	return w.epoch.Add(1)
+}
+
+// ackEpoch 记录 OpenResty 已成功应用的 epoch。并发推送的响应可能乱序到达，只保留最大值
+func (w *Watcher) ackEpoch(epoch uint64) {
+	for {
+		current := w.ackedEpoch.Load()
+		if epoch <= current || w.ackedEpoch.CompareAndSwap(current, epoch) {
+			return
+		}
+	}
+}
+
+// monitorEpoch 周期性检查 epoch 是否一致，在初始同步完成后启动
+func (w *Watcher) monitorEpoch() {
+	gate := w.epochGate
+	gate.start = time.Now()
+	slog.Info("Epoch gating enabled", "grace", gate.grace.String(), "checkInterval", gate.interval.String())
+
+	ticker := time.NewTicker(gate.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+			w.checkEpoch()
+		}
+	}
+}
+
+func (w *Watcher) checkEpoch() {
+	gate := w.epochGate
+
+	var status epochStatus
+	if err := w.fetchOpenresty("/api/epoch", &status); err != nil {
+		slog.Warn("Failed to fetch OpenResty epoch", "error", err)
+		return
+	}
+
+	expected := w.ackedEpoch.Load()
+	inGrace := time.Since(gate.start) < gate.grace
+	if !inGrace && !gate.expired {
+		gate.expired = true
+		slog.Info("Startup epoch grace expired, enforcing epoch gating", "grace", gate.grace.String())
+	}
+
+	// OpenResty 的 epoch 只增不减，可能已包含尚未收到响应的推送，因此不小于已确认的 epoch 即视为一致
+	if status.Epoch >= expected {
+		if gate.closed {
+			if err := w.setOpenrestyReadiness(true); err != nil {
+				slog.Error("Failed to reopen readiness gate", "error", err)
+				return
+			}
+			gate.closed = false
+			slog.Info("Epoch converged, readiness gate reopened", "epoch", expected)
+		}
+		return
+	}
+
+	if inGrace {
+		slog.Info("Epoch mismatch within startup grace, keeping ready", "watcherEpoch", expected, "openrestyEpoch", status.Epoch,
+			"graceRemaining", (gate.grace - time.Since(gate.start)).Round(time.Second).String())
+		return
+	}
+
+	if !gate.closed {
+		if err := w.setOpenrestyReadiness(false); err != nil {
+			slog.Error("Failed to close readiness gate", "error", err)
+			return
+		}
+		gate.closed = true
+		slog.Warn("Epoch mismatch, readiness gate closed", "watcherEpoch", expected, "openrestyEpoch", status.Epoch)
+	}
+}
+
+// setOpenrestyReadiness 打开或关闭 OpenResty 侧的 readiness gate
+func (w *Watcher) setOpenrestyReadiness(ready bool) error {
+	data, err := json.Marshal(map[string]bool{"ready": ready})
+	if err != nil {
+		return fmt.Errorf("failed to marshal readiness: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", w.openresty.url("/api/readiness"), bytes.NewBuffer(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	w.authorize(req, "/api/readiness", data)
+
+	resp, err := w.openresty.do(req, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return newOpenrestyStatusError(resp)
+	}
+	return nil
+}
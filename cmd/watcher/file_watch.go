@@ -0,0 +1,55 @@
+package main
+
+import (
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// fileWatchDebounce 为合并同一次写入产生的多个 fsnotify 事件的窗口，避免读到写了一半的文件
+const fileWatchDebounce = 100 * time.Millisecond
+
+// watchFile 在 path 变化时调用 onChange，直到 done 关闭。
+// 监听的是文件所在目录而不是文件本身：ConfigMap/Secret 挂载通过替换 ..data 符号链接原子更新内容，
+// 文件本身不会产生事件，编辑器保存时也常以新文件替换旧文件。目录中其他文件的变化同样会触发 onChange，
+// 调用方需自行判断内容是否变化。另外每 interval 调用一次，作为 fsnotify 不可用或丢失事件时的兜底。
+func watchFile(done <-chan struct{}, path string, interval time.Duration, onChange func()) {
+	var (
+		events <-chan fsnotify.Event
+		errs   <-chan error
+	)
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		if err = watcher.Add(filepath.Dir(path)); err != nil {
+			watcher.Close()
+		}
+	}
+	if err != nil {
+		slog.Warn("Failed to watch file for changes, falling back to polling", "path", path, "interval", interval.String(), "error", err)
+	} else {
+		defer watcher.Close()
+		events, errs = watcher.Events, watcher.Errors
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var debounced <-chan time.Time
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-events:
+			debounced = time.After(fileWatchDebounce)
+		case err := <-errs:
+			slog.Warn("File watch error", "path", path, "error", err)
+		case <-debounced:
+			debounced = nil
+			onChange()
+		case <-ticker.C:
+			onChange()
+		}
+	}
+}
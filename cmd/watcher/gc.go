@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// collectGarbage 删除 OpenResty 中没有对应 CR 的 route 和 upstream。
+// watcher 停机期间发生的删除不会再收到 Deleted 事件，启动时通过对比补上这些删除。
+// routes/upstreams 为初始同步时从 API server 列出的全部对象。
+// 设置了 WATCH_NAMESPACES 时，不在监听范围内的命名空间的对象不会出现在 routes/upstreams 中，不能据此删除。
+func (w *Watcher) collectGarbage(routes, upstreams []unstructured.Unstructured) error {
+	var heldRoutes map[string][]string
+	if err := w.fetchOpenresty("/api/routes/keys", &heldRoutes); err != nil {
+		return fmt.Errorf("failed to list routes in OpenResty: %v", err)
+	}
+	var heldUpstreams []string
+	if err := w.fetchOpenresty("/api/upstreams/keys", &heldUpstreams); err != nil {
+		return fmt.Errorf("failed to list upstreams in OpenResty: %v", err)
+	}
+
+	gcErrors := 0
+
+	existingRoutes := objectKeySet(routes)
+	routeKeys := make([]string, 0, len(heldRoutes))
+	for key := range heldRoutes {
+		routeKeys = append(routeKeys, key)
+	}
+	sort.Strings(routeKeys)
+	for _, key := range routeKeys {
+		if existingRoutes[key] || !w.gcOwns(key) {
+			continue
+		}
+
+		// delete_route 按 spec.hosts 删除，使用 OpenResty 中记录的域名构造对象
+		route := newStubObject("OSSProxyRoute", key)
+		hosts := make([]interface{}, 0, len(heldRoutes[key]))
+		for _, host := range heldRoutes[key] {
+			hosts = append(hosts, host)
+		}
+		unstructured.SetNestedSlice(route.Object, hosts, "spec", "hosts")
+
+		slog.Info("Garbage collecting route with no OSSProxyRoute", append(objectKeyLogAttrs("routes", key), "hosts", heldRoutes[key])...)
+		if err := w.notifyOpenresty("POST", "/api/routes/delete", route); err != nil {
+			slog.Error("Failed to garbage collect route", append(objectKeyLogAttrs("routes", key), "error", err)...)
+			gcErrors++
+		}
+	}
+
+	existingUpstreams := objectKeySet(upstreams)
+	for _, key := range heldUpstreams {
+		if existingUpstreams[key] || !w.gcOwns(key) {
+			continue
+		}
+
+		slog.Info("Garbage collecting upstream with no OSSProxyUpstream", objectKeyLogAttrs("upstreams", key)...)
+		if err := w.notifyOpenresty("POST", "/api/upstreams/delete", newStubObject("OSSProxyUpstream", key)); err != nil {
+			slog.Error("Failed to garbage collect upstream", append(objectKeyLogAttrs("upstreams", key), "error", err)...)
+			gcErrors++
+		}
+	}
+
+	if gcErrors > 0 {
+		return fmt.Errorf("failed to garbage collect %d objects", gcErrors)
+	}
+	return nil
+}
+
+// gcOwns 判断 OpenResty 中 key 为 namespace/name 的对象是否在本 watcher 的监听范围内
+func (w *Watcher) gcOwns(key string) bool {
+	namespace, _ := splitObjectKey(key)
+	return w.informers.watched(namespace)
+}
+
+// objectKeySet 返回对象列表的 namespace/name 集合
+func objectKeySet(objects []unstructured.Unstructured) map[string]bool {
+	keys := make(map[string]bool, len(objects))
+	for i := range objects {
+		keys[objectKey(&objects[i])] = true
+	}
+	return keys
+}
+
+// newStubObject 构造只有 metadata 的对象，用于删除已经不存在于集群中的对象
+func newStubObject(kind, key string) *unstructured.Unstructured {
+	namespace, name := splitObjectKey(key)
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("ossfe.imvictor.tech/v1")
+	obj.SetKind(kind)
+	obj.SetName(name)
+	obj.SetNamespace(namespace)
+	return obj
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestCollectGarbage(t *testing.T) {
+	tests := []struct {
+		name       string
+		namespaces []string
+		want       []string
+	}{
+		{"whole cluster", nil, []string{"routes web/gone [gone.example.com]", "upstreams web/gone-upstream []", "upstreams other/gone-upstream []"}},
+		{"only watched namespaces", []string{"web"}, []string{"routes web/gone [gone.example.com]", "upstreams web/gone-upstream []"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newOpenrestyStub()
+			stub.setResponse("/api/routes/keys", map[string][]string{
+				"web/kept": {"kept.example.com"},
+				"web/gone": {"gone.example.com"},
+			})
+			stub.setResponse("/api/upstreams/keys", []string{"web/kept-upstream", "web/gone-upstream", "other/gone-upstream"})
+			w := newTestWatcher(t, stub)
+			w.informers.namespaces = tt.namespaces
+			for _, ns := range tt.namespaces {
+				w.informers.scopes[ns] = nil
+			}
+
+			routes := []unstructured.Unstructured{*newStubObject("OSSProxyRoute", "web/kept")}
+			upstreams := []unstructured.Unstructured{*newStubObject("OSSProxyUpstream", "web/kept-upstream")}
+			if err := w.collectGarbage(routes, upstreams); err != nil {
+				t.Fatalf("collectGarbage: %v", err)
+			}
+
+			var deleted []string
+			for _, req := range stub.posts() {
+				metadata := req.body["metadata"].(map[string]interface{})
+				hosts, _, _ := unstructured.NestedStringSlice(req.body, "spec", "hosts")
+				deleted = append(deleted, syncResource(req.path)+" "+metadata["namespace"].(string)+"/"+metadata["name"].(string)+" "+fmt.Sprint(hosts))
+			}
+			if !reflect.DeepEqual(deleted, tt.want) {
+				t.Errorf("deleted %v, want %v", deleted, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollectGarbageFailsWhenOpenRestyUnavailable(t *testing.T) {
+	w := newTestWatcher(t, newOpenrestyStub())
+	if err := w.collectGarbage(nil, nil); err == nil {
+		t.Fatal("expected an error when OpenResty cannot list its routes")
+	}
+}
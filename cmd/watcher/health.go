@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// healthState 记录 watcher 各子系统的运行状态，供详细健康检查使用
+type healthState struct {
+	mu       sync.Mutex
+	watches  map[string]*watchHealth
+	lastSync *syncHealth
+}
+
+type watchHealth struct {
+	Connected bool      `json:"connected"`
+	Since     time.Time `json:"since"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+type syncHealth struct {
+	Time  time.Time `json:"time"`
+	OK    bool      `json:"ok"`
+	Error string    `json:"error,omitempty"`
+}
+
+type openrestyHealth struct {
+	Reachable bool   `json:"reachable"`
+	Ready     bool   `json:"ready"`
+	Epoch     uint64 `json:"epoch"`
+	Error     string `json:"error,omitempty"`
+}
+
+// healthReport 是 /health/detail 的响应，Status 为 ok 或 degraded
+type healthReport struct {
+	Status    string                 `json:"status"`
+	Watches   map[string]watchHealth `json:"watches"`
+	LastSync  *syncHealth            `json:"lastSync"`
+	OpenResty openrestyHealth        `json:"openresty"`
+	// CacheInSync 表示 OpenResty 已应用的 epoch 不小于它确认过的最大 epoch，即没有已确认的推送丢失
+	CacheInSync bool   `json:"cacheInSync"`
+	Epoch       uint64 `json:"epoch"`
+}
+
+func newHealthState() *healthState {
+	return &healthState{
+		watches: map[string]*watchHealth{
+			"routes":    {},
+			"upstreams": {},
+		},
+	}
+}
+
+func (h *healthState) setWatch(resourceType string, connected bool, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	state := &watchHealth{Connected: connected, Since: time.Now()}
+	if err != nil {
+		state.LastError = err.Error()
+	}
+	h.watches[resourceType] = state
+}
+
+// watchesConnected 表示给定资源类型的 watch 当前均已建立
+func (h *healthState) watchesConnected(resourceTypes ...string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, resourceType := range resourceTypes {
+		state, ok := h.watches[resourceType]
+		if !ok || !state.Connected {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *healthState) recordSync(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastSync = &syncHealth{Time: time.Now(), OK: err == nil}
+	if err != nil {
+		h.lastSync.Error = err.Error()
+	}
+}
+
+// healthReport 汇总当前状态，会同步请求一次 OpenResty 的 /api/epoch
+func (w *Watcher) healthReport() healthReport {
+	report := healthReport{
+		Status:  "ok",
+		Watches: make(map[string]watchHealth),
+		Epoch:   w.ackedEpoch.Load(),
+	}
+
+	w.health.mu.Lock()
+	for resourceType, state := range w.health.watches {
+		report.Watches[resourceType] = *state
+		if !state.Connected {
+			report.Status = "degraded"
+		}
+	}
+	if w.health.lastSync != nil {
+		lastSync := *w.health.lastSync
+		report.LastSync = &lastSync
+	}
+	w.health.mu.Unlock()
+
+	if report.LastSync == nil || !report.LastSync.OK {
+		report.Status = "degraded"
+	}
+
+	var status epochStatus
+	if err := w.fetchOpenresty("/api/epoch", &status); err != nil {
+		report.OpenResty.Error = err.Error()
+		report.Status = "degraded"
+	} else {
+		report.OpenResty.Reachable = true
+		report.OpenResty.Ready = status.Ready
+		report.OpenResty.Epoch = status.Epoch
+		report.CacheInSync = status.Epoch >= report.Epoch
+		if !status.Ready || !report.CacheInSync {
+			report.Status = "degraded"
+		}
+	}
+
+	return report
+}
+
+// handleHealth 为轻量的存活检查：进程在运行且未开始退出时返回 200
+func (ws *WebhookServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if ws.watcher.ctx.Err() != nil {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// handleHealthDetail 返回各子系统的详细状态，整体状态不为 ok 时返回 503
+func (ws *WebhookServer) handleHealthDetail(w http.ResponseWriter, r *http.Request) {
+	report := ws.watcher.healthReport()
+
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,31 @@
+package main
+
+import "strings"
+
+// normalizeHost 将域名转换为小写并去掉末尾的点，用于比较
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// wildcardCovers 判断通配符域名 *.domain 是否匹配 host。与 nginx server_name 一致，
+// 通配符匹配任意层级的子域名（*.example.com 匹配 a.example.com 和 a.b.example.com），但不匹配 example.com 本身。
+// host 也可以是通配符，*.example.com 覆盖 *.a.example.com。
+func wildcardCovers(wildcard, host string) bool {
+	if !strings.HasPrefix(wildcard, "*.") {
+		return false
+	}
+	suffix := wildcard[1:]
+	return len(host) > len(suffix) && strings.HasSuffix(host, suffix)
+}
+
+// hostsOverlap 判断两个已规范化的域名是否会匹配到同一请求
+func hostsOverlap(a, b string) bool {
+	return a == b || wildcardCovers(a, b) || wildcardCovers(b, a)
+}
+
+// routeKeysOverlap 判断两个 route key 是否冲突：租户相同且域名重叠
+func routeKeysOverlap(a, b string) bool {
+	hostA, tenantA, _ := strings.Cut(a, routeKeySeparator)
+	hostB, tenantB, _ := strings.Cut(b, routeKeySeparator)
+	return tenantA == tenantB && hostsOverlap(normalizeHost(hostA), normalizeHost(hostB))
+}
@@ -0,0 +1,500 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// informerResyncFromEnv 读取 WATCH_RESYNC_PERIOD（默认 0，即不定期重新投递缓存中的对象）
+func informerResyncFromEnv() (time.Duration, error) {
+	resync, err := time.ParseDuration(getEnvOrDefault("WATCH_RESYNC_PERIOD", "0"))
+	if err != nil || resync < 0 {
+		return 0, fmt.Errorf("invalid WATCH_RESYNC_PERIOD")
+	}
+	return resync, nil
+}
+
+// watchNamespacesFromEnv 读取 WATCH_NAMESPACES（逗号分隔），未设置时返回 nil，表示监听整个集群
+func watchNamespacesFromEnv() []string {
+	var namespaces []string
+	seen := make(map[string]bool)
+	for _, ns := range strings.Split(os.Getenv("WATCH_NAMESPACES"), ",") {
+		ns = strings.TrimSpace(ns)
+		if ns == "" || seen[ns] {
+			continue
+		}
+		seen[ns] = true
+		namespaces = append(namespaces, ns)
+	}
+	return namespaces
+}
+
+// watchSelector 为 LABEL_SELECTOR 和 FIELD_SELECTOR，限定 watcher 管理的 route/upstream 范围，
+// 用于在同一集群中运行多组各自管理不相交对象子集的 watcher。两者都为空时不做过滤。
+// credentials 为 CREDENTIAL_SECRET_LABEL_SELECTOR，限定凭据 Secret informer 缓存的范围
+type watchSelector struct {
+	label       labels.Selector
+	field       fields.Selector
+	credentials labels.Selector
+}
+
+// watchSelectorFromEnv 解析 LABEL_SELECTOR 和 FIELD_SELECTOR，语法与 kubectl -l / --field-selector 相同。
+// CRD 只支持按 metadata.name 和 metadata.namespace 过滤字段
+func watchSelectorFromEnv() (*watchSelector, error) {
+	s := &watchSelector{label: labels.Everything(), field: fields.Everything(), credentials: labels.Everything()}
+	if value := os.Getenv("CREDENTIAL_SECRET_LABEL_SELECTOR"); value != "" {
+		selector, err := labels.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CREDENTIAL_SECRET_LABEL_SELECTOR %q: %v", value, err)
+		}
+		s.credentials = selector
+	}
+	if value := os.Getenv("LABEL_SELECTOR"); value != "" {
+		selector, err := labels.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LABEL_SELECTOR %q: %v", value, err)
+		}
+		s.label = selector
+	}
+	if value := os.Getenv("FIELD_SELECTOR"); value != "" {
+		selector, err := fields.ParseSelector(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid FIELD_SELECTOR %q: %v", value, err)
+		}
+		for _, r := range selector.Requirements() {
+			if r.Field != "metadata.name" && r.Field != "metadata.namespace" {
+				return nil, fmt.Errorf("invalid FIELD_SELECTOR %q: only metadata.name and metadata.namespace are supported for custom resources", value)
+			}
+		}
+		s.field = selector
+	}
+	return s, nil
+}
+
+// apply 将选择器设置到 route/upstream 的 List/Watch 请求中
+func (s *watchSelector) apply(opts *metav1.ListOptions) {
+	if !s.label.Empty() {
+		opts.LabelSelector = s.label.String()
+	}
+	if !s.field.Empty() {
+		opts.FieldSelector = s.field.String()
+	}
+}
+
+// matches 表示对象在 watcher 管理的范围内
+func (s *watchSelector) matches(obj *unstructured.Unstructured) bool {
+	return s.label.Matches(labels.Set(obj.GetLabels())) &&
+		s.field.Matches(fields.Set{"metadata.name": obj.GetName(), "metadata.namespace": obj.GetNamespace()})
+}
+
+// informerScope 持有一个命名空间（或整个集群）内 route/upstream 以及 TLS Secret、凭据 Secret 的 informer
+type informerScope struct {
+	factory       dynamicinformer.DynamicSharedInformerFactory
+	tlsFactory    dynamicinformer.DynamicSharedInformerFactory
+	secretFactory dynamicinformer.DynamicSharedInformerFactory
+
+	routes            informers.GenericInformer
+	upstreams         informers.GenericInformer
+	tlsSecrets        informers.GenericInformer
+	credentialSecrets informers.GenericInformer
+}
+
+func newInformerScope(client dynamic.Interface, resync time.Duration, namespace string, selector *watchSelector) *informerScope {
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, resync, namespace, selector.apply)
+	// 只关心 TLS 类型的 Secret
+	tlsFactory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, resync, namespace, func(opts *metav1.ListOptions) {
+		opts.FieldSelector = "type=kubernetes.io/tls"
+	})
+
+	secretFactory, credentialSecrets := newCredentialSecretInformer(client, resync, namespace, selector.credentials)
+
+	return &informerScope{
+		factory:           factory,
+		tlsFactory:        tlsFactory,
+		secretFactory:     secretFactory,
+		routes:            factory.ForResource(routeGVR),
+		upstreams:         factory.ForResource(upstreamGVR),
+		tlsSecrets:        tlsFactory.ForResource(secretGVR),
+		credentialSecrets: credentialSecrets,
+	}
+}
+
+// watcherInformers 持有各命名空间的 informer。informer 负责断线重连、resourceVersion 过期后的重新列出，
+// 并维护本地缓存供全量同步和 webhook 读取。未设置 WATCH_NAMESPACES 时只有一个监听整个集群的 scope。
+type watcherInformers struct {
+	// namespaces 为监听的命名空间，为空表示整个集群；scopes 以命名空间为 key，整个集群时 key 为空字符串
+	namespaces []string
+	scopes     map[string]*informerScope
+	// selector 为 route/upstream 的 label/field 选择器，直接请求 apiserver 时同样使用
+	selector *watchSelector
+
+	// initialSynced 在初始全量同步完成后关闭，此前到达的事件等待同步完成后再处理，
+	// 避免较旧的全量快照覆盖较新的事件
+	initialSynced chan struct{}
+
+	// errorVersions 记录各 informer watch 出错时的 resourceVersion，之后前进即视为已恢复
+	mu            sync.Mutex
+	errorVersions map[string]string
+}
+
+func newWatcherInformers(client dynamic.Interface, resync time.Duration, namespaces []string, selector *watchSelector) *watcherInformers {
+	scopes := make(map[string]*informerScope)
+	if len(namespaces) == 0 {
+		scopes[metav1.NamespaceAll] = newInformerScope(client, resync, metav1.NamespaceAll, selector)
+	}
+	for _, ns := range namespaces {
+		scopes[ns] = newInformerScope(client, resync, ns, selector)
+	}
+
+	return &watcherInformers{
+		namespaces:    namespaces,
+		scopes:        scopes,
+		selector:      selector,
+		initialSynced: make(chan struct{}),
+		errorVersions: make(map[string]string),
+	}
+}
+
+// scopedInformer 是某个命名空间 scope 中的一个 informer
+type scopedInformer struct {
+	namespace string
+	informer  cache.SharedIndexInformer
+}
+
+func (i *watcherInformers) byType() map[string][]scopedInformer {
+	byType := make(map[string][]scopedInformer)
+	for ns, scope := range i.scopes {
+		byType["routes"] = append(byType["routes"], scopedInformer{ns, scope.routes.Informer()})
+		byType["upstreams"] = append(byType["upstreams"], scopedInformer{ns, scope.upstreams.Informer()})
+		byType["secrets"] = append(byType["secrets"], scopedInformer{ns, scope.tlsSecrets.Informer()})
+		// upstream 引用的凭据 Secret
+		byType["credentials"] = append(byType["credentials"], scopedInformer{ns, scope.credentialSecrets.Informer()})
+	}
+	return byType
+}
+
+// watched 表示命名空间在监听范围内
+func (i *watcherInformers) watched(namespace string) bool {
+	if len(i.namespaces) == 0 {
+		return true
+	}
+	_, ok := i.scopes[namespace]
+	return ok
+}
+
+// scopeFor 返回负责该命名空间的 scope，不在监听范围内时返回 nil
+func (i *watcherInformers) scopeFor(namespace string) *informerScope {
+	if len(i.namespaces) == 0 {
+		return i.scopes[metav1.NamespaceAll]
+	}
+	return i.scopes[namespace]
+}
+
+// routesSynced 表示 route 缓存已完成首次列出，可以代替直接请求 apiserver
+func (i *watcherInformers) routesSynced() bool {
+	for _, scope := range i.scopes {
+		if !scope.routes.Informer().HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// cachedRoutes 返回所有监听范围内缓存的 route 副本
+func (i *watcherInformers) cachedRoutes() ([]unstructured.Unstructured, error) {
+	var items []unstructured.Unstructured
+	for _, scope := range i.scopes {
+		routes, err := listCached(scope.routes)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, routes...)
+	}
+	return items, nil
+}
+
+// cachedUpstreams 返回所有监听范围内缓存的 upstream 副本
+func (i *watcherInformers) cachedUpstreams() ([]unstructured.Unstructured, error) {
+	var items []unstructured.Unstructured
+	for _, scope := range i.scopes {
+		upstreams, err := listCached(scope.upstreams)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, upstreams...)
+	}
+	return items, nil
+}
+
+// cachedTLSSecretExists 从 TLS Secret informer 缓存判断 Secret 是否存在。缓存尚未完成首次列出、
+// 或命名空间不在监听范围内时 ok 为 false，由调用方直接请求 apiserver
+func (i *watcherInformers) cachedTLSSecretExists(namespace, name string) (exists, ok bool) {
+	scope := i.scopeFor(namespace)
+	if scope == nil || !scope.tlsSecrets.Informer().HasSynced() {
+		return false, false
+	}
+	_, err := scope.tlsSecrets.Lister().ByNamespace(namespace).Get(name)
+	if errors.IsNotFound(err) {
+		return false, true
+	}
+	return err == nil, err == nil
+}
+
+// listCached 返回缓存中对象的副本，缓存中的对象是共享的，不能修改
+func listCached(informer informers.GenericInformer) ([]unstructured.Unstructured, error) {
+	objs, err := informer.Lister().List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	items := make([]unstructured.Unstructured, 0, len(objs))
+	for _, obj := range objs {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return nil, fmt.Errorf("unexpected object type in cache: %T", obj)
+		}
+		items = append(items, *u.DeepCopy())
+	}
+	return items, nil
+}
+
+// listObjects 直接从 apiserver 列出监听范围内的对象，设置了 WATCH_NAMESPACES 时逐个命名空间列出
+func (w *Watcher) listObjects(ctx context.Context, gvr schema.GroupVersionResource) ([]unstructured.Unstructured, error) {
+	var opts metav1.ListOptions
+	w.informers.selector.apply(&opts)
+	if len(w.informers.namespaces) == 0 {
+		list, err := w.client.Resource(gvr).List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		return list.Items, nil
+	}
+
+	var items []unstructured.Unstructured
+	for _, ns := range w.informers.namespaces {
+		list, err := w.client.Resource(gvr).Namespace(ns).List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %s: %v", ns, err)
+		}
+		items = append(items, list.Items...)
+	}
+	return items, nil
+}
+
+// watchKey 为 errorVersions 的 key，区分同一资源类型在不同命名空间的 informer
+func watchKey(resourceType, namespace string) string {
+	return resourceType + "@" + namespace
+}
+
+// setupInformers 为各资源注册事件处理函数，必须在 startInformers 之前调用
+func (w *Watcher) setupInformers() error {
+	for resourceType, scoped := range w.informers.byType() {
+		for _, si := range scoped {
+			resourceType := resourceType
+			informer := si.informer
+			key := watchKey(resourceType, si.namespace)
+			err := informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+				w.informers.mu.Lock()
+				w.informers.errorVersions[key] = informer.LastSyncResourceVersion()
+				w.informers.mu.Unlock()
+				w.health.setWatch(resourceType, false, err)
+				// reflector 在出错后会重新 list/watch
+				w.metrics.watchReconnects.inc(resourceType)
+				cache.DefaultWatchErrorHandler(r, err)
+			})
+			if err != nil {
+				return fmt.Errorf("failed to set watch error handler for %s: %v", resourceType, err)
+			}
+			if resourceType == "credentials" {
+				if err := informer.SetTransform(stripSecretData); err != nil {
+					return fmt.Errorf("failed to set transform for %s: %v", resourceType, err)
+				}
+			}
+
+			_, err = informer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+				AddFunc: func(obj interface{}, isInInitialList bool) {
+					// 首次列出的对象由初始全量同步推送
+					if isInInitialList {
+						return
+					}
+					w.debouncer.dispatch(w, watch.Added, obj, resourceType)
+				},
+				UpdateFunc: func(oldObj, newObj interface{}) {
+					if !contentChanged(oldObj, newObj) {
+						return
+					}
+					w.debouncer.dispatch(w, watch.Modified, newObj, resourceType)
+				},
+				DeleteFunc: func(obj interface{}) {
+					// 断线期间被删除的对象在重新列出后以 tombstone 的形式投递
+					if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+						obj = tombstone.Obj
+					}
+					if u, ok := obj.(*unstructured.Unstructured); ok && resourceType == "routes" && w.webhook != nil {
+						w.webhook.admitted.forget(u.GetNamespace(), u.GetName())
+					}
+					w.debouncer.dispatch(w, watch.Deleted, obj, resourceType)
+				},
+			})
+			if err != nil {
+				return fmt.Errorf("failed to add event handler for %s: %v", resourceType, err)
+			}
+		}
+	}
+	return nil
+}
+
+// contentChanged 过滤掉只有 status 或 resourceVersion 变化的更新（例如 watcher 自己写入 condition），
+// 这些更新不影响推送给 OpenResty 的内容。resourceVersion 相同的更新来自定期 resync，总是处理。
+func contentChanged(oldObj, newObj interface{}) bool {
+	oldU, ok := oldObj.(*unstructured.Unstructured)
+	if !ok {
+		return true
+	}
+	newU, ok := newObj.(*unstructured.Unstructured)
+	if !ok {
+		return true
+	}
+	if oldU.GetResourceVersion() == newU.GetResourceVersion() {
+		return true
+	}
+	// 开始删除（设置 deletionTimestamp）时需要处理 finalizer
+	if (oldU.GetDeletionTimestamp() == nil) != (newU.GetDeletionTimestamp() == nil) {
+		return true
+	}
+	return objectHash(oldU) != objectHash(newU) || !labels.Equals(oldU.GetLabels(), newU.GetLabels())
+}
+
+// startInformers 启动 informer 并等待 route/upstream 缓存完成首次列出
+func (w *Watcher) startInformers() error {
+	for _, scope := range w.informers.scopes {
+		scope.factory.Start(w.ctx.Done())
+		scope.tlsFactory.Start(w.ctx.Done())
+		scope.secretFactory.Start(w.ctx.Done())
+	}
+
+	for ns, scope := range w.informers.scopes {
+		for resourceType, synced := range scope.factory.WaitForCacheSync(w.ctx.Done()) {
+			if !synced {
+				if ns != metav1.NamespaceAll {
+					return fmt.Errorf("failed to sync informer cache for %s in namespace %s", resourceType.Resource, ns)
+				}
+				return fmt.Errorf("failed to sync informer cache for %s", resourceType.Resource)
+			}
+		}
+	}
+	for resourceType, scoped := range w.informers.byType() {
+		synced := true
+		for _, si := range scoped {
+			synced = synced && si.informer.HasSynced()
+		}
+		if synced {
+			w.health.setWatch(resourceType, true, nil)
+		}
+		w.updateWatchedObjects(resourceType)
+	}
+	go w.monitorInformerHealth()
+	return nil
+}
+
+// updateWatchedObjects 以 informer 缓存中的对象数更新 ossfe_watched_objects
+func (w *Watcher) updateWatchedObjects(resourceType string) {
+	scoped, ok := w.informers.byType()[resourceType]
+	if !ok {
+		return
+	}
+	total := 0
+	for _, si := range scoped {
+		total += len(si.informer.GetStore().ListKeys())
+	}
+	w.metrics.watchedObjects.set(resourceType, float64(total))
+}
+
+// monitorInformerHealth 在 watch 出错后，resourceVersion 再次前进（收到事件或 bookmark）时将其标记为已恢复；
+// 同一资源类型在所有命名空间都恢复后才视为已恢复
+func (w *Watcher) monitorInformerHealth() {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for resourceType, scoped := range w.informers.byType() {
+			w.informers.mu.Lock()
+			recovered, failing := false, false
+			for _, si := range scoped {
+				key := watchKey(resourceType, si.namespace)
+				errorVersion, failed := w.informers.errorVersions[key]
+				if !failed {
+					continue
+				}
+				if si.informer.HasSynced() && si.informer.LastSyncResourceVersion() != errorVersion {
+					delete(w.informers.errorVersions, key)
+					recovered = true
+				} else {
+					failing = true
+				}
+			}
+			if recovered && !failing {
+				w.health.setWatch(resourceType, true, nil)
+				slog.Info("Watch recovered", "resource", resourceType)
+			}
+			w.informers.mu.Unlock()
+		}
+	}
+}
+
+// dispatchEvent 处理 informer 投递的事件，处理失败的事件按指数退避重试
+func (w *Watcher) dispatchEvent(eventType watch.EventType, obj interface{}, resourceType string) {
+	select {
+	case <-w.informers.initialSynced:
+	case <-w.ctx.Done():
+		return
+	}
+
+	// 排空期间不再接收新事件，新 Pod 启动时的全量同步会覆盖这些变更
+	if !w.beginEvent() {
+		return
+	}
+
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		w.endEvent()
+		slog.Error("Failed to handle event: unexpected object type", "resource", resourceType, "type", fmt.Sprintf("%T", obj))
+		return
+	}
+	u = u.DeepCopy()
+
+	err := w.handleEvent(watch.Event{Type: eventType, Object: u}, resourceType)
+	w.endEvent()
+	if resourceType == "routes" || resourceType == "upstreams" {
+		if err != nil {
+			w.enqueueFailedSync(resourceType, eventType, u)
+		} else {
+			w.retryQueue.done(resourceType, u)
+		}
+	}
+	if err != nil {
+		slog.Error("Failed to handle event", append(objectLogAttrs(resourceType, u.GetNamespace(), u.GetName()), "event", eventType, "error", err)...)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// validateIPFilter 校验 spec.ipFilter 中 allow/deny 列表的 CIDR 格式
+//
+// 优先级：deny 优先于 allow。命中 deny 的客户端始终被拒绝；
+// allow 非空时，仅放行命中 allow 的客户端。IPv4 与 IPv6 可以混用。
+func validateIPFilter(route *unstructured.Unstructured) error {
+	ipFilter, found, err := unstructured.NestedMap(route.Object, "spec", "ipFilter")
+	if err != nil {
+		return fmt.Errorf("invalid spec.ipFilter: %v", err)
+	}
+	if !found {
+		return nil
+	}
+
+	var problems []string
+	for _, field := range []string{"allow", "deny"} {
+		cidrs, found, err := unstructured.NestedStringSlice(ipFilter, field)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("spec.ipFilter.%s must be a list of strings", field))
+			continue
+		}
+		if !found {
+			continue
+		}
+
+		for i, cidr := range cidrs {
+			if err := parseCIDROrIP(cidr); err != nil {
+				problems = append(problems, fmt.Sprintf("spec.ipFilter.%s[%d] %q: %v", field, i, cidr, err))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid ipFilter: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// parseCIDROrIP 接受 CIDR 或单个 IP 地址（视为 /32 或 /128）。
+// OpenResty 按原样解析条目，带首尾空白的条目在 Lua 侧无法匹配任何地址，因此直接拒绝而不是修剪。
+func parseCIDROrIP(value string) error {
+	if value == "" {
+		return fmt.Errorf("empty value")
+	}
+	if strings.TrimSpace(value) != value {
+		return fmt.Errorf("must not contain leading or trailing whitespace")
+	}
+
+	if strings.Contains(value, "/") {
+		if _, _, err := net.ParseCIDR(value); err != nil {
+			return fmt.Errorf("not a valid CIDR")
+		}
+		return nil
+	}
+
+	if net.ParseIP(value) == nil {
+		return fmt.Errorf("not a valid IP address")
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCIDROrIP(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr string
+	}{
+		{"10.0.0.0/8", ""},
+		{"192.168.1.1", ""},
+		{"2001:db8::/32", ""},
+		{"::1", ""},
+		{"::ffff:10.0.0.1", ""},
+		{"", "empty value"},
+		{" 10.0.0.0/8", "whitespace"},
+		{"10.0.0.1\t", "whitespace"},
+		{"10.0.0.0/33", "not a valid CIDR"},
+		{"2001:db8::/129", "not a valid CIDR"},
+		{"10.0.0.0/", "not a valid CIDR"},
+		{"10.0.0.0/8/8", "not a valid CIDR"},
+		{"256.0.0.1", "not a valid IP address"},
+		{"example.com", "not a valid IP address"},
+		{"2001:db8:::1", "not a valid IP address"},
+	}
+
+	for _, tt := range tests {
+		err := parseCIDROrIP(tt.value)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error: %v", tt.value, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%q: err = %v, want it to contain %q", tt.value, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateIPFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		ipFilter interface{}
+		wantErrs []string
+	}{
+		{"unset", nil, nil},
+		{
+			name: "mixed IPv4 and IPv6",
+			ipFilter: map[string]interface{}{
+				"allow": []interface{}{"10.0.0.0/8", "2001:db8::/32", "203.0.113.7"},
+				"deny":  []interface{}{"10.1.0.0/16", "2001:db8:1::1"},
+			},
+		},
+		{
+			name: "every invalid entry is reported",
+			ipFilter: map[string]interface{}{
+				"allow": []interface{}{"10.0.0.0/8", " 10.2.0.0/16"},
+				"deny":  []interface{}{"2001:db8::/200", "10.3.0.1"},
+			},
+			wantErrs: []string{`spec.ipFilter.allow[1] " 10.2.0.0/16"`, `spec.ipFilter.deny[0] "2001:db8::/200"`},
+		},
+		{
+			name:     "not a list",
+			ipFilter: map[string]interface{}{"allow": "10.0.0.0/8"},
+			wantErrs: []string{"spec.ipFilter.allow must be a list of strings"},
+		},
+		{
+			name:     "not a map",
+			ipFilter: []interface{}{"10.0.0.0/8"},
+			wantErrs: []string{"invalid spec.ipFilter"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := map[string]interface{}{}
+			if tt.ipFilter != nil {
+				spec["ipFilter"] = tt.ipFilter
+			}
+			err := validateIPFilter(testRoute(spec))
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("err = %v, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,783 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// 依赖中没有 JSON Schema 实现，这里实现 draft 2020-12 中常用的校验关键字。
+// 不支持的关键字（unevaluatedProperties、$dynamicRef、远程 $ref 等）会在加载时报错，
+// 避免运维人员以为某条约束生效而实际被忽略。pattern 使用 Go 的 RE2 语法。
+
+const jsonSchemaDraft202012 = "https://json-schema.org/draft/2020-12/schema"
+
+// schemaMaxErrors 限制一次校验返回的错误数量
+const schemaMaxErrors = 20
+
+// 仅作为注释、不影响校验结果的关键字
+var schemaAnnotationKeywords = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true, "$defs": true, "$anchor": true,
+	"title": true, "description": true, "default": true, "examples": true,
+	"deprecated": true, "readOnly": true, "writeOnly": true, "format": true,
+}
+
+type schemaPattern struct {
+	re     *regexp.Regexp
+	schema *jsonSchema
+}
+
+// jsonSchema 是编译后的 schema
+type jsonSchema struct {
+	// location 为 schema 在文件中的位置（如 #/$defs/a），用于加载时报错
+	location string
+	// boolean 为非 nil 时表示 true/false schema
+	boolean *bool
+
+	ref      string
+	resolved *jsonSchema
+
+	types    []string
+	enum     []interface{}
+	hasConst bool
+	constVal interface{}
+
+	multipleOf, minimum, maximum, exclusiveMinimum, exclusiveMaximum *float64
+
+	minLength, maxLength *int
+	pattern              *regexp.Regexp
+
+	minItems, maxItems       *int
+	uniqueItems              bool
+	prefixItems              []*jsonSchema
+	items                    *jsonSchema
+	contains                 *jsonSchema
+	minContains, maxContains *int
+
+	minProperties, maxProperties *int
+	required                     []string
+	dependentRequired            map[string][]string
+	properties                   map[string]*jsonSchema
+	patternProperties            []schemaPattern
+	additionalProperties         *jsonSchema
+	propertyNames                *jsonSchema
+
+	allOf, anyOf, oneOf              []*jsonSchema
+	not                              *jsonSchema
+	ifSchema, thenSchema, elseSchema *jsonSchema
+}
+
+// schemaError 是一条校验失败，field 为出错位置（如 spec.hosts[0]），根对象为空字符串
+type schemaError struct {
+	field   string
+	message string
+}
+
+// schemaCompiler 记录 $defs 和待解析的 $ref
+type schemaCompiler struct {
+	root map[string]interface{}
+	refs []*jsonSchema
+	// compiled 缓存已编译的 $ref 目标，使递归引用指向同一个对象
+	compiled map[string]*jsonSchema
+	// all 为编译出的全部 schema，用于检查引用环
+	all []*jsonSchema
+}
+
+// compileJSONSchema 解析 JSON 格式的 schema 并校验其中所有关键字
+func compileJSONSchema(data []byte) (*jsonSchema, error) {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %v", err)
+	}
+
+	root, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("schema root must be an object")
+	}
+	if draft, ok := root["$schema"]; ok && draft != jsonSchemaDraft202012 {
+		return nil, fmt.Errorf("unsupported $schema %v, only %s is supported", draft, jsonSchemaDraft202012)
+	}
+
+	c := &schemaCompiler{root: root, compiled: make(map[string]*jsonSchema)}
+	schema, err := c.compile(root, "#")
+	if err != nil {
+		return nil, err
+	}
+	c.compiled["#"] = schema
+
+	// $ref 可能引用尚未编译的 $defs，全部编译完成后再解析
+	for i := 0; i < len(c.refs); i++ {
+		s := c.refs[i]
+		target, err := c.resolve(s.ref)
+		if err != nil {
+			return nil, err
+		}
+		s.resolved = target
+	}
+	if err := c.checkRefCycles(); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// inPlaceSubschemas 返回对同一个值（而不是其中的属性或元素）进行校验的子 schema
+func (s *jsonSchema) inPlaceSubschemas() []*jsonSchema {
+	subs := []*jsonSchema{s.resolved, s.not, s.ifSchema, s.thenSchema, s.elseSchema}
+	subs = append(subs, s.allOf...)
+	subs = append(subs, s.anyOf...)
+	subs = append(subs, s.oneOf...)
+	return subs
+}
+
+// checkRefCycles 拒绝经由 $ref（以及 allOf、not、if 等）回到自身、途中没有进入属性或数组元素的引用环，
+// 例如 {"$defs": {"a": {"$ref": "#/$defs/a"}}}。这样的 schema 校验时会在同一个值上无限递归，耗尽栈导致进程崩溃。
+// 经过 properties、items 等关键字的递归每一层都深入实例一层，会随实例结束而终止，是允许的。
+func (c *schemaCompiler) checkRefCycles() error {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[*jsonSchema]int, len(c.all))
+	var stack []*jsonSchema
+	var visit func(s *jsonSchema) error
+	visit = func(s *jsonSchema) error {
+		switch state[s] {
+		case visiting:
+			var cycle []string
+			for i := len(stack) - 1; i >= 0; i-- {
+				cycle = append([]string{stack[i].location}, cycle...)
+				if stack[i] == s {
+					break
+				}
+			}
+			return fmt.Errorf("schema reference cycle %s -> %s never descends into a property or item and would recurse forever",
+				strings.Join(cycle, " -> "), s.location)
+		case done:
+			return nil
+		}
+		state[s] = visiting
+		stack = append(stack, s)
+		for _, sub := range s.inPlaceSubschemas() {
+			if sub == nil {
+				continue
+			}
+			if err := visit(sub); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[s] = done
+		return nil
+	}
+
+	for _, s := range c.all {
+		if err := visit(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *schemaCompiler) resolve(ref string) (*jsonSchema, error) {
+	if target, ok := c.compiled[ref]; ok {
+		return target, nil
+	}
+
+	name, ok := strings.CutPrefix(ref, "#/$defs/")
+	if !ok || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("unsupported $ref %q, only \"#\" and \"#/$defs/<name>\" are supported", ref)
+	}
+	defs, _ := c.root["$defs"].(map[string]interface{})
+	raw, ok := defs[name]
+	if !ok {
+		return nil, fmt.Errorf("$ref %q: definition not found", ref)
+	}
+
+	target, err := c.compile(raw, ref)
+	if err != nil {
+		return nil, err
+	}
+	c.compiled[ref] = target
+	return target, nil
+}
+
+func (c *schemaCompiler) compile(raw interface{}, path string) (*jsonSchema, error) {
+	if b, ok := raw.(bool); ok {
+		return &jsonSchema{location: path, boolean: &b}, nil
+	}
+	obj, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: schema must be an object or boolean", path)
+	}
+
+	s := &jsonSchema{location: path}
+	c.all = append(c.all, s)
+	// 按关键字排序处理，使报错顺序稳定
+	keywords := make([]string, 0, len(obj))
+	for k := range obj {
+		keywords = append(keywords, k)
+	}
+	sort.Strings(keywords)
+
+	for _, k := range keywords {
+		v := obj[k]
+		at := path + "/" + k
+		var err error
+		switch k {
+		case "$ref":
+			ref, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: must be a string", at)
+			}
+			s.ref = ref
+			c.refs = append(c.refs, s)
+		case "$defs":
+			defs, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: must be an object", at)
+			}
+			// 即使未被引用也要校验，保证整个文件都是有效的
+			for name, def := range defs {
+				if _, err := c.compile(def, at+"/"+name); err != nil {
+					return nil, err
+				}
+			}
+		case "type":
+			s.types, err = schemaTypes(v, at)
+		case "enum":
+			values, ok := v.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: must be an array", at)
+			}
+			s.enum = values
+		case "const":
+			s.hasConst, s.constVal = true, v
+		case "multipleOf":
+			s.multipleOf, err = schemaNumber(v, at)
+			if err == nil && *s.multipleOf <= 0 {
+				err = fmt.Errorf("%s: must be greater than 0", at)
+			}
+		case "minimum":
+			s.minimum, err = schemaNumber(v, at)
+		case "maximum":
+			s.maximum, err = schemaNumber(v, at)
+		case "exclusiveMinimum":
+			s.exclusiveMinimum, err = schemaNumber(v, at)
+		case "exclusiveMaximum":
+			s.exclusiveMaximum, err = schemaNumber(v, at)
+		case "minLength":
+			s.minLength, err = schemaCount(v, at)
+		case "maxLength":
+			s.maxLength, err = schemaCount(v, at)
+		case "pattern":
+			s.pattern, err = schemaRegexp(v, at)
+		case "minItems":
+			s.minItems, err = schemaCount(v, at)
+		case "maxItems":
+			s.maxItems, err = schemaCount(v, at)
+		case "uniqueItems":
+			b, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("%s: must be a boolean", at)
+			}
+			s.uniqueItems = b
+		case "prefixItems":
+			s.prefixItems, err = c.compileList(v, at)
+		case "items":
+			s.items, err = c.compile(v, at)
+		case "contains":
+			s.contains, err = c.compile(v, at)
+		case "minContains":
+			s.minContains, err = schemaCount(v, at)
+		case "maxContains":
+			s.maxContains, err = schemaCount(v, at)
+		case "minProperties":
+			s.minProperties, err = schemaCount(v, at)
+		case "maxProperties":
+			s.maxProperties, err = schemaCount(v, at)
+		case "required":
+			s.required, err = schemaStrings(v, at)
+		case "dependentRequired":
+			deps, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: must be an object", at)
+			}
+			s.dependentRequired = make(map[string][]string, len(deps))
+			for name, list := range deps {
+				if s.dependentRequired[name], err = schemaStrings(list, at+"/"+name); err != nil {
+					return nil, err
+				}
+			}
+		case "properties":
+			props, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: must be an object", at)
+			}
+			s.properties = make(map[string]*jsonSchema, len(props))
+			for name, prop := range props {
+				if s.properties[name], err = c.compile(prop, at+"/"+name); err != nil {
+					return nil, err
+				}
+			}
+		case "patternProperties":
+			props, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: must be an object", at)
+			}
+			patterns := make([]string, 0, len(props))
+			for p := range props {
+				patterns = append(patterns, p)
+			}
+			sort.Strings(patterns)
+			for _, p := range patterns {
+				re, err := schemaRegexp(p, at)
+				if err != nil {
+					return nil, err
+				}
+				sub, err := c.compile(props[p], at+"/"+p)
+				if err != nil {
+					return nil, err
+				}
+				s.patternProperties = append(s.patternProperties, schemaPattern{re: re, schema: sub})
+			}
+		case "additionalProperties":
+			s.additionalProperties, err = c.compile(v, at)
+		case "propertyNames":
+			s.propertyNames, err = c.compile(v, at)
+		case "allOf":
+			s.allOf, err = c.compileList(v, at)
+		case "anyOf":
+			s.anyOf, err = c.compileList(v, at)
+		case "oneOf":
+			s.oneOf, err = c.compileList(v, at)
+		case "not":
+			s.not, err = c.compile(v, at)
+		case "if":
+			s.ifSchema, err = c.compile(v, at)
+		case "then":
+			s.thenSchema, err = c.compile(v, at)
+		case "else":
+			s.elseSchema, err = c.compile(v, at)
+		default:
+			if !schemaAnnotationKeywords[k] {
+				return nil, fmt.Errorf("%s: unsupported keyword %q", path, k)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (c *schemaCompiler) compileList(v interface{}, at string) ([]*jsonSchema, error) {
+	list, ok := v.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("%s: must be a non-empty array", at)
+	}
+	schemas := make([]*jsonSchema, len(list))
+	for i, raw := range list {
+		s, err := c.compile(raw, fmt.Sprintf("%s/%d", at, i))
+		if err != nil {
+			return nil, err
+		}
+		schemas[i] = s
+	}
+	return schemas, nil
+}
+
+var schemaTypeNames = map[string]bool{
+	"null": true, "boolean": true, "object": true, "array": true, "number": true, "integer": true, "string": true,
+}
+
+func schemaTypes(v interface{}, at string) ([]string, error) {
+	var types []string
+	switch t := v.(type) {
+	case string:
+		types = []string{t}
+	case []interface{}:
+		for _, item := range t {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: must be a string or an array of strings", at)
+			}
+			types = append(types, name)
+		}
+	default:
+		return nil, fmt.Errorf("%s: must be a string or an array of strings", at)
+	}
+	for _, name := range types {
+		if !schemaTypeNames[name] {
+			return nil, fmt.Errorf("%s: unknown type %q", at, name)
+		}
+	}
+	return types, nil
+}
+
+func schemaNumber(v interface{}, at string) (*float64, error) {
+	n, ok := v.(float64)
+	if !ok {
+		return nil, fmt.Errorf("%s: must be a number", at)
+	}
+	return &n, nil
+}
+
+func schemaCount(v interface{}, at string) (*int, error) {
+	n, ok := v.(float64)
+	if !ok || n < 0 || n != math.Trunc(n) {
+		return nil, fmt.Errorf("%s: must be a non-negative integer", at)
+	}
+	count := int(n)
+	return &count, nil
+}
+
+func schemaRegexp(v interface{}, at string) (*regexp.Regexp, error) {
+	pattern, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s: must be a string", at)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid pattern %q: %v", at, pattern, err)
+	}
+	return re, nil
+}
+
+func schemaStrings(v interface{}, at string) ([]string, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: must be an array of strings", at)
+	}
+	values := make([]string, len(list))
+	for i, item := range list {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: must be an array of strings", at)
+		}
+		values[i] = s
+	}
+	return values, nil
+}
+
+// validate 校验 instance，返回最多 schemaMaxErrors 条错误
+func (s *jsonSchema) validate(instance interface{}) []schemaError {
+	var errs []schemaError
+	s.check(normalizeJSONValue(instance), "", &errs)
+	if len(errs) > schemaMaxErrors {
+		errs = errs[:schemaMaxErrors]
+	}
+	return errs
+}
+
+// valid 判断 instance 是否满足 schema，用于 anyOf/oneOf/not/if 等不直接报告子错误的关键字
+func (s *jsonSchema) valid(instance interface{}, field string) bool {
+	var errs []schemaError
+	s.check(instance, field, &errs)
+	return len(errs) == 0
+}
+
+func (s *jsonSchema) check(v interface{}, field string, errs *[]schemaError) {
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, schemaError{field: field, message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.boolean != nil {
+		if !*s.boolean {
+			fail("is not allowed")
+		}
+		return
+	}
+	if s.resolved != nil {
+		s.resolved.check(v, field, errs)
+	}
+
+	if len(s.types) > 0 && !schemaTypeMatches(s.types, v) {
+		fail("must be of type %s", strings.Join(s.types, " or "))
+		// 类型不符时其余关键字的结果没有意义
+		return
+	}
+	if s.enum != nil {
+		matched := false
+		for _, e := range s.enum {
+			if reflect.DeepEqual(normalizeJSONValue(e), v) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("must be one of %s", compactJSON(s.enum))
+		}
+	}
+	if s.hasConst && !reflect.DeepEqual(normalizeJSONValue(s.constVal), v) {
+		fail("must be %s", compactJSON(s.constVal))
+	}
+
+	switch value := v.(type) {
+	case float64:
+		s.checkNumber(value, fail)
+	case string:
+		s.checkString(value, fail)
+	case []interface{}:
+		s.checkArray(value, field, errs, fail)
+	case map[string]interface{}:
+		s.checkObject(value, field, errs, fail)
+	}
+
+	for _, sub := range s.allOf {
+		sub.check(v, field, errs)
+	}
+	if s.anyOf != nil {
+		matched := false
+		for _, sub := range s.anyOf {
+			if sub.valid(v, field) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("must match at least one schema in anyOf")
+		}
+	}
+	if s.oneOf != nil {
+		matched := 0
+		for _, sub := range s.oneOf {
+			if sub.valid(v, field) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			fail("must match exactly one schema in oneOf, matched %d", matched)
+		}
+	}
+	if s.not != nil && s.not.valid(v, field) {
+		fail("must not match the schema in not")
+	}
+	if s.ifSchema != nil {
+		if s.ifSchema.valid(v, field) {
+			if s.thenSchema != nil {
+				s.thenSchema.check(v, field, errs)
+			}
+		} else if s.elseSchema != nil {
+			s.elseSchema.check(v, field, errs)
+		}
+	}
+}
+
+func (s *jsonSchema) checkNumber(n float64, fail func(string, ...interface{})) {
+	if s.multipleOf != nil {
+		q := n / *s.multipleOf
+		if math.Abs(q-math.Round(q)) > 1e-9 {
+			fail("must be a multiple of %g", *s.multipleOf)
+		}
+	}
+	if s.minimum != nil && n < *s.minimum {
+		fail("must be >= %g", *s.minimum)
+	}
+	if s.maximum != nil && n > *s.maximum {
+		fail("must be <= %g", *s.maximum)
+	}
+	if s.exclusiveMinimum != nil && n <= *s.exclusiveMinimum {
+		fail("must be > %g", *s.exclusiveMinimum)
+	}
+	if s.exclusiveMaximum != nil && n >= *s.exclusiveMaximum {
+		fail("must be < %g", *s.exclusiveMaximum)
+	}
+}
+
+func (s *jsonSchema) checkString(str string, fail func(string, ...interface{})) {
+	length := utf8.RuneCountInString(str)
+	if s.minLength != nil && length < *s.minLength {
+		fail("must be at least %d characters", *s.minLength)
+	}
+	if s.maxLength != nil && length > *s.maxLength {
+		fail("must be at most %d characters", *s.maxLength)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(str) {
+		fail("must match pattern %q", s.pattern.String())
+	}
+}
+
+func (s *jsonSchema) checkArray(items []interface{}, field string, errs *[]schemaError, fail func(string, ...interface{})) {
+	if s.minItems != nil && len(items) < *s.minItems {
+		fail("must have at least %d items", *s.minItems)
+	}
+	if s.maxItems != nil && len(items) > *s.maxItems {
+		fail("must have at most %d items", *s.maxItems)
+	}
+	if s.uniqueItems {
+		for i := range items {
+			for j := i + 1; j < len(items); j++ {
+				if reflect.DeepEqual(items[i], items[j]) {
+					fail("items %d and %d are equal, items must be unique", i, j)
+				}
+			}
+		}
+	}
+
+	for i, item := range items {
+		itemField := field + "[" + strconv.Itoa(i) + "]"
+		if i < len(s.prefixItems) {
+			s.prefixItems[i].check(item, itemField, errs)
+		} else if s.items != nil {
+			s.items.check(item, itemField, errs)
+		}
+	}
+
+	if s.contains != nil {
+		matched := 0
+		for i, item := range items {
+			if s.contains.valid(item, field+"["+strconv.Itoa(i)+"]") {
+				matched++
+			}
+		}
+		minContains := 1
+		if s.minContains != nil {
+			minContains = *s.minContains
+		}
+		if matched < minContains {
+			fail("must contain at least %d matching items", minContains)
+		}
+		if s.maxContains != nil && matched > *s.maxContains {
+			fail("must contain at most %d matching items", *s.maxContains)
+		}
+	}
+}
+
+func (s *jsonSchema) checkObject(obj map[string]interface{}, field string, errs *[]schemaError, fail func(string, ...interface{})) {
+	if s.minProperties != nil && len(obj) < *s.minProperties {
+		fail("must have at least %d properties", *s.minProperties)
+	}
+	if s.maxProperties != nil && len(obj) > *s.maxProperties {
+		fail("must have at most %d properties", *s.maxProperties)
+	}
+	for _, name := range s.required {
+		if _, ok := obj[name]; !ok {
+			*errs = append(*errs, schemaError{field: schemaChildField(field, name), message: "is required"})
+		}
+	}
+	for name, deps := range s.dependentRequired {
+		if _, ok := obj[name]; !ok {
+			continue
+		}
+		for _, dep := range deps {
+			if _, ok := obj[dep]; !ok {
+				*errs = append(*errs, schemaError{field: schemaChildField(field, dep), message: fmt.Sprintf("is required when %s is set", name)})
+			}
+		}
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := obj[name]
+		child := schemaChildField(field, name)
+		if s.propertyNames != nil && !s.propertyNames.valid(name, child) {
+			*errs = append(*errs, schemaError{field: child, message: "property name is not allowed"})
+		}
+
+		evaluated := false
+		if sub, ok := s.properties[name]; ok {
+			sub.check(value, child, errs)
+			evaluated = true
+		}
+		for _, p := range s.patternProperties {
+			if p.re.MatchString(name) {
+				p.schema.check(value, child, errs)
+				evaluated = true
+			}
+		}
+		if !evaluated && s.additionalProperties != nil {
+			s.additionalProperties.check(value, child, errs)
+		}
+	}
+}
+
+func schemaChildField(field, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
+
+func schemaTypeMatches(types []string, v interface{}) bool {
+	for _, t := range types {
+		switch t {
+		case "null":
+			if v == nil {
+				return true
+			}
+		case "boolean":
+			if _, ok := v.(bool); ok {
+				return true
+			}
+		case "object":
+			if _, ok := v.(map[string]interface{}); ok {
+				return true
+			}
+		case "array":
+			if _, ok := v.([]interface{}); ok {
+				return true
+			}
+		case "number":
+			if _, ok := v.(float64); ok {
+				return true
+			}
+		case "integer":
+			if n, ok := v.(float64); ok && n == math.Trunc(n) {
+				return true
+			}
+		case "string":
+			if _, ok := v.(string); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// normalizeJSONValue 将 unstructured 中的 int64 等数值统一为 float64，便于比较
+func normalizeJSONValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case int:
+		return float64(value)
+	case int32:
+		return float64(value)
+	case int64:
+		return float64(value)
+	case json.Number:
+		n, _ := value.Float64()
+		return n
+	case []interface{}:
+		out := make([]interface{}, len(value))
+		for i, item := range value {
+			out[i] = normalizeJSONValue(item)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			out[k] = normalizeJSONValue(item)
+		}
+		return out
+	}
+	return v
+}
+
+func compactJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
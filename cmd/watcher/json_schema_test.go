@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSONSchemaKeywords(t *testing.T) {
+	tests := []struct {
+		name     string
+		schema   string
+		instance string
+		valid    bool
+	}{
+		{"type match", `{"type":"string"}`, `"a"`, true},
+		{"type mismatch", `{"type":"string"}`, `1`, false},
+		{"type integer", `{"type":"integer"}`, `2.0`, true},
+		{"type integer fraction", `{"type":"integer"}`, `2.5`, false},
+		{"type list", `{"type":["string","null"]}`, `null`, true},
+		{"enum match", `{"enum":["a",1]}`, `1`, true},
+		{"enum mismatch", `{"enum":["a",1]}`, `"b"`, false},
+		{"const match", `{"const":{"a":[1]}}`, `{"a":[1]}`, true},
+		{"const mismatch", `{"const":{"a":[1]}}`, `{"a":[2]}`, false},
+		{"multipleOf match", `{"multipleOf":3}`, `9`, true},
+		{"multipleOf mismatch", `{"multipleOf":3}`, `10`, false},
+		{"minimum inclusive", `{"minimum":1}`, `1`, true},
+		{"minimum below", `{"minimum":1}`, `0`, false},
+		{"maximum inclusive", `{"maximum":1}`, `1`, true},
+		{"maximum above", `{"maximum":1}`, `2`, false},
+		{"exclusiveMinimum boundary", `{"exclusiveMinimum":1}`, `1`, false},
+		{"exclusiveMinimum above", `{"exclusiveMinimum":1}`, `2`, true},
+		{"exclusiveMaximum boundary", `{"exclusiveMaximum":1}`, `1`, false},
+		{"exclusiveMaximum below", `{"exclusiveMaximum":1}`, `0`, true},
+		{"minLength counts runes", `{"minLength":2}`, `"中文"`, true},
+		{"minLength short", `{"minLength":2}`, `"a"`, false},
+		{"maxLength ok", `{"maxLength":2}`, `"ab"`, true},
+		{"maxLength long", `{"maxLength":2}`, `"abc"`, false},
+		{"pattern match", `{"pattern":"^[a-z]+$"}`, `"abc"`, true},
+		{"pattern mismatch", `{"pattern":"^[a-z]+$"}`, `"ABC"`, false},
+		{"minItems ok", `{"minItems":1}`, `[1]`, true},
+		{"minItems short", `{"minItems":1}`, `[]`, false},
+		{"maxItems ok", `{"maxItems":1}`, `[1]`, true},
+		{"maxItems long", `{"maxItems":1}`, `[1,2]`, false},
+		{"uniqueItems ok", `{"uniqueItems":true}`, `[1,"1"]`, true},
+		{"uniqueItems duplicate", `{"uniqueItems":true}`, `[{"a":1},{"a":1}]`, false},
+		{"prefixItems ok", `{"prefixItems":[{"type":"string"},{"type":"integer"}]}`, `["a",1,true]`, true},
+		{"prefixItems mismatch", `{"prefixItems":[{"type":"string"}]}`, `[1]`, false},
+		{"items after prefix", `{"prefixItems":[{"type":"string"}],"items":{"type":"integer"}}`, `["a","b"]`, false},
+		{"items ok", `{"items":{"type":"integer"}}`, `[1,2]`, true},
+		{"contains ok", `{"contains":{"const":2}}`, `[1,2]`, true},
+		{"contains missing", `{"contains":{"const":2}}`, `[1,3]`, false},
+		{"minContains short", `{"contains":{"const":2},"minContains":2}`, `[2,1]`, false},
+		{"maxContains exceeded", `{"contains":{"const":2},"maxContains":1}`, `[2,2]`, false},
+		{"minProperties ok", `{"minProperties":1}`, `{"a":1}`, true},
+		{"minProperties short", `{"minProperties":1}`, `{}`, false},
+		{"maxProperties long", `{"maxProperties":1}`, `{"a":1,"b":2}`, false},
+		{"required present", `{"required":["a"]}`, `{"a":null}`, true},
+		{"required missing", `{"required":["a"]}`, `{"b":1}`, false},
+		{"dependentRequired ok", `{"dependentRequired":{"a":["b"]}}`, `{"a":1,"b":2}`, true},
+		{"dependentRequired missing", `{"dependentRequired":{"a":["b"]}}`, `{"a":1}`, false},
+		{"properties ok", `{"properties":{"a":{"type":"string"}}}`, `{"a":"x"}`, true},
+		{"properties mismatch", `{"properties":{"a":{"type":"string"}}}`, `{"a":1}`, false},
+		{"patternProperties mismatch", `{"patternProperties":{"^x-":{"type":"string"}}}`, `{"x-a":1}`, false},
+		{"additionalProperties false", `{"properties":{"a":{}},"additionalProperties":false}`, `{"a":1,"b":2}`, false},
+		{"additionalProperties skips pattern", `{"patternProperties":{"^x-":{}},"additionalProperties":false}`, `{"x-a":1}`, true},
+		{"propertyNames mismatch", `{"propertyNames":{"pattern":"^[a-z]+$"}}`, `{"A":1}`, false},
+		{"allOf ok", `{"allOf":[{"type":"integer"},{"minimum":1}]}`, `2`, true},
+		{"allOf mismatch", `{"allOf":[{"type":"integer"},{"minimum":1}]}`, `0`, false},
+		{"anyOf ok", `{"anyOf":[{"type":"string"},{"type":"integer"}]}`, `1`, true},
+		{"anyOf mismatch", `{"anyOf":[{"type":"string"},{"type":"integer"}]}`, `true`, false},
+		{"oneOf ok", `{"oneOf":[{"type":"integer"},{"type":"string"}]}`, `1`, true},
+		{"oneOf ambiguous", `{"oneOf":[{"type":"integer"},{"minimum":0}]}`, `1`, false},
+		{"not ok", `{"not":{"type":"string"}}`, `1`, true},
+		{"not mismatch", `{"not":{"type":"string"}}`, `"a"`, false},
+		{"if then", `{"if":{"required":["a"]},"then":{"required":["b"]}}`, `{"a":1}`, false},
+		{"if else", `{"if":{"required":["a"]},"then":{"required":["b"]},"else":{"required":["c"]}}`, `{"c":1}`, true},
+		{"ref to defs", `{"$defs":{"port":{"type":"integer","maximum":65535}},"properties":{"p":{"$ref":"#/$defs/port"}}}`, `{"p":70000}`, false},
+		{"recursive ref through properties", `{"type":"object","properties":{"child":{"$ref":"#"}},"additionalProperties":false}`, `{"child":{"child":{}}}`, true},
+		{"recursive ref through items", `{"$defs":{"tree":{"type":"array","items":{"$ref":"#/$defs/tree"}}},"$ref":"#/$defs/tree"}`, `[[[]],[1]]`, false},
+		{"boolean schema false", `{"properties":{"a":false}}`, `{"a":1}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := compileJSONSchema([]byte(tt.schema))
+			if err != nil {
+				t.Fatalf("compileJSONSchema: %v", err)
+			}
+			var instance interface{}
+			if err := json.Unmarshal([]byte(tt.instance), &instance); err != nil {
+				t.Fatalf("bad instance: %v", err)
+			}
+			errs := schema.validate(instance)
+			if got := len(errs) == 0; got != tt.valid {
+				t.Errorf("valid = %v, want %v (errors: %v)", got, tt.valid, errs)
+			}
+		})
+	}
+}
+
+func TestCompileJSONSchemaErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		wantErr string
+	}{
+		{"root not object", `[]`, "schema root must be an object"},
+		{"unsupported draft", `{"$schema":"http://json-schema.org/draft-07/schema#"}`, "unsupported $schema"},
+		{"unsupported keyword", `{"unevaluatedProperties":false}`, "unsupported keyword"},
+		{"bad pattern", `{"pattern":"("}`, "pattern"},
+		{"unknown ref", `{"$ref":"#/$defs/missing"}`, "missing"},
+		{"self ref", `{"$defs":{"a":{"$ref":"#/$defs/a"}},"$ref":"#/$defs/a"}`, "schema reference cycle"},
+		{"unreferenced self ref", `{"$defs":{"a":{"$ref":"#/$defs/a"}}}`, "schema reference cycle"},
+		{"root ref", `{"$ref":"#"}`, "schema reference cycle"},
+		{"cycle through allOf", `{"$defs":{"a":{"allOf":[{"$ref":"#/$defs/b"}]},"b":{"anyOf":[{"$ref":"#/$defs/a"}]}}}`, "schema reference cycle"},
+		{"cycle through not and if", `{"$defs":{"a":{"not":{"$ref":"#/$defs/b"}},"b":{"if":{"$ref":"#/$defs/a"}}}}`, "schema reference cycle"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileJSONSchema([]byte(tt.schema))
+			if err == nil {
+				t.Fatalf("expected error containing %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
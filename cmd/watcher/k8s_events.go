@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// 推送结果对应的 Event reason
+const (
+	syncedReason     = "Synced"
+	syncFailedReason = "SyncFailed"
+	// syncConflictReason 为 OpenResty 持续以 409 拒绝更新、watcher 放弃该事件时的 reason
+	syncConflictReason = "SyncConflict"
+	dryRunReason       = "DryRun"
+)
+
+// dryRunMessage 为 dry-run 模式下 Event 和 Synced condition 的消息
+const dryRunMessage = "Dry run: would sync to OpenResty, nothing was pushed"
+
+// newEventRecorder 创建写入 Kubernetes Event 的 recorder。相同的 Event 会被合并计数，写入在后台异步进行。
+func newEventRecorder(clientset kubernetes.Interface) (record.EventBroadcaster, record.EventRecorder) {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "oss-fe-proxy"})
+	return broadcaster, recorder
+}
+
+// recordWarningEvent 为对象记录一个 Warning 类型的 Kubernetes Event，分片模式下只由负责该对象的 Pod 记录
+func (w *Watcher) recordWarningEvent(obj *unstructured.Unstructured, reason, message string) {
+	if !w.ownsObject(obj) {
+		return
+	}
+	w.recorder.Event(obj, corev1.EventTypeWarning, reason, message)
+}
+
+// recordSyncResult 按推送到 OpenResty 的结果为 route/upstream 记录 Synced 或 SyncFailed Event，
+// 失败时在消息中附带 OpenResty 返回的 HTTP 状态码
+func (w *Watcher) recordSyncResult(obj *unstructured.Unstructured, err error) {
+	if err == nil && w.dryRun {
+		w.recorder.Event(obj, corev1.EventTypeNormal, dryRunReason, dryRunMessage)
+		return
+	}
+	if err == nil {
+		w.recorder.Event(obj, corev1.EventTypeNormal, syncedReason, "Synced to OpenResty")
+		return
+	}
+
+	var statusErr *openrestyStatusError
+	if errors.As(err, &statusErr) {
+		w.recordWarningEvent(obj, syncFailedReason, fmt.Sprintf("OpenResty rejected the object with HTTP %d: %v", statusErr.StatusCode, err))
+		return
+	}
+	w.recordWarningEvent(obj, syncFailedReason, fmt.Sprintf("Failed to sync to OpenResty: %v", err))
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// 日志格式：json 便于日志系统解析，text 便于本地开发时阅读
+const (
+	logFormatJSON = "json"
+	logFormatText = "text"
+)
+
+// setupLogging 按 LOG_FORMAT（默认 json）和 LOG_LEVEL（debug/info/warn/error，默认 info）设置默认 logger。
+// 设置后标准库 log 的输出同样经过该 logger，以 INFO 级别输出。
+func setupLogging() error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(getEnvOrDefault("LOG_LEVEL", "info"))); err != nil {
+		return fmt.Errorf("invalid LOG_LEVEL: %v", err)
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch format := strings.ToLower(getEnvOrDefault("LOG_FORMAT", logFormatJSON)); format {
+	case logFormatJSON:
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	case logFormatText:
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid LOG_FORMAT %q, must be %q or %q", format, logFormatJSON, logFormatText)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// objectLogAttrs 返回对象的 resource、namespace、name 结构化字段
+func objectLogAttrs(resource, namespace, name string) []any {
+	return []any{"resource", resource, "namespace", namespace, "name", name}
+}
+
+// objectKeyLogAttrs 与 objectLogAttrs 相同，对象以 namespace/name 形式的 key 给出
+func objectKeyLogAttrs(resource, key string) []any {
+	namespace, name := splitObjectKey(key)
+	return objectLogAttrs(resource, namespace, name)
+}
+
+// kindLogResource 返回 Kind 对应的日志 resource 字段，与 handleEvent 使用的 resourceType 一致
+func kindLogResource(kind string) string {
+	switch kind {
+	case "OSSProxyRoute":
+		return "routes"
+	case "OSSProxyUpstream":
+		return "upstreams"
+	default:
+		return strings.ToLower(kind)
+	}
+}
@@ -4,16 +4,24 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -21,10 +29,19 @@ import (
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 )
 
 const (
-	openrestyAPIBase = "http://127.0.0.1:9180"
+	// 全量同步顺序，upstream 是 route 的依赖，默认先同步
+	syncOrderUpstreamsFirst = "upstreams-first"
+	syncOrderRoutesFirst    = "routes-first"
+
+	// 启动时对 OpenResty 的依赖方式：wait 先等待 OpenResty 就绪再开始 watch，超时则启动失败；
+	// buffer 立即开始 watch，事件缓存在 informer 中，OpenResty 就绪后全量同步并依次处理
+	startupModeWait   = "wait"
+	startupModeBuffer = "buffer"
 )
 
 var (
@@ -45,90 +62,407 @@ type Watcher struct {
 	clientset kubernetes.Interface
 	ctx       context.Context
 	cancel    context.CancelFunc
-	apiKey    string
+	apiKey    *apiKeyStore
+	signer    *payloadSigner
+	secrets   *secretIndex
+
+	// config 为启动时校验过的配置
+	config *watcherConfig
+
+	// openresty 为 OpenResty 内部 API 的地址与连接设置
+	openresty *openrestyAPI
+	// notifier 负责把单个对象推送到 OpenResty，默认为 httpNotifier
+	notifier Notifier
+
+	// epoch 在每次推送时递增，随请求发送给 OpenResty 用于检测推送丢失；
+	// ackedEpoch 为 OpenResty 返回成功的推送中最大的 epoch
+	epoch      atomic.Uint64
+	ackedEpoch atomic.Uint64
+	epochGate  *epochGate
+
+	shards *shardManager
+
+	// draining 为 true 时不再接收新的 watch 事件，pending 为正在处理的事件数
+	draining atomic.Bool
+	pending  atomic.Int64
+	// inflight 跟踪进行中的 notifyOpenresty 调用，退出时等待它们返回后再取消 context
+	inflight pushGate
+
+	// hashes 记录已推送对象的内容哈希；adoptOnStartup 为 true 时初始同步跳过 OpenResty 中已一致的对象
+	hashes         *hashCache
+	adoptOnStartup atomic.Bool
+
+	// gcOnStartup 为 true 时初始同步会删除 OpenResty 中没有对应 CR 的 route/upstream
+	gcOnStartup atomic.Bool
+
+	// bulkUnsupported 为 true 表示 OpenResty 不支持批量推送接口，全量同步退回逐个推送
+	bulkUnsupported atomic.Bool
+
+	// policies 为 webhook 域名策略，未启用 webhook 或未配置策略文件时为 nil
+	policies *policyStore
+	// schemas 为 webhook 自定义 route schema，未配置时为 nil
+	schemas *routeSchemaStore
+	webhook *WebhookServer
+
+	// events 将同步结果投递到 CloudEvents sink，未配置时为 nil
+	events *cloudEventEmitter
+	// tracer 导出 watch 事件到推送完成的 trace，未配置 OTLP exporter 时为 nil
+	tracer *tracer
+
+	retry *retryPolicy
+
+	// syncOrder 决定全量同步时 upstream 与 route 的先后顺序
+	syncOrder string
+	// startupMode 决定启动时是否先等待 OpenResty 就绪，openrestyWaitTimeout 为 wait 模式的等待上限
+	startupMode          string
+	openrestyWaitTimeout time.Duration
+
+	// secretFlight 合并对同一 secret 的并发同步，secretSyncConcurrency 为全量同步时 secret 的并发度
+	secretFlight          *secretFlight
+	secretSyncConcurrency int
+	// syncConcurrency 为全量同步时 route/upstream 推送请求的并发度
+	syncConcurrency int
+	// secretFailurePolicy 决定 secret 推送失败时是否仍推送引用它的 upstream
+	secretFailurePolicy string
+
+	// tlsMissingPolicy 决定 TLS Secret 不存在时是否仍推送 route，tlsWaiting 记录等待 Secret 的 route
+	tlsMissingPolicy string
+	tlsWaiting       *tlsWaitList
+
+	// dryRun 为 true 时只记录将要推送到 OpenResty 的内容，不发出任何写请求
+	dryRun bool
+
+	// debouncer 合并同一 route/upstream 在 DEBOUNCE_INTERVAL 内的连续更新
+	debouncer *eventDebouncer
+
+	health *healthState
+	// openrestyHealthy 为后台健康检查看到的 OpenResty 可达状态，用于 /readyz
+	openrestyHealthy atomic.Bool
+	// reconcileMu 保证同一时刻只有一次全量 reconcile
+	reconcileMu sync.Mutex
+
+	// ready 在初始全量同步成功完成后置为 true，用于 /readyz
+	ready atomic.Bool
+
+	// recorder 在 route/upstream 上记录 Kubernetes Event
+	eventBroadcaster record.EventBroadcaster
+	recorder         record.EventRecorder
+
+	// maxPayloadBytes 为推送到 OpenResty 的单个对象的大小上限，oversize 记录因过大被拒绝的对象
+	maxPayloadBytes int
+	oversize        *oversizeTracker
+
+	metrics *syncMetrics
+	// routeKeys 决定 route 在 OpenResty 路由表中的 key
+	routeKeys *routeKeyConfig
+
+	clockProbe *clockSkewProbe
+
+	// informers 监听 route/upstream/TLS Secret 的变化并维护本地缓存
+	informers *watcherInformers
+
+	// syncQueue 以指数退避重试处理失败的事件，重试用尽后交给 retryQueue
+	syncQueue *syncQueue
+	// retryQueue 记录处理失败的事件并定期重试
+	retryQueue *retryQueue
+
+	// maxAge 为 nil 时不强制重新推送内容未变的对象
+	maxAge *maxAgeResync
+
+	// upstreamStats 为 nil 时不采集 OpenResty 的 upstream 统计
+	upstreamStats *upstreamStatsPoller
+
+	// reconciler 为 nil 时不定期全量 reconcile，也不检测 OpenResty 重启
+	reconciler *driftReconciler
+
+	// deleteNotFoundOK 为 true 时，删除 OpenResty 中本就不存在的对象（返回 404）视为成功
+	deleteNotFoundOK bool
+}
+
+// kubeconfigFlag 为 --kubeconfig 参数，仅在集群外运行（本地开发、测试）时使用。
+// envtest 测试引入的 controller-runtime 已注册同名、同义的参数，此时不再重复注册
+const kubeconfigFlag = "kubeconfig"
+
+func init() {
+	if flag.Lookup(kubeconfigFlag) == nil {
+		flag.String(kubeconfigFlag, "", "path to a kubeconfig file, used when not running in a cluster (defaults to $KUBECONFIG)")
+	}
 }
 
-func NewWatcher() (*Watcher, error) {
+// newKubeClients 创建 dynamic client 和 clientset。优先使用 in-cluster 配置，
+// 不在集群中运行时回退到 --kubeconfig 或 KUBECONFIG 指定的 kubeconfig
+func newKubeClients() (dynamic.Interface, kubernetes.Interface, error) {
 	config, err := rest.InClusterConfig()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get in-cluster config: %v", err)
+		path := flag.Lookup(kubeconfigFlag).Value.String()
+		if path == "" {
+			path = os.Getenv("KUBECONFIG")
+		}
+		if path == "" {
+			return nil, nil, fmt.Errorf("failed to get in-cluster config and no --kubeconfig or KUBECONFIG is set: %v", err)
+		}
+		config, err = clientcmd.BuildConfigFromFlags("", path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load kubeconfig %s: %v", path, err)
+		}
+		slog.Info("Not running in a cluster, using kubeconfig", "path", path)
 	}
+	return newKubeClientsForConfig(config)
+}
 
+// newKubeClientsForConfig 用给定的 rest.Config 创建 dynamic client 与 clientset
+func newKubeClientsForConfig(config *rest.Config) (dynamic.Interface, kubernetes.Interface, error) {
 	client, err := dynamic.NewForConfig(config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create dynamic client: %v", err)
+		return nil, nil, fmt.Errorf("failed to create dynamic client: %v", err)
 	}
 
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create kubernetes clientset: %v", err)
+		return nil, nil, fmt.Errorf("failed to create kubernetes clientset: %v", err)
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	return client, clientset, nil
+}
+
+func NewWatcher(cfg *watcherConfig) (*Watcher, error) {
+	client, clientset, err := newKubeClients()
+	if err != nil {
+		return nil, err
+	}
 
 	// 读取内部 API 认证密钥
-	apiKeyFile := "/tmp/api.key"
-	apiKeyBytes, err := os.ReadFile(apiKeyFile)
+	apiKey, err := newAPIKeyStore(cfg.apiKeyReloadInterval)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read API key from %s: %v", apiKeyFile, err)
+		return nil, err
 	}
-	apiKey := string(bytes.TrimSpace(apiKeyBytes))
-	if apiKey == "" {
-		return nil, fmt.Errorf("API key is empty")
+	signer, err := newPayloadSigner(cfg, apiKey)
+	if err != nil {
+		return nil, err
 	}
-	log.Printf("Loaded internal API key: %s...", apiKey[:8])
 
-	return &Watcher{
+	ctx, cancel := context.WithCancel(context.Background())
+
+	w := &Watcher{
 		client:    client,
 		clientset: clientset,
 		ctx:       ctx,
 		cancel:    cancel,
+		config:    cfg,
 		apiKey:    apiKey,
-	}, nil
+		signer:    signer,
+		openresty: cfg.openresty,
+		secrets:   newSecretIndex(),
+		epochGate: newEpochGate(cfg.epochGrace, cfg.epochCheckInterval),
+		shards:    cfg.shards,
+		hashes:    newHashCache(),
+		events:    cfg.events,
+		tracer:    cfg.tracer,
+		retry:     cfg.retry,
+		syncOrder: cfg.syncOrder,
+
+		startupMode:          cfg.startupMode,
+		openrestyWaitTimeout: cfg.openrestyWaitTimeout,
+
+		secretFlight:          newSecretFlight(),
+		secretSyncConcurrency: cfg.secretSyncConcurrency,
+		syncConcurrency:       cfg.syncConcurrency,
+		secretFailurePolicy:   cfg.secretFailurePolicy,
+		tlsMissingPolicy:      cfg.tlsMissingPolicy,
+		tlsWaiting:            newTLSWaitList(),
+		health:                newHealthState(),
+		maxPayloadBytes:       cfg.maxPayloadBytes,
+		oversize:              newOversizeTracker(),
+		metrics:               newSyncMetrics(),
+		routeKeys:             cfg.routeKeys,
+		clockProbe:            cfg.clockProbe,
+		upstreamStats:         cfg.upstreamStats,
+		maxAge:                cfg.maxAge,
+		reconciler:            cfg.reconciler,
+		syncQueue:             cfg.syncQueue,
+		retryQueue:            cfg.retryQueue,
+		deleteNotFoundOK:      cfg.deleteNotFoundOK,
+		dryRun:                cfg.dryRun,
+		debouncer:             newEventDebouncer(cfg.debounceInterval),
+	}
+	w.notifier = &httpNotifier{w: w}
+	if cfg.adminAuth != nil {
+		cfg.adminAuth.clientset = clientset
+	}
+	w.eventBroadcaster, w.recorder = newEventRecorder(clientset)
+	w.informers = newWatcherInformers(client, cfg.resync, cfg.watchNamespaces, cfg.watchSelector)
+	if err := w.setupInformers(); err != nil {
+		return nil, err
+	}
+	w.adoptOnStartup.Store(cfg.adoptOnStartup)
+	w.gcOnStartup.Store(cfg.gcOnStartup)
+
+	return w, nil
 }
 
 func (w *Watcher) Start() error {
-	log.Println("Starting CRD watcher...")
+	slog.Info("Starting CRD watcher")
+	if w.dryRun {
+		slog.Warn("DRY_RUN is enabled, nothing will be pushed to OpenResty")
+	}
+
+	// 密钥文件被替换后跟随重新加载
+	go w.apiKey.watch(w.ctx.Done())
+	if w.signer != nil && w.signer.key != w.apiKey {
+		go w.signer.key.watch(w.ctx.Done())
+	}
 
 	// 启动 admission webhook（如果启用）
 	var webhookServer *WebhookServer
-	if webhookEnabled := os.Getenv("WEBHOOK_ENABLED"); webhookEnabled == "true" {
-		webhookPort, _ := strconv.Atoi(getEnvOrDefault("WEBHOOK_PORT", "8443"))
+	if w.config.webhookEnabled {
+		webhookPort := w.config.webhookPort
 		certPath := getEnvOrDefault("WEBHOOK_CERT_PATH", "/tmp/webhook-certs/tls.crt")
 		keyPath := getEnvOrDefault("WEBHOOK_KEY_PATH", "/tmp/webhook-certs/tls.key")
 
 		// 检查证书文件是否存在
 		if err := validateCertFiles(certPath, keyPath); err != nil {
-			log.Printf("Webhook certificate files validation failed: %v", err)
+			slog.Error("Webhook certificate files validation failed", "certPath", certPath, "keyPath", keyPath, "error", err)
 			return err
 		}
 
-		webhookServer = NewWebhookServer(w, webhookPort, certPath, keyPath)
+		// 域名策略与自定义 route schema（可选）已在 loadConfig 中加载，这里启动热加载
+		policies, schemas := w.config.policies, w.config.schemas
+		if policies != nil {
+			go policies.watch(w.ctx.Done())
+		}
+		w.policies = policies
+		if schemas != nil {
+			go schemas.watch(w.ctx.Done())
+		}
+		w.schemas = schemas
+
+		webhookServer = NewWebhookServer(w, webhookPort, certPath, keyPath, policies, schemas, w.config.createLimiter)
+		w.webhook = webhookServer
 		go func() {
 			if err := webhookServer.Start(); err != nil {
-				log.Printf("Webhook server failed: %v", err)
+				slog.Error("Webhook server failed", "error", err)
 			}
 		}()
-		log.Printf("Admission webhook started on port %d", webhookPort)
+		slog.Info("Admission webhook started", "port", webhookPort)
 	}
 
+	if w.events != nil {
+		go w.events.run(w.ctx.Done())
+	}
+	if w.tracer != nil {
+		go w.tracer.run(w.ctx.Done())
+	}
+
+	// 启动本地运维端点（drain 等）
+	adminServer := NewAdminServer(w, w.config.adminAddr, w.config.adminAuth)
+	go func() {
+		if err := adminServer.Start(); err != nil {
+			slog.Error("Admin server failed", "error", err)
+		}
+	}()
+
+	// 启动 Prometheus 指标端点
+	metricsServer := NewMetricsServer(w, w.config.metricsPort)
+	go func() {
+		if err := metricsServer.Start(); err != nil {
+			slog.Error("Metrics server failed", "error", err)
+		}
+	}()
+
+	// 启动存活/就绪检查端点
+	probeServer := NewProbeServer(w, w.config.probePort)
+	go func() {
+		if err := probeServer.Start(); err != nil {
+			slog.Error("Probe server failed", "error", err)
+		}
+	}()
+
 	// 等待 OpenResty 启动
-	if err := w.waitForOpenResty(); err != nil {
-		log.Printf("Failed to connect to OpenResty: %v", err)
+	if w.startupMode == startupModeWait {
+		if err := w.waitForOpenResty(w.openrestyWaitTimeout); err != nil {
+			slog.Error("Failed to connect to OpenResty", "error", err)
+			return err
+		}
+	}
+
+	// 分片模式下先加入成员列表，初始同步只为分配给自己的对象写入 status 与 finalizer
+	if w.shards.enabled {
+		if err := w.joinShard(); err != nil {
+			slog.Error("Failed to join shard", "error", err)
+			return err
+		}
+		go w.runSharding()
+	}
+
+	// 恢复上次退出前未完成的重试，全量同步无法覆盖处理失败的删除事件
+	if err := w.loadRetryQueue(); err != nil {
+		slog.Warn("Failed to restore retry queue", "error", err)
+	}
+
+	// 启动 informer，初始全量同步基于其缓存进行
+	if err := w.startInformers(); err != nil {
+		slog.Error("Failed to start informers", "error", err)
 		return err
 	}
 
+	// buffer 模式下 watch 已经开始，期间的事件在初始全量同步完成后依次处理
+	if w.startupMode == startupModeBuffer {
+		slog.Info("Watches started, buffering events until OpenResty is ready")
+		if err := w.waitForOpenResty(0); err != nil {
+			slog.Error("Failed to connect to OpenResty", "error", err)
+			return err
+		}
+	}
+	w.seedEpoch()
+
 	// 初始全量同步 - 这是关键步骤，完成后 Lua 侧才会 ready
-	log.Println("Performing initial full sync...")
-	if err := w.syncAll(); err != nil {
-		log.Printf("Initial sync failed: %v", err)
+	slog.Info("Performing initial full sync")
+	syncStart := time.Now()
+	err := w.syncAll()
+	w.health.recordSync(err)
+	if err != nil {
+		slog.Error("Initial sync failed", "error", err, "durationMs", time.Since(syncStart).Milliseconds())
 		return err
 	}
-	log.Println("Initial sync completed, OpenResty should be ready now")
+	slog.Info("Initial sync completed, OpenResty should be ready now", "durationMs", time.Since(syncStart).Milliseconds())
+	w.ready.Store(true)
+	w.openrestyHealthy.Store(true)
+	w.metrics.openrestyHealthy.set(1)
+
+	// 开始处理 informer 投递的事件
+	close(w.informers.initialSynced)
+
+	// 启动 epoch 一致性检查；dry-run 下 OpenResty 不会收到推送，epoch 不会前进
+	if !w.dryRun {
+		go w.monitorEpoch()
+	}
+
+	// 启动时钟偏差检查
+	go w.monitorClockSkew()
+
+	// 启动失败事件的重试：先按指数退避快速重试，用尽后按固定间隔继续
+	go w.runSyncQueue()
+	go w.runRetryQueue()
+
+	// 启动超龄对象的强制重新推送（如果启用）
+	if w.maxAge != nil {
+		go w.runMaxAgeResync()
+	}
+
+	// 启动 OpenResty 可达性检查（如果启用）
+	if w.config.openrestyHealthInterval > 0 {
+		go w.runOpenrestyHealthCheck()
+	}
+
+	// 启动全量 reconcile 与 OpenResty 重启检测（如果启用）
+	if w.reconciler != nil {
+		go w.runDriftReconcile()
+	}
 
-	// 启动 watch goroutines
-	go w.watchRoutes()
-	go w.watchUpstreams()
+	// 启动 upstream 统计采集（如果启用）
+	if w.upstreamStats != nil {
+		go w.pollUpstreamStats()
+	}
 
 	// 等待信号
 	sigCh := make(chan os.Signal, 1)
@@ -136,17 +470,36 @@ func (w *Watcher) Start() error {
 
 	select {
 	case sig := <-sigCh:
-		log.Printf("Received signal %v, shutting down...", sig)
+		slog.Info("Received signal, shutting down", "signal", sig.String())
+
+		// 先排空正在处理的事件并等待进行中的推送返回，再取消 context，避免 OpenResty 只应用了部分变更。
+		// 两者共用 SHUTDOWN_TIMEOUT
+		shutdownTimeout := w.config.shutdownTimeout
+		deadline := time.Now().Add(shutdownTimeout)
+		w.startDrain()
+		if w.waitDrained(context.Background(), shutdownTimeout) {
+			slog.Info("All pending events drained")
+		}
+		if w.waitInflight(time.Until(deadline)) {
+			slog.Info("All in-flight pushes completed")
+		}
+		w.saveRetryQueue()
+
 		w.cancel()
 		if webhookServer != nil {
 			webhookServer.Stop()
 		}
 	case <-w.ctx.Done():
-		log.Println("Context cancelled, shutting down...")
+		slog.Info("Context cancelled, shutting down")
 		if webhookServer != nil {
 			webhookServer.Stop()
 		}
 	}
+	adminServer.Stop()
+	metricsServer.Stop()
+	probeServer.Stop()
+	w.eventBroadcaster.Shutdown()
+	w.openresty.closeIdle()
 
 	return nil
 }
@@ -175,138 +528,283 @@ func validateCertFiles(certPath, keyPath string) error {
 		return fmt.Errorf("failed to load certificate pair: %v", err)
 	}
 
-	log.Printf("Webhook certificates validated successfully: cert=%s, key=%s", certPath, keyPath)
+	slog.Info("Webhook certificates validated", "certPath", certPath, "keyPath", keyPath)
 	return nil
 }
 
-func (w *Watcher) waitForOpenResty() error {
-	log.Println("Waiting for OpenResty to be ready...")
+// waitForOpenResty 等待 OpenResty 就绪，timeout 为 0 时一直等待直到 ctx 结束。
+// 两次探测之间的间隔从 200ms 开始按指数增长，最长为 OPENRESTY_WAIT_MAX_INTERVAL
+func (w *Watcher) waitForOpenResty(timeout time.Duration) error {
+	slog.Info("Waiting for OpenResty to be ready", "timeout", timeout.String())
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
 
-	timeout := time.After(30 * time.Second)
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
+	interval := 200 * time.Millisecond
+	var (
+		lastStatus int
+		lastErr    error
+	)
+	for attempt := 1; ; attempt++ {
+		lastStatus, lastErr = w.probeOpenResty()
+		if lastErr == nil && lastStatus == http.StatusOK {
+			slog.Info("OpenResty is ready", "attempts", attempt)
+			return nil
+		}
+		slog.Debug("OpenResty not ready yet", "attempt", attempt, "statusCode", lastStatus, "error", lastErr, "nextAttemptIn", interval.String())
 
-	for {
 		select {
-		case <-timeout:
-			return fmt.Errorf("timeout waiting for OpenResty")
-		case <-ticker.C:
-			// 尝试连接 OpenResty health 端点
-			client := &http.Client{Timeout: 2 * time.Second}
-			resp, err := client.Get(openrestyAPIBase + "/")
-			if err == nil && resp.StatusCode == http.StatusOK {
-				resp.Body.Close()
-				log.Println("OpenResty is ready")
-				return nil
-			}
-			if resp != nil {
-				resp.Body.Close()
+		case <-w.ctx.Done():
+			return w.ctx.Err()
+		case <-deadline:
+			slog.Error("Gave up waiting for OpenResty", "timeout", timeout.String(), "attempts", attempt, "lastStatusCode", lastStatus, "lastError", lastErr)
+			if lastErr != nil {
+				return fmt.Errorf("timeout waiting for OpenResty after %s: %v", timeout, lastErr)
 			}
+			return fmt.Errorf("timeout waiting for OpenResty after %s: last status %d", timeout, lastStatus)
+		case <-time.After(interval):
+		}
+
+		interval *= 2
+		if interval > w.config.openrestyWaitMaxInterval {
+			interval = w.config.openrestyWaitMaxInterval
 		}
 	}
 }
 
-func (w *Watcher) syncAll() error {
-	// 同步所有 routes
-	routes, err := w.client.Resource(routeGVR).List(w.ctx, metav1.ListOptions{})
+// probeOpenResty 请求一次 OpenResty 的 health 端点，返回状态码
+func (w *Watcher) probeOpenResty() (int, error) {
+	req, err := http.NewRequestWithContext(w.ctx, "GET", w.openresty.url("/"), nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %v", err)
+	}
+	resp, err := w.openresty.do(req, 2*time.Second)
 	if err != nil {
-		return fmt.Errorf("failed to list routes: %v", err)
+		return 0, err
 	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
 
-	syncErrors := 0
-	for _, route := range routes.Items {
-		if err := w.notifyOpenresty("POST", "/api/routes/update", &route); err != nil {
-			log.Printf("Failed to sync route %s: %v", route.GetName(), err)
-			syncErrors++
+func (w *Watcher) syncAll() error {
+	_, err := w.syncAllWithSummary()
+	return err
+}
+
+// syncSummary 汇总一次全量同步中各类资源的数量和失败数
+type syncSummary struct {
+	Routes    resourceSyncSummary `json:"routes"`
+	Upstreams resourceSyncSummary `json:"upstreams"`
+	// OtherFailures 为启动时 GC、清理 secret 等不属于单个 route/upstream 的失败数
+	OtherFailures int   `json:"otherFailures"`
+	DurationMs    int64 `json:"durationMs"`
+}
+
+type resourceSyncSummary struct {
+	// Total 为本 Pod 负责的对象数，分片模式下不含其他成员的 route
+	Total   int `json:"total"`
+	Synced  int `json:"synced"`
+	Adopted int `json:"adopted"`
+	Failed  int `json:"failed"`
+}
+
+func newResourceSyncSummary(total, failed, adopted int) resourceSyncSummary {
+	return resourceSyncSummary{Total: total, Synced: total - failed, Adopted: adopted, Failed: failed}
+}
+
+// syncAllWithSummary 执行一次全量同步，返回各类资源的同步结果
+func (w *Watcher) syncAllWithSummary() (syncSummary, error) {
+	start := time.Now()
+	var summary syncSummary
+
+	// adopt 模式：获取 OpenResty 当前持有的对象哈希，只推送不一致的对象
+	var remoteRoutes, remoteUpstreams map[string]string
+	if w.adoptOnStartup.Swap(false) {
+		var err error
+		remoteRoutes, remoteUpstreams, err = w.fetchAdoptableHashes()
+		if err != nil {
+			slog.Warn("Failed to fetch OpenResty state for adoption, falling back to full push", "error", err)
+		} else {
+			slog.Info("Adopting existing OpenResty state", "routes", len(remoteRoutes), "upstreams", len(remoteUpstreams))
 		}
 	}
-	log.Printf("Synced %d/%d routes successfully", len(routes.Items)-syncErrors, len(routes.Items))
 
-	// 同步所有 upstreams
-	upstreams, err := w.client.Resource(upstreamGVR).List(w.ctx, metav1.ListOptions{})
+	// 先从 informer 缓存取出全部对象再推送，保证 upstream 与 route 基于同一时刻的快照；
+	// 之后的变更由 informer 事件处理
+	routes, err := w.informers.cachedRoutes()
+	if err != nil {
+		return summary, fmt.Errorf("failed to list routes: %v", err)
+	}
+	upstreams, err := w.informers.cachedUpstreams()
 	if err != nil {
-		return fmt.Errorf("failed to list upstreams: %v", err)
+		return summary, fmt.Errorf("failed to list upstreams: %v", err)
+	}
+	// 默认先同步 upstream（及其 secret）再同步 route，避免 route 短暂引用不存在的 upstream
+	syncRoutes := func() {
+		errs, n := w.syncRoutes(routes, remoteRoutes)
+		summary.Routes = newResourceSyncSummary(len(routes), errs, n)
+	}
+	syncUpstreams := func() {
+		errs, n := w.syncUpstreams(upstreams, remoteUpstreams)
+		summary.Upstreams = newResourceSyncSummary(len(upstreams), errs, n)
+	}
+	if w.syncOrder == syncOrderRoutesFirst {
+		syncRoutes()
+		syncUpstreams()
+	} else {
+		syncUpstreams()
+		syncRoutes()
 	}
+	adopted := summary.Routes.Adopted + summary.Upstreams.Adopted
 
-	for _, upstream := range upstreams.Items {
-		if err := w.notifyOpenresty("POST", "/api/upstreams/update", &upstream); err != nil {
-			log.Printf("Failed to sync upstream %s: %v", upstream.GetName(), err)
-			syncErrors++
-		}
+	if adopted > 0 {
+		slog.Info("Adopted objects already up to date in OpenResty", "count", adopted)
+	}
 
-		// 级联同步 upstream 引用的 secret
-		if err := w.syncUpstreamSecrets(&upstream); err != nil {
-			log.Printf("Failed to sync secrets for upstream %s: %v", upstream.GetName(), err)
-			syncErrors++
+	// 补上 watcher 停机期间错过的删除事件
+	if w.gcOnStartup.Swap(false) {
+		if err := w.collectGarbage(routes, upstreams); err != nil {
+			slog.Error("Startup garbage collection failed", "error", err)
+			summary.OtherFailures++
 		}
 	}
-	log.Printf("Synced %d/%d upstreams successfully", len(upstreams.Items)-syncErrors, len(upstreams.Items))
 
-	if syncErrors > 0 {
-		return fmt.Errorf("failed to sync %d resources", syncErrors)
+	// 清理 OpenResty 中已不再被引用的 secret
+	if err := w.pruneSecrets(); err != nil {
+		slog.Error("Failed to prune unreferenced secrets", "error", err)
+		summary.OtherFailures++
 	}
 
-	return nil
+	summary.DurationMs = time.Since(start).Milliseconds()
+	if syncErrors := summary.Routes.Failed + summary.Upstreams.Failed + summary.OtherFailures; syncErrors > 0 {
+		return summary, fmt.Errorf("failed to sync %d resources", syncErrors)
+	}
+
+	return summary, nil
 }
 
-func (w *Watcher) watchRoutes() {
-	for {
-		select {
-		case <-w.ctx.Done():
-			return
-		default:
-			if err := w.watchResource(routeGVR, "routes"); err != nil {
-				log.Printf("Route watch failed: %v, retrying in 5 seconds...", err)
-				time.Sleep(5 * time.Second)
+// syncRoutes 推送所有 route，返回失败数和 adopt 的数量
+func (w *Watcher) syncRoutes(routes []unstructured.Unstructured, remote map[string]string) (syncErrors, adopted int) {
+	start := time.Now()
+	var pending []*unstructured.Unstructured
+	for i := range routes {
+		route := &routes[i]
+		// watcher 停止期间被删除的 route 仍带着 finalizer，重启后在这里补做清理
+		if route.GetDeletionTimestamp() != nil && hasRouteFinalizer(route) {
+			if err := w.finalizeRoute(nil, route); err != nil {
+				slog.Error("Failed to finalize route", append(objectLogAttrs("routes", route.GetNamespace(), route.GetName()), "error", err)...)
+				syncErrors++
 			}
+			continue
+		}
+		w.ensureRouteFinalizer(route)
+		if !w.checkRouteTLSSecret(route) {
+			syncErrors++
+			continue
+		}
+		if w.adoptIfUnchanged(remote, route) {
+			adopted++
+			continue
 		}
+		pending = append(pending, route)
 	}
-}
 
-func (w *Watcher) watchUpstreams() {
-	for {
-		select {
-		case <-w.ctx.Done():
-			return
-		default:
-			if err := w.watchResource(upstreamGVR, "upstreams"); err != nil {
-				log.Printf("Upstream watch failed: %v, retrying in 5 seconds...", err)
-				time.Sleep(5 * time.Second)
-			}
+	// 需要推送的 route 通过批量接口一次性推送
+	for i, err := range w.bulkUpdate("/api/routes/update", pending) {
+		route := pending[i]
+		w.reportSyncResult(route, err)
+		if err != nil {
+			slog.Error("Failed to sync route", append(objectLogAttrs("routes", route.GetNamespace(), route.GetName()), "error", err)...)
+			syncErrors++
 		}
 	}
+	slog.Info("Synced routes", "resource", "routes", "synced", len(routes)-syncErrors, "total", len(routes),
+		"durationMs", time.Since(start).Milliseconds())
+	return syncErrors, adopted
 }
 
-func (w *Watcher) watchResource(gvr schema.GroupVersionResource, resourceType string) error {
-	log.Printf("Starting watch for %s", resourceType)
+// syncUpstreams 同步所有 upstream 引用的 secret 后再推送 upstream，返回失败数和 adopt 的数量
+func (w *Watcher) syncUpstreams(upstreams []unstructured.Unstructured, remote map[string]string) (syncErrors, adopted int) {
+	start := time.Now()
+	// 先同步 secret，保证 upstream 被标记为 Ready 时凭据已经存在；共享的 secret 只同步一次
+	syncErrors, credentialErrs := w.syncSecretsForUpstreams(upstreams)
+
+	failed := 0
+	var pending []*unstructured.Unstructured
+	for i := range upstreams {
+		upstream := &upstreams[i]
+		secretErr := credentialErrs[objectKey(upstream)]
+		if w.holdBackUpstream(upstream, secretErr) {
+			slog.Warn("Holding back upstream until its credentials are synced", objectLogAttrs("upstreams", upstream.GetNamespace(), upstream.GetName())...)
+			w.setUpstreamReady(upstream, secretErr)
+			failed++
+			continue
+		}
 
-	watchInterface, err := w.client.Resource(gvr).Watch(w.ctx, metav1.ListOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to start watch: %v", err)
+		if w.adoptIfUnchanged(remote, upstream) {
+			adopted++
+			w.setUpstreamReady(upstream, secretErr)
+			continue
+		}
+		pending = append(pending, upstream)
 	}
-	defer watchInterface.Stop()
-
-	for {
-		select {
-		case <-w.ctx.Done():
-			return nil
-		case event, ok := <-watchInterface.ResultChan():
-			if !ok {
-				return fmt.Errorf("watch channel closed")
-			}
 
-			if err := w.handleEvent(event, resourceType); err != nil {
-				log.Printf("Failed to handle %s event: %v", resourceType, err)
-			}
+	for i, err := range w.bulkUpdate("/api/upstreams/update", pending) {
+		upstream := pending[i]
+		w.reportSyncResult(upstream, err)
+		if err != nil {
+			slog.Error("Failed to sync upstream", append(objectLogAttrs("upstreams", upstream.GetNamespace(), upstream.GetName()), "error", err)...)
+			failed++
+			continue
 		}
+		w.setUpstreamReady(upstream, credentialErrs[objectKey(upstream)])
 	}
+	slog.Info("Synced upstreams", "resource", "upstreams", "synced", len(upstreams)-failed, "total", len(upstreams),
+		"durationMs", time.Since(start).Milliseconds())
+
+	return syncErrors + failed, adopted
 }
 
-func (w *Watcher) handleEvent(event watch.Event, resourceType string) error {
+func (w *Watcher) handleEvent(event watch.Event, resourceType string) (err error) {
+	// bookmark 只用于推进 resourceVersion，不代表对象变化。informer 的 reflector 在 watch 请求中
+	// 总是带上 AllowWatchBookmarks，并在内部消费 bookmark 更新 LastSyncResourceVersion，重连时从该版本继续，
+	// 安静的资源也不容易因版本过旧收到 410 Gone；这里只是防止 bookmark 经其他路径到达时被当作变更推送
+	if event.Type == watch.Bookmark {
+		slog.Debug("Ignoring bookmark event", "resource", resourceType)
+		return nil
+	}
+
+	span := w.tracer.start(nil, "handleEvent", spanKindInternal)
+	span.setAttr("ossfe.resource", resourceType)
+	span.setAttr("ossfe.event", string(event.Type))
+	defer func() {
+		result := pushSuccess
+		if err != nil {
+			result = pushFailure
+		}
+		span.setAttr("ossfe.result", result)
+		span.finish(err)
+	}()
+
 	obj, ok := event.Object.(*unstructured.Unstructured)
 	if !ok {
 		return fmt.Errorf("unexpected object type: %T", event.Object)
 	}
+	span.setAttr("k8s.namespace.name", obj.GetNamespace())
+	span.setAttr("ossfe.object", obj.GetName())
+
+	if resourceType == "secrets" {
+		return w.handleTLSSecretEvent(event, obj)
+	}
+	if resourceType == "credentials" {
+		return w.handleCredentialSecretEvent(event, obj)
+	}
+
+	w.updateWatchedObjects(resourceType)
 
 	name := obj.GetName()
 	namespace := obj.GetNamespace()
@@ -314,110 +812,359 @@ func (w *Watcher) handleEvent(event watch.Event, resourceType string) error {
 		namespace = "default"
 	}
 
-	log.Printf("Received %s event for %s %s/%s", event.Type, resourceType, namespace, name)
+	attrs := append(objectLogAttrs(resourceType, namespace, name), "eventType", string(event.Type))
+	slog.Info("Received event", attrs...)
 
-	var endpoint string
+	// 带有 finalizer 的 route 被删除时只会收到设置了 deletionTimestamp 的更新，在这里完成清理
+	if resourceType == "routes" && event.Type != watch.Deleted {
+		if obj.GetDeletionTimestamp() != nil && hasRouteFinalizer(obj) {
+			return w.finalizeRoute(span, obj)
+		}
+		w.ensureRouteFinalizer(obj)
+	}
+
+	var (
+		endpoint  string
+		secretErr error
+	)
 	switch event.Type {
 	case watch.Added, watch.Modified:
 		if resourceType == "routes" {
 			endpoint = "/api/routes/update"
+			if !w.checkRouteTLSSecret(obj) {
+				return nil
+			}
 		} else {
 			endpoint = "/api/upstreams/update"
 		}
 
-		// 对于 upstream 事件，需要级联同步相关的 secret
+		// 对于 upstream 事件，需要先级联同步相关的 secret
 		if resourceType == "upstreams" {
-			if err := w.syncUpstreamSecrets(obj); err != nil {
-				log.Printf("Failed to sync secrets for upstream %s: %v", name, err)
+			if secretErr = w.syncUpstreamSecrets(obj); secretErr != nil {
+				slog.Error("Failed to sync secrets for upstream", append(attrs, "error", secretErr)...)
+				if w.holdBackUpstream(obj, secretErr) {
+					w.setUpstreamReady(obj, secretErr)
+					return fmt.Errorf("holding back upstream %s until its credentials are synced: %v", name, secretErr)
+				}
 			}
 		}
 
 	case watch.Deleted:
 		if resourceType == "routes" {
 			endpoint = "/api/routes/delete"
+			w.tlsWaiting.set(objectKey(obj), "")
 		} else {
 			endpoint = "/api/upstreams/delete"
+			w.trimReleasedSecret(w.unindexUpstreamSecret(objectKey(obj)))
 		}
 	default:
-		log.Printf("Unknown event type: %s", event.Type)
+		slog.Warn("Unknown event type", attrs...)
 		return nil
 	}
 
-	return w.notifyOpenresty("POST", endpoint, obj)
+	err = w.notifyOpenrestyTraced(span, "POST", endpoint, obj)
+	// OpenResty 以 409 表示它已持有更新的版本：用最新版本重试一次，仍冲突则放弃，避免在重试队列中反复推送
+	if isOpenrestyConflict(err) && event.Type != watch.Deleted {
+		latest, retryErr := w.retryAfterConflict(span, resourceType, endpoint, obj, err)
+		if latest == nil {
+			return nil
+		}
+		obj, err = latest, retryErr
+	}
+	// 已删除的对象不再记录 Event
+	if event.Type != watch.Deleted {
+		w.reportSyncResult(obj, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if resourceType == "upstreams" && event.Type != watch.Deleted {
+		w.setUpstreamReady(obj, secretErr)
+	}
+
+	// upstream 变更可能使某些 secret 不再被引用，借助反向索引立即清理
+	if resourceType == "upstreams" {
+		if err := w.pruneSecrets(); err != nil {
+			slog.Error("Failed to prune unreferenced secrets", "error", err)
+		}
+	}
+
+	return nil
 }
 
+// notifyOpenresty 推送对象，记录同步指标并将结果投递到 CloudEvents sink（若已配置）
 func (w *Watcher) notifyOpenresty(method, path string, obj *unstructured.Unstructured) error {
+	return w.notifyOpenrestyTraced(nil, method, path, obj)
+}
+
+// notifyOpenrestyTraced 与 notifyOpenresty 相同，推送的 span 作为 parent（如 handleEvent）的子 span，parent 为 nil 时开始新的 trace
+func (w *Watcher) notifyOpenrestyTraced(parent *span, method, path string, obj *unstructured.Unstructured) (err error) {
+	if !w.inflight.begin() {
+		return errPushesStopped
+	}
+	defer w.inflight.done()
+
+	span := w.tracer.start(parent, "notifyOpenresty", spanKindInternal)
+	span.setAttr("ossfe.resource", syncResource(path))
+	span.setAttr("ossfe.operation", path)
+	defer func() {
+		result := pushSuccess
+		if err != nil {
+			result = pushFailure
+		}
+		span.setAttr("ossfe.result", result)
+		span.finish(err)
+	}()
+
+	if w.dryRun {
+		w.logDryRun(method, path, obj)
+		return nil
+	}
+
+	// 同一次调用的所有重试共用一个请求 ID，便于与 OpenResty 日志对应
+	requestID := newEventID()
+	info := &notifyInfo{parent: span, requestID: requestID}
+	start := time.Now()
+	err = w.notifier.Notify(withNotifyInfo(w.ctx, info), method, path, obj)
+	echoedID := info.responseRequestID
+	duration := time.Since(start)
+	w.metrics.syncDuration.observe(duration.Seconds())
+	w.recordSync(path, err)
+	w.events.emit(path, obj, err)
+
+	attrs := append(objectLogAttrs(syncResource(path), obj.GetNamespace(), obj.GetName()),
+		"method", method, "path", path, "requestId", requestID, "durationMs", duration.Milliseconds())
+	if echoedID != "" {
+		attrs = append(attrs, "responseRequestId", echoedID)
+	}
+	if err != nil {
+		var statusErr *openrestyStatusError
+		if errors.As(err, &statusErr) {
+			attrs = append(attrs, "statusCode", statusErr.StatusCode)
+		}
+		slog.Warn("Push to OpenResty failed", append(attrs, "error", err)...)
+	} else {
+		slog.Debug("Pushed to OpenResty", append(attrs, "statusCode", http.StatusOK)...)
+	}
+	return err
+}
+
+// syncResource 返回 path 中的资源类型，如 /api/routes/update 中的 routes
+func syncResource(path string) string {
+	return strings.Split(strings.TrimPrefix(path, "/api/"), "/")[0]
+}
+
+// recordSync 按 path 中的资源类型（如 /api/routes/update 中的 routes）统计同步结果
+func (w *Watcher) recordSync(path string, err error) {
+	resource := syncResource(path)
+	result := pushSuccess
+	if err != nil {
+		result = pushFailure
+	}
+	w.metrics.syncs.inc(resource, result)
+}
+
+// pushToOpenresty 将对象推送到 OpenResty 内部 API，按 retryPolicy 对可重试的错误进行退避重试。
+// requestID 作为 X-Request-ID 请求头发送，返回最后一次响应中带回的 X-Request-ID（如有）。
+func (w *Watcher) pushToOpenresty(ctx context.Context, method, path string, obj *unstructured.Unstructured, requestID string) (string, error) {
+	isUpdate := strings.HasSuffix(path, "/update")
+
+	// 内容未变且此前已因过大被拒绝的对象不再重复推送
+	if isUpdate && w.oversize.rejected(obj) {
+		return "", fmt.Errorf("%s %s was previously rejected as too large, skipping until it changes", obj.GetKind(), objectKey(obj))
+	}
+
+	for attempt := 1; ; attempt++ {
+		echoedID, err := w.pushOnce(ctx, method, path, obj, requestID)
+		if errors.Is(err, errAlreadyAbsent) {
+			slog.Info("Object was already absent from OpenResty, treating delete as successful",
+				append(objectLogAttrs(syncResource(path), obj.GetNamespace(), obj.GetName()), "path", path)...)
+			w.metrics.pushes.inc(pushAlreadyAbsent)
+			return echoedID, nil
+		}
+		if isUpdate {
+			var oversizeErr *openrestyOversizeError
+			if errors.As(err, &oversizeErr) {
+				w.reportOversize(obj, oversizeErr)
+			} else if err == nil {
+				w.clearOversize(obj)
+			}
+		}
+		if err == nil || attempt >= w.retry.attempts || !w.retry.retriable(err) {
+			if err != nil {
+				w.metrics.pushes.inc(pushFailure)
+			} else {
+				w.metrics.pushes.inc(pushSuccess)
+			}
+			return echoedID, err
+		}
+
+		delay := w.retry.delay(attempt)
+		slog.Warn("Push to OpenResty failed, retrying", append(objectLogAttrs(syncResource(path), obj.GetNamespace(), obj.GetName()),
+			"method", method, "path", path, "attempt", attempt, "maxAttempts", w.retry.attempts, "requestId", requestID, "retryInMs", delay.Milliseconds(), "error", err)...)
+		select {
+		case <-ctx.Done():
+			return echoedID, err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// pushOnce 执行一次推送，成功后更新哈希缓存，返回响应中的 X-Request-ID。每次尝试是 ctx 中父 span 下的一个 client span
+func (w *Watcher) pushOnce(ctx context.Context, method, path string, obj *unstructured.Unstructured, requestID string) (_ string, err error) {
+	span := w.tracer.start(notifyInfoFrom(ctx).parent, method+" "+path, spanKindClient)
+	span.setAttr("http.request.method", method)
+	span.setAttr("url.path", path)
+	defer func() { span.finish(err) }()
+
 	data, err := json.Marshal(obj)
 	if err != nil {
-		return fmt.Errorf("failed to marshal object: %v", err)
+		return "", fmt.Errorf("failed to marshal object: %v", err)
+	}
+
+	if len(data) > w.maxPayloadBytes {
+		return "", &openrestyOversizeError{Size: len(data), Limit: w.maxPayloadBytes}
 	}
 
-	url := openrestyAPIBase + path
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(data))
+	// ctx 为 watcher 的 context，退出时等待推送返回的时间用尽后中止请求
+	req, err := http.NewRequestWithContext(ctx, method, w.openresty.url(path), bytes.NewBuffer(data))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
+		return "", fmt.Errorf("failed to create request: %v", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-API-Key", w.apiKey)
+	w.authorize(req, path, data)
+	span.inject(req)
+	req.Header.Set("X-Request-ID", requestID)
+	epoch := w.nextEpoch()
+	req.Header.Set("X-Sync-Epoch", strconv.FormatUint(epoch, 10))
+	if obj.GetKind() == "OSSProxyRoute" {
+		req.Header.Set("X-Route-Keys", strings.Join(w.routeKeys.keys(obj), ","))
+	}
+	isUpdate := strings.HasSuffix(path, "/update")
+	hash := ""
+	if isUpdate {
+		hash = objectHash(obj)
+		req.Header.Set("X-Object-Hash", hash)
+	}
+
+	resp, err := w.openresty.do(req, 5*time.Second)
+	if err != nil {
+		return "", &openrestyTransportError{Err: err}
+	}
+	defer resp.Body.Close()
+	echoedID := resp.Header.Get("X-Request-ID")
+
+	if resp.StatusCode == http.StatusRequestEntityTooLarge {
+		return echoedID, &openrestyOversizeError{Size: len(data), Limit: w.maxPayloadBytes}
+	}
+	isDelete := strings.HasSuffix(path, "/delete")
+	// OpenResty 在删除本就不存在的对象时同样记录了 epoch
+	if resp.StatusCode == http.StatusOK || (resp.StatusCode == http.StatusNotFound && isDelete) {
+		w.ackEpoch(epoch)
+	}
+	if resp.StatusCode == http.StatusNotFound && isDelete && w.deleteNotFoundOK {
+		w.hashes.remove(hashCacheKey(obj))
+		w.maxAge.remove(hashCacheKey(obj))
+		return echoedID, errAlreadyAbsent
+	}
+	if resp.StatusCode != http.StatusOK {
+		w.reloadKeysOnUnauthorized(resp.StatusCode)
+		statusErr := newOpenrestyStatusError(resp)
+		slog.Warn("OpenResty rejected push", append(objectLogAttrs(syncResource(path), obj.GetNamespace(), obj.GetName()),
+			"method", method, "path", path, "statusCode", resp.StatusCode, "reason", statusErr.Message,
+			"requestId", requestID, "responseRequestId", echoedID, "payload", describeObject(obj))...)
+		return echoedID, statusErr
+	}
+
+	if isUpdate {
+		w.hashes.set(hashCacheKey(obj), hash)
+		w.maxAge.schedule(hashCacheKey(obj))
+	} else if isDelete {
+		w.hashes.remove(hashCacheKey(obj))
+		w.maxAge.remove(hashCacheKey(obj))
+	}
+
+	return echoedID, nil
+}
+
+// fetchOpenresty 以 GET 方式调用 OpenResty 内部 API 并解析 JSON 响应
+func (w *Watcher) fetchOpenresty(path string, out interface{}) error {
+	req, err := http.NewRequest("GET", w.openresty.url(path), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	w.authorize(req, path, nil)
 
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := w.openresty.do(req, 5*time.Second)
 	if err != nil {
 		return fmt.Errorf("failed to make request: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("request failed with status %d", resp.StatusCode)
+		w.reloadKeysOnUnauthorized(resp.StatusCode)
+		return newOpenrestyStatusError(resp)
 	}
 
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
 	return nil
 }
 
 // syncUpstreamSecrets 级联同步 upstream 引用的 secret
 func (w *Watcher) syncUpstreamSecrets(upstream *unstructured.Unstructured) error {
+	// 无论是否引用 secret，都先更新反向索引；upstream 改为引用其他 secret 或不再引用时，裁剪原 secret 中只有它需要的 key
+	w.trimReleasedSecret(w.indexUpstreamSecret(upstream))
+
 	// 提取 secretRef 信息
-	credentials, found, err := unstructured.NestedMap(upstream.Object, "spec", "credentials")
+	secretNamespace, secretName, found, err := upstreamSecretRef(upstream)
 	if err != nil {
-		return fmt.Errorf("failed to get credentials: %v", err)
+		return err
 	}
 	if !found {
-		// 没有配置凭据，不需要同步 secret
+		slog.Debug("Upstream has no credentials secretRef, skipping secret push", objectLogAttrs("upstreams", upstream.GetNamespace(), upstream.GetName())...)
 		return nil
 	}
 
-	secretRef, found, err := unstructured.NestedMap(credentials, "secretRef")
-	if err != nil {
-		return fmt.Errorf("failed to get secretRef: %v", err)
-	}
-	if !found {
-		// 没有引用 secret，不需要同步
-		return nil
-	}
+	slog.Info("Syncing secret for upstream", append(objectLogAttrs("upstreams", upstream.GetNamespace(), upstream.GetName()),
+		"secret", secretNamespace+"/"+secretName)...)
+	return w.syncSecret(secretNamespace, secretName)
+}
 
-	// 获取 secret 名称和命名空间
-	secretName, found, err := unstructured.NestedString(secretRef, "name")
-	if err != nil || !found {
-		return fmt.Errorf("secretRef missing name field")
-	}
+// syncSecret 获取 secret 并推送到 OpenResty，对同一 secret 的并发调用会被合并
+func (w *Watcher) syncSecret(secretNamespace, secretName string) error {
+	return w.secretFlight.do(secretNamespace+"/"+secretName, func() error {
+		return w.pushSecret(secretNamespace, secretName)
+	})
+}
 
-	secretNamespace, found, err := unstructured.NestedString(secretRef, "namespace")
-	if err != nil || !found {
-		// 如果没有指定命名空间，使用 upstream 的命名空间
-		secretNamespace = upstream.GetNamespace()
-		if secretNamespace == "" {
-			secretNamespace = "default"
+// pushSecret 推送 secret 并按结果计入 ossfe_secret_syncs_total
+func (w *Watcher) pushSecret(secretNamespace, secretName string) (err error) {
+	key := secretNamespace + "/" + secretName
+	defer func() {
+		result := pushSuccess
+		if err != nil {
+			result = pushFailure
 		}
-	}
-
-	log.Printf("Syncing secret %s/%s for upstream %s", secretNamespace, secretName, upstream.GetName())
+		w.metrics.secretSyncs.inc(result)
+		slog.Debug("Secret sync finished", "secret", key, "result", result, "dependentUpstreams", w.secrets.upstreamsFor(key))
+	}()
 
 	// 获取 secret
-	secret, err := w.clientset.CoreV1().Secrets(secretNamespace).Get(w.ctx, secretName, metav1.GetOptions{})
-	if err != nil {
+	ctx, cancel := w.apiContext()
+	defer cancel()
+	secret, err := w.clientset.CoreV1().Secrets(secretNamespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err = apiTimeoutError(ctx, err, "getting secret", w.config.apiTimeout); err != nil {
 		return fmt.Errorf("failed to get secret %s/%s: %v", secretNamespace, secretName, err)
 	}
+	// OpenResty 按 Opaque secret 的 key 读取凭据，其他类型（如 kubernetes.io/tls）的 key 通常对不上
+	if secret.Type != "" && secret.Type != corev1.SecretTypeOpaque {
+		slog.Warn("Credential secret is not of type Opaque, OpenResty may not find the expected keys",
+			"secret", key, "type", string(secret.Type), "dependentUpstreams", w.secrets.upstreamsFor(key))
+	}
 
 	// 转换为 unstructured 格式并同步到 Lua
 	secretUnstructured := &unstructured.Unstructured{}
@@ -428,11 +1175,17 @@ func (w *Watcher) syncUpstreamSecrets(upstream *unstructured.Unstructured) error
 	secretUnstructured.SetUID(secret.UID)
 	secretUnstructured.SetResourceVersion(secret.ResourceVersion)
 
-	// 设置 data 字段
+	// 设置 data 字段，引用它的 upstream 都设置了 secretRef.keys 时只推送这些 key。
+	// 值以 base64 编码并用 dataEncoding 标明，string(value) 经 JSON 编码会把非 UTF-8 的二进制值（如 DER 私钥）替换为 U+FFFD
+	secretUnstructured.Object["dataEncoding"] = "base64"
 	if secret.Data != nil {
+		allowed := w.secrets.allowedKeys(key)
 		data := make(map[string]interface{})
-		for key, value := range secret.Data {
-			data[key] = string(value)
+		for dataKey, value := range secret.Data {
+			if allowed != nil && !allowed[dataKey] {
+				continue
+			}
+			data[dataKey] = base64.StdEncoding.EncodeToString(value)
 		}
 		unstructured.SetNestedMap(secretUnstructured.Object, data, "data")
 	}
@@ -441,7 +1194,22 @@ func (w *Watcher) syncUpstreamSecrets(upstream *unstructured.Unstructured) error
 }
 
 func main() {
-	watcher, err := NewWatcher()
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		flag.CommandLine.Parse(os.Args[2:])
+		os.Exit(runAuditCommand())
+	}
+	flag.Parse()
+
+	if err := setupLogging(); err != nil {
+		log.Fatalf("Failed to configure logging: %v", err)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
+	watcher, err := NewWatcher(cfg)
 	if err != nil {
 		log.Fatalf("Failed to create watcher: %v", err)
 	}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+// stubRequest 是 openrestyStub 收到的一次请求
+type stubRequest struct {
+	method string
+	path   string
+	epoch  string
+	body   map[string]interface{}
+}
+
+// openrestyStub 模拟 OpenResty 内部 API：记录收到的推送，POST 按 status 返回（默认 200），
+// GET 返回 responses 中对应 path 的 JSON（不存在时 404）
+type openrestyStub struct {
+	mu        sync.Mutex
+	requests  []stubRequest
+	status    map[string]int
+	responses map[string]interface{}
+}
+
+// newOpenrestyStub 返回不持有任何 secret 的 stub，全量同步结束时清理 secret 需要读取该列表
+func newOpenrestyStub() *openrestyStub {
+	return &openrestyStub{
+		status:    make(map[string]int),
+		responses: map[string]interface{}{"/api/secrets/list": []string{}},
+	}
+}
+
+func (s *openrestyStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, stubRequest{method: r.Method, path: r.URL.Path, epoch: r.Header.Get("X-Sync-Epoch"), body: body})
+	status, hasStatus := s.status[r.URL.Path]
+	response, hasResponse := s.responses[r.URL.Path]
+	s.mu.Unlock()
+
+	w.Header().Set("X-Request-ID", r.Header.Get("X-Request-ID"))
+	if r.Method == http.MethodGet {
+		if !hasResponse {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if hasStatus && status != http.StatusOK {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": http.StatusText(status)})
+		return
+	}
+	w.Write([]byte("{}"))
+}
+
+func (s *openrestyStub) setStatus(path string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status[path] = status
+}
+
+func (s *openrestyStub) setResponse(path string, response interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[path] = response
+}
+
+// posts 返回收到的 POST 请求
+func (s *openrestyStub) posts() []stubRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var posts []stubRequest
+	for _, req := range s.requests {
+		if req.method == http.MethodPost {
+			posts = append(posts, req)
+		}
+	}
+	return posts
+}
+
+// testListKinds 为 fake dynamic client 注册 CRD 的 List 类型
+var testListKinds = map[schema.GroupVersionResource]string{
+	routeGVR:    "OSSProxyRouteList",
+	upstreamGVR: "OSSProxyUpstreamList",
+	secretGVR:   "SecretList",
+}
+
+// newVersionedDynamicClient 返回写入时递增 resourceVersion 的 fake dynamic client。fake 的 object tracker
+// 不维护 resourceVersion，informer 会把 watcher 自己写入的 status/finalizer 当作 resync 再次推送，形成循环。
+// watcher 只使用 merge patch，这里自行应用 patch 以便在存入前设置 resourceVersion。
+func newVersionedDynamicClient() *dynamicfake.FakeDynamicClient {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), testListKinds)
+	tracker := client.Tracker()
+	var version atomic.Int64
+	nextVersion := func() string { return strconv.FormatInt(version.Add(1), 10) }
+
+	client.PrependReactor("create", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		action.(k8stesting.CreateAction).GetObject().(*unstructured.Unstructured).SetResourceVersion(nextVersion())
+		return false, nil, nil
+	})
+	client.PrependReactor("update", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		action.(k8stesting.UpdateAction).GetObject().(*unstructured.Unstructured).SetResourceVersion(nextVersion())
+		return false, nil, nil
+	})
+	client.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		if patch.GetPatchType() != types.MergePatchType {
+			return false, nil, nil
+		}
+		current, err := tracker.Get(patch.GetResource(), patch.GetNamespace(), patch.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		original, err := json.Marshal(current)
+		if err != nil {
+			return true, nil, err
+		}
+		modified, err := jsonpatch.MergePatch(original, patch.GetPatch())
+		if err != nil {
+			return true, nil, err
+		}
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(modified); err != nil {
+			return true, nil, err
+		}
+		obj.SetResourceVersion(nextVersion())
+		return true, obj, tracker.Update(patch.GetResource(), obj, patch.GetNamespace())
+	})
+	return client
+}
+
+// newTestWatcher 构造推送到 stub、使用 fake clientset（预置 kubeObjects）的 Watcher，
+// 只设置推送路径需要的字段，不启动 informer 和任何后台任务
+func newTestWatcher(t *testing.T, stub http.Handler, kubeObjects ...runtime.Object) *Watcher {
+	t.Helper()
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+
+	apiKey := &apiKeyStore{}
+	apiKey.current.Store("test-key")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	client := newVersionedDynamicClient()
+	cfg := &watcherConfig{
+		apiTimeout:         5 * time.Second,
+		webhookAPITimeout:  5 * time.Second,
+		webhookAdmittedTTL: time.Minute,
+
+		webhookUpstreamDeletePolicy: upstreamDeleteBlock,
+	}
+	w := &Watcher{
+		client:                client,
+		clientset:             fake.NewSimpleClientset(kubeObjects...),
+		ctx:                   ctx,
+		cancel:                cancel,
+		config:                cfg,
+		apiKey:                apiKey,
+		openresty:             &openrestyAPI{base: server.URL, httpClient: server.Client()},
+		secrets:               newSecretIndex(),
+		epochGate:             newEpochGate(0, time.Second),
+		shards:                &shardManager{},
+		hashes:                newHashCache(),
+		retry:                 &retryPolicy{attempts: 1, retriableStatus: map[int]bool{}},
+		secretFlight:          newSecretFlight(),
+		tlsWaiting:            newTLSWaitList(),
+		health:                newHealthState(),
+		maxPayloadBytes:       1 << 20,
+		syncConcurrency:       1,
+		secretSyncConcurrency: 2,
+		oversize:              newOversizeTracker(),
+		metrics:               newSyncMetrics(),
+		routeKeys:             &routeKeyConfig{mode: routeKeyHost},
+		recorder:              record.NewFakeRecorder(100),
+		debouncer:             newEventDebouncer(0),
+		informers:             newWatcherInformers(client, 0, nil, &watchSelector{label: labels.Everything(), field: fields.Everything(), credentials: labels.Everything()}),
+	}
+	w.notifier = &httpNotifier{w: w}
+	return w
+}
+
+// createTestObject 在 fake dynamic client 中创建 route/upstream
+func createTestObject(t *testing.T, w *Watcher, gvr schema.GroupVersionResource, obj *unstructured.Unstructured) {
+	t.Helper()
+	if _, err := w.client.Resource(gvr).Namespace(obj.GetNamespace()).Create(context.Background(), obj, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("failed to create %s %s: %v", gvr.Resource, objectKey(obj), err)
+	}
+}
+
+// newTestWebhook 构造使用 w 的 WebhookServer，不监听端口
+func newTestWebhook(w *Watcher) *WebhookServer {
+	ws := NewWebhookServer(w, 0, "", "", nil, nil, nil)
+	w.webhook = ws
+	return ws
+}
+
+// admissionRequest 构造 kind 为 OSSProxyRoute/OSSProxyUpstream 的 AdmissionRequest
+func admissionRequest(t *testing.T, kind string, operation admissionv1.Operation, obj, oldObj *unstructured.Unstructured) *admissionv1.AdmissionRequest {
+	t.Helper()
+	req := &admissionv1.AdmissionRequest{
+		UID:       "uid",
+		Kind:      metav1.GroupVersionKind{Group: "ossfe.imvictor.tech", Version: "v1", Kind: kind},
+		Operation: operation,
+	}
+	if obj != nil {
+		req.Name, req.Namespace = obj.GetName(), obj.GetNamespace()
+		raw, err := obj.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Object.Raw = raw
+	}
+	if oldObj != nil {
+		req.Name, req.Namespace = oldObj.GetName(), oldObj.GetNamespace()
+		raw, err := oldObj.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.OldObject.Raw = raw
+	}
+	return req
+}
+
+// testRoute 构造 spec 为 spec 的 route
+func testRoute(spec map[string]interface{}) *unstructured.Unstructured {
+	route := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "ossfe.imvictor.tech/v1",
+		"kind":       "OSSProxyRoute",
+		"spec":       spec,
+	}}
+	route.SetName("r")
+	route.SetNamespace("web")
+	return route
+}
+
+// routeSpec 返回能通过 webhook 格式校验的 route spec
+func routeSpec(hosts ...string) map[string]interface{} {
+	list := make([]interface{}, 0, len(hosts))
+	for _, host := range hosts {
+		list = append(list, host)
+	}
+	return map[string]interface{}{"bucket": "assets", "hosts": list}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 依赖中没有 Prometheus client，这里实现输出 text exposition format 所需的最小子集。
+// label 的取值必须是有限集合，不要使用 host 等用户输入作为 label。
+
+type metricCollector interface {
+	writeTo(w io.Writer)
+}
+
+// counterVec 是带 label 的计数器，label 可以有多个，inc 时按相同顺序给出取值
+type counterVec struct {
+	mu     sync.Mutex
+	name   string
+	help   string
+	labels []string
+	values map[string]float64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+// labelSep 用于拼接多个 label 取值作为 map 的 key，不会出现在正常的取值中
+const labelSep = "\xff"
+
+func (c *counterVec) inc(labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[strings.Join(labelValues, labelSep)]++
+}
+
+func (c *counterVec) writeTo(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		values := strings.Split(k, labelSep)
+		pairs := make([]string, len(c.labels))
+		for i, label := range c.labels {
+			pairs[i] = fmt.Sprintf("%s=%q", label, values[i])
+		}
+		fmt.Fprintf(w, "%s{%s} %g\n", c.name, strings.Join(pairs, ","), c.values[k])
+	}
+}
+
+// gauge 是不带 label 的瞬时值
+type gauge struct {
+	mu    sync.Mutex
+	name  string
+	help  string
+	value float64
+}
+
+func newGauge(name, help string) *gauge {
+	return &gauge{name: name, help: help}
+}
+
+func (g *gauge) set(v float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.value = v
+}
+
+func (g *gauge) writeTo(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", g.name, g.help, g.name, g.name, g.value)
+}
+
+// gaugeVec 是带 label 的瞬时值，各 label 取值独立设置
+type gaugeVec struct {
+	mu     sync.Mutex
+	name   string
+	help   string
+	label  string
+	values map[string]float64
+}
+
+func newGaugeVec(name, help, label string) *gaugeVec {
+	return &gaugeVec{name: name, help: help, label: label, values: make(map[string]float64)}
+}
+
+func (g *gaugeVec) set(labelValue string, v float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[labelValue] = v
+}
+
+func (g *gaugeVec) writeTo(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+	keys := make([]string, 0, len(g.values))
+	for k := range g.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s=%q} %g\n", g.name, g.label, k, g.values[k])
+	}
+}
+
+// snapshotVec 是带 label 的一组值，每次由外部数据源整体替换，用于转发 OpenResty 侧的统计。
+// typ 为 counter 或 gauge，取决于数据源中该值是否单调递增。
+type snapshotVec struct {
+	mu     sync.Mutex
+	name   string
+	help   string
+	typ    string
+	label  string
+	values map[string]float64
+}
+
+func newSnapshotVec(name, help, typ, label string) *snapshotVec {
+	return &snapshotVec{name: name, help: help, typ: typ, label: label, values: make(map[string]float64)}
+}
+
+// replace 用 values 替换全部现有值，不在 values 中的 label 不再输出
+func (s *snapshotVec) replace(values map[string]float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values = values
+}
+
+func (s *snapshotVec) writeTo(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", s.name, s.help, s.name, s.typ)
+	keys := make([]string, 0, len(s.values))
+	for k := range s.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s=%q} %g\n", s.name, s.label, k, s.values[k])
+	}
+}
+
+// histogram 是固定桶的直方图
+type histogram struct {
+	mu      sync.Mutex
+	name    string
+	help    string
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(name, help string, buckets []float64) *histogram {
+	return &histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) writeTo(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for i, upper := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", h.name, upper, h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %g\n", h.name, h.sum)
+	fmt.Fprintf(w, "%s_count %d\n", h.name, h.count)
+}
+
+// metricsHandler 以 Prometheus text format 输出给定的指标
+func metricsHandler(collectors ...metricCollector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var sb strings.Builder
+		for _, c := range collectors {
+			c.writeTo(&sb)
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		io.WriteString(w, sb.String())
+	}
+}
+
+// webhookMetrics 统计 admission 请求量、拒绝原因以及每个 route 的域名数量
+type webhookMetrics struct {
+	admissions    *counterVec
+	rejections    *counterVec
+	hostsPerRoute *histogram
+	rateLimited   *counterVec
+	// requestsByKind 按 group/version/kind 统计所有 admission 请求，包括 webhook 不处理的类型
+	requestsByKind *counterVec
+}
+
+// 拒绝原因，作为 reason label 的取值
+const (
+	rejectFormat    = "format"
+	rejectSchema    = "schema"
+	rejectPolicy    = "policy"
+	rejectDuplicate = "duplicate"
+	rejectTLS       = "tls"
+	rejectUpstream  = "upstream"
+	rejectSecret    = "secret"
+)
+
+func newWebhookMetrics() *webhookMetrics {
+	return &webhookMetrics{
+		admissions: newCounterVec("ossfe_webhook_admissions_total",
+			"OSSProxyRoute admission requests by operation.", "operation"),
+		rejections: newCounterVec("ossfe_webhook_rejections_total",
+			"Rejected OSSProxyRoute admission requests by reason.", "reason"),
+		hostsPerRoute: newHistogram("ossfe_webhook_hosts_per_route",
+			"Number of hosts in each validated OSSProxyRoute.", []float64{1, 2, 3, 5, 10, 20, 50}),
+		rateLimited: newCounterVec("ossfe_webhook_rate_limited_total",
+			"OSSProxyRoute creations rejected by the per-namespace rate limit.", "namespace"),
+		requestsByKind: newCounterVec("ossfe_webhook_requests_by_kind_total",
+			"Admission requests received by group/version/kind, including kinds the webhook does not handle.", "gvk"),
+	}
+}
+
+func (m *webhookMetrics) collectors() []metricCollector {
+	return []metricCollector{m.admissions, m.rejections, m.hostsPerRoute, m.rateLimited, m.requestsByKind}
+}
+
+// syncMetrics 统计 watcher 向 OpenResty 推送的结果
+type syncMetrics struct {
+	pushes    *counterVec
+	clockSkew *gauge
+
+	// syncs 按资源类型和结果统计每次同步（含重试），syncDuration 为单次同步的耗时
+	syncs        *counterVec
+	syncDuration *histogram
+	// watchReconnects 统计 watch 出错后重新建立的次数，watchedObjects 为各 informer 缓存中的对象数
+	watchReconnects *counterVec
+	watchedObjects  *gaugeVec
+	// reconciles 按触发原因和结果统计全量 reconcile
+	reconciles *counterVec
+	// openrestyHealthy 为后台健康检查看到的 OpenResty 可达状态
+	openrestyHealthy *gauge
+	// secretSyncs 按结果统计 upstream 引用的凭据 secret 的同步（含读取 secret 失败），
+	// secretDependents 为引用每个 secret 的 upstream 数量
+	secretSyncs      *counterVec
+	secretDependents *snapshotVec
+
+	// 从 OpenResty 采集的按 upstream 统计
+	upstreamRequests    *snapshotVec
+	upstreamErrors      *snapshotVec
+	upstreamLatencyMean *snapshotVec
+	upstreamLatencyP50  *snapshotVec
+	upstreamLatencyP99  *snapshotVec
+}
+
+// 推送结果，作为 result label 的取值
+const (
+	pushSuccess       = "success"
+	pushFailure       = "failure"
+	pushAlreadyAbsent = "already_absent"
+)
+
+func newSyncMetrics() *syncMetrics {
+	return &syncMetrics{
+		pushes: newCounterVec("ossfe_watcher_pushes_total",
+			"Pushes to the OpenResty internal API by result.", "result"),
+		clockSkew: newGauge("ossfe_watcher_clock_skew_seconds",
+			"OpenResty clock minus watcher clock, measured at the last probe."),
+		syncs: newCounterVec("ossfe_sync_total",
+			"Syncs of objects to OpenResty by resource type and result.", "resource", "result"),
+		syncDuration: newHistogram("ossfe_sync_duration_seconds",
+			"Time taken to sync a single object to OpenResty, including retries.",
+			[]float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}),
+		watchReconnects: newCounterVec("ossfe_watch_reconnects_total",
+			"Watches re-established after an error, by resource type.", "resource"),
+		watchedObjects: newGaugeVec("ossfe_watched_objects",
+			"Objects currently held in the watch cache, by resource type.", "resource"),
+		reconciles: newCounterVec("ossfe_reconcile_total",
+			"Full reconciles of all objects into OpenResty by trigger and result.", "trigger", "result"),
+		openrestyHealthy: newGauge("ossfe_watcher_openresty_healthy",
+			"Whether the background health check currently reaches OpenResty (1) or not (0)."),
+		secretSyncs: newCounterVec("ossfe_secret_syncs_total",
+			"Syncs of credential secrets referenced by upstreams, by result.", "result"),
+		secretDependents: newSnapshotVec("ossfe_secret_dependent_upstreams",
+			"Number of upstreams referencing each credential secret.", "gauge", "secret"),
+		upstreamRequests: newSnapshotVec("ossfe_upstream_requests_total",
+			"Requests proxied to each upstream, as reported by OpenResty.", "counter", "upstream"),
+		upstreamErrors: newSnapshotVec("ossfe_upstream_errors_total",
+			"Requests to each upstream that returned status >= 400, as reported by OpenResty.", "counter", "upstream"),
+		upstreamLatencyMean: newSnapshotVec("ossfe_upstream_latency_mean_seconds",
+			"Mean request latency of each upstream, as reported by OpenResty.", "gauge", "upstream"),
+		upstreamLatencyP50: newSnapshotVec("ossfe_upstream_latency_p50_seconds",
+			"Approximate median request latency of each upstream, as reported by OpenResty.", "gauge", "upstream"),
+		upstreamLatencyP99: newSnapshotVec("ossfe_upstream_latency_p99_seconds",
+			"Approximate 99th percentile request latency of each upstream, as reported by OpenResty.", "gauge", "upstream"),
+	}
+}
+
+func (m *syncMetrics) collectors() []metricCollector {
+	return []metricCollector{m.pushes, m.clockSkew,
+		m.syncs, m.syncDuration, m.watchReconnects, m.watchedObjects, m.reconciles, m.openrestyHealthy,
+		m.secretSyncs, m.secretDependents,
+		m.upstreamRequests, m.upstreamErrors, m.upstreamLatencyMean, m.upstreamLatencyP50, m.upstreamLatencyP99}
+}
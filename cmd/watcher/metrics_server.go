@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// MetricsServer 在 METRICS_PORT 上以 Prometheus text format 输出 watcher 的同步指标，
+// 不依赖 webhook 是否启用
+type MetricsServer struct {
+	server *http.Server
+}
+
+func NewMetricsServer(watcher *Watcher, port int) *MetricsServer {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", metricsHandler(watcher.metrics.collectors()...))
+
+	return &MetricsServer{
+		server: &http.Server{
+			Addr:    fmt.Sprintf(":%d", port),
+			Handler: mux,
+		},
+	}
+}
+
+func (ms *MetricsServer) Start() error {
+	slog.Info("Starting metrics server", "addr", ms.server.Addr)
+	if err := ms.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (ms *MetricsServer) Stop() error {
+	return ms.server.Shutdown(context.Background())
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// routeDefault 是 route 中一个字段的默认值，path 为字段在对象中的路径
+type routeDefault struct {
+	path  []string
+	value interface{}
+}
+
+// routeDefaults 为 MutatingWebhook 补全的字段。CRD schema 中的 default 只在父对象存在时生效，
+// 例如未写 spec.cache 时不会得到 spec.cache.maxAge，这里补全后 kubectl get -o yaml 能看到实际生效的值。
+// prefix 是相对 bucket 根目录的对象前缀，默认为空而不是 /。
+var routeDefaults = []routeDefault{
+	{[]string{"spec", "prefix"}, ""},
+	{[]string{"spec", "cache", "maxAge"}, int64(3600)},
+}
+
+// jsonPatchOp 是 RFC 6902 JSON Patch 中的一项操作
+type jsonPatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+func (ws *WebhookServer) handleMutate(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("Received mutation request", "remoteAddr", r.RemoteAddr)
+	ws.serveAdmission(w, r, ws.mutate)
+}
+
+// mutate 为 OSSProxyRoute 补全缺失字段的默认值，其他资源类型原样放行
+func (ws *WebhookServer) mutate(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	if req.Kind.Group != "ossfe.imvictor.tech" || req.Kind.Kind != "OSSProxyRoute" {
+		return &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+	}
+
+	var route unstructured.Unstructured
+	if err := json.Unmarshal(req.Object.Raw, &route); err != nil {
+		slog.Error("Failed to unmarshal OSSProxyRoute", append(objectLogAttrs("routes", req.Namespace, req.Name), "error", err)...)
+		return &admissionv1.AdmissionResponse{
+			UID:     req.UID,
+			Allowed: false,
+			Result: &metav1.Status{
+				Message: fmt.Sprintf("Failed to unmarshal OSSProxyRoute: %v", err),
+			},
+		}
+	}
+
+	ops := defaultingPatch(route.Object, routeDefaults)
+	if len(ops) == 0 {
+		return &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+	}
+
+	// Patch 为原始 JSON，序列化 AdmissionReview 时作为 []byte 自动进行 base64 编码
+	patch, err := json.Marshal(ops)
+	if err != nil {
+		slog.Error("Failed to marshal defaulting patch", append(objectLogAttrs("routes", req.Namespace, route.GetName()), "error", err)...)
+		return &admissionv1.AdmissionResponse{
+			UID:     req.UID,
+			Allowed: false,
+			Result: &metav1.Status{
+				Message: fmt.Sprintf("failed to build defaulting patch: %v", err),
+			},
+		}
+	}
+	slog.Info("Defaulting route fields", append(objectLogAttrs("routes", req.Namespace, route.GetName()), "fields", len(ops))...)
+
+	patchType := admissionv1.PatchTypeJSONPatch
+	return &admissionv1.AdmissionResponse{
+		UID:       req.UID,
+		Allowed:   true,
+		Patch:     patch,
+		PatchType: &patchType,
+	}
+}
+
+// defaultingPatch 为 obj 中缺失的字段生成 add 操作。父对象不存在时在第一个缺失的层级添加整个子对象，
+// 多个默认值共用的父对象只添加一次。
+func defaultingPatch(obj map[string]interface{}, defaults []routeDefault) []jsonPatchOp {
+	// 在副本上应用，使后续默认值能看到前面添加的父对象
+	obj = (&unstructured.Unstructured{Object: obj}).DeepCopy().Object
+
+	var ops []jsonPatchOp
+	for _, d := range defaults {
+		current := obj
+		for i, field := range d.path {
+			next, exists := current[field]
+			if !exists {
+				value := d.value
+				for j := len(d.path) - 1; j > i; j-- {
+					value = map[string]interface{}{d.path[j]: value}
+				}
+				current[field] = value
+				ops = append(ops, jsonPatchOp{Op: "add", Path: jsonPointer(d.path[:i+1]), Value: runtime.DeepCopyJSONValue(value)})
+				break
+			}
+			child, ok := next.(map[string]interface{})
+			if !ok {
+				// 字段存在但不是对象（或已是叶子节点），不做修改，交给校验处理
+				break
+			}
+			current = child
+		}
+	}
+	return ops
+}
+
+// jsonPointer 按 RFC 6901 将字段路径转换为 JSON Pointer
+func jsonPointer(path []string) string {
+	var sb strings.Builder
+	for _, field := range path {
+		sb.WriteByte('/')
+		sb.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(field))
+	}
+	return sb.String()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// validateNotFoundBehavior 校验 spec.notFoundBehavior 的组合：
+// passThrough、redirect、document、body 最多设置一个；redirect 只能配合 3xx 状态码；
+// 与 spaApp 同时设置时语义冲突，直接拒绝。
+func validateNotFoundBehavior(route *unstructured.Unstructured) error {
+	behavior, found, err := unstructured.NestedMap(route.Object, "spec", "notFoundBehavior")
+	if err != nil {
+		return fmt.Errorf("spec.notFoundBehavior must be an object: %v", err)
+	}
+	if !found {
+		return nil
+	}
+
+	passThrough, _, err := unstructured.NestedBool(behavior, "passThrough")
+	if err != nil {
+		return fmt.Errorf("spec.notFoundBehavior.passThrough must be a boolean: %v", err)
+	}
+	redirect, _, err := unstructured.NestedString(behavior, "redirect")
+	if err != nil {
+		return fmt.Errorf("spec.notFoundBehavior.redirect must be a string: %v", err)
+	}
+	document, _, err := unstructured.NestedString(behavior, "document")
+	if err != nil {
+		return fmt.Errorf("spec.notFoundBehavior.document must be a string: %v", err)
+	}
+	body, _, err := unstructured.NestedString(behavior, "body")
+	if err != nil {
+		return fmt.Errorf("spec.notFoundBehavior.body must be a string: %v", err)
+	}
+	status, hasStatus, err := unstructured.NestedInt64(behavior, "status")
+	if err != nil {
+		return fmt.Errorf("spec.notFoundBehavior.status must be an integer: %v", err)
+	}
+
+	modes := 0
+	for _, set := range []bool{passThrough, redirect != "", document != "", body != ""} {
+		if set {
+			modes++
+		}
+	}
+	if modes > 1 {
+		return fmt.Errorf("spec.notFoundBehavior: only one of passThrough, redirect, document, body may be set")
+	}
+
+	if spaApp, _, _ := unstructured.NestedBool(route.Object, "spec", "spaApp"); spaApp {
+		return fmt.Errorf("spec.notFoundBehavior cannot be used together with spec.spaApp")
+	}
+
+	if hasStatus {
+		if passThrough {
+			return fmt.Errorf("spec.notFoundBehavior.status cannot be set with passThrough, the upstream status is returned as-is")
+		}
+		if redirect != "" {
+			switch status {
+			case 301, 302, 303, 307, 308:
+			default:
+				return fmt.Errorf("spec.notFoundBehavior.status %d is not a redirect status (301, 302, 303, 307, 308)", status)
+			}
+		} else if status < 200 || status > 599 || (status >= 300 && status < 400) {
+			return fmt.Errorf("spec.notFoundBehavior.status %d must be a 2xx, 4xx or 5xx status", status)
+		}
+	}
+
+	if redirect != "" {
+		u, err := url.Parse(redirect)
+		if err != nil {
+			return fmt.Errorf("spec.notFoundBehavior.redirect is not a valid URL: %v", err)
+		}
+		if u.IsAbs() {
+			if u.Scheme != "http" && u.Scheme != "https" {
+				return fmt.Errorf("spec.notFoundBehavior.redirect must use http or https")
+			}
+		} else if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") {
+			return fmt.Errorf("spec.notFoundBehavior.redirect must be an absolute http(s) URL or a path starting with a single /")
+		}
+	}
+
+	if strings.HasPrefix(document, "/") {
+		return fmt.Errorf("spec.notFoundBehavior.document must be an object key relative to the route prefix, without a leading /")
+	}
+
+	return nil
+}
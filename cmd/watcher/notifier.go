@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Notifier 将单个对象的变更推送到 OpenResty。Watcher 的所有单对象推送（watch 事件、全量同步、secret 级联、GC 等）
+// 都经由 w.notifier 发出，指标、CloudEvents、日志和 dry-run 由 notifyOpenresty 统一处理，Notifier 只负责传输；
+// 测试中可以替换为记录调用序列的实现。批量同步（/api/bulk）和只读查询不经过 Notifier。
+type Notifier interface {
+	Notify(ctx context.Context, method, path string, obj *unstructured.Unstructured) error
+}
+
+// httpNotifier 为默认实现，经由 OpenResty 内部 API 推送，按 retryPolicy 重试并维护哈希缓存
+type httpNotifier struct {
+	w *Watcher
+}
+
+func (n *httpNotifier) Notify(ctx context.Context, method, path string, obj *unstructured.Unstructured) error {
+	info := notifyInfoFrom(ctx)
+	echoedID, err := n.w.pushToOpenresty(ctx, method, path, obj, info.requestID)
+	info.responseRequestID = echoedID
+	return err
+}
+
+// notifyInfo 随 context 传给 Notifier 的调用信息：parent 为推送的父 span，requestID 为同一次推送的所有重试共用的请求 ID，
+// responseRequestID 由 Notifier 回填 OpenResty 响应中带回的 X-Request-ID（如有）
+type notifyInfo struct {
+	parent            *span
+	requestID         string
+	responseRequestID string
+}
+
+type notifyInfoKey struct{}
+
+func withNotifyInfo(ctx context.Context, info *notifyInfo) context.Context {
+	return context.WithValue(ctx, notifyInfoKey{}, info)
+}
+
+// notifyInfoFrom 返回 ctx 中的调用信息，不存在时返回空的 notifyInfo
+func notifyInfoFrom(ctx context.Context) *notifyInfo {
+	if info, ok := ctx.Value(notifyInfoKey{}).(*notifyInfo); ok {
+		return info
+	}
+	return &notifyInfo{}
+}
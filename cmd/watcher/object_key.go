@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// validateCaseInsensitiveKeys 校验 spec.caseInsensitiveKeys 必须是布尔值
+func validateCaseInsensitiveKeys(route *unstructured.Unstructured) error {
+	if _, _, err := unstructured.NestedBool(route.Object, "spec", "caseInsensitiveKeys"); err != nil {
+		return fmt.Errorf("spec.caseInsensitiveKeys must be a boolean: %v", err)
+	}
+	return nil
+}
+
+// spec.trailingSlash 的取值
+const (
+	trailingSlashPreserve = "preserve"
+	trailingSlashStrip    = "strip"
+	trailingSlashAdd      = "add"
+)
+
+// validateTrailingSlash 校验 spec.trailingSlash 必须是 preserve、strip 或 add
+func validateTrailingSlash(route *unstructured.Unstructured) error {
+	mode, found, err := unstructured.NestedString(route.Object, "spec", "trailingSlash")
+	if err != nil {
+		return fmt.Errorf("spec.trailingSlash must be a string: %v", err)
+	}
+	if !found {
+		return nil
+	}
+	switch mode {
+	case trailingSlashPreserve, trailingSlashStrip, trailingSlashAdd:
+		return nil
+	}
+	return fmt.Errorf("spec.trailingSlash '%s' must be one of %s, %s, %s", mode, trailingSlashPreserve, trailingSlashStrip, trailingSlashAdd)
+}
+
+// validateUpstreamPathPrefix 校验 spec.upstreamPathPrefix：不能以 / 开头，不能包含空段、. 或 ..，
+// 也不能包含 ?、# 等会改变请求语义的字符。允许末尾带一个 /。
+func validateUpstreamPathPrefix(route *unstructured.Unstructured) error {
+	prefix, found, err := unstructured.NestedString(route.Object, "spec", "upstreamPathPrefix")
+	if err != nil {
+		return fmt.Errorf("spec.upstreamPathPrefix must be a string: %v", err)
+	}
+	if !found || prefix == "" {
+		return nil
+	}
+
+	if strings.ContainsAny(prefix, "?#\\%") {
+		return fmt.Errorf("spec.upstreamPathPrefix '%s' must not contain '?', '#', '\\' or '%%'", prefix)
+	}
+	for _, r := range prefix {
+		if r < 0x20 || r == 0x7f {
+			return fmt.Errorf("spec.upstreamPathPrefix must not contain control characters")
+		}
+	}
+
+	for i, segment := range strings.Split(strings.TrimSuffix(prefix, "/"), "/") {
+		switch segment {
+		case "":
+			if i == 0 {
+				return fmt.Errorf("spec.upstreamPathPrefix '%s' must start with a non-empty segment", prefix)
+			}
+			return fmt.Errorf("spec.upstreamPathPrefix '%s' must not contain empty segments", prefix)
+		case ".", "..":
+			return fmt.Errorf("spec.upstreamPathPrefix '%s' must not contain '.' or '..' segments", prefix)
+		}
+	}
+	return nil
+}
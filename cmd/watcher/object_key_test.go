@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateUpstreamPathPrefix(t *testing.T) {
+	tests := []struct {
+		prefix  interface{}
+		wantErr string
+	}{
+		{nil, ""},
+		{"", ""},
+		{"assets", ""},
+		{"tenant-a/assets/", ""},
+		{"/assets", "must start with a non-empty segment"},
+		{"a//b", "must not contain empty segments"},
+		{"a/../b", "must not contain '.' or '..' segments"},
+		{"./a", "must not contain '.' or '..' segments"},
+		{"a?b", "must not contain '?'"},
+		{"a%2e", "must not contain '?'"},
+		{"a\tb", "control characters"},
+		{42, "must be a string"},
+	}
+
+	for _, tt := range tests {
+		spec := map[string]interface{}{}
+		if tt.prefix != nil {
+			spec["upstreamPathPrefix"] = tt.prefix
+		}
+		err := validateUpstreamPathPrefix(testRoute(spec))
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("prefix %q: unexpected error: %v", tt.prefix, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("prefix %q: err = %v, want it to contain %q", tt.prefix, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateTrailingSlash(t *testing.T) {
+	tests := []struct {
+		mode    interface{}
+		wantErr bool
+	}{
+		{nil, false},
+		{trailingSlashPreserve, false},
+		{trailingSlashStrip, false},
+		{trailingSlashAdd, false},
+		{"remove", true},
+		{"", true},
+		{true, true},
+	}
+
+	for _, tt := range tests {
+		spec := map[string]interface{}{}
+		if tt.mode != nil {
+			spec["trailingSlash"] = tt.mode
+		}
+		if err := validateTrailingSlash(testRoute(spec)); (err != nil) != tt.wantErr {
+			t.Errorf("trailingSlash %v: err = %v, wantErr %v", tt.mode, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateCaseInsensitiveKeys(t *testing.T) {
+	tests := []struct {
+		value   interface{}
+		wantErr bool
+	}{
+		{nil, false},
+		{true, false},
+		{"true", true},
+	}
+
+	for _, tt := range tests {
+		spec := map[string]interface{}{}
+		if tt.value != nil {
+			spec["caseInsensitiveKeys"] = tt.value
+		}
+		if err := validateCaseInsensitiveKeys(testRoute(spec)); (err != nil) != tt.wantErr {
+			t.Errorf("caseInsensitiveKeys %v: err = %v, wantErr %v", tt.value, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// maxAgeResync 为每个已推送的对象安排一次强制重新推送。即使内容没有变化，OpenResty 侧的状态
+// 也可能因异常而悄然损坏，定期重新推送可以兜底修复。每个对象的到期时间加上随机抖动，
+// 使重新推送分散在一段时间内而不是集中发生。
+type maxAgeResync struct {
+	maxAge time.Duration
+	jitter time.Duration
+
+	mu        sync.Mutex
+	deadlines map[string]time.Time // hashCacheKey -> 到期时间
+}
+
+// maxAgeResyncFromEnv 读取 OBJECT_MAX_AGE（默认 0，不强制重新推送）和
+// OBJECT_MAX_AGE_JITTER（默认为 OBJECT_MAX_AGE 的 10%）
+func maxAgeResyncFromEnv() (*maxAgeResync, error) {
+	maxAge, err := time.ParseDuration(getEnvOrDefault("OBJECT_MAX_AGE", "0"))
+	if err != nil || maxAge < 0 {
+		return nil, fmt.Errorf("invalid OBJECT_MAX_AGE")
+	}
+	if maxAge == 0 {
+		return nil, nil
+	}
+	jitter, err := time.ParseDuration(getEnvOrDefault("OBJECT_MAX_AGE_JITTER", (maxAge / 10).String()))
+	if err != nil || jitter < 0 {
+		return nil, fmt.Errorf("invalid OBJECT_MAX_AGE_JITTER")
+	}
+	return &maxAgeResync{maxAge: maxAge, jitter: jitter, deadlines: make(map[string]time.Time)}, nil
+}
+
+// schedule 在对象推送成功后重新计算其到期时间，nil 接收者表示未启用
+func (m *maxAgeResync) schedule(key string) {
+	if m == nil {
+		return
+	}
+	deadline := time.Now().Add(m.maxAge)
+	if m.jitter > 0 {
+		deadline = deadline.Add(time.Duration(rand.Int63n(int64(m.jitter))))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deadlines[key] = deadline
+}
+
+func (m *maxAgeResync) remove(key string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.deadlines, key)
+}
+
+// due 取出已到期的对象，按 key 排序。取出的对象在重新推送成功后会被重新安排。
+func (m *maxAgeResync) due(now time.Time) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var keys []string
+	for key, deadline := range m.deadlines {
+		if !now.Before(deadline) {
+			keys = append(keys, key)
+			delete(m.deadlines, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// checkInterval 为检查到期对象的间隔，取 maxAge 的 1/10，最长 1 分钟
+func (m *maxAgeResync) checkInterval() time.Duration {
+	interval := m.maxAge / 10
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	if interval < time.Second {
+		interval = time.Second
+	}
+	return interval
+}
+
+// runMaxAgeResync 定期重新推送超过最大存活时间的对象
+func (w *Watcher) runMaxAgeResync() {
+	ticker := time.NewTicker(w.maxAge.checkInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case now := <-ticker.C:
+			if w.draining.Load() {
+				continue
+			}
+			for _, key := range w.maxAge.due(now) {
+				if err := w.resyncAged(key); err != nil {
+					// 下一个周期再试
+					slog.Error("Failed to re-sync aged object", "key", key, "error", err)
+					w.maxAge.schedule(key)
+				}
+			}
+		}
+	}
+}
+
+// resyncAged 从 apiserver 读取对象的最新内容并重新推送，忽略哈希是否一致
+func (w *Watcher) resyncAged(key string) error {
+	kind, objKey, ok := strings.Cut(key, "/")
+	if !ok {
+		return fmt.Errorf("invalid key")
+	}
+	namespace, name := splitObjectKey(objKey)
+
+	if kind == "Secret" {
+		slog.Info("Secret exceeded max age, re-pushing", append(objectLogAttrs("secrets", namespace, name), "maxAge", w.maxAge.maxAge)...)
+		return w.syncSecret(namespace, name)
+	}
+
+	gvr, resourceType := routeGVR, "routes"
+	if kind == "OSSProxyUpstream" {
+		gvr, resourceType = upstreamGVR, "upstreams"
+	} else if kind != "OSSProxyRoute" {
+		return fmt.Errorf("unsupported kind %s", kind)
+	}
+
+	obj, err := w.getObject(gvr, namespace, name)
+	if errors.IsNotFound(err) {
+		// 对象已删除，删除事件会负责清理
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Object exceeded max age, re-pushing", append(objectLogAttrs(resourceType, namespace, name), "maxAge", w.maxAge.maxAge)...)
+	return w.handleEvent(watch.Event{Type: watch.Modified, Object: obj}, resourceType)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMaxAgeResyncDue(t *testing.T) {
+	m := &maxAgeResync{maxAge: time.Hour, jitter: time.Minute, deadlines: make(map[string]time.Time)}
+	start := time.Now()
+	m.schedule("OSSProxyRoute/web/b")
+	m.schedule("OSSProxyRoute/web/a")
+	m.schedule("Secret/web/s")
+	m.remove("Secret/web/s")
+
+	for key, deadline := range m.deadlines {
+		if deadline.Before(start.Add(time.Hour)) || deadline.After(time.Now().Add(time.Hour+time.Minute)) {
+			t.Errorf("%s deadline %s outside [maxAge, maxAge+jitter]", key, deadline.Sub(start))
+		}
+	}
+
+	if due := m.due(start.Add(30 * time.Minute)); len(due) != 0 {
+		t.Errorf("due before max age: %v", due)
+	}
+	want := []string{"OSSProxyRoute/web/a", "OSSProxyRoute/web/b"}
+	if due := m.due(start.Add(2 * time.Hour)); !reflect.DeepEqual(due, want) {
+		t.Errorf("due = %v, want %v", due, want)
+	}
+	if due := m.due(start.Add(2 * time.Hour)); len(due) != 0 {
+		t.Errorf("due objects were not taken: %v", due)
+	}
+
+	var disabled *maxAgeResync
+	disabled.schedule("OSSProxyRoute/web/a")
+	disabled.remove("OSSProxyRoute/web/a")
+}
+
+func TestMaxAgeResyncCheckInterval(t *testing.T) {
+	tests := []struct {
+		maxAge time.Duration
+		want   time.Duration
+	}{
+		{5 * time.Second, time.Second},
+		{5 * time.Minute, 30 * time.Second},
+		{24 * time.Hour, time.Minute},
+	}
+	for _, tt := range tests {
+		m := &maxAgeResync{maxAge: tt.maxAge}
+		if got := m.checkInterval(); got != tt.want {
+			t.Errorf("checkInterval(%s) = %s, want %s", tt.maxAge, got, tt.want)
+		}
+	}
+}
+
+func TestMaxAgeResyncFromEnv(t *testing.T) {
+	tests := []struct {
+		maxAge     string
+		jitter     string
+		wantNil    bool
+		wantErr    bool
+		wantJitter time.Duration
+	}{
+		{"", "", true, false, 0},
+		{"1h", "", false, false, 6 * time.Minute},
+		{"1h", "0", false, false, 0},
+		{"-1h", "", true, true, 0},
+		{"1h", "-1s", true, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.maxAge+"/"+tt.jitter, func(t *testing.T) {
+			if tt.maxAge != "" {
+				t.Setenv("OBJECT_MAX_AGE", tt.maxAge)
+			}
+			if tt.jitter != "" {
+				t.Setenv("OBJECT_MAX_AGE_JITTER", tt.jitter)
+			}
+			m, err := maxAgeResyncFromEnv()
+			if (err != nil) != tt.wantErr || (m == nil) != tt.wantNil {
+				t.Fatalf("got (%v, %v), wantNil %v wantErr %v", m, err, tt.wantNil, tt.wantErr)
+			}
+			if m != nil && m.jitter != tt.wantJitter {
+				t.Errorf("jitter = %s, want %s", m.jitter, tt.wantJitter)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultOpenrestyAPIBase 为 sidecar 部署时同一 Pod 内 OpenResty 内部 API 的地址
+const defaultOpenrestyAPIBase = "http://127.0.0.1:9180"
+
+// openrestyAPI 为 OpenResty 内部 API 的地址与连接设置，所有推送和查询都经由它发出
+type openrestyAPI struct {
+	base string
+	// httpClient 为所有请求共用的 client，超时按请求通过 context 设置，不使用 Client.Timeout
+	httpClient *http.Client
+}
+
+// openrestyAPIFromEnv 读取 OPENRESTY_API_BASE（默认 http://127.0.0.1:9180）、OPENRESTY_API_CA_FILE（兼容 OPENRESTY_CA_FILE）、
+// OPENRESTY_API_CERT_SHA256 和 OPENRESTY_CLIENT_CERT/OPENRESTY_CLIENT_KEY。地址必须是 http 或 https 的绝对 URL；
+// CA 文件、证书指纹和客户端证书只用于 https，CA 为空时使用系统 CA。
+func openrestyAPIFromEnv() (*openrestyAPI, error) {
+	base := strings.TrimRight(getEnvOrDefault("OPENRESTY_API_BASE", defaultOpenrestyAPIBase), "/")
+	parsed, err := url.Parse(base)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OPENRESTY_API_BASE %q: %v", base, err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("invalid OPENRESTY_API_BASE %q: scheme must be http or https", base)
+	}
+	if parsed.Host == "" {
+		return nil, fmt.Errorf("invalid OPENRESTY_API_BASE %q: host must be specified", base)
+	}
+	if parsed.RawQuery != "" || parsed.Fragment != "" {
+		return nil, fmt.Errorf("invalid OPENRESTY_API_BASE %q: must not contain a query or fragment", base)
+	}
+
+	transport, err := openrestyTransportFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := openrestyTLSConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		if parsed.Scheme != "https" {
+			return nil, fmt.Errorf("OPENRESTY_API_CA_FILE, OPENRESTY_API_CERT_SHA256 and OPENRESTY_CLIENT_CERT require an https OPENRESTY_API_BASE")
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &openrestyAPI{base: base, httpClient: &http.Client{Transport: transport}}, nil
+}
+
+// openrestyTransportFromEnv 构造连接池参数可调的 transport。watcher 只访问一个 OpenResty，
+// 默认每个 host 只保留 2 个空闲连接的设置会让全量同步和事件风暴期间频繁建连，因此调大空闲连接上限。
+func openrestyTransportFromEnv() (*http.Transport, error) {
+	maxIdle, err := strconv.Atoi(getEnvOrDefault("OPENRESTY_MAX_IDLE_CONNS_PER_HOST", "32"))
+	if err != nil || maxIdle <= 0 {
+		return nil, fmt.Errorf("invalid OPENRESTY_MAX_IDLE_CONNS_PER_HOST")
+	}
+	idleTimeout, err := time.ParseDuration(getEnvOrDefault("OPENRESTY_IDLE_CONN_TIMEOUT", "90s"))
+	if err != nil || idleTimeout <= 0 {
+		return nil, fmt.Errorf("invalid OPENRESTY_IDLE_CONN_TIMEOUT")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = maxIdle
+	transport.MaxIdleConnsPerHost = maxIdle
+	transport.IdleConnTimeout = idleTimeout
+	return transport, nil
+}
+
+// openrestyTLSConfigFromEnv 按 CA 文件、证书指纹和客户端证书构造访问 OpenResty 的 TLS 配置，都未配置时返回 nil。
+// 指纹为叶子证书 DER 的 SHA-256（十六进制，可带 : 分隔），在常规的证书链校验之外额外比对。
+// 客户端证书用于 mTLS，证书和私钥必须同时设置，启动时加载，无效时拒绝启动。
+func openrestyTLSConfigFromEnv() (*tls.Config, error) {
+	caFile := getEnvOrDefault("OPENRESTY_API_CA_FILE", getEnvOrDefault("OPENRESTY_CA_FILE", ""))
+	fingerprint := strings.ToLower(strings.ReplaceAll(getEnvOrDefault("OPENRESTY_API_CERT_SHA256", ""), ":", ""))
+	clientCert := getEnvOrDefault("OPENRESTY_CLIENT_CERT", "")
+	clientKey := getEnvOrDefault("OPENRESTY_CLIENT_KEY", "")
+	if caFile == "" && fingerprint == "" && clientCert == "" && clientKey == "" {
+		return nil, nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if clientCert != "" || clientKey != "" {
+		if clientCert == "" || clientKey == "" {
+			return nil, fmt.Errorf("OPENRESTY_CLIENT_CERT and OPENRESTY_CLIENT_KEY must be set together")
+		}
+		keyPair, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load OpenResty client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{keyPair}
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read OPENRESTY_API_CA_FILE: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in OPENRESTY_API_CA_FILE %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if fingerprint != "" {
+		decoded, err := hex.DecodeString(fingerprint)
+		if err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("invalid OPENRESTY_API_CERT_SHA256: must be a hex-encoded SHA-256 fingerprint")
+		}
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return fmt.Errorf("OpenResty presented no certificate")
+			}
+			sum := sha256.Sum256(state.PeerCertificates[0].Raw)
+			if hex.EncodeToString(sum[:]) != fingerprint {
+				return fmt.Errorf("OpenResty certificate fingerprint %x does not match OPENRESTY_API_CERT_SHA256", sum)
+			}
+			return nil
+		}
+	}
+	return config, nil
+}
+
+// url 返回内部 API 路径（以 / 开头）的完整地址
+func (a *openrestyAPI) url(path string) string {
+	return a.base + path
+}
+
+// do 使用共享的 client 发出请求，timeout 覆盖从发出请求到读完响应体的整个过程。
+// 超时 context 在响应体关闭时释放，调用方必须关闭 resp.Body。
+func (a *openrestyAPI) do(req *http.Request, timeout time.Duration) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	resp, err := a.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// closeIdle 关闭连接池中的空闲连接，退出时调用
+func (a *openrestyAPI) closeIdle() {
+	a.httpClient.CloseIdleConnections()
+}
+
+// cancelOnClose 在响应体关闭时释放请求的超时 context
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
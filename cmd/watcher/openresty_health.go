@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// runOpenrestyHealthCheck 在初始同步完成后每 OPENRESTY_HEALTH_CHECK_INTERVAL 探测一次 OpenResty 的 /，
+// 连续 OPENRESTY_HEALTH_FAILURE_THRESHOLD 次失败后标记为不健康，/readyz 随之返回 503；
+// 重新探测成功时恢复，并立即执行一次全量同步，补上不可达期间（或 OpenResty 重启后）丢失的配置
+func (w *Watcher) runOpenrestyHealthCheck() {
+	interval := w.config.openrestyHealthInterval
+	threshold := w.config.openrestyHealthFailureThreshold
+	slog.Info("OpenResty health check enabled", "interval", interval.String(), "failureThreshold", threshold)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		status, err := w.probeOpenResty()
+		if err == nil && status == http.StatusOK {
+			failures = 0
+			if !w.openrestyHealthy.Swap(true) {
+				w.metrics.openrestyHealthy.set(1)
+				slog.Info("OpenResty is reachable again, forcing a full resync")
+				w.reconcileAll(reconcileOpenrestyRecovered)
+			}
+			continue
+		}
+
+		failures++
+		slog.Debug("OpenResty health probe failed", "consecutiveFailures", failures, "statusCode", status, "error", err)
+		if failures >= threshold && w.openrestyHealthy.Swap(false) {
+			w.metrics.openrestyHealthy.set(0)
+			slog.Error("OpenResty became unreachable, marking watcher not ready",
+				"consecutiveFailures", failures, "statusCode", status, "error", err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const payloadTooLargeReason = "PayloadTooLarge"
+
+// openrestyOversizeError 表示对象序列化后超过 OpenResty 内部 API 可接受的大小，重试不会成功
+type openrestyOversizeError struct {
+	Size  int
+	Limit int
+}
+
+func (e *openrestyOversizeError) Error() string {
+	if e.Size > 0 {
+		return fmt.Sprintf("payload of %d bytes exceeds OpenResty limit of %d bytes", e.Size, e.Limit)
+	}
+	return fmt.Sprintf("payload rejected by OpenResty as too large (limit %d bytes)", e.Limit)
+}
+
+// maxPayloadBytesFromEnv 读取 OPENRESTY_MAX_PAYLOAD_BYTES，需与 nginx.conf 中 /api/ 的 client_max_body_size 一致
+func maxPayloadBytesFromEnv() (int, error) {
+	limit, err := strconv.Atoi(getEnvOrDefault("OPENRESTY_MAX_PAYLOAD_BYTES", "1048576"))
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("invalid OPENRESTY_MAX_PAYLOAD_BYTES")
+	}
+	return limit, nil
+}
+
+// oversizeTracker 记录因过大而被拒绝的对象及其内容哈希，内容不变时不再重复推送
+type oversizeTracker struct {
+	mu     sync.Mutex
+	hashes map[string]string
+}
+
+func newOversizeTracker() *oversizeTracker {
+	return &oversizeTracker{hashes: make(map[string]string)}
+}
+
+// rejected 判断对象当前的内容此前是否已因过大被拒绝
+func (t *oversizeTracker) rejected(obj *unstructured.Unstructured) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	hash, ok := t.hashes[hashCacheKey(obj)]
+	return ok && hash == objectHash(obj)
+}
+
+func (t *oversizeTracker) mark(obj *unstructured.Unstructured) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hashes[hashCacheKey(obj)] = objectHash(obj)
+}
+
+// clear 移除记录，返回对象此前是否被标记过
+func (t *oversizeTracker) clear(obj *unstructured.Unstructured) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := hashCacheKey(obj)
+	_, ok := t.hashes[key]
+	delete(t.hashes, key)
+	return ok
+}
+
+// reportOversize 记录过大的对象：写入 status condition 并产生一个 Warning Event
+func (w *Watcher) reportOversize(obj *unstructured.Unstructured, err *openrestyOversizeError) {
+	w.oversize.mark(obj)
+
+	message := fmt.Sprintf("%s %s cannot be synced to OpenResty: %v. Reduce the size of the spec (e.g. fewer hosts or smaller maps), or raise client_max_body_size for /api/ in nginx.conf together with OPENRESTY_MAX_PAYLOAD_BYTES",
+		obj.GetKind(), objectKey(obj), err)
+	slog.Error("Object is too large to sync to OpenResty", append(objectLogAttrs(kindLogResource(obj.GetKind()), obj.GetNamespace(), obj.GetName()), "error", err)...)
+
+	if hasCondition(obj, syncedConditionType, payloadTooLargeReason) {
+		return
+	}
+	w.setCondition(obj, syncedConditionType, "False", payloadTooLargeReason, message)
+	w.recordWarningEvent(obj, payloadTooLargeReason, message)
+}
+
+// clearOversize 在对象成功推送后清除之前记录的过大状态
+func (w *Watcher) clearOversize(obj *unstructured.Unstructured) {
+	if w.oversize.clear(obj) || hasCondition(obj, syncedConditionType, payloadTooLargeReason) {
+		w.setCondition(obj, syncedConditionType, "True", "Synced", "Synced to OpenResty")
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// webhookPolicy 是 webhook 的域名策略配置，从 WEBHOOK_POLICY_FILE（YAML 或 JSON）加载
+type webhookPolicy struct {
+	// ReservedHosts 禁止任何 route 使用的域名，支持 *.example.com 形式的后缀
+	ReservedHosts []string `json:"reservedHosts"`
+	// DelegatedSuffixes 域名后缀 -> 允许使用该后缀的命名空间列表
+	DelegatedSuffixes map[string][]string `json:"delegatedSuffixes"`
+	// HostAllowPatterns 非空时，所有域名必须匹配其中至少一个正则
+	HostAllowPatterns []string `json:"hostAllowPatterns"`
+
+	allowPatterns []*regexp.Regexp
+}
+
+// parseWebhookPolicy 解析并校验策略配置，任何错误都会导致整个配置被拒绝
+func parseWebhookPolicy(data []byte) (*webhookPolicy, error) {
+	policy := &webhookPolicy{}
+	if err := yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %v", err)
+	}
+
+	for i, host := range policy.ReservedHosts {
+		if strings.TrimSpace(host) == "" {
+			return nil, fmt.Errorf("reservedHosts[%d] is empty", i)
+		}
+	}
+
+	for suffix, namespaces := range policy.DelegatedSuffixes {
+		if strings.TrimSpace(suffix) == "" {
+			return nil, fmt.Errorf("delegatedSuffixes contains an empty suffix")
+		}
+		if len(namespaces) == 0 {
+			return nil, fmt.Errorf("delegatedSuffixes[%s] must list at least one namespace", suffix)
+		}
+	}
+
+	for i, pattern := range policy.HostAllowPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("hostAllowPatterns[%d] %q: %v", i, pattern, err)
+		}
+		policy.allowPatterns = append(policy.allowPatterns, re)
+	}
+
+	return policy, nil
+}
+
+// checkHosts 按策略校验 route 的域名
+func (p *webhookPolicy) checkHosts(hosts []string, namespace string) error {
+	var problems []string
+	for _, host := range hosts {
+		host = strings.ToLower(host)
+
+		for _, reserved := range p.ReservedHosts {
+			if hostMatchesSuffix(host, strings.ToLower(reserved)) {
+				problems = append(problems, fmt.Sprintf("host '%s' is reserved", host))
+				break
+			}
+		}
+
+		for suffix, namespaces := range p.DelegatedSuffixes {
+			if !hostMatchesSuffix(host, "*."+strings.TrimPrefix(strings.ToLower(suffix), "*.")) {
+				continue
+			}
+			allowed := false
+			for _, ns := range namespaces {
+				if ns == namespace {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				problems = append(problems, fmt.Sprintf("host '%s' is under suffix '%s' which is not delegated to namespace %s", host, suffix, namespace))
+			}
+		}
+
+		if len(p.allowPatterns) > 0 {
+			matched := false
+			for _, re := range p.allowPatterns {
+				if re.MatchString(host) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				problems = append(problems, fmt.Sprintf("host '%s' does not match any allowed pattern", host))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("host policy violation: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// hostMatchesSuffix 判断 host 是否等于 pattern，或 pattern 为 *.suffix 时 host 是 suffix 本身或其任意子域名
+func hostMatchesSuffix(host, pattern string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return host == suffix || strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
+
+// policyStore 持有当前生效的策略，通过 fsnotify 监听文件变化实现热加载，并每 interval 检查一次作为兜底。
+// 新配置校验通过后才原子替换；解析失败时保留旧配置。
+type policyStore struct {
+	path     string
+	interval time.Duration
+	current  atomic.Pointer[webhookPolicy]
+	digest   [sha256.Size]byte
+	// failed 记录最近一次校验失败的内容摘要，避免对同一份坏配置反复报错
+	failed [sha256.Size]byte
+}
+
+func newPolicyStore() (*policyStore, error) {
+	path := os.Getenv("WEBHOOK_POLICY_FILE")
+	if path == "" {
+		return nil, nil
+	}
+
+	interval, err := time.ParseDuration(getEnvOrDefault("WEBHOOK_POLICY_RELOAD_INTERVAL", "10s"))
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("invalid WEBHOOK_POLICY_RELOAD_INTERVAL")
+	}
+
+	ps := &policyStore{path: path, interval: interval}
+	changed, err := ps.reload()
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		slog.Info("Loaded webhook policy", "path", path)
+	}
+	return ps, nil
+}
+
+// get 返回当前生效的策略
+func (ps *policyStore) get() *webhookPolicy {
+	if ps == nil {
+		return nil
+	}
+	return ps.current.Load()
+}
+
+// reload 读取策略文件，内容变化且校验通过时替换当前策略
+func (ps *policyStore) reload() (bool, error) {
+	data, err := os.ReadFile(ps.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read policy file %s: %v", ps.path, err)
+	}
+
+	digest := sha256.Sum256(data)
+	if bytes.Equal(digest[:], ps.digest[:]) && ps.current.Load() != nil {
+		return false, nil
+	}
+	if bytes.Equal(digest[:], ps.failed[:]) {
+		return false, nil
+	}
+
+	policy, err := parseWebhookPolicy(data)
+	if err != nil {
+		ps.failed = digest
+		return false, err
+	}
+
+	ps.current.Store(policy)
+	ps.digest = digest
+	return true, nil
+}
+
+// watch 在策略文件变化时重新加载
+func (ps *policyStore) watch(done <-chan struct{}) {
+	watchFile(done, ps.path, ps.interval, func() {
+		changed, err := ps.reload()
+		if err != nil {
+			slog.Error("Webhook policy reload failed, keeping previous policy", "path", ps.path, "error", err)
+			return
+		}
+		if changed {
+			slog.Info("Reloaded webhook policy", "path", ps.path)
+		}
+	})
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseWebhookPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"empty", ``, ""},
+		{"full", "reservedHosts: [admin.example.com]\ndelegatedSuffixes:\n  team.example.com: [team]\nhostAllowPatterns: ['^[a-z.]+$']\n", ""},
+		{"unknown field", "reservedHost: [a.example.com]\n", "failed to parse policy"},
+		{"empty reserved host", "reservedHosts: [' ']\n", "reservedHosts[0] is empty"},
+		{"suffix without namespaces", "delegatedSuffixes:\n  team.example.com: []\n", "must list at least one namespace"},
+		{"bad pattern", "hostAllowPatterns: ['(']\n", "hostAllowPatterns[0]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseWebhookPolicy([]byte(tt.data))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebhookPolicyCheckHosts(t *testing.T) {
+	policy, err := parseWebhookPolicy([]byte(`
+reservedHosts: [admin.example.com, '*.internal.example.com']
+delegatedSuffixes:
+  team.example.com: [team-a, team-b]
+hostAllowPatterns: ['\.example\.com$']
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		hosts     []string
+		namespace string
+		wantErr   string
+	}{
+		{"allowed", []string{"www.example.com"}, "web", ""},
+		{"reserved exact", []string{"Admin.example.com"}, "web", "host 'admin.example.com' is reserved"},
+		{"reserved suffix", []string{"a.internal.example.com"}, "web", "is reserved"},
+		{"reserved suffix itself", []string{"internal.example.com"}, "web", "is reserved"},
+		{"delegated namespace", []string{"app.team.example.com"}, "team-b", ""},
+		{"not delegated", []string{"app.team.example.com"}, "web", "not delegated to namespace web"},
+		{"pattern mismatch", []string{"www.example.org"}, "web", "does not match any allowed pattern"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.checkHosts(tt.hosts, tt.namespace)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHostMatchesSuffix(t *testing.T) {
+	tests := []struct {
+		host, pattern string
+		want          bool
+	}{
+		{"example.com", "example.com", true},
+		{"www.example.com", "example.com", false},
+		{"www.example.com", "*.example.com", true},
+		{"example.com", "*.example.com", true},
+		{"badexample.com", "*.example.com", false},
+	}
+	for _, tt := range tests {
+		if got := hostMatchesSuffix(tt.host, tt.pattern); got != tt.want {
+			t.Errorf("hostMatchesSuffix(%q, %q) = %v, want %v", tt.host, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyStoreReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	write := func(data string) {
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("reservedHosts: [a.example.com]\n")
+	ps := &policyStore{path: path}
+	if changed, err := ps.reload(); err != nil || !changed {
+		t.Fatalf("initial reload = %v, %v", changed, err)
+	}
+	if changed, err := ps.reload(); err != nil || changed {
+		t.Fatalf("unchanged reload = %v, %v", changed, err)
+	}
+
+	// 无效的配置被拒绝，继续使用旧配置，同一份坏配置不重复报错
+	write("reservedHosts: [' ']\n")
+	if _, err := ps.reload(); err == nil {
+		t.Fatal("expected invalid policy to be rejected")
+	}
+	if _, err := ps.reload(); err != nil {
+		t.Fatalf("same invalid policy reported again: %v", err)
+	}
+	if err := ps.get().checkHosts([]string{"a.example.com"}, "web"); err == nil {
+		t.Fatal("previous policy should still be in effect")
+	}
+
+	write("reservedHosts: [b.example.com]\n")
+	if changed, err := ps.reload(); err != nil || !changed {
+		t.Fatalf("reload after fix = %v, %v", changed, err)
+	}
+	if err := ps.get().checkHosts([]string{"a.example.com"}, "web"); err != nil {
+		t.Fatalf("new policy not in effect: %v", err)
+	}
+}
+
+// TestPolicyStoreWatch 以 ConfigMap 挂载的方式（替换 ..data 符号链接）更新策略文件，轮询间隔足够长，
+// 只有 fsnotify 事件能触发重新加载
+func TestPolicyStoreWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "policy.yaml")
+	version := 0
+	update := func(data string) {
+		version++
+		versionDir := fmt.Sprintf("..v%d", version)
+		if err := os.Mkdir(filepath.Join(dir, versionDir), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, versionDir, "policy.yaml"), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(versionDir, filepath.Join(dir, "..data_tmp")); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	update("reservedHosts: [a.example.com]\n")
+	if err := os.Symlink(filepath.Join("..data", "policy.yaml"), path); err != nil {
+		t.Fatal(err)
+	}
+
+	ps := &policyStore{path: path, interval: time.Hour}
+	if _, err := ps.reload(); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go ps.watch(done)
+	// 等待 watcher 开始监听
+	time.Sleep(100 * time.Millisecond)
+
+	reserved := func(host string) bool {
+		return ps.get().checkHosts([]string{host}, "web") != nil
+	}
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	update("reservedHosts: [b.example.com]\n")
+	waitFor("the updated policy", func() bool { return reserved("b.example.com") && !reserved("a.example.com") })
+
+	// 无效的配置被拒绝，旧配置继续生效；之后的有效配置仍会被加载
+	update("reservedHosts: [' ']\n")
+	time.Sleep(4 * fileWatchDebounce)
+	if !reserved("b.example.com") {
+		t.Fatal("previous policy should still be in effect after an invalid update")
+	}
+	update("reservedHosts: [c.example.com]\n")
+	waitFor("the policy after the invalid one", func() bool { return reserved("c.example.com") && !reserved("b.example.com") })
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// ProbeServer 提供 watcher 自身的存活与就绪检查，供 Kubernetes livenessProbe/readinessProbe 使用
+type ProbeServer struct {
+	server  *http.Server
+	watcher *Watcher
+}
+
+func NewProbeServer(watcher *Watcher, port int) *ProbeServer {
+	mux := http.NewServeMux()
+	ps := &ProbeServer{watcher: watcher}
+
+	mux.HandleFunc("/healthz", ps.handleHealthz)
+	mux.HandleFunc("/readyz", ps.handleReadyz)
+
+	ps.server = &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: mux,
+	}
+	return ps
+}
+
+func (ps *ProbeServer) Start() error {
+	slog.Info("Starting probe server", "addr", ps.server.Addr)
+	if err := ps.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (ps *ProbeServer) Stop() error {
+	return ps.server.Shutdown(context.Background())
+}
+
+// handleHealthz 进程在运行且 context 未取消时返回 200
+func (ps *ProbeServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if ps.watcher.ctx.Err() != nil {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("OK"))
+}
+
+// handleReadyz 初始全量同步已成功完成、route/upstream 的 watch 均已建立且 OpenResty 可达时返回 200
+func (ps *ProbeServer) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case ps.watcher.ctx.Err() != nil:
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+	case !ps.watcher.ready.Load():
+		http.Error(w, "initial sync not completed", http.StatusServiceUnavailable)
+	case !ps.watcher.health.watchesConnected("routes", "upstreams"):
+		http.Error(w, "watches not established", http.StatusServiceUnavailable)
+	case !ps.watcher.openrestyHealthy.Load():
+		http.Error(w, "OpenResty unreachable", http.StatusServiceUnavailable)
+	default:
+		w.Write([]byte("OK"))
+	}
+}
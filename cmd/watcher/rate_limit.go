@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// namespaceRateLimiter 为每个命名空间维护一个令牌桶，限制 route 的创建速率，
+// 防止失控的 controller 在短时间内创建大量 route
+type namespaceRateLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // 每秒补充的令牌数
+	burst   float64
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// namespaceRateLimiterFromEnv 读取 WEBHOOK_ROUTE_CREATE_RATE（每分钟允许创建的 route 数，默认 0 表示不限制）
+// 和 WEBHOOK_ROUTE_CREATE_BURST（突发上限，默认 20）
+func namespaceRateLimiterFromEnv() (*namespaceRateLimiter, error) {
+	perMinute, err := strconv.ParseFloat(getEnvOrDefault("WEBHOOK_ROUTE_CREATE_RATE", "0"), 64)
+	if err != nil || perMinute < 0 {
+		return nil, fmt.Errorf("invalid WEBHOOK_ROUTE_CREATE_RATE")
+	}
+	if perMinute == 0 {
+		return nil, nil
+	}
+
+	burst, err := strconv.Atoi(getEnvOrDefault("WEBHOOK_ROUTE_CREATE_BURST", "20"))
+	if err != nil || burst < 1 {
+		return nil, fmt.Errorf("invalid WEBHOOK_ROUTE_CREATE_BURST")
+	}
+
+	return &namespaceRateLimiter{
+		rate:    perMinute / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}, nil
+}
+
+// allow 从命名空间的令牌桶中取出一个令牌，令牌不足时返回需要等待的时间
+func (l *namespaceRateLimiter) allow(namespace string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.refillLocked(now)
+
+	bucket, ok := l.buckets[namespace]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[namespace] = bucket
+	}
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// refillLocked 按流逝的时间补充所有令牌桶，已补满的桶与不存在等价，直接移除
+func (l *namespaceRateLimiter) refillLocked(now time.Time) {
+	for namespace, bucket := range l.buckets {
+		bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+		bucket.last = now
+		if bucket.tokens >= l.burst {
+			delete(l.buckets, namespace)
+		}
+	}
+}
+
+// writeTo 输出各命名空间当前剩余的令牌数，令牌已补满的命名空间不输出
+func (l *namespaceRateLimiter) writeTo(w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refillLocked(time.Now())
+
+	const name = "ossfe_webhook_route_create_tokens"
+	fmt.Fprintf(w, "# HELP %s Remaining route creation tokens per namespace (namespaces with a full bucket are omitted).\n# TYPE %s gauge\n", name, name)
+	namespaces := make([]string, 0, len(l.buckets))
+	for namespace := range l.buckets {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	for _, namespace := range namespaces {
+		fmt.Fprintf(w, "%s{namespace=%q} %g\n", name, namespace, l.buckets[namespace].tokens)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNamespaceRateLimiterFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		rate     string
+		burst    string
+		wantNil  bool
+		wantErr  bool
+		wantRate float64
+	}{
+		{"disabled by default", "", "", true, false, 0},
+		{"per minute", "30", "", false, false, 0.5},
+		{"negative rate", "-1", "", true, true, 0},
+		{"invalid burst", "30", "0", true, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.rate != "" {
+				t.Setenv("WEBHOOK_ROUTE_CREATE_RATE", tt.rate)
+			}
+			if tt.burst != "" {
+				t.Setenv("WEBHOOK_ROUTE_CREATE_BURST", tt.burst)
+			}
+			l, err := namespaceRateLimiterFromEnv()
+			if (err != nil) != tt.wantErr || (l == nil) != tt.wantNil {
+				t.Fatalf("got (%v, %v), wantNil %v wantErr %v", l, err, tt.wantNil, tt.wantErr)
+			}
+			if l != nil && (l.rate != tt.wantRate || l.burst != 20) {
+				t.Errorf("rate = %g burst = %g, want %g and 20", l.rate, l.burst, tt.wantRate)
+			}
+		})
+	}
+}
+
+func TestNamespaceRateLimiterAllow(t *testing.T) {
+	l := &namespaceRateLimiter{rate: 1, burst: 2, buckets: make(map[string]*tokenBucket)}
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.allow("web"); !ok {
+			t.Fatalf("request %d within the burst was denied", i+1)
+		}
+	}
+	ok, wait := l.allow("web")
+	if ok {
+		t.Fatal("request beyond the burst was allowed")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("wait = %s, want (0, 1s]", wait)
+	}
+	if ok, _ := l.allow("other"); !ok {
+		t.Error("other namespace shares the exhausted bucket")
+	}
+
+	// 模拟流逝 1 秒，补充一个令牌
+	l.buckets["web"].last = l.buckets["web"].last.Add(-time.Second)
+	if ok, _ := l.allow("web"); !ok {
+		t.Error("request after refill was denied")
+	}
+}
+
+func TestNamespaceRateLimiterDropsFullBuckets(t *testing.T) {
+	l := &namespaceRateLimiter{rate: 1, burst: 2, buckets: make(map[string]*tokenBucket)}
+	l.allow("web")
+	l.allow("idle")
+	l.buckets["idle"].last = l.buckets["idle"].last.Add(-time.Minute)
+
+	var buf bytes.Buffer
+	l.writeTo(&buf)
+	out := buf.String()
+	if !strings.Contains(out, `ossfe_webhook_route_create_tokens{namespace="web"}`) {
+		t.Errorf("missing partially used bucket:\n%s", out)
+	}
+	if strings.Contains(out, `namespace="idle"`) {
+		t.Errorf("refilled bucket should be omitted:\n%s", out)
+	}
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("refilled bucket was not removed")
+	}
+}
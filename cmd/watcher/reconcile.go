@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// 触发全量 reconcile 的原因，作为 trigger label 的取值
+const (
+	reconcilePeriodic           = "periodic"
+	reconcileOpenrestyRestart   = "openresty_restart"
+	reconcileOpenrestyRecovered = "openresty_recovered"
+	reconcileManual             = "manual"
+	// reconcileShardRebalance 为分片成员变化后的全量 reconcile
+	reconcileShardRebalance = "shard_rebalance"
+)
+
+// driftReconciler 定期把全部 CR 重新推送到 OpenResty，并在检测到 OpenResty 重启（内存中的配置丢失）时立即推送，
+// 使两侧在没有 CR 变更的情况下也能最终一致
+type driftReconciler struct {
+	// interval 为定期全量 reconcile 的间隔，0 表示不定期执行
+	interval time.Duration
+	// restartCheckInterval 为检查 OpenResty 是否重启的间隔，0 表示不检查
+	restartCheckInterval time.Duration
+
+	// 上一次看到的 OpenResty 实例 ID 与 epoch，实例 ID 变化或 epoch 回退说明 OpenResty 已重启
+	lastInstance string
+	lastEpoch    uint64
+}
+
+// driftReconcilerFromEnv 读取 RECONCILE_INTERVAL（默认 5m）和 OPENRESTY_RESTART_CHECK_INTERVAL（默认 10s），
+// 两者都为 0 时返回 nil
+func driftReconcilerFromEnv() (*driftReconciler, error) {
+	interval, err := time.ParseDuration(getEnvOrDefault("RECONCILE_INTERVAL", "5m"))
+	if err != nil || interval < 0 {
+		return nil, fmt.Errorf("invalid RECONCILE_INTERVAL")
+	}
+	restartCheckInterval, err := time.ParseDuration(getEnvOrDefault("OPENRESTY_RESTART_CHECK_INTERVAL", "10s"))
+	if err != nil || restartCheckInterval < 0 {
+		return nil, fmt.Errorf("invalid OPENRESTY_RESTART_CHECK_INTERVAL")
+	}
+	if interval == 0 && restartCheckInterval == 0 {
+		return nil, nil
+	}
+	return &driftReconciler{interval: interval, restartCheckInterval: restartCheckInterval}, nil
+}
+
+// tickerChan 返回间隔为 d 的 ticker 通道，d 为 0 时返回永不触发的 nil 通道
+func tickerChan(d time.Duration) (<-chan time.Time, func()) {
+	if d <= 0 {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(d)
+	return ticker.C, ticker.Stop
+}
+
+// runDriftReconcile 在初始同步完成后启动
+func (w *Watcher) runDriftReconcile() {
+	r := w.reconciler
+	slog.Info("Drift reconcile enabled", "interval", r.interval.String(), "restartCheckInterval", r.restartCheckInterval.String())
+
+	// 以当前的 OpenResty 实例为基准，之后的变化才视为重启
+	w.openrestyRestarted()
+
+	periodic, stopPeriodic := tickerChan(r.interval)
+	defer stopPeriodic()
+	restartCheck, stopRestartCheck := tickerChan(r.restartCheckInterval)
+	defer stopRestartCheck()
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-periodic:
+			w.reconcileAll(reconcilePeriodic)
+		case <-restartCheck:
+			if w.openrestyRestarted() {
+				w.reconcileAll(reconcileOpenrestyRestart)
+			}
+		}
+	}
+}
+
+// openrestyRestarted 读取 OpenResty 的实例 ID 与 epoch，与上一次相比判断 OpenResty 是否已重启。
+// epoch 在 OpenResty 侧只增不减，只有共享内存被清空（即重启）时才会回退
+func (w *Watcher) openrestyRestarted() bool {
+	r := w.reconciler
+
+	var status epochStatus
+	if err := w.fetchOpenresty("/api/epoch", &status); err != nil {
+		slog.Debug("Failed to fetch OpenResty epoch for restart detection", "error", err)
+		return false
+	}
+
+	restarted := (r.lastInstance != "" && status.Instance != r.lastInstance) || status.Epoch < r.lastEpoch
+	if restarted {
+		slog.Warn("OpenResty restart detected, forcing a full resync",
+			"previousInstance", r.lastInstance, "instance", status.Instance,
+			"previousEpoch", r.lastEpoch, "epoch", status.Epoch)
+	}
+	r.lastInstance, r.lastEpoch = status.Instance, status.Epoch
+	return restarted
+}
+
+// reconcileAll 重新执行一次全量同步。排空期间跳过；上一次尚未结束时不重复执行
+func (w *Watcher) reconcileAll(trigger string) {
+	if w.draining.Load() {
+		return
+	}
+	if !w.reconcileMu.TryLock() {
+		slog.Info("Previous reconcile still running, skipping", "trigger", trigger)
+		return
+	}
+	defer w.reconcileMu.Unlock()
+	w.runReconcile(trigger)
+}
+
+// runReconcile 执行一次全量同步并记录健康状态和指标，调用方需持有 reconcileMu
+func (w *Watcher) runReconcile(trigger string) (syncSummary, error) {
+	start := time.Now()
+	summary, err := w.syncAllWithSummary()
+	w.health.recordSync(err)
+
+	result := pushSuccess
+	if err != nil {
+		result = pushFailure
+		slog.Warn("Drift reconcile failed", "trigger", trigger, "error", err, "durationMs", time.Since(start).Milliseconds())
+	} else {
+		slog.Info("Drift reconcile completed", "trigger", trigger, "durationMs", time.Since(start).Milliseconds())
+	}
+	w.metrics.reconciles.inc(trigger, result)
+	return summary, err
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const redactedValue = "[REDACTED]"
+
+// defaultRedactPaths 是已知可能携带凭据的字段路径
+var defaultRedactPaths = [][]string{
+	{"spec", "credentials", "accessKeyId"},
+	{"spec", "credentials", "secretAccessKey"},
+	{"spec", "credentials", "sessionToken"},
+	{"metadata", "annotations", "kubectl.kubernetes.io/last-applied-configuration"},
+}
+
+// redactPaths 在默认路径基础上追加 LOG_REDACT_PATHS（逗号分隔，字段之间用 . 分隔）
+var redactPaths = loadRedactPaths()
+
+func loadRedactPaths() [][]string {
+	paths := append([][]string{}, defaultRedactPaths...)
+	for _, p := range strings.Split(os.Getenv("LOG_REDACT_PATHS"), ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		paths = append(paths, strings.Split(p, "."))
+	}
+	return paths
+}
+
+// redactObject 返回去除敏感字段后的对象副本，原对象不会被修改。
+// Secret 的 data/stringData 整体替换为只包含 key 的占位值。
+func redactObject(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	if obj == nil {
+		return nil
+	}
+	redacted := obj.DeepCopy()
+
+	if redacted.GetKind() == "Secret" {
+		for _, field := range []string{"data", "stringData"} {
+			data, found, _ := unstructured.NestedMap(redacted.Object, field)
+			if !found {
+				continue
+			}
+			for key := range data {
+				data[key] = redactedValue
+			}
+			unstructured.SetNestedMap(redacted.Object, data, field)
+		}
+	}
+
+	for _, path := range redactPaths {
+		if _, found, _ := unstructured.NestedFieldNoCopy(redacted.Object, path...); found {
+			unstructured.SetNestedField(redacted.Object, redactedValue, path...)
+		}
+	}
+
+	return redacted
+}
+
+// describeObject 返回适合写入日志的对象 JSON，所有对象日志都应通过它输出
+func describeObject(obj *unstructured.Unstructured) string {
+	data, err := json.Marshal(redactObject(obj))
+	if err != nil {
+		return "<unprintable object>"
+	}
+	return string(data)
+}
+
+// maskSecret 只保留长度信息，用于记录密钥类字符串
+func maskSecret(value string) string {
+	if value == "" {
+		return "<empty>"
+	}
+	return fmt.Sprintf("**** (%d chars)", len(value))
+}
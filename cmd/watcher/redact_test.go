@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRedactObject(t *testing.T) {
+	upstream := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "OSSProxyUpstream",
+		"metadata": map[string]interface{}{
+			"name": "u",
+			"annotations": map[string]interface{}{
+				"kubectl.kubernetes.io/last-applied-configuration": `{"spec":{"credentials":{"secretAccessKey":"s3cr3t"}}}`,
+			},
+		},
+		"spec": map[string]interface{}{
+			"endpoint": "https://oss.example.com",
+			"credentials": map[string]interface{}{
+				"accessKeyId":     "AKID",
+				"secretAccessKey": "s3cr3t",
+			},
+		},
+	}}
+	secret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "s"},
+		"data":       map[string]interface{}{"secretAccessKey": "czNjcjN0"},
+		"stringData": map[string]interface{}{"token": "plain"},
+	}}
+
+	tests := []struct {
+		name     string
+		obj      *unstructured.Unstructured
+		hidden   []string
+		retained []string
+	}{
+		{"upstream credentials", upstream, []string{"AKID", "s3cr3t"}, []string{"oss.example.com", "accessKeyId"}},
+		{"secret data", secret, []string{"czNjcjN0", "plain"}, []string{"secretAccessKey", "token"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := describeObjectUnredacted(t, tt.obj)
+			described := describeObject(tt.obj)
+			for _, s := range tt.hidden {
+				if strings.Contains(described, s) {
+					t.Errorf("%q leaked into %s", s, described)
+				}
+			}
+			for _, s := range tt.retained {
+				if !strings.Contains(described, s) {
+					t.Errorf("%q missing from %s", s, described)
+				}
+			}
+			if after := describeObjectUnredacted(t, tt.obj); after != before {
+				t.Errorf("redactObject modified the original object")
+			}
+		})
+	}
+
+	if redactObject(nil) != nil {
+		t.Error("redactObject(nil) should return nil")
+	}
+}
+
+func describeObjectUnredacted(t *testing.T, obj *unstructured.Unstructured) string {
+	t.Helper()
+	data, err := obj.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestLoadRedactPaths(t *testing.T) {
+	t.Setenv("LOG_REDACT_PATHS", " spec.token , ,metadata.labels.owner")
+	paths := loadRedactPaths()
+	if len(paths) != len(defaultRedactPaths)+2 {
+		t.Fatalf("got %d paths, want %d", len(paths), len(defaultRedactPaths)+2)
+	}
+	if got := strings.Join(paths[len(paths)-1], "."); got != "metadata.labels.owner" {
+		t.Errorf("last path = %q", got)
+	}
+}
+
+func TestMaskSecret(t *testing.T) {
+	tests := map[string]string{
+		"":       "<empty>",
+		"abcdef": "**** (6 chars)",
+	}
+	for value, want := range tests {
+		if got := maskSecret(value); got != want {
+			t.Errorf("maskSecret(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxOpenrestyErrorBody 为读取 OpenResty 错误响应体的上限，超出部分截断
+const maxOpenrestyErrorBody = 4096
+
+// openrestyStatusError 表示 OpenResty 返回了非 200 状态码，Message 为响应体中的错误说明（可能为空）
+type openrestyStatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *openrestyStatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("request failed with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("request failed with status %d: %s", e.StatusCode, e.Message)
+}
+
+// newOpenrestyStatusError 读取非 200 响应的响应体（最多 maxOpenrestyErrorBody 字节）作为错误说明。
+// 响应体为 {"error": ..., "detail": ...} 形式的 JSON 时取这两个字段，否则原样使用文本，
+// 使 Lua 侧的校验失败原因能出现在日志和 Kubernetes Event 中
+func newOpenrestyStatusError(resp *http.Response) *openrestyStatusError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxOpenrestyErrorBody+1))
+	truncated := len(body) > maxOpenrestyErrorBody
+	if truncated {
+		body = body[:maxOpenrestyErrorBody]
+	}
+	return &openrestyStatusError{StatusCode: resp.StatusCode, Message: parseOpenrestyError(body, truncated)}
+}
+
+func parseOpenrestyError(body []byte, truncated bool) string {
+	var structured struct {
+		Error  string          `json:"error"`
+		Detail json.RawMessage `json:"detail"`
+	}
+	if !truncated && json.Unmarshal(body, &structured) == nil && structured.Error != "" {
+		var detail string
+		if len(structured.Detail) > 0 && string(structured.Detail) != "null" {
+			if json.Unmarshal(structured.Detail, &detail) != nil {
+				detail = string(structured.Detail)
+			}
+		}
+		if detail == "" {
+			return structured.Error
+		}
+		return structured.Error + ": " + detail
+	}
+
+	message := strings.Join(strings.Fields(string(body)), " ")
+	if truncated && message != "" {
+		message += " ...(truncated)"
+	}
+	return message
+}
+
+// openrestyTransportError 表示请求未能得到响应（连接失败、超时等）
+type openrestyTransportError struct {
+	Err error
+}
+
+func (e *openrestyTransportError) Error() string {
+	return fmt.Sprintf("failed to make request: %v", e.Err)
+}
+
+func (e *openrestyTransportError) Unwrap() error {
+	return e.Err
+}
+
+// retryPolicy 决定推送到 OpenResty 失败时是否重试以及重试几次
+type retryPolicy struct {
+	attempts int
+	backoff  time.Duration
+	// jitter 为退避时间上随机增加的比例，避免 OpenResty 重载后所有推送同时重试
+	jitter          float64
+	retriableStatus map[int]bool
+}
+
+// newRetryPolicy 从环境变量读取重试配置：
+// OPENRESTY_RETRY_ATTEMPTS（总尝试次数，默认 3）、OPENRESTY_RETRY_BACKOFF（首次退避，默认 200ms，之后翻倍）、
+// OPENRESTY_RETRY_JITTER（退避时间上随机增加的比例，0 到 1，默认 0.2）、
+// OPENRESTY_RETRIABLE_STATUS（可重试的状态码，默认 502,503,504）
+func newRetryPolicy() (*retryPolicy, error) {
+	attempts, err := strconv.Atoi(getEnvOrDefault("OPENRESTY_RETRY_ATTEMPTS", "3"))
+	if err != nil || attempts < 1 {
+		return nil, fmt.Errorf("invalid OPENRESTY_RETRY_ATTEMPTS")
+	}
+
+	backoff, err := time.ParseDuration(getEnvOrDefault("OPENRESTY_RETRY_BACKOFF", "200ms"))
+	if err != nil || backoff < 0 {
+		return nil, fmt.Errorf("invalid OPENRESTY_RETRY_BACKOFF")
+	}
+
+	jitter, err := strconv.ParseFloat(getEnvOrDefault("OPENRESTY_RETRY_JITTER", "0.2"), 64)
+	if err != nil || jitter < 0 || jitter > 1 {
+		return nil, fmt.Errorf("invalid OPENRESTY_RETRY_JITTER")
+	}
+
+	statuses, err := parseStatusCodes(getEnvOrDefault("OPENRESTY_RETRIABLE_STATUS", "502,503,504"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OPENRESTY_RETRIABLE_STATUS: %v", err)
+	}
+
+	return &retryPolicy{
+		attempts:        attempts,
+		backoff:         backoff,
+		jitter:          jitter,
+		retriableStatus: statuses,
+	}, nil
+}
+
+// parseStatusCodes 解析逗号分隔的 HTTP 状态码列表，允许为空
+func parseStatusCodes(value string) (map[int]bool, error) {
+	codes := make(map[int]bool)
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		code, err := strconv.Atoi(field)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid status code '%s'", field)
+		}
+		codes[code] = true
+	}
+	return codes, nil
+}
+
+// errAlreadyAbsent 表示删除的对象在 OpenResty 中本就不存在（404），删除是幂等的，不视为失败
+var errAlreadyAbsent = errors.New("object already absent from OpenResty")
+
+// retriable 判断错误是否值得重试：连接类错误总是重试，状态码错误按配置的集合判断，
+// 其他错误（序列化失败等）重试也不会成功
+func (p *retryPolicy) retriable(err error) bool {
+	var statusErr *openrestyStatusError
+	if errors.As(err, &statusErr) {
+		return p.retriableStatus[statusErr.StatusCode]
+	}
+	var transportErr *openrestyTransportError
+	return errors.As(err, &transportErr)
+}
+
+// delay 返回第 attempt 次失败后的退避时间（attempt 从 1 开始），在指数退避的基础上随机增加至多 jitter 比例
+func (p *retryPolicy) delay(attempt int) time.Duration {
+	d := p.backoff << (attempt - 1)
+	if p.jitter > 0 && d > 0 {
+		d += time.Duration(rand.Float64() * p.jitter * float64(d))
+	}
+	return d
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// retryQueueDataKey 为 ConfigMap 中保存待重试事件的 key
+const retryQueueDataKey = "pending.json"
+
+// pendingSync 是一个处理失败、等待重试的事件。更新事件只记录对象的 key，重试时从 apiserver 读取最新内容；
+// 删除事件无法再从 apiserver 读取，保存删除所需的最少字段（不含凭据等 spec 内容）。
+type pendingSync struct {
+	ResourceType string                 `json:"resourceType"`
+	Namespace    string                 `json:"namespace"`
+	Name         string                 `json:"name"`
+	Deleted      bool                   `json:"deleted"`
+	Object       map[string]interface{} `json:"object,omitempty"`
+	FirstFailed  time.Time              `json:"firstFailed"`
+	Attempts     int                    `json:"attempts"`
+	LastError    string                 `json:"lastError"`
+}
+
+func (p *pendingSync) key() string {
+	return p.ResourceType + "/" + p.Namespace + "/" + p.Name
+}
+
+// retryQueue 记录 watch 事件处理失败的对象并定期重试，成功处理同一对象的后续事件时移除。
+// 配置了 ConfigMap 时队列会持久化，Pod 重启后在初始同步完成时恢复，避免失败的删除在重启后丢失。
+type retryQueue struct {
+	interval   time.Duration
+	maxEntries int
+
+	// configMap 为空时不持久化；写入最多每 flushInterval 一次
+	configMap     string
+	namespace     string
+	flushInterval time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*pendingSync
+	dirty   bool
+}
+
+// retryQueueFromEnv 读取 RETRY_QUEUE_INTERVAL（默认 30s）、RETRY_QUEUE_MAX_ENTRIES（默认 500）、
+// RETRY_QUEUE_CONFIGMAP（默认为空，不持久化）和 RETRY_QUEUE_FLUSH_INTERVAL（默认 10s）
+func retryQueueFromEnv() (*retryQueue, error) {
+	interval, err := time.ParseDuration(getEnvOrDefault("RETRY_QUEUE_INTERVAL", "30s"))
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("invalid RETRY_QUEUE_INTERVAL")
+	}
+	maxEntries, err := strconv.Atoi(getEnvOrDefault("RETRY_QUEUE_MAX_ENTRIES", "500"))
+	if err != nil || maxEntries <= 0 {
+		return nil, fmt.Errorf("invalid RETRY_QUEUE_MAX_ENTRIES")
+	}
+	flushInterval, err := time.ParseDuration(getEnvOrDefault("RETRY_QUEUE_FLUSH_INTERVAL", "10s"))
+	if err != nil || flushInterval <= 0 {
+		return nil, fmt.Errorf("invalid RETRY_QUEUE_FLUSH_INTERVAL")
+	}
+
+	return &retryQueue{
+		interval:      interval,
+		maxEntries:    maxEntries,
+		configMap:     getEnvOrDefault("RETRY_QUEUE_CONFIGMAP", ""),
+		namespace:     getEnvOrDefault("POD_NAMESPACE", "default"),
+		flushInterval: flushInterval,
+		entries:       make(map[string]*pendingSync),
+	}, nil
+}
+
+// deletedObjectStub 保留删除对象时 OpenResty 需要的字段：name、namespace、labels，以及 route 的域名
+func deletedObjectStub(obj *unstructured.Unstructured) map[string]interface{} {
+	stub := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	stub.SetAPIVersion(obj.GetAPIVersion())
+	stub.SetKind(obj.GetKind())
+	stub.SetName(obj.GetName())
+	stub.SetNamespace(obj.GetNamespace())
+	stub.SetLabels(obj.GetLabels())
+	if hosts, found, _ := unstructured.NestedStringSlice(obj.Object, "spec", "hosts"); found {
+		unstructured.SetNestedStringSlice(stub.Object, hosts, "spec", "hosts")
+	}
+	return stub.Object
+}
+
+// record 记录一次处理失败。同一对象只保留最新的事件；超过上限时淘汰最早失败的条目。
+func (q *retryQueue) record(resourceType string, eventType watch.EventType, obj *unstructured.Unstructured, err error) {
+	entry := &pendingSync{
+		ResourceType: resourceType,
+		Namespace:    obj.GetNamespace(),
+		Name:         obj.GetName(),
+		Deleted:      eventType == watch.Deleted,
+		FirstFailed:  time.Now(),
+		LastError:    err.Error(),
+	}
+	if entry.Deleted {
+		entry.Object = deletedObjectStub(obj)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if existing, ok := q.entries[entry.key()]; ok {
+		entry.FirstFailed = existing.FirstFailed
+		entry.Attempts = existing.Attempts
+	}
+	q.entries[entry.key()] = entry
+	q.evictLocked()
+	q.dirty = true
+}
+
+// evictLocked 按 FirstFailed 淘汰最早的条目直到不超过上限
+func (q *retryQueue) evictLocked() {
+	for len(q.entries) > q.maxEntries {
+		var oldest *pendingSync
+		for _, entry := range q.entries {
+			if oldest == nil || entry.FirstFailed.Before(oldest.FirstFailed) {
+				oldest = entry
+			}
+		}
+		slog.Warn("Retry queue is full, dropping oldest entry", append(objectLogAttrs(oldest.ResourceType, oldest.Namespace, oldest.Name), "firstFailed", oldest.FirstFailed)...)
+		delete(q.entries, oldest.key())
+	}
+}
+
+// done 在对象的事件处理成功后移除其待重试条目
+func (q *retryQueue) done(resourceType string, obj *unstructured.Unstructured) {
+	q.remove(resourceType + "/" + obj.GetNamespace() + "/" + obj.GetName())
+}
+
+func (q *retryQueue) remove(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.entries[key]; ok {
+		delete(q.entries, key)
+		q.dirty = true
+	}
+}
+
+// snapshot 返回按 FirstFailed 排序的条目副本
+func (q *retryQueue) snapshot() []pendingSync {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entries := make([]pendingSync, 0, len(q.entries))
+	for _, entry := range q.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].FirstFailed.Before(entries[j].FirstFailed)
+	})
+	return entries
+}
+
+// failed 记录一次重试失败
+func (q *retryQueue) failed(key string, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if entry, ok := q.entries[key]; ok {
+		entry.Attempts++
+		entry.LastError = err.Error()
+		q.dirty = true
+	}
+}
+
+// loadRetryQueue 从 ConfigMap 恢复上次保存的队列
+func (w *Watcher) loadRetryQueue() error {
+	q := w.retryQueue
+	if q.configMap == "" {
+		return nil
+	}
+
+	ctx, cancel := w.apiContext()
+	defer cancel()
+	cm, err := w.clientset.CoreV1().ConfigMaps(q.namespace).Get(ctx, q.configMap, metav1.GetOptions{})
+	err = apiTimeoutError(ctx, err, "getting retry queue ConfigMap", w.config.apiTimeout)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get retry queue ConfigMap %s/%s: %v", q.namespace, q.configMap, err)
+	}
+
+	var entries []pendingSync
+	if data := cm.Data[retryQueueDataKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &entries); err != nil {
+			return fmt.Errorf("failed to decode retry queue: %v", err)
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := range entries {
+		entry := entries[i]
+		q.entries[entry.key()] = &entry
+	}
+	q.evictLocked()
+	if len(entries) > 0 {
+		slog.Info("Restored pending retries", "count", len(q.entries), "namespace", q.namespace, "configMap", q.configMap)
+	}
+	return nil
+}
+
+// flushRetryQueue 在队列有变化时写入 ConfigMap
+func (w *Watcher) flushRetryQueue(ctx context.Context) error {
+	q := w.retryQueue
+
+	q.mu.Lock()
+	if !q.dirty {
+		q.mu.Unlock()
+		return nil
+	}
+	q.dirty = false
+	q.mu.Unlock()
+
+	data, err := json.Marshal(q.snapshot())
+	if err != nil {
+		return fmt.Errorf("failed to encode retry queue: %v", err)
+	}
+
+	configMaps := w.clientset.CoreV1().ConfigMaps(q.namespace)
+	cm, err := configMaps.Get(ctx, q.configMap, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: q.configMap, Namespace: q.namespace},
+			Data:       map[string]string{retryQueueDataKey: string(data)},
+		}
+		_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+	} else if err == nil {
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[retryQueueDataKey] = string(data)
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		// 下一个周期再写
+		q.mu.Lock()
+		q.dirty = true
+		q.mu.Unlock()
+		return fmt.Errorf("failed to save retry queue to ConfigMap %s/%s: %v", q.namespace, q.configMap, err)
+	}
+	return nil
+}
+
+// retryPending 重新处理一个待重试的事件
+func (w *Watcher) retryPending(entry pendingSync) error {
+	if entry.Deleted {
+		obj := &unstructured.Unstructured{Object: entry.Object}
+		return w.handleEvent(watch.Event{Type: watch.Deleted, Object: obj}, entry.ResourceType)
+	}
+
+	gvr := routeGVR
+	if entry.ResourceType == "upstreams" {
+		gvr = upstreamGVR
+	}
+	obj, err := w.getObject(gvr, entry.Namespace, entry.Name)
+	if errors.IsNotFound(err) {
+		// 对象已被删除，之后的删除事件会负责清理
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return w.handleEvent(watch.Event{Type: watch.Modified, Object: obj}, entry.ResourceType)
+}
+
+// processRetryQueue 依次重试所有待处理的事件
+func (w *Watcher) processRetryQueue() {
+	for _, entry := range w.retryQueue.snapshot() {
+		if w.ctx.Err() != nil || w.draining.Load() {
+			return
+		}
+
+		w.pending.Add(1)
+		err := w.retryPending(entry)
+		w.pending.Add(-1)
+		if err != nil {
+			slog.Warn("Retry failed", append(objectLogAttrs(entry.ResourceType, entry.Namespace, entry.Name), "attempt", entry.Attempts+1, "error", err)...)
+			w.retryQueue.failed(entry.key(), err)
+			continue
+		}
+
+		slog.Info("Retry succeeded", objectLogAttrs(entry.ResourceType, entry.Namespace, entry.Name)...)
+		w.retryQueue.remove(entry.key())
+	}
+}
+
+// saveRetryQueue 在退出前保存队列的最新状态。此时 w.ctx 已结束，单独计算超时。
+func (w *Watcher) saveRetryQueue() {
+	if w.retryQueue.configMap == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), w.config.apiTimeout)
+	defer cancel()
+	if err := w.flushRetryQueue(ctx); err != nil {
+		slog.Error("Failed to save retry queue", "error", err)
+	}
+}
+
+// runRetryQueue 在初始同步后立即处理一次恢复的队列，之后按 interval 重试，并按 flushInterval 持久化
+func (w *Watcher) runRetryQueue() {
+	w.processRetryQueue()
+
+	retryTicker := time.NewTicker(w.retryQueue.interval)
+	defer retryTicker.Stop()
+
+	var flushC <-chan time.Time
+	if w.retryQueue.configMap != "" {
+		flushTicker := time.NewTicker(w.retryQueue.flushInterval)
+		defer flushTicker.Stop()
+		flushC = flushTicker.C
+	}
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-retryTicker.C:
+			w.processRetryQueue()
+		case <-flushC:
+			ctx, cancel := w.apiContext()
+			if err := w.flushRetryQueue(ctx); err != nil {
+				slog.Error("Failed to save retry queue", "error", err)
+			}
+			cancel()
+		}
+	}
+}
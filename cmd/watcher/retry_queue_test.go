@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func newTestRetryQueue(maxEntries int) *retryQueue {
+	return &retryQueue{
+		interval:   time.Minute,
+		maxEntries: maxEntries,
+		namespace:  "ossfe",
+		entries:    make(map[string]*pendingSync),
+	}
+}
+
+func TestRetryQueueRecord(t *testing.T) {
+	q := newTestRetryQueue(2)
+	route := testRoute(map[string]interface{}{
+		"hosts":       []interface{}{"a.example.com"},
+		"credentials": map[string]interface{}{"accessKeySecret": "s3cr3t"},
+	})
+	route.SetLabels(map[string]string{"team": "web"})
+
+	q.record("routes", watch.Modified, route, errors.New("first"))
+	first := q.snapshot()[0].FirstFailed
+	q.failed("routes/web/r", errors.New("retry failed"))
+	q.record("routes", watch.Deleted, route, errors.New("second"))
+
+	entries := q.snapshot()
+	if len(entries) != 1 {
+		t.Fatalf("entries = %+v, want the latest event only", entries)
+	}
+	entry := entries[0]
+	if !entry.Deleted || entry.LastError != "second" || entry.Attempts != 1 || !entry.FirstFailed.Equal(first) {
+		t.Errorf("entry = %+v, want the delete keeping FirstFailed and Attempts", entry)
+	}
+
+	// 删除事件只保留 OpenResty 需要的字段，不保存凭据
+	stub := &unstructured.Unstructured{Object: entry.Object}
+	hosts, _, _ := unstructured.NestedStringSlice(stub.Object, "spec", "hosts")
+	if _, found, _ := unstructured.NestedFieldNoCopy(stub.Object, "spec", "credentials"); found {
+		t.Error("deleted object stub kept spec.credentials")
+	}
+	if stub.GetName() != "r" || stub.GetLabels()["team"] != "web" || !reflect.DeepEqual(hosts, []string{"a.example.com"}) {
+		t.Errorf("deleted object stub = %v", stub.Object)
+	}
+
+	q.done("routes", route)
+	if n := len(q.snapshot()); n != 0 {
+		t.Errorf("done left %d entries", n)
+	}
+}
+
+func TestRetryQueueEvictsOldest(t *testing.T) {
+	q := newTestRetryQueue(2)
+	for _, name := range []string{"a", "b", "c"} {
+		route := testRoute(nil)
+		route.SetName(name)
+		q.record("routes", watch.Modified, route, errors.New("failed"))
+		time.Sleep(time.Millisecond)
+	}
+
+	var keys []string
+	for _, entry := range q.snapshot() {
+		keys = append(keys, entry.key())
+	}
+	if want := []string{"routes/web/b", "routes/web/c"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+}
+
+func TestRetryQueuePersistence(t *testing.T) {
+	w := newTestWatcher(t, newOpenrestyStub())
+	w.retryQueue = newTestRetryQueue(10)
+	w.retryQueue.configMap = "watcher-retry"
+
+	route := testRoute(routeSpec("a.example.com"))
+	w.retryQueue.record("routes", watch.Deleted, route, errors.New("unavailable"))
+	upstream := newStubObject("OSSProxyUpstream", "web/u")
+	w.retryQueue.record("upstreams", watch.Modified, upstream, errors.New("unavailable"))
+
+	// 第一次写入创建 ConfigMap，之后更新
+	for i := 0; i < 2; i++ {
+		if err := w.flushRetryQueue(context.Background()); err != nil {
+			t.Fatalf("flush %d: %v", i, err)
+		}
+		w.retryQueue.dirty = true
+	}
+	cm, err := w.clientset.CoreV1().ConfigMaps("ossfe").Get(context.Background(), "watcher-retry", metav1.GetOptions{})
+	if err != nil || cm.Data[retryQueueDataKey] == "" {
+		t.Fatalf("ConfigMap not written: %v", err)
+	}
+
+	restored := newTestWatcher(t, newOpenrestyStub(), cm)
+	restored.retryQueue = newTestRetryQueue(10)
+	restored.retryQueue.configMap = "watcher-retry"
+	if err := restored.loadRetryQueue(); err != nil {
+		t.Fatalf("loadRetryQueue: %v", err)
+	}
+
+	got, want := restored.retryQueue.snapshot(), w.retryQueue.snapshot()
+	if len(got) != len(want) {
+		t.Fatalf("restored %d entries, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].key() != want[i].key() || got[i].Deleted != want[i].Deleted || !got[i].FirstFailed.Equal(want[i].FirstFailed) {
+			t.Errorf("entry %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
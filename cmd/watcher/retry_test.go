@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStatusCodes(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []int
+		wantErr bool
+	}{
+		{"502,503,504", []int{502, 503, 504}, false},
+		{" 429 , ,500", []int{429, 500}, false},
+		{"", nil, false},
+		{"5xx", nil, true},
+		{"99", nil, true},
+		{"600", nil, true},
+	}
+
+	for _, tt := range tests {
+		codes, err := parseStatusCodes(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseStatusCodes(%q) err = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if len(codes) != len(tt.want) {
+			t.Errorf("parseStatusCodes(%q) = %v, want %v", tt.value, codes, tt.want)
+		}
+		for _, code := range tt.want {
+			if !codes[code] {
+				t.Errorf("parseStatusCodes(%q) missing %d", tt.value, code)
+			}
+		}
+	}
+}
+
+func TestRetryPolicyRetriable(t *testing.T) {
+	p := &retryPolicy{retriableStatus: map[int]bool{503: true}}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"retriable status", &openrestyStatusError{StatusCode: 503}, true},
+		{"other status", &openrestyStatusError{StatusCode: 400}, false},
+		{"wrapped status", fmt.Errorf("push: %w", &openrestyStatusError{StatusCode: 503}), true},
+		{"transport", &openrestyTransportError{Err: errors.New("connection refused")}, true},
+		{"other", errors.New("failed to marshal object"), false},
+		{"oversize", &openrestyOversizeError{Size: 2, Limit: 1}, false},
+	}
+
+	for _, tt := range tests {
+		if got := p.retriable(tt.err); got != tt.want {
+			t.Errorf("%s: retriable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := &retryPolicy{backoff: 100 * time.Millisecond, jitter: 0.5}
+	for attempt := 1; attempt <= 4; attempt++ {
+		base := p.backoff << (attempt - 1)
+		for i := 0; i < 20; i++ {
+			d := p.delay(attempt)
+			if d < base || d > base+base/2 {
+				t.Fatalf("delay(%d) = %s, want within [%s, %s]", attempt, d, base, base+base/2)
+			}
+		}
+	}
+
+	p.jitter = 0
+	if d := p.delay(3); d != 400*time.Millisecond {
+		t.Errorf("delay without jitter = %s, want 400ms", d)
+	}
+}
+
+func TestNewRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{"defaults", nil, ""},
+		{"zero attempts", map[string]string{"OPENRESTY_RETRY_ATTEMPTS": "0"}, "OPENRESTY_RETRY_ATTEMPTS"},
+		{"negative backoff", map[string]string{"OPENRESTY_RETRY_BACKOFF": "-1s"}, "OPENRESTY_RETRY_BACKOFF"},
+		{"jitter above one", map[string]string{"OPENRESTY_RETRY_JITTER": "1.5"}, "OPENRESTY_RETRY_JITTER"},
+		{"bad status", map[string]string{"OPENRESTY_RETRIABLE_STATUS": "50x"}, "OPENRESTY_RETRIABLE_STATUS"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			p, err := newRetryPolicy()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if p.attempts != 3 || !p.retriableStatus[502] {
+					t.Errorf("unexpected defaults: %+v", p)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseOpenrestyError(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		truncated bool
+		want      string
+	}{
+		{"error only", `{"error":"invalid route"}`, false, "invalid route"},
+		{"string detail", `{"error":"invalid route","detail":"hosts is empty"}`, false, "invalid route: hosts is empty"},
+		{"object detail", `{"error":"invalid route","detail":{"field":"hosts"}}`, false, `invalid route: {"field":"hosts"}`},
+		{"null detail", `{"error":"invalid route","detail":null}`, false, "invalid route"},
+		{"plain text", "  bad\n  gateway ", false, "bad gateway"},
+		{"truncated json", `{"error":"invalid`, true, `{"error":"invalid ...(truncated)`},
+		{"empty", "", false, ""},
+	}
+
+	for _, tt := range tests {
+		if got := parseOpenrestyError([]byte(tt.body), tt.truncated); got != tt.want {
+			t.Errorf("%s: parseOpenrestyError = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPushRetriesRetriableStatus(t *testing.T) {
+	stub := newOpenrestyStub()
+	stub.setStatus("/api/routes/update", 503)
+	w := newTestWatcher(t, stub)
+	w.retry = &retryPolicy{attempts: 3, retriableStatus: map[int]bool{503: true}}
+
+	err := w.notifyOpenresty("POST", "/api/routes/update", testRoute(map[string]interface{}{"hosts": []interface{}{"a.example.com"}}))
+	var statusErr *openrestyStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != 503 {
+		t.Fatalf("err = %v, want status 503", err)
+	}
+	if n := len(stub.posts()); n != 3 {
+		t.Errorf("got %d attempts, want 3", n)
+	}
+
+	stub.setStatus("/api/routes/update", 400)
+	before := len(stub.posts())
+	w.notifyOpenresty("POST", "/api/routes/update", testRoute(map[string]interface{}{"hosts": []interface{}{"b.example.com"}}))
+	if n := len(stub.posts()) - before; n != 1 {
+		t.Errorf("non-retriable status retried: %d attempts", n)
+	}
+}
+
+func TestDeleteNotFound(t *testing.T) {
+	tests := []struct {
+		name             string
+		path             string
+		deleteNotFoundOK bool
+		wantErr          bool
+		wantResult       string
+	}{
+		{"delete treated as success", "/api/routes/delete", true, false, pushAlreadyAbsent},
+		{"delete treated as failure", "/api/routes/delete", false, true, pushFailure},
+		{"update is never absent", "/api/routes/update", true, true, pushFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newOpenrestyStub()
+			stub.setStatus(tt.path, 404)
+			w := newTestWatcher(t, stub)
+			w.deleteNotFoundOK = tt.deleteNotFoundOK
+
+			err := w.notifyOpenresty("POST", tt.path, testRoute(routeSpec("a.example.com")))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := w.metrics.pushes.values[tt.wantResult]; got != 1 {
+				t.Errorf("pushes{result=%q} = %g, want 1 (%v)", tt.wantResult, got, w.metrics.pushes.values)
+			}
+			// 删除返回 404 时 OpenResty 同样记录了 epoch
+			if acked := w.ackedEpoch.Load() > 0; acked != strings.HasSuffix(tt.path, "/delete") {
+				t.Errorf("epoch acked = %v for %s", acked, tt.path)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// routeFinalizer 保证 route 被删除时 OpenResty 中的配置一定会被清理：
+// 启用 ROUTE_FINALIZER_ENABLED 后 watcher 为负责的 route 加上该 finalizer，
+// route 被删除时 apiserver 只设置 deletionTimestamp，watcher（包括重启后的全量同步）
+// 确认 OpenResty 删除成功后才移除 finalizer，对象随后才真正被删除。
+// 分片模式下只有负责该 route 的 Pod 添加和移除 finalizer，因此只保证该 Pod 的 OpenResty 已删除。
+const routeFinalizer = "ossfe.imvictor.tech/cleanup"
+
+// hasRouteFinalizer 表示 route 带有 watcher 的 finalizer
+func hasRouteFinalizer(route *unstructured.Unstructured) bool {
+	for _, f := range route.GetFinalizers() {
+		if f == routeFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureRouteFinalizer 在启用 finalizer 时为尚未带有 finalizer、也未在删除中的 route 加上 finalizer。
+// 失败只记录日志，下一次事件或全量同步时重试，不影响推送
+func (w *Watcher) ensureRouteFinalizer(route *unstructured.Unstructured) {
+	if !w.config.routeFinalizer || w.dryRun || route.GetDeletionTimestamp() != nil || hasRouteFinalizer(route) || !w.ownsObject(route) {
+		return
+	}
+	finalizers := append(route.GetFinalizers(), routeFinalizer)
+	if err := w.patchRouteFinalizers(route, finalizers); err != nil {
+		slog.Warn("Failed to add finalizer to route", append(objectLogAttrs("routes", route.GetNamespace(), route.GetName()),
+			"finalizer", routeFinalizer, "error", err)...)
+		return
+	}
+	route.SetFinalizers(finalizers)
+}
+
+// finalizeRoute 处理正在删除且带有 watcher finalizer 的 route：先从 OpenResty 删除，成功后移除 finalizer。
+// 即使 ROUTE_FINALIZER_ENABLED 已关闭也会执行，否则之前加上的 finalizer 会让 route 无法删除。
+// 分片模式下每个 Pod 都从自己的 OpenResty 删除，只有负责该 route 的 Pod 移除 finalizer
+func (w *Watcher) finalizeRoute(parent *span, route *unstructured.Unstructured) error {
+	if err := w.notifyOpenrestyTraced(parent, "POST", "/api/routes/delete", route); err != nil {
+		return fmt.Errorf("keeping finalizer on route %s until OpenResty confirms the delete: %v", objectKey(route), err)
+	}
+	w.tlsWaiting.set(objectKey(route), "")
+	if w.dryRun || !w.ownsObject(route) {
+		return nil
+	}
+
+	var finalizers []string
+	for _, f := range route.GetFinalizers() {
+		if f != routeFinalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	if err := w.patchRouteFinalizers(route, finalizers); err != nil {
+		return fmt.Errorf("failed to remove finalizer from route %s: %v", objectKey(route), err)
+	}
+	slog.Info("Removed finalizer after deleting route from OpenResty", objectLogAttrs("routes", route.GetNamespace(), route.GetName())...)
+	return nil
+}
+
+// patchRouteFinalizers 以 merge patch 替换 route 的 finalizer 列表。带上 resourceVersion 作为前置条件，
+// 期间 route 被其他人修改时 patch 以冲突失败，避免覆盖其他控制器同时加上的 finalizer
+func (w *Watcher) patchRouteFinalizers(route *unstructured.Unstructured, finalizers []string) error {
+	if finalizers == nil {
+		finalizers = []string{}
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"finalizers":      finalizers,
+			"resourceVersion": route.GetResourceVersion(),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build finalizer patch: %v", err)
+	}
+
+	ctx, cancel := w.apiContext()
+	defer cancel()
+	_, err = w.client.Resource(routeGVR).Namespace(route.GetNamespace()).Patch(ctx, route.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+	return apiTimeoutError(ctx, err, "patching route finalizers", w.config.apiTimeout)
+}
+
+// routeContentUnchanged 表示 UPDATE 没有修改 spec、labels 和 annotations，即 webhook 校验的内容都没有变化
+func routeContentUnchanged(req *admissionv1.AdmissionRequest, route *unstructured.Unstructured) bool {
+	var old unstructured.Unstructured
+	if err := old.UnmarshalJSON(req.OldObject.Raw); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(old.Object["spec"], route.Object["spec"]) &&
+		reflect.DeepEqual(old.GetLabels(), route.GetLabels()) &&
+		reflect.DeepEqual(old.GetAnnotations(), route.GetAnnotations())
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// route key 的组成方式，决定 OpenResty 中路由表的 key 以及 webhook 判定冲突的粒度
+const (
+	// routeKeyHost 以域名为 key，同一域名只能属于一个 route
+	routeKeyHost = "host"
+	// routeKeyHostLabel 以域名加租户 label 为 key，不同租户可以使用同一域名，
+	// 请求按 ROUTE_TENANT_HEADER 请求头选择租户
+	routeKeyHostLabel = "host+label"
+
+	// routeKeySeparator 分隔域名与租户，域名和 label 值中都不会出现
+	routeKeySeparator = "|"
+)
+
+// routeKeyConfig 为 route key 的组成方式，watcher 推送、webhook 冲突检测和全量审计共用
+type routeKeyConfig struct {
+	mode        string
+	tenantLabel string
+}
+
+// routeKeyConfigFromEnv 读取 ROUTE_KEY_MODE（默认 host）和 ROUTE_TENANT_LABEL。
+// OpenResty 与 watcher 运行在同一容器中，ROUTE_TENANT_HEADER 由 OpenResty 直接读取。
+func routeKeyConfigFromEnv() (*routeKeyConfig, error) {
+	config := &routeKeyConfig{
+		mode:        getEnvOrDefault("ROUTE_KEY_MODE", routeKeyHost),
+		tenantLabel: getEnvOrDefault("ROUTE_TENANT_LABEL", "ossfe.imvictor.tech/tenant"),
+	}
+	if config.mode != routeKeyHost && config.mode != routeKeyHostLabel {
+		return nil, fmt.Errorf("invalid ROUTE_KEY_MODE %q, must be %q or %q", config.mode, routeKeyHost, routeKeyHostLabel)
+	}
+	return config, nil
+}
+
+// keys 返回 route 在 OpenResty 路由表中的 key。host+label 模式下带有租户 label 的 route
+// 使用 host|tenant，没有该 label 的 route 仍使用 host，作为未匹配到租户时的默认路由。
+func (c *routeKeyConfig) keys(route *unstructured.Unstructured) []string {
+	hosts, _, _ := unstructured.NestedStringSlice(route.Object, "spec", "hosts")
+
+	tenant := ""
+	if c.mode == routeKeyHostLabel {
+		tenant = route.GetLabels()[c.tenantLabel]
+	}
+	if tenant == "" {
+		return hosts
+	}
+
+	keys := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		keys = append(keys, host+routeKeySeparator+tenant)
+	}
+	return keys
+}
+
+// describeRouteKey 将 route key 转换为便于阅读的描述，用于错误信息
+func describeRouteKey(key string) string {
+	if host, tenant, ok := strings.Cut(key, routeKeySeparator); ok {
+		return fmt.Sprintf("host '%s' (tenant '%s')", host, tenant)
+	}
+	return fmt.Sprintf("host '%s'", key)
+}
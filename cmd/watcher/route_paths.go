@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// routePathPrefixes 返回 spec.paths 中各项的 prefix，格式错误时返回 error
+func routePathPrefixes(route *unstructured.Unstructured) ([]string, error) {
+	paths, found, err := unstructured.NestedSlice(route.Object, "spec", "paths")
+	if err != nil {
+		return nil, fmt.Errorf("spec.paths must be a list: %v", err)
+	}
+	if !found {
+		return nil, nil
+	}
+
+	prefixes := make([]string, 0, len(paths))
+	for i, item := range paths {
+		path, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("spec.paths[%d] must be an object", i)
+		}
+		prefix, ok := path["prefix"].(string)
+		if !ok {
+			return nil, fmt.Errorf("spec.paths[%d].prefix must be a string", i)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// validatePaths 校验 spec.paths 中的 prefix：必须以 / 开头，不能包含空段、. 或 ..，
+// 也不能包含 ?、# 等会改变请求语义的字符。允许末尾带一个 /。
+func validatePaths(route *unstructured.Unstructured) error {
+	prefixes, err := routePathPrefixes(route)
+	if err != nil {
+		return err
+	}
+
+	for i, prefix := range prefixes {
+		if !strings.HasPrefix(prefix, "/") {
+			return fmt.Errorf("spec.paths[%d].prefix '%s' must start with '/'", i, prefix)
+		}
+		if strings.ContainsAny(prefix, "?#\\%") {
+			return fmt.Errorf("spec.paths[%d].prefix '%s' must not contain '?', '#', '\\' or '%%'", i, prefix)
+		}
+		for _, r := range prefix {
+			if r < 0x20 || r == 0x7f {
+				return fmt.Errorf("spec.paths[%d].prefix must not contain control characters", i)
+			}
+		}
+		if prefix == "/" {
+			continue
+		}
+		for _, segment := range strings.Split(strings.TrimSuffix(prefix[1:], "/"), "/") {
+			switch segment {
+			case "":
+				return fmt.Errorf("spec.paths[%d].prefix '%s' must not contain empty segments", i, prefix)
+			case ".", "..":
+				return fmt.Errorf("spec.paths[%d].prefix '%s' must not contain '.' or '..' segments", i, prefix)
+			}
+		}
+	}
+	return nil
+}
+
+// normalizePathPrefix 去掉 prefix 末尾的 /，OpenResty 按路径段匹配，/docs 与 /docs/ 等价
+func normalizePathPrefix(prefix string) string {
+	if prefix == "/" {
+		return prefix
+	}
+	return strings.TrimSuffix(prefix, "/")
+}
+
+// checkDuplicatePaths 检查同一个 route 内的 spec.paths：相同的 prefix（忽略末尾的 /）视为重复，
+// catch-all 的 / 与其他 prefix 同时出现时其他 prefix 不再起作用，OpenResty 无法区分其意图，同样拒绝。
+// 每一对冲突单独列出。route key 在 route 之间唯一（见 checkDuplicateHosts），不同 route 的 paths 不会作用于同一个请求，因此只检查 route 内部。
+func checkDuplicatePaths(route *unstructured.Unstructured) error {
+	// 格式错误由 validatePaths 报告
+	prefixes, err := routePathPrefixes(route)
+	if err != nil {
+		return nil
+	}
+
+	var conflicts []string
+	for i := range prefixes {
+		for j := i + 1; j < len(prefixes); j++ {
+			a, b := normalizePathPrefix(prefixes[i]), normalizePathPrefix(prefixes[j])
+			switch {
+			case a == b:
+				conflicts = append(conflicts, fmt.Sprintf("path '%s' duplicates '%s'", prefixes[j], prefixes[i]))
+			case a == "/":
+				conflicts = append(conflicts, fmt.Sprintf("catch-all path '/' is ambiguous with '%s'", prefixes[j]))
+			case b == "/":
+				conflicts = append(conflicts, fmt.Sprintf("catch-all path '/' is ambiguous with '%s'", prefixes[i]))
+			}
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return fmt.Errorf("conflicting paths detected: %s", strings.Join(conflicts, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// routePaths 返回 spec.paths 的值
+func routePaths(prefixes ...string) []interface{} {
+	paths := make([]interface{}, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		paths = append(paths, map[string]interface{}{"prefix": prefix})
+	}
+	return paths
+}
+
+func TestValidatePaths(t *testing.T) {
+	tests := []struct {
+		paths   interface{}
+		wantErr string
+	}{
+		{nil, ""},
+		{routePaths("/"), ""},
+		{routePaths("/docs", "/assets/"), ""},
+		{routePaths("docs"), "must start with '/'"},
+		{routePaths("/a//b"), "must not contain empty segments"},
+		{routePaths("/a/../b"), "must not contain '.' or '..' segments"},
+		{routePaths("/a?b"), "must not contain '?'"},
+		{routePaths("/a\tb"), "control characters"},
+		{[]interface{}{"/docs"}, "must be an object"},
+		{[]interface{}{map[string]interface{}{"prefix": int64(1)}}, "must be a string"},
+		{"/docs", "must be a list"},
+	}
+
+	for _, tt := range tests {
+		spec := map[string]interface{}{}
+		if tt.paths != nil {
+			spec["paths"] = tt.paths
+		}
+		err := validatePaths(testRoute(spec))
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("paths %v: unexpected error: %v", tt.paths, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("paths %v: err = %v, want it to contain %q", tt.paths, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckDuplicatePaths(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefixes []string
+		want     []string
+	}{
+		{"distinct", []string{"/docs", "/assets", "/docs/api"}, nil},
+		{"catch-all alone", []string{"/"}, nil},
+		{"identical", []string{"/docs", "/docs"}, []string{"path '/docs' duplicates '/docs'"}},
+		{"trailing slash", []string{"/docs", "/docs/"}, []string{"path '/docs/' duplicates '/docs'"}},
+		{"catch-all with specific paths", []string{"/docs", "/", "/assets"}, []string{
+			"catch-all path '/' is ambiguous with '/docs'",
+			"catch-all path '/' is ambiguous with '/assets'",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkDuplicatePaths(testRoute(map[string]interface{}{"paths": routePaths(tt.prefixes...)}))
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected conflicts %v", tt.want)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("err = %v, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// routeSchemaStore 持有 webhook 用于校验 OSSProxyRoute 的 JSON Schema（从 WEBHOOK_ROUTE_SCHEMA_FILE 加载，
+// YAML 或 JSON），在 CRD schema 之外提供无需重新编译的自定义约束。与 policyStore 一样通过轮询实现热加载，
+// 启动时 schema 无效会直接失败；热加载失败时保留旧 schema。
+type routeSchemaStore struct {
+	path     string
+	interval time.Duration
+	current  atomic.Pointer[jsonSchema]
+	digest   [sha256.Size]byte
+	failed   [sha256.Size]byte
+}
+
+func newRouteSchemaStore() (*routeSchemaStore, error) {
+	path := os.Getenv("WEBHOOK_ROUTE_SCHEMA_FILE")
+	if path == "" {
+		return nil, nil
+	}
+
+	interval, err := time.ParseDuration(getEnvOrDefault("WEBHOOK_ROUTE_SCHEMA_RELOAD_INTERVAL", "10s"))
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("invalid WEBHOOK_ROUTE_SCHEMA_RELOAD_INTERVAL")
+	}
+
+	ss := &routeSchemaStore{path: path, interval: interval}
+	if _, err := ss.reload(); err != nil {
+		return nil, err
+	}
+	slog.Info("Loaded route schema", "path", path)
+	return ss, nil
+}
+
+// get 返回当前生效的 schema
+func (ss *routeSchemaStore) get() *jsonSchema {
+	if ss == nil {
+		return nil
+	}
+	return ss.current.Load()
+}
+
+// reload 读取 schema 文件，内容变化且编译通过时替换当前 schema
+func (ss *routeSchemaStore) reload() (bool, error) {
+	data, err := os.ReadFile(ss.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read route schema file %s: %v", ss.path, err)
+	}
+
+	digest := sha256.Sum256(data)
+	if bytes.Equal(digest[:], ss.digest[:]) && ss.current.Load() != nil {
+		return false, nil
+	}
+	if bytes.Equal(digest[:], ss.failed[:]) {
+		return false, nil
+	}
+
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		ss.failed = digest
+		return false, fmt.Errorf("failed to parse route schema: %v", err)
+	}
+	schema, err := compileJSONSchema(jsonData)
+	if err != nil {
+		ss.failed = digest
+		return false, fmt.Errorf("invalid route schema: %v", err)
+	}
+
+	ss.current.Store(schema)
+	ss.digest = digest
+	return true, nil
+}
+
+// watch 周期性检查 schema 文件是否变化
+func (ss *routeSchemaStore) watch(done <-chan struct{}) {
+	ticker := time.NewTicker(ss.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			changed, err := ss.reload()
+			if err != nil {
+				slog.Error("Route schema reload failed, keeping previous schema", "path", ss.path, "error", err)
+				continue
+			}
+			if changed {
+				slog.Info("Reloaded route schema", "path", ss.path)
+			}
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	// tlsMissingWarn 时 TLS Secret 不存在仍推送 route，只将 Ready 置为 False
+	tlsMissingWarn = "warn"
+	// tlsMissingBlock 时 TLS Secret 不存在会暂缓推送 route，直到 Secret 出现
+	tlsMissingBlock = "block"
+
+	tlsSecretMissingReason    = "TLSSecretMissing"
+	tlsSecretNotAllowedReason = "TLSSecretNotAllowed"
+	tlsSecretAvailableReason  = "TLSSecretAvailable"
+)
+
+var secretGVR = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+
+// tlsMissingPolicyFromEnv 读取 ROUTE_TLS_SECRET_MISSING_POLICY（默认 warn）
+func tlsMissingPolicyFromEnv() (string, error) {
+	policy := getEnvOrDefault("ROUTE_TLS_SECRET_MISSING_POLICY", tlsMissingWarn)
+	if policy != tlsMissingWarn && policy != tlsMissingBlock {
+		return "", fmt.Errorf("invalid ROUTE_TLS_SECRET_MISSING_POLICY %q, must be %q or %q", policy, tlsMissingWarn, tlsMissingBlock)
+	}
+	return policy, nil
+}
+
+// tlsSecretNamespacesFromEnv 读取 ROUTE_TLS_SECRET_NAMESPACES（逗号分隔）。route 默认只能引用自身命名空间中的
+// TLS Secret，列出的命名空间（如集中存放通配符证书的命名空间）中的 Secret 可以被任意 route 引用
+func tlsSecretNamespacesFromEnv() map[string]bool {
+	namespaces := make(map[string]bool)
+	for _, ns := range strings.Split(os.Getenv("ROUTE_TLS_SECRET_NAMESPACES"), ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces[ns] = true
+		}
+	}
+	return namespaces
+}
+
+// checkTLSSecretNamespace 拒绝引用其他命名空间中 TLS Secret 的 route，除非该命名空间在 sharedNamespaces 中。
+// 否则任何能创建 route 的用户都可以让 webhook 读取任意命名空间的证书，并从拒绝信息中得知其 SAN
+func checkTLSSecretNamespace(route *unstructured.Unstructured, secretNamespace string, sharedNamespaces map[string]bool) error {
+	if secretNamespace == route.GetNamespace() || sharedNamespaces[secretNamespace] {
+		return nil
+	}
+	return fmt.Errorf("spec.tls.namespace '%s' is not allowed, TLS secrets must be in the route's namespace or in ROUTE_TLS_SECRET_NAMESPACES", secretNamespace)
+}
+
+// routeTLSSecretRef 解析 route 的 spec.tls，namespace 缺省时为 route 所在命名空间
+func routeTLSSecretRef(route *unstructured.Unstructured) (namespace, name string, found bool, err error) {
+	name, found, err = unstructured.NestedString(route.Object, "spec", "tls", "secretName")
+	if err != nil {
+		return "", "", false, fmt.Errorf("invalid spec.tls.secretName: %v", err)
+	}
+	if !found || name == "" {
+		return "", "", false, nil
+	}
+
+	namespace, _, _ = unstructured.NestedString(route.Object, "spec", "tls", "namespace")
+	if namespace == "" {
+		namespace = route.GetNamespace()
+		if namespace == "" {
+			namespace = "default"
+		}
+	}
+	return namespace, name, true, nil
+}
+
+// tlsWaitList 记录因 TLS Secret 不存在而等待的 route（secret key -> route key 集合），
+// Secret 出现后据此重新同步这些 route
+type tlsWaitList struct {
+	mu      sync.Mutex
+	waiting map[string]map[string]bool
+}
+
+func newTLSWaitList() *tlsWaitList {
+	return &tlsWaitList{waiting: make(map[string]map[string]bool)}
+}
+
+// set 记录 route 正在等待的 secret，secretKey 为空表示不再等待
+func (l *tlsWaitList) set(routeKey, secretKey string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, routes := range l.waiting {
+		delete(routes, routeKey)
+		if len(routes) == 0 {
+			delete(l.waiting, key)
+		}
+	}
+	if secretKey == "" {
+		return
+	}
+	if l.waiting[secretKey] == nil {
+		l.waiting[secretKey] = make(map[string]bool)
+	}
+	l.waiting[secretKey][routeKey] = true
+}
+
+// take 取出并清除等待指定 secret 的 route，按字典序排列
+func (l *tlsWaitList) take(secretKey string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	routes := make([]string, 0, len(l.waiting[secretKey]))
+	for routeKey := range l.waiting[secretKey] {
+		routes = append(routes, routeKey)
+	}
+	delete(l.waiting, secretKey)
+	sort.Strings(routes)
+	return routes
+}
+
+// checkRouteTLSSecret 在推送 route 前检查其 TLS Secret 是否存在，返回是否应推送该 route。
+// Secret 不存在时记录等待并将 Ready 置为 False；此前因此被标记的 route 在 Secret 出现后恢复为 True。
+func (w *Watcher) checkRouteTLSSecret(route *unstructured.Unstructured) bool {
+	routeKey := objectKey(route)
+
+	namespace, name, found, err := routeTLSSecretRef(route)
+	if err != nil || !found {
+		w.tlsWaiting.set(routeKey, "")
+		w.clearTLSSecretMissing(route)
+		return true
+	}
+	if err := checkTLSSecretNamespace(route, namespace, w.config.tlsSecretNamespaces); err != nil {
+		// 不读取其他命名空间的 Secret，按 Secret 缺失处理，但不等待它出现
+		w.tlsWaiting.set(routeKey, "")
+		if !hasCondition(route, readyConditionType, tlsSecretNotAllowedReason) {
+			slog.Warn("TLS secret reference is not allowed", append(objectLogAttrs("routes", route.GetNamespace(), route.GetName()), "error", err)...)
+			w.setCondition(route, readyConditionType, "False", tlsSecretNotAllowedReason, err.Error())
+		}
+		return w.tlsMissingPolicy != tlsMissingBlock
+	}
+
+	exists, err := w.tlsSecretExists(namespace, name, w.ownsObject(route))
+	if err != nil {
+		// 无法确认时按 Secret 存在处理，避免 apiserver 抖动导致 route 被暂缓
+		slog.Error("Failed to check TLS secret", append(objectLogAttrs("routes", route.GetNamespace(), route.GetName()), "secret", namespace+"/"+name, "error", err)...)
+		return true
+	}
+	if exists {
+		w.tlsWaiting.set(routeKey, "")
+		w.clearTLSSecretMissing(route)
+		return true
+	}
+
+	secretKey := namespace + "/" + name
+	w.tlsWaiting.set(routeKey, secretKey)
+	message := fmt.Sprintf("TLS secret %s does not exist", secretKey)
+	if !hasCondition(route, readyConditionType, tlsSecretMissingReason) {
+		slog.Warn("TLS secret does not exist", append(objectLogAttrs("routes", route.GetNamespace(), route.GetName()), "secret", secretKey)...)
+		w.setCondition(route, readyConditionType, "False", tlsSecretMissingReason, message)
+	}
+
+	if w.tlsMissingPolicy == tlsMissingBlock {
+		slog.Info("Holding back route until TLS secret exists", append(objectLogAttrs("routes", route.GetNamespace(), route.GetName()), "secret", secretKey)...)
+		return false
+	}
+	return true
+}
+
+// tlsSecretExists 优先读取 TLS Secret informer 的缓存，全量同步时不必为每个 route 请求 apiserver；
+// 缓存只包含 kubernetes.io/tls 类型的 Secret，其他类型视为不存在。缓存不可用时，lookup 为 true 则退回直接请求；
+// 分片模式下不负责该 route 的 Pod 传入 false，不请求 apiserver，按 Secret 存在处理。
+func (w *Watcher) tlsSecretExists(namespace, name string, lookup bool) (bool, error) {
+	if exists, ok := w.informers.cachedTLSSecretExists(namespace, name); ok {
+		return exists, nil
+	}
+	if !lookup {
+		return true, nil
+	}
+
+	ctx, cancel := w.apiContext()
+	defer cancel()
+	secret, err := w.clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	err = apiTimeoutError(ctx, err, "getting secret", w.config.apiTimeout)
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return secret.Type == corev1.SecretTypeTLS, nil
+}
+
+// clearTLSSecretMissing 将此前因 TLS Secret 不存在或不允许引用而为 False 的 Ready 恢复为 True
+func (w *Watcher) clearTLSSecretMissing(route *unstructured.Unstructured) {
+	if hasCondition(route, readyConditionType, tlsSecretMissingReason) || hasCondition(route, readyConditionType, tlsSecretNotAllowedReason) {
+		w.setCondition(route, readyConditionType, "True", tlsSecretAvailableReason, "TLS secret is available")
+	}
+}
+
+// handleTLSSecretEvent 在 TLS Secret 创建或更新时重新同步等待它的 route
+func (w *Watcher) handleTLSSecretEvent(event watch.Event, secret *unstructured.Unstructured) error {
+	if event.Type != watch.Added && event.Type != watch.Modified {
+		return nil
+	}
+
+	secretKey := objectKey(secret)
+	for _, routeKey := range w.tlsWaiting.take(secretKey) {
+		namespace, name := splitObjectKey(routeKey)
+		route, err := w.getObject(routeGVR, namespace, name)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			slog.Error("Failed to get route after TLS secret appeared", append(objectLogAttrs("routes", namespace, name), "secret", secretKey, "error", err)...)
+			continue
+		}
+
+		slog.Info("TLS secret is now available, re-syncing route", append(objectLogAttrs("routes", namespace, name), "secret", secretKey)...)
+		if err := w.handleEvent(watch.Event{Type: watch.Modified, Object: route}, "routes"); err != nil {
+			slog.Error("Failed to re-sync route", append(objectLogAttrs("routes", namespace, name), "error", err)...)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// sampledLogger 对同一 key 的日志在 interval 内只输出一次，并在下次输出时附带期间被抑制的次数
+type sampledLogger struct {
+	interval time.Duration
+
+	mu         sync.Mutex
+	last       map[string]time.Time
+	suppressed map[string]int
+}
+
+func newSampledLogger(interval time.Duration) *sampledLogger {
+	return &sampledLogger{
+		interval:   interval,
+		last:       make(map[string]time.Time),
+		suppressed: make(map[string]int),
+	}
+}
+
+// warn 以 WARN 级别输出 msg 与 args 结构化字段，有被抑制的日志时附带 suppressed 字段
+func (l *sampledLogger) warn(key, msg string, args ...any) {
+	l.mu.Lock()
+	now := time.Now()
+	if last, ok := l.last[key]; ok && now.Sub(last) < l.interval {
+		l.suppressed[key]++
+		l.mu.Unlock()
+		return
+	}
+	suppressed := l.suppressed[key]
+	l.last[key] = now
+	delete(l.suppressed, key)
+	l.mu.Unlock()
+
+	if suppressed > 0 {
+		args = append(args, "suppressed", suppressed)
+	}
+	slog.Warn(msg, args...)
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// secretIndex 维护 upstream 与其引用的 secret 之间的双向索引，
+// 用于在 reconcile 时判断哪些已推送到 OpenResty 的 secret 已不再被引用
+type secretIndex struct {
+	mu sync.Mutex
+	// upstream key (namespace/name) -> secret key (namespace/name)
+	upstreamToSecret map[string]string
+	// secret key -> 引用它的 upstream key 集合
+	secretToUpstreams map[string]map[string]bool
+	// upstream key -> secretRef.keys 中允许推送的 key，未设置 keys 的 upstream 不在其中
+	upstreamKeys map[string][]string
+}
+
+func newSecretIndex() *secretIndex {
+	return &secretIndex{
+		upstreamToSecret:  make(map[string]string),
+		secretToUpstreams: make(map[string]map[string]bool),
+		upstreamKeys:      make(map[string][]string),
+	}
+}
+
+// set 记录 upstream 当前引用的 secret 及允许推送的 key，secretKey 为空表示不再引用任何 secret，
+// keys 为 nil 表示推送 secret 的全部 key。返回 upstream 此前引用、现在不再引用的 secret，没有时为空字符串
+func (idx *secretIndex) set(upstreamKey, secretKey string, keys []string) (released string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if old, ok := idx.upstreamToSecret[upstreamKey]; ok && old != secretKey {
+		idx.unlinkLocked(upstreamKey, old)
+		released = old
+	}
+
+	if keys != nil && secretKey != "" {
+		idx.upstreamKeys[upstreamKey] = keys
+	} else {
+		delete(idx.upstreamKeys, upstreamKey)
+	}
+
+	if secretKey == "" {
+		return released
+	}
+
+	idx.upstreamToSecret[upstreamKey] = secretKey
+	if idx.secretToUpstreams[secretKey] == nil {
+		idx.secretToUpstreams[secretKey] = make(map[string]bool)
+	}
+	idx.secretToUpstreams[secretKey][upstreamKey] = true
+	return released
+}
+
+// remove 删除 upstream 的引用记录（upstream 被删除时调用），返回它此前引用的 secret
+func (idx *secretIndex) remove(upstreamKey string) (released string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if old, ok := idx.upstreamToSecret[upstreamKey]; ok {
+		idx.unlinkLocked(upstreamKey, old)
+		return old
+	}
+	return ""
+}
+
+// retain 删除不在 upstreams 中的 upstream 的引用记录，用于全量同步时清理错过删除事件的 upstream
+func (idx *secretIndex) retain(upstreams map[string]bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for upstreamKey, secretKey := range idx.upstreamToSecret {
+		if !upstreams[upstreamKey] {
+			idx.unlinkLocked(upstreamKey, secretKey)
+		}
+	}
+}
+
+func (idx *secretIndex) unlinkLocked(upstreamKey, secretKey string) {
+	delete(idx.upstreamToSecret, upstreamKey)
+	delete(idx.upstreamKeys, upstreamKey)
+	if refs := idx.secretToUpstreams[secretKey]; refs != nil {
+		delete(refs, upstreamKey)
+		if len(refs) == 0 {
+			delete(idx.secretToUpstreams, secretKey)
+		}
+	}
+}
+
+// referenced 返回当前仍被至少一个 upstream 引用的 secret key 集合
+func (idx *secretIndex) referenced() map[string]bool {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	result := make(map[string]bool, len(idx.secretToUpstreams))
+	for key := range idx.secretToUpstreams {
+		result[key] = true
+	}
+	return result
+}
+
+// upstreamsFor 返回引用指定 secret 的 upstream key，按字典序排列
+func (idx *secretIndex) upstreamsFor(secretKey string) []string {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	upstreams := make([]string, 0, len(idx.secretToUpstreams[secretKey]))
+	for key := range idx.secretToUpstreams[secretKey] {
+		upstreams = append(upstreams, key)
+	}
+	sort.Strings(upstreams)
+	return upstreams
+}
+
+// allowedKeys 返回推送 secret 时保留的 key：引用它的所有 upstream 的 secretRef.keys 的并集。
+// 有任一引用它的 upstream 未设置 keys，或没有 upstream 引用它时返回 nil，表示推送全部 key
+func (idx *secretIndex) allowedKeys(secretKey string) map[string]bool {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	refs := idx.secretToUpstreams[secretKey]
+	if len(refs) == 0 {
+		return nil
+	}
+	allowed := make(map[string]bool)
+	for upstreamKey := range refs {
+		keys, ok := idx.upstreamKeys[upstreamKey]
+		if !ok {
+			return nil
+		}
+		for _, k := range keys {
+			allowed[k] = true
+		}
+	}
+	return allowed
+}
+
+// dependents 返回每个被引用的 secret 对应的 upstream 数量
+func (idx *secretIndex) dependents() map[string]float64 {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	result := make(map[string]float64, len(idx.secretToUpstreams))
+	for key, refs := range idx.secretToUpstreams {
+		result[key] = float64(len(refs))
+	}
+	return result
+}
+
+// objectKey 返回 namespace/name 形式的对象键，namespace 为空时使用 default
+func objectKey(obj *unstructured.Unstructured) string {
+	namespace := obj.GetNamespace()
+	if namespace == "" {
+		namespace = "default"
+	}
+	return namespace + "/" + obj.GetName()
+}
+
+// upstreamSecretRef 解析 upstream 的 spec.credentials.secretRef，
+// 未配置 secretRef 时 found 为 false
+func upstreamSecretRef(upstream *unstructured.Unstructured) (namespace, name string, found bool, err error) {
+	credentials, found, err := unstructured.NestedMap(upstream.Object, "spec", "credentials")
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to get credentials: %v", err)
+	}
+	if !found {
+		// 没有配置凭据，不需要同步 secret
+		return "", "", false, nil
+	}
+
+	secretRef, found, err := unstructured.NestedMap(credentials, "secretRef")
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to get secretRef: %v", err)
+	}
+	if !found {
+		// 没有引用 secret，不需要同步
+		return "", "", false, nil
+	}
+
+	name, found, err = unstructured.NestedString(secretRef, "name")
+	if err != nil || !found {
+		return "", "", false, fmt.Errorf("secretRef missing name field")
+	}
+
+	namespace, found, err = unstructured.NestedString(secretRef, "namespace")
+	if err != nil || !found || namespace == "" {
+		// 如果没有指定命名空间，使用 upstream 的命名空间
+		namespace = upstream.GetNamespace()
+		if namespace == "" {
+			namespace = "default"
+		}
+	}
+
+	return namespace, name, true, nil
+}
+
+// indexUpstreamSecret 根据 upstream 当前的 spec 更新反向索引，返回 upstream 不再引用的 secret
+func (w *Watcher) indexUpstreamSecret(upstream *unstructured.Unstructured) (released string) {
+	namespace, name, found, err := upstreamSecretRef(upstream)
+	if err != nil || !found {
+		released = w.secrets.set(objectKey(upstream), "", nil)
+	} else {
+		keys, _, _ := unstructured.NestedStringSlice(upstream.Object, "spec", "credentials", "secretRef", "keys")
+		released = w.secrets.set(objectKey(upstream), namespace+"/"+name, keys)
+	}
+	w.metrics.secretDependents.replace(w.secrets.dependents())
+	return released
+}
+
+// unindexUpstreamSecret 在 upstream 被删除时移除它的引用记录，返回它此前引用的 secret
+func (w *Watcher) unindexUpstreamSecret(upstreamKey string) (released string) {
+	released = w.secrets.remove(upstreamKey)
+	w.metrics.secretDependents.replace(w.secrets.dependents())
+	return released
+}
+
+// trimReleasedSecret 在某个 upstream 不再引用 secret 后，按仍引用它的 upstream 的 secretRef.keys 的并集重新推送，
+// 使 OpenResty 不再持有只有该 upstream 需要的 key。没有 upstream 引用时由 pruneSecrets 删除；
+// 剩余的 upstream 都需要全部 key 时 OpenResty 持有的内容不变，不需要推送。
+// 失败只记录日志，下一次全量同步会按当前的并集重新推送所有被引用的 secret
+func (w *Watcher) trimReleasedSecret(secretKey string) {
+	if secretKey == "" || len(w.secrets.upstreamsFor(secretKey)) == 0 || w.secrets.allowedKeys(secretKey) == nil {
+		return
+	}
+	namespace, name := splitObjectKey(secretKey)
+	if err := w.syncSecret(namespace, name); err != nil {
+		slog.Error("Failed to trim secret after an upstream stopped referencing it", "secret", secretKey,
+			"dependentUpstreams", w.secrets.upstreamsFor(secretKey), "error", err)
+	}
+}
+
+// pruneSecrets 删除 OpenResty 中持有但已不再被任何 upstream 引用的 secret
+func (w *Watcher) pruneSecrets() error {
+	// 与 dispatchEvent 相同，排空期间不再推送，由新 Pod 的全量同步清理
+	if !w.beginEvent() {
+		return nil
+	}
+	defer w.endEvent()
+
+	var held []string
+	if err := w.fetchOpenresty("/api/secrets/list", &held); err != nil {
+		return fmt.Errorf("failed to list secrets in OpenResty: %v", err)
+	}
+
+	referenced := w.secrets.referenced()
+
+	pruneErrors := 0
+	for _, key := range held {
+		if referenced[key] {
+			continue
+		}
+
+		namespace, name := splitObjectKey(key)
+		secret := &unstructured.Unstructured{}
+		secret.SetAPIVersion("v1")
+		secret.SetKind("Secret")
+		secret.SetName(name)
+		secret.SetNamespace(namespace)
+
+		slog.Info("Pruning unreferenced secret from OpenResty", objectLogAttrs("secrets", namespace, name)...)
+		if err := w.notifyOpenresty("POST", "/api/secrets/delete", secret); err != nil {
+			slog.Error("Failed to prune secret", append(objectLogAttrs("secrets", namespace, name), "error", err)...)
+			pruneErrors++
+		}
+	}
+
+	if pruneErrors > 0 {
+		return fmt.Errorf("failed to prune %d secrets", pruneErrors)
+	}
+	return nil
+}
+
+// splitObjectKey 将 namespace/name 拆分为两部分
+func splitObjectKey(key string) (namespace, name string) {
+	if namespace, name, ok := strings.Cut(key, "/"); ok {
+		return namespace, name
+	}
+	return "default", key
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestSecretIndex(t *testing.T) {
+	type op struct {
+		upstream string
+		secret   string // 为空表示 upstream 不再引用 secret；remove 为 true 时删除 upstream
+		remove   bool
+	}
+	tests := []struct {
+		name       string
+		ops        []op
+		referenced []string
+		users      map[string][]string
+	}{
+		{
+			name:       "shared secret",
+			ops:        []op{{upstream: "a/u1", secret: "a/s"}, {upstream: "a/u2", secret: "a/s"}},
+			referenced: []string{"a/s"},
+			users:      map[string][]string{"a/s": {"a/u1", "a/u2"}},
+		},
+		{
+			name:       "switch secret",
+			ops:        []op{{upstream: "a/u1", secret: "a/old"}, {upstream: "a/u1", secret: "a/new"}},
+			referenced: []string{"a/new"},
+			users:      map[string][]string{"a/old": {}, "a/new": {"a/u1"}},
+		},
+		{
+			name:       "drop reference",
+			ops:        []op{{upstream: "a/u1", secret: "a/s"}, {upstream: "a/u1"}},
+			referenced: []string{},
+			users:      map[string][]string{"a/s": {}},
+		},
+		{
+			name:       "remove one of two upstreams",
+			ops:        []op{{upstream: "a/u1", secret: "a/s"}, {upstream: "a/u2", secret: "a/s"}, {upstream: "a/u1", remove: true}},
+			referenced: []string{"a/s"},
+			users:      map[string][]string{"a/s": {"a/u2"}},
+		},
+		{
+			name:       "remove unknown upstream",
+			ops:        []op{{upstream: "a/u1", remove: true}},
+			referenced: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := newSecretIndex()
+			for _, o := range tt.ops {
+				if o.remove {
+					idx.remove(o.upstream)
+				} else {
+					idx.set(o.upstream, o.secret, nil)
+				}
+			}
+
+			want := make(map[string]bool)
+			for _, key := range tt.referenced {
+				want[key] = true
+			}
+			if got := idx.referenced(); !reflect.DeepEqual(got, want) {
+				t.Errorf("referenced() = %v, want %v", got, want)
+			}
+			for secret, upstreams := range tt.users {
+				if got := idx.upstreamsFor(secret); !reflect.DeepEqual(got, upstreams) {
+					t.Errorf("upstreamsFor(%s) = %v, want %v", secret, got, upstreams)
+				}
+			}
+			for secret, count := range idx.dependents() {
+				if int(count) != len(tt.users[secret]) {
+					t.Errorf("dependents()[%s] = %v, want %d", secret, count, len(tt.users[secret]))
+				}
+			}
+		})
+	}
+}
+
+func TestUpstreamSecretRef(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		spec      map[string]interface{}
+		wantNS    string
+		wantName  string
+		wantFound bool
+		wantErr   bool
+	}{
+		{"no credentials", "a", map[string]interface{}{}, "", "", false, false},
+		{"no secretRef", "a", map[string]interface{}{"credentials": map[string]interface{}{}}, "", "", false, false},
+		{"same namespace", "a", map[string]interface{}{"credentials": map[string]interface{}{
+			"secretRef": map[string]interface{}{"name": "s"}}}, "a", "s", true, false},
+		{"explicit namespace", "a", map[string]interface{}{"credentials": map[string]interface{}{
+			"secretRef": map[string]interface{}{"name": "s", "namespace": "b"}}}, "b", "s", true, false},
+		{"default namespace", "", map[string]interface{}{"credentials": map[string]interface{}{
+			"secretRef": map[string]interface{}{"name": "s"}}}, "default", "s", true, false},
+		{"missing name", "a", map[string]interface{}{"credentials": map[string]interface{}{
+			"secretRef": map[string]interface{}{}}}, "", "", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := &unstructured.Unstructured{Object: map[string]interface{}{"spec": tt.spec}}
+			upstream.SetName("u")
+			upstream.SetNamespace(tt.namespace)
+
+			namespace, name, found, err := upstreamSecretRef(upstream)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if namespace != tt.wantNS || name != tt.wantName || found != tt.wantFound {
+				t.Errorf("got (%q, %q, %v), want (%q, %q, %v)", namespace, name, found, tt.wantNS, tt.wantName, tt.wantFound)
+			}
+		})
+	}
+}
+
+// deletedSecrets 返回 from 之后 stub 收到的 secret 删除请求
+func deletedSecrets(t *testing.T, stub *openrestyStub, from int) []string {
+	t.Helper()
+	var deleted []string
+	for _, req := range stub.posts()[from:] {
+		if req.path == "/api/secrets/delete" {
+			metadata := req.body["metadata"].(map[string]interface{})
+			deleted = append(deleted, metadata["namespace"].(string)+"/"+metadata["name"].(string))
+		}
+	}
+	return deleted
+}
+
+func TestPruneSecrets(t *testing.T) {
+	secret := testSecret("web", "creds", map[string][]byte{"accessKeyId": []byte("id"), "accessKeySecret": []byte("v1")})
+	stub := newOpenrestyStub()
+	stub.setResponse("/api/secrets/list", []string{"web/creds", "b/stale"})
+	w := newTestWatcher(t, stub, secret)
+	ctx := context.Background()
+
+	upstream := testUpstream("web", "u", "", "creds")
+	createTestObject(t, w, upstreamGVR, &upstream)
+	createTestObject(t, w, secretGVR, toUnstructured(t, secret, "v1", "Secret"))
+
+	// 初始同步只删除没有 upstream 引用的 secret
+	startTestWatcher(t, w)
+	if deleted := deletedSecrets(t, stub, 0); !reflect.DeepEqual(deleted, []string{"b/stale"}) {
+		t.Fatalf("deleted %v on the initial sync, want [b/stale]", deleted)
+	}
+
+	// upstream 去掉 secretRef 后 handleEvent 立即清理；OpenResty 拒绝删除时由下一次全量同步补上
+	stub.setResponse("/api/secrets/list", []string{"web/creds"})
+	stub.setStatus("/api/secrets/delete", http.StatusInternalServerError)
+	from := len(stub.posts())
+	upstreams := w.client.Resource(upstreamGVR).Namespace("web")
+	current, err := upstreams.Get(ctx, "u", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unstructured.RemoveNestedField(current.Object, "spec", "credentials")
+	if _, err := upstreams.Update(ctx, current, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitForPushes(t, stub, from, "/api/upstreams/update web/u", "/api/secrets/delete web/creds")
+
+	stub.setStatus("/api/secrets/delete", http.StatusOK)
+	from = len(stub.posts())
+	if err := w.syncAll(); err != nil {
+		t.Fatalf("syncAll: %v", err)
+	}
+	if deleted := deletedSecrets(t, stub, from); !reflect.DeepEqual(deleted, []string{"web/creds"}) {
+		t.Errorf("deleted %v on the next sync, want [web/creds]", deleted)
+	}
+}
+
+func TestPruneSecretsReportsFailures(t *testing.T) {
+	stub := newOpenrestyStub()
+	stub.setResponse("/api/secrets/list", []string{"a/stale"})
+	stub.setStatus("/api/secrets/delete", 500)
+	w := newTestWatcher(t, stub)
+
+	if err := w.pruneSecrets(); err == nil {
+		t.Fatal("expected an error when OpenResty rejects the delete")
+	}
+}
+
+func TestSecretIndexAllowedKeys(t *testing.T) {
+	type ref struct {
+		upstream string
+		keys     []string // nil 表示推送全部 key
+	}
+	tests := []struct {
+		name string
+		refs []ref
+		want map[string]bool
+	}{
+		{"unreferenced", nil, nil},
+		{"single upstream", []ref{{"a/u1", []string{"id", "secret"}}}, map[string]bool{"id": true, "secret": true}},
+		{"union across upstreams", []ref{{"a/u1", []string{"id", "secret"}}, {"b/u2", []string{"id", "token"}}},
+			map[string]bool{"id": true, "secret": true, "token": true}},
+		{"one upstream needs all keys", []ref{{"a/u1", []string{"id"}}, {"b/u2", nil}}, nil},
+		{"empty allow-list", []ref{{"a/u1", []string{}}}, map[string]bool{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := newSecretIndex()
+			for _, r := range tt.refs {
+				idx.set(r.upstream, "a/s", r.keys)
+			}
+			if got := idx.allowedKeys("a/s"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("allowedKeys = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecretIndexReleased(t *testing.T) {
+	idx := newSecretIndex()
+	if released := idx.set("a/u1", "a/s", []string{"id"}); released != "" {
+		t.Errorf("first reference released %q", released)
+	}
+	if released := idx.set("a/u1", "a/s", []string{"id", "secret"}); released != "" {
+		t.Errorf("changing keys released %q", released)
+	}
+	if released := idx.set("a/u1", "a/other", nil); released != "a/s" {
+		t.Errorf("switching secret released %q, want a/s", released)
+	}
+	if released := idx.remove("a/u1"); released != "a/other" {
+		t.Errorf("remove released %q, want a/other", released)
+	}
+	if released := idx.remove("a/u1"); released != "" {
+		t.Errorf("second remove released %q", released)
+	}
+
+	// retain 清理不再存在的 upstream，并把它们移出 keys 的并集
+	idx.set("a/u1", "a/s", []string{"id"})
+	idx.set("a/gone", "a/s", []string{"secret"})
+	idx.set("a/gone2", "a/only", nil)
+	idx.retain(map[string]bool{"a/u1": true})
+	if got := idx.allowedKeys("a/s"); !reflect.DeepEqual(got, map[string]bool{"id": true}) {
+		t.Errorf("allowedKeys after retain = %v", got)
+	}
+	if want := map[string]bool{"a/s": true}; !reflect.DeepEqual(idx.referenced(), want) {
+		t.Errorf("referenced after retain = %v, want %v", idx.referenced(), want)
+	}
+}
+
+// withSecretKeys 设置 upstream 的 secretRef.keys
+func withSecretKeys(upstream unstructured.Unstructured, keys ...string) *unstructured.Unstructured {
+	unstructured.SetNestedStringSlice(upstream.Object, keys, "spec", "credentials", "secretRef", "keys")
+	return &upstream
+}
+
+// pushedSecretKeys 返回 from 之后推送的 secret 及其 data 中的 key
+func pushedSecretKeys(stub *openrestyStub, from int) map[string][]string {
+	pushed := make(map[string][]string)
+	for _, req := range stub.posts()[from:] {
+		if req.path != "/api/secrets/update" {
+			continue
+		}
+		metadata := req.body["metadata"].(map[string]interface{})
+		keys := []string{}
+		for key := range req.body["data"].(map[string]interface{}) {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		pushed[metadata["namespace"].(string)+"/"+metadata["name"].(string)] = keys
+	}
+	return pushed
+}
+
+func TestTrimSecretOnReferenceChange(t *testing.T) {
+	stub := newOpenrestyStub()
+	w := newTestWatcher(t, stub,
+		testSecret("a", "s", map[string][]byte{"id": []byte("1"), "secret": []byte("2"), "token": []byte("3")}),
+		testSecret("a", "other", map[string][]byte{"id": []byte("4")}),
+	)
+	update := func(upstream *unstructured.Unstructured) {
+		t.Helper()
+		if err := w.handleEvent(watch.Event{Type: watch.Modified, Object: upstream}, "upstreams"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	update(withSecretKeys(testUpstream("a", "u1", "", "s"), "id"))
+	update(withSecretKeys(testUpstream("a", "u2", "", "s"), "secret", "token"))
+
+	tests := []struct {
+		name   string
+		change func()
+		want   map[string][]string
+	}{
+		{
+			name:   "narrow secretRef.keys",
+			change: func() { update(withSecretKeys(testUpstream("a", "u2", "", "s"), "secret")) },
+			want:   map[string][]string{"a/s": {"id", "secret"}},
+		},
+		{
+			name: "delete an upstream",
+			change: func() {
+				if err := w.handleEvent(watch.Event{Type: watch.Deleted, Object: withSecretKeys(testUpstream("a", "u2", "", "s"), "secret")}, "upstreams"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: map[string][]string{"a/s": {"id"}},
+		},
+		{
+			name: "switch to another secret",
+			change: func() {
+				update(withSecretKeys(testUpstream("a", "u2", "", "s"), "token"))
+				update(withSecretKeys(testUpstream("a", "u2", "", "other"), "id"))
+			},
+			want: map[string][]string{"a/s": {"id"}, "a/other": {"id"}},
+		},
+		{
+			name: "drop the reference",
+			change: func() {
+				update(withSecretKeys(testUpstream("a", "u2", "", "s"), "token"))
+				noCredentials := testUpstream("a", "u2", "", "")
+				update(&noCredentials)
+			},
+			want: map[string][]string{"a/s": {"id"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from := len(stub.posts())
+			tt.change()
+			// 只看最后一次推送：引用变化前的中间步骤可能先推送了更宽的并集
+			if got := pushedSecretKeys(stub, from); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("last pushed secret keys = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// secretRotation 为一次定向凭据轮换的结果
+type secretRotation struct {
+	Secret    string   `json:"secret"`
+	Upstreams []string `json:"upstreams"`
+	Affected  int      `json:"affected"`
+	Failed    []string `json:"failed,omitempty"`
+}
+
+// rotateSecret 重新推送 secret，并借助反向索引重新同步所有引用它的 upstream，
+// 使 OpenResty 使用新凭据而无需全量 reconcile。secret 推送失败时不再同步 upstream。
+func (w *Watcher) rotateSecret(namespace, name string) (*secretRotation, error) {
+	w.pending.Add(1)
+	defer w.pending.Add(-1)
+
+	secretKey := namespace + "/" + name
+	result := &secretRotation{
+		Secret:    secretKey,
+		Upstreams: w.secrets.upstreamsFor(secretKey),
+	}
+
+	if err := w.syncSecret(namespace, name); err != nil {
+		return nil, err
+	}
+
+	for _, upstreamKey := range result.Upstreams {
+		upstreamNamespace, upstreamName := splitObjectKey(upstreamKey)
+		upstream, err := w.getObject(upstreamGVR, upstreamNamespace, upstreamName)
+		if err == nil {
+			err = w.notifyOpenresty("POST", "/api/upstreams/update", upstream)
+		}
+		if err != nil {
+			slog.Error("Failed to re-sync upstream after rotating secret", append(objectLogAttrs("upstreams", upstreamNamespace, upstreamName), "secret", secretKey, "error", err)...)
+			result.Failed = append(result.Failed, upstreamKey)
+			continue
+		}
+		w.setUpstreamReady(upstream, nil)
+		result.Affected++
+	}
+
+	slog.Info("Rotated secret", append(objectKeyLogAttrs("secrets", secretKey), "resynced", result.Affected, "upstreams", len(result.Upstreams))...)
+	return result, nil
+}
+
+// handleSecretRotate POST ?secret=<namespace>/<name> 触发指定 secret 的定向轮换。
+// 有 upstream 同步失败时返回 500，secret 本身推送失败时返回 502。
+func (as *AdminServer) handleSecretRotate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	namespace, name, ok := strings.Cut(r.URL.Query().Get("secret"), "/")
+	if !ok || namespace == "" || name == "" {
+		http.Error(w, "secret must be specified as <namespace>/<name>", http.StatusBadRequest)
+		return
+	}
+
+	result, err := as.watcher.rotateSecret(namespace, name)
+	if err != nil {
+		slog.Error("Secret rotation failed", append(objectLogAttrs("secrets", namespace, name), "error", err)...)
+		http.Error(w, fmt.Sprintf("failed to push secret: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(result.Failed) > 0 {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// secretFlight 合并对同一个 secret 的并发同步：同一时刻只有一个 Get + 推送在执行，
+// 其他调用者等待并共享它的结果
+type secretFlight struct {
+	mu    sync.Mutex
+	calls map[string]*secretCall
+}
+
+type secretCall struct {
+	done chan struct{}
+	err  error
+}
+
+func newSecretFlight() *secretFlight {
+	return &secretFlight{calls: make(map[string]*secretCall)}
+}
+
+func (f *secretFlight) do(key string, fn func() error) error {
+	f.mu.Lock()
+	if call, ok := f.calls[key]; ok {
+		f.mu.Unlock()
+		<-call.done
+		return call.err
+	}
+	call := &secretCall{done: make(chan struct{})}
+	f.calls[key] = call
+	f.mu.Unlock()
+
+	call.err = fn()
+
+	f.mu.Lock()
+	delete(f.calls, key)
+	f.mu.Unlock()
+	close(call.done)
+	return call.err
+}
+
+// secretSyncConcurrencyFromEnv 读取 SECRET_SYNC_CONCURRENCY（默认 4）
+func secretSyncConcurrencyFromEnv() (int, error) {
+	concurrency, err := strconv.Atoi(getEnvOrDefault("SECRET_SYNC_CONCURRENCY", "4"))
+	if err != nil || concurrency < 1 {
+		return 0, fmt.Errorf("invalid SECRET_SYNC_CONCURRENCY")
+	}
+	return concurrency, nil
+}
+
+// syncSecretsForUpstreams 在全量同步时同步所有 upstream 引用的 secret。
+// 多个 upstream 共享的 secret 只同步一次，不同 secret 之间以 secretSyncConcurrency 的并发度并行。
+// 返回失败的 secret 数量，以及凭据未能同步的 upstream（upstream key -> 原因）。
+func (w *Watcher) syncSecretsForUpstreams(upstreams []unstructured.Unstructured) (int, map[string]error) {
+	// secret key -> 引用它的 upstream，无法解析 secretRef 的 upstream 直接计为失败
+	dependents := make(map[string][]string)
+	credentialErrs := make(map[string]error)
+	syncErrors := 0
+	// 错过删除事件的 upstream 不再参与 secretRef.keys 的并集，它们独占的 secret 随后被清理
+	w.secrets.retain(objectKeySet(upstreams))
+	for i := range upstreams {
+		upstream := &upstreams[i]
+		w.indexUpstreamSecret(upstream)
+
+		namespace, name, found, err := upstreamSecretRef(upstream)
+		if err != nil {
+			slog.Error("Failed to sync secrets for upstream", append(objectLogAttrs("upstreams", upstream.GetNamespace(), upstream.GetName()), "error", err)...)
+			credentialErrs[objectKey(upstream)] = err
+			syncErrors++
+			continue
+		}
+		if found {
+			key := namespace + "/" + name
+			dependents[key] = append(dependents[key], objectKey(upstream))
+		}
+	}
+
+	keys := make([]string, 0, len(dependents))
+	for key := range dependents {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var (
+		mu     sync.Mutex
+		failed []string
+		wg     sync.WaitGroup
+	)
+	sem := make(chan struct{}, w.secretSyncConcurrency)
+	for _, key := range keys {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(key string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			namespace, name := splitObjectKey(key)
+			if err := w.syncSecret(namespace, name); err != nil {
+				slog.Error("Failed to sync secret", append(objectLogAttrs("secrets", namespace, name), "upstreams", dependents[key], "error", err)...)
+				mu.Lock()
+				failed = append(failed, key)
+				for _, upstreamKey := range dependents[key] {
+					credentialErrs[upstreamKey] = err
+				}
+				mu.Unlock()
+			}
+		}(key)
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		slog.Error("Failed to sync secrets", "failed", failed, "total", len(keys))
+	} else if len(keys) > 0 {
+		slog.Info("Synced secrets successfully", "count", len(keys))
+	}
+	return syncErrors + len(failed), credentialErrs
+}
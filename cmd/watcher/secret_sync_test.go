@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSecretFlightSharesConcurrentCalls(t *testing.T) {
+	f := newSecretFlight()
+	var calls atomic.Int32
+	release := make(chan struct{})
+	started := make(chan struct{})
+	want := errors.New("push failed")
+
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		errs[0] = f.do("a/s", func() error {
+			calls.Add(1)
+			close(started)
+			<-release
+			return want
+		})
+	}()
+	<-started
+	for i := 1; i < len(errs); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = f.do("a/s", func() error {
+				calls.Add(1)
+				return nil
+			})
+		}(i)
+	}
+	// 等待其余调用者进入等待状态后再结束第一次调用
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("fn called %d times, want 1", n)
+	}
+	for i, err := range errs {
+		if err != want {
+			t.Errorf("caller %d got %v, want the shared error", i, err)
+		}
+	}
+
+	// 结束后的调用重新执行
+	if err := f.do("a/s", func() error { calls.Add(1); return nil }); err != nil || calls.Load() != 2 {
+		t.Errorf("call after completion: err = %v, calls = %d", err, calls.Load())
+	}
+}
+
+func TestSecretSyncConcurrencyFromEnv(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"", 4, false},
+		{"16", 16, false},
+		{"0", 0, true},
+		{"many", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if tt.value != "" {
+				t.Setenv("SECRET_SYNC_CONCURRENCY", tt.value)
+			}
+			got, err := secretSyncConcurrencyFromEnv()
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("got (%d, %v), want (%d, wantErr %v)", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+// testUpstream 构造引用 secretNamespace/secretName 的 upstream，secretName 为空时不引用 secret
+func testUpstream(namespace, name, secretNamespace, secretName string) unstructured.Unstructured {
+	upstream := unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "ossfe.imvictor.tech/v1",
+		"kind":       "OSSProxyUpstream",
+		"spec":       map[string]interface{}{"endpoint": "https://oss.example.com"},
+	}}
+	upstream.SetNamespace(namespace)
+	upstream.SetName(name)
+	if secretName != "" {
+		ref := map[string]interface{}{"name": secretName}
+		if secretNamespace != "" {
+			ref["namespace"] = secretNamespace
+		}
+		unstructured.SetNestedMap(upstream.Object, ref, "spec", "credentials", "secretRef")
+	}
+	return upstream
+}
+
+func testSecret(namespace, name string, data map[string][]byte) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Type:       corev1.SecretTypeOpaque,
+		Data:       data,
+	}
+}
+
+func TestSyncSecretsForUpstreams(t *testing.T) {
+	stub := newOpenrestyStub()
+	w := newTestWatcher(t, stub,
+		testSecret("a", "shared", map[string][]byte{"k": []byte("v")}),
+		testSecret("b", "own", map[string][]byte{"k": []byte("v")}),
+	)
+
+	upstreams := []unstructured.Unstructured{
+		testUpstream("a", "u1", "", "shared"),
+		testUpstream("a", "u2", "", "shared"),
+		testUpstream("b", "u3", "a", "shared"),
+		testUpstream("b", "u4", "", "own"),
+		testUpstream("b", "u5", "", "missing"),
+		testUpstream("b", "u6", "", ""),
+	}
+	failures, credentialErrs := w.syncSecretsForUpstreams(upstreams)
+
+	if failures != 1 {
+		t.Errorf("failures = %d, want 1", failures)
+	}
+	if len(credentialErrs) != 1 || credentialErrs["b/u5"] == nil {
+		t.Errorf("credentialErrs = %v, want only b/u5", credentialErrs)
+	}
+
+	pushed := make(map[string]int)
+	for _, req := range stub.posts() {
+		metadata := req.body["metadata"].(map[string]interface{})
+		pushed[fmt.Sprintf("%s/%s", metadata["namespace"], metadata["name"])]++
+	}
+	if pushed["a/shared"] != 1 || pushed["b/own"] != 1 || len(pushed) != 2 {
+		t.Errorf("pushed = %v, want a/shared and b/own once each", pushed)
+	}
+	if got := w.secrets.upstreamsFor("a/shared"); len(got) != 3 {
+		t.Errorf("a/shared dependents = %v, want 3 upstreams", got)
+	}
+}
+
+func TestPushSecretPreservesBinaryValues(t *testing.T) {
+	// DER 编码的私钥等二进制值不是合法的 UTF-8，直接作为 JSON 字符串发送会被替换为 U+FFFD
+	binary := []byte{0x30, 0x82, 0xff, 0xfe, 0x00, 0xc3, 0x28}
+	stub := newOpenrestyStub()
+	w := newTestWatcher(t, stub, testSecret("a", "s", map[string][]byte{
+		"der":   binary,
+		"plain": []byte("hello"),
+		"empty": {},
+	}))
+
+	if err := w.pushSecret("a", "s"); err != nil {
+		t.Fatalf("pushSecret: %v", err)
+	}
+
+	posts := stub.posts()
+	if len(posts) != 1 || posts[0].path != "/api/secrets/update" {
+		t.Fatalf("unexpected pushes: %+v", posts)
+	}
+	body := posts[0].body
+	if body["dataEncoding"] != "base64" {
+		t.Errorf("dataEncoding = %v, want base64", body["dataEncoding"])
+	}
+
+	data := body["data"].(map[string]interface{})
+	for key, want := range map[string][]byte{"der": binary, "plain": []byte("hello"), "empty": {}} {
+		encoded, ok := data[key].(string)
+		if !ok {
+			t.Errorf("data[%s] missing", key)
+			continue
+		}
+		got, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			t.Errorf("data[%s] is not valid base64: %v", key, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("data[%s] = %x, want %x", key, got, want)
+		}
+	}
+}
+
+func TestPushSecretMissing(t *testing.T) {
+	stub := newOpenrestyStub()
+	w := newTestWatcher(t, stub)
+
+	if err := w.pushSecret("a", "missing"); err == nil {
+		t.Fatal("expected an error for a missing secret")
+	}
+	if n := len(stub.posts()); n != 0 {
+		t.Errorf("pushed %d times for a missing secret", n)
+	}
+}
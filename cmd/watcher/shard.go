@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	shardLeaseLabel  = "ossfe.imvictor.tech/shard-member"
+	shardLeasePrefix = "oss-fe-proxy-shard-"
+	// shardLeaderLease 为 leader 选举使用的 Lease，leader 负责发布成员列表
+	shardLeaderLease = "oss-fe-proxy-shard-leader"
+	// shardRingLease 的 shardMembersAnnotation 注解保存 leader 发布的成员列表（排序后以逗号分隔）
+	shardRingLease         = "oss-fe-proxy-shard-ring"
+	shardMembersAnnotation = "ossfe.imvictor.tech/shard-members"
+)
+
+// hashRing 是基于虚拟节点的一致性哈希环
+type hashRing struct {
+	points []uint32
+	owners map[uint32]string
+}
+
+func newHashRing(members []string, virtualNodes int) *hashRing {
+	ring := &hashRing{owners: make(map[uint32]string)}
+	for _, member := range members {
+		for i := 0; i < virtualNodes; i++ {
+			point := hashKey(member + "#" + strconv.Itoa(i))
+			ring.points = append(ring.points, point)
+			ring.owners[point] = member
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool { return ring.points[i] < ring.points[j] })
+	return ring
+}
+
+// owner 返回负责该 key 的成员，环为空时返回空字符串
+func (r *hashRing) owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := hashKey(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// shardManager 用一致性哈希把 route/upstream 对 apiserver 的写入（status、Event、finalizer）分配给成员，
+// 每个 Pod 仍把全部配置推送到自己的 OpenResty。成员通过各自续约的 Lease 发现，由选举出的 leader
+// 汇总后发布到 shardRingLease，所有 Pod 按同一份列表构建哈希环，避免各自列出 Lease 时看到不同的成员。
+type shardManager struct {
+	enabled       bool
+	identity      string
+	namespace     string
+	leaseDuration time.Duration
+	virtualNodes  int
+
+	mu      sync.RWMutex
+	members []string
+	ring    *hashRing
+}
+
+func newShardManager() (*shardManager, error) {
+	enabled, err := boolFromEnv("SHARDING_ENABLED", "false")
+	if err != nil {
+		return nil, err
+	}
+	sm := &shardManager{enabled: enabled}
+	if !sm.enabled {
+		return sm, nil
+	}
+
+	sm.identity = os.Getenv("POD_NAME")
+	if sm.identity == "" {
+		return nil, fmt.Errorf("POD_NAME is required when SHARDING_ENABLED=true")
+	}
+	sm.namespace = getEnvOrDefault("POD_NAMESPACE", "default")
+
+	leaseDuration, err := time.ParseDuration(getEnvOrDefault("SHARD_LEASE_DURATION", "15s"))
+	if err != nil || leaseDuration <= 0 {
+		return nil, fmt.Errorf("invalid SHARD_LEASE_DURATION")
+	}
+	sm.leaseDuration = leaseDuration
+
+	virtualNodes, err := strconv.Atoi(getEnvOrDefault("SHARD_VIRTUAL_NODES", "100"))
+	if err != nil || virtualNodes <= 0 {
+		return nil, fmt.Errorf("invalid SHARD_VIRTUAL_NODES")
+	}
+	sm.virtualNodes = virtualNodes
+
+	// leader 发布成员列表之前，先假定自己负责全部对象
+	sm.members = []string{sm.identity}
+	sm.ring = newHashRing(sm.members, sm.virtualNodes)
+	return sm, nil
+}
+
+// owns 判断当前 Pod 是否负责该 key；未启用分片时始终返回 true
+func (sm *shardManager) owns(key string) bool {
+	if !sm.enabled {
+		return true
+	}
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.ring.owner(key) == sm.identity
+}
+
+// ownsObject 判断当前 Pod 是否负责该 route/upstream 的 status、Event 与 finalizer。
+// key 带上 kind，同名的 route 与 upstream 分别分配
+func (w *Watcher) ownsObject(obj *unstructured.Unstructured) bool {
+	return w.shards.owns(obj.GetKind() + "/" + objectKey(obj))
+}
+
+// joinShard 在初始同步前注册自己的 Lease 并读取已发布的成员列表，避免启动时写入不属于自己的对象
+func (w *Watcher) joinShard() error {
+	if err := w.renewShardLease(); err != nil {
+		return fmt.Errorf("failed to create shard lease: %v", err)
+	}
+	return w.refreshShardMembers(false)
+}
+
+// runSharding 参与 leader 选举，并周期性续约自己的 Lease、读取成员列表，成员变化时重新平衡
+func (w *Watcher) runSharding() {
+	sm := w.shards
+	slog.Info("Sharding enabled", "identity", sm.identity, "leaseDuration", sm.leaseDuration.String(), "virtualNodes", sm.virtualNodes)
+	go w.runShardLeaderElection()
+
+	ticker := time.NewTicker(sm.leaseDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		if err := w.renewShardLease(); err != nil {
+			slog.Warn("Failed to renew shard lease", "identity", sm.identity, "error", err)
+		} else if err := w.refreshShardMembers(true); err != nil {
+			slog.Warn("Failed to refresh shard members", "identity", sm.identity, "error", err)
+		}
+
+		select {
+		case <-w.ctx.Done():
+			w.releaseShardLease()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Watcher) renewShardLease() error {
+	sm := w.shards
+	leases := w.clientset.CoordinationV1().Leases(sm.namespace)
+	name := shardLeasePrefix + sm.identity
+	now := metav1.NewMicroTime(time.Now())
+	durationSeconds := int32(sm.leaseDuration.Seconds())
+
+	ctx, cancel := w.apiContext()
+	defer cancel()
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: sm.namespace,
+				Labels:    map[string]string{shardLeaseLabel: "true"},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &sm.identity,
+				LeaseDurationSeconds: &durationSeconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		_, err = leases.Create(ctx, lease, metav1.CreateOptions{})
+		return apiTimeoutError(ctx, err, "creating shard lease", w.config.apiTimeout)
+	}
+	if err != nil {
+		return apiTimeoutError(ctx, err, "getting shard lease", w.config.apiTimeout)
+	}
+
+	lease.Spec.HolderIdentity = &sm.identity
+	lease.Spec.LeaseDurationSeconds = &durationSeconds
+	lease.Spec.RenewTime = &now
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	return apiTimeoutError(ctx, err, "renewing shard lease", w.config.apiTimeout)
+}
+
+// releaseShardLease 在退出时删除自己的 Lease，使其他成员尽快接管。此时 w.ctx 已结束，单独计算超时。
+func (w *Watcher) releaseShardLease() {
+	sm := w.shards
+	name := shardLeasePrefix + sm.identity
+	ctx, cancel := context.WithTimeout(context.Background(), w.config.apiTimeout)
+	defer cancel()
+	err := w.clientset.CoordinationV1().Leases(sm.namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err = apiTimeoutError(ctx, err, "deleting shard lease", w.config.apiTimeout); err != nil && !errors.IsNotFound(err) {
+		slog.Warn("Failed to release shard lease", "lease", name, "error", err)
+		return
+	}
+	slog.Info("Released shard lease", "lease", name)
+}
+
+// liveShardMembers 列出带成员标签、仍在有效期内的 Lease，返回排序后的成员
+func (w *Watcher) liveShardMembers() ([]string, error) {
+	sm := w.shards
+	ctx, cancel := w.apiContext()
+	defer cancel()
+	leases, err := w.clientset.CoordinationV1().Leases(sm.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: shardLeaseLabel + "=true",
+	})
+	if err = apiTimeoutError(ctx, err, "listing shard leases", w.config.apiTimeout); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var members []string
+	for _, lease := range leases.Items {
+		if lease.Spec.HolderIdentity == nil || lease.Spec.RenewTime == nil {
+			continue
+		}
+		duration := sm.leaseDuration
+		if lease.Spec.LeaseDurationSeconds != nil {
+			duration = time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+		}
+		if lease.Spec.RenewTime.Add(duration).Before(now) {
+			continue
+		}
+		members = append(members, *lease.Spec.HolderIdentity)
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+// runShardLeaderElection 参与 leader 选举，当选后发布成员列表；失去 leader 身份后重新参选，直到 w.ctx 结束
+func (w *Watcher) runShardLeaderElection() {
+	sm := w.shards
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Name: shardLeaderLease, Namespace: sm.namespace},
+			Client:     w.clientset.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: sm.identity},
+		},
+		LeaseDuration:   sm.leaseDuration,
+		RenewDeadline:   sm.leaseDuration * 2 / 3,
+		RetryPeriod:     sm.leaseDuration / 5,
+		ReleaseOnCancel: true,
+		Name:            shardLeaderLease,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: w.publishShardMembersLoop,
+			OnStoppedLeading: func() {
+				slog.Info("Stopped leading shard membership", "identity", sm.identity)
+			},
+			OnNewLeader: func(identity string) {
+				slog.Info("Shard leader elected", "leader", identity)
+			},
+		},
+	})
+	if err != nil {
+		slog.Error("Failed to set up shard leader election", "error", err)
+		return
+	}
+	for w.ctx.Err() == nil {
+		elector.Run(w.ctx)
+	}
+}
+
+// publishShardMembersLoop 在担任 leader 期间每 SHARD_LEASE_DURATION / 3 发布一次成员列表
+func (w *Watcher) publishShardMembersLoop(ctx context.Context) {
+	slog.Info("Leading shard membership", "identity", w.shards.identity)
+	ticker := time.NewTicker(w.shards.leaseDuration / 3)
+	defer ticker.Stop()
+	for {
+		if err := w.publishShardMembers(); err != nil {
+			slog.Warn("Failed to publish shard members", "identity", w.shards.identity, "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishShardMembers 把存活成员写入 shardRingLease 的注解，列表未变化时不写入
+func (w *Watcher) publishShardMembers() error {
+	members, err := w.liveShardMembers()
+	if err != nil {
+		return err
+	}
+	value := strings.Join(members, ",")
+
+	sm := w.shards
+	leases := w.clientset.CoordinationV1().Leases(sm.namespace)
+	ctx, cancel := w.apiContext()
+	defer cancel()
+	lease, err := leases.Get(ctx, shardRingLease, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        shardRingLease,
+				Namespace:   sm.namespace,
+				Annotations: map[string]string{shardMembersAnnotation: value},
+			},
+			Spec: coordinationv1.LeaseSpec{HolderIdentity: &sm.identity},
+		}
+		_, err = leases.Create(ctx, lease, metav1.CreateOptions{})
+		return apiTimeoutError(ctx, err, "creating shard ring lease", w.config.apiTimeout)
+	}
+	if err != nil {
+		return apiTimeoutError(ctx, err, "getting shard ring lease", w.config.apiTimeout)
+	}
+	if current, ok := lease.Annotations[shardMembersAnnotation]; ok && current == value {
+		return nil
+	}
+
+	if lease.Annotations == nil {
+		lease.Annotations = make(map[string]string)
+	}
+	lease.Annotations[shardMembersAnnotation] = value
+	lease.Spec.HolderIdentity = &sm.identity
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	if err = apiTimeoutError(ctx, err, "updating shard ring lease", w.config.apiTimeout); err != nil {
+		return err
+	}
+	slog.Info("Published shard members", "memberCount", len(members), "members", members)
+	return nil
+}
+
+// refreshShardMembers 读取 leader 发布的成员列表并重建哈希环。leader 尚未发布时保持当前的哈希环。
+// rebalance 为 true 且初始同步已完成时，成员变化后在后台执行一次全量 reconcile，
+// 由新的负责 Pod 补写 status、Event 与 finalizer，并清理正在删除的 route
+func (w *Watcher) refreshShardMembers(rebalance bool) error {
+	sm := w.shards
+	ctx, cancel := w.apiContext()
+	lease, err := w.clientset.CoordinationV1().Leases(sm.namespace).Get(ctx, shardRingLease, metav1.GetOptions{})
+	err = apiTimeoutError(ctx, err, "getting shard ring lease", w.config.apiTimeout)
+	cancel()
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var members []string
+	for _, member := range strings.Split(lease.Annotations[shardMembersAnnotation], ",") {
+		if member != "" {
+			members = append(members, member)
+		}
+	}
+	sort.Strings(members)
+
+	sm.mu.Lock()
+	if equalStrings(members, sm.members) {
+		sm.mu.Unlock()
+		return nil
+	}
+	sm.members = members
+	sm.ring = newHashRing(members, sm.virtualNodes)
+	sm.mu.Unlock()
+
+	slog.Info("Shard membership changed", "memberCount", len(members), "members", members)
+	if rebalance && w.ready.Load() {
+		// 全量 reconcile 可能较慢，不能阻塞自己 Lease 的续约
+		go w.reconcileAll(reconcileShardRebalance)
+	}
+	return nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
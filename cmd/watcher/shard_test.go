@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+// setTestShards 启用分片，本 Pod 为 identity，当前哈希环只包含 members
+func setTestShards(w *Watcher, identity string, members ...string) {
+	w.shards = &shardManager{
+		enabled:       true,
+		identity:      identity,
+		namespace:     "oss-fe-proxy",
+		leaseDuration: 15 * time.Second,
+		virtualNodes:  10,
+		members:       members,
+		ring:          newHashRing(members, 10),
+	}
+}
+
+// memberLease 返回成员 identity 的 Lease，renewed 为上次续约的时间
+func memberLease(identity string, renewed time.Time) *coordinationv1.Lease {
+	duration := int32(15)
+	renewTime := metav1.NewMicroTime(renewed)
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      shardLeasePrefix + identity,
+			Namespace: "oss-fe-proxy",
+			Labels:    map[string]string{shardLeaseLabel: "true"},
+		},
+		Spec: coordinationv1.LeaseSpec{HolderIdentity: &identity, LeaseDurationSeconds: &duration, RenewTime: &renewTime},
+	}
+}
+
+func TestShardOwnershipGatesAPIServerWrites(t *testing.T) {
+	for _, owned := range []bool{true, false} {
+		name := "owned"
+		if !owned {
+			name = "owned by another member"
+		}
+		t.Run(name, func(t *testing.T) {
+			stub := newOpenrestyStub()
+			w := newTestWatcher(t, stub)
+			w.config.routeFinalizer = true
+			createTestObject(t, w, routeGVR, testRoute(routeSpec("a.example.com")))
+
+			setTestShards(w, "a", "a", "b")
+			w.shards.identity = w.shards.ring.owner("OSSProxyRoute/web/r")
+			if !owned {
+				w.shards.identity = map[string]string{"a": "b", "b": "a"}[w.shards.identity]
+			}
+
+			routes := w.client.Resource(routeGVR).Namespace("web")
+			route, err := routes.Get(context.Background(), "r", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := w.handleEvent(watch.Event{Type: watch.Added, Object: route}, "routes"); err != nil {
+				t.Fatal(err)
+			}
+
+			// 不论是否负责，都推送到本 Pod 的 OpenResty
+			if posts := stub.posts(); len(posts) != 1 || pushedKey(posts[0]) != "/api/routes/update web/r" {
+				t.Fatalf("pushes = %v", posts)
+			}
+			route, err = routes.Get(context.Background(), "r", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hasRouteFinalizer(route); got != owned {
+				t.Errorf("finalizer added = %v, want %v", got, owned)
+			}
+			if got := hasCondition(route, syncedConditionType, syncedReason); got != owned {
+				t.Errorf("Synced condition written = %v, want %v", got, owned)
+			}
+			if got := len(w.recorder.(*record.FakeRecorder).Events) > 0; got != owned {
+				t.Errorf("event recorded = %v, want %v", got, owned)
+			}
+		})
+	}
+}
+
+func TestFinalizeRouteOnNonOwner(t *testing.T) {
+	stub := newOpenrestyStub()
+	w := newTestWatcher(t, stub)
+	route := testRoute(routeSpec("a.example.com"))
+	route.SetFinalizers([]string{routeFinalizer})
+	createTestObject(t, w, routeGVR, route)
+
+	setTestShards(w, "a", "a", "b")
+	w.shards.identity = map[string]string{"a": "b", "b": "a"}[w.shards.ring.owner("OSSProxyRoute/web/r")]
+
+	// 其他成员只从自己的 OpenResty 删除，finalizer 留给负责的 Pod 移除
+	if err := w.finalizeRoute(nil, route); err != nil {
+		t.Fatal(err)
+	}
+	if posts := stub.posts(); len(posts) != 1 || pushedKey(posts[0]) != "/api/routes/delete web/r" {
+		t.Fatalf("pushes = %v", posts)
+	}
+	current, err := w.client.Resource(routeGVR).Namespace("web").Get(context.Background(), "r", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasRouteFinalizer(current) {
+		t.Error("non-owner removed the finalizer")
+	}
+}
+
+func TestShardMembership(t *testing.T) {
+	now := time.Now()
+	stub := newOpenrestyStub()
+	w := newTestWatcher(t, stub)
+	w.clientset = fake.NewSimpleClientset(
+		memberLease("a", now),
+		memberLease("c", now),
+		// 已过期的成员不再参与分配
+		memberLease("b", now.Add(-time.Minute)),
+	)
+	setTestShards(w, "a", "a")
+
+	// leader 发布之前保持当前的哈希环
+	if err := w.refreshShardMembers(false); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(w.shards.members, []string{"a"}) {
+		t.Fatalf("members before publishing = %v", w.shards.members)
+	}
+
+	if err := w.publishShardMembers(); err != nil {
+		t.Fatal(err)
+	}
+	lease, err := w.clientset.CoordinationV1().Leases("oss-fe-proxy").Get(context.Background(), shardRingLease, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lease.Annotations[shardMembersAnnotation]; got != "a,c" {
+		t.Errorf("published members = %q, want %q", got, "a,c")
+	}
+
+	if err := w.refreshShardMembers(false); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(w.shards.members, []string{"a", "c"}) {
+		t.Errorf("members = %v, want [a c]", w.shards.members)
+	}
+
+	// 成员变化后的重新平衡是一次全量 reconcile
+	if err := w.clientset.CoordinationV1().Leases("oss-fe-proxy").Delete(context.Background(), shardLeasePrefix+"c", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.publishShardMembers(); err != nil {
+		t.Fatal(err)
+	}
+	startTestWatcher(t, w)
+	w.ready.Store(true)
+	if err := w.refreshShardMembers(true); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(w.shards.members, []string{"a"}) {
+		t.Errorf("members after c left = %v, want [a]", w.shards.members)
+	}
+	reconciled := func() bool {
+		w.metrics.reconciles.mu.Lock()
+		defer w.metrics.reconciles.mu.Unlock()
+		return w.metrics.reconciles.values[reconcileShardRebalance+labelSep+pushSuccess] > 0
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !reconciled() {
+		if time.Now().After(deadline) {
+			t.Fatal("membership change did not trigger a reconcile")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestShardLeaderPublishesMembers(t *testing.T) {
+	stub := newOpenrestyStub()
+	w := newTestWatcher(t, stub)
+	w.clientset = fake.NewSimpleClientset(memberLease("a", time.Now()), memberLease("b", time.Now()))
+	setTestShards(w, "a", "a")
+
+	done := make(chan struct{})
+	go func() {
+		w.runShardLeaderElection()
+		close(done)
+	}()
+
+	leases := w.clientset.CoordinationV1().Leases("oss-fe-proxy")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		lease, err := leases.Get(context.Background(), shardRingLease, metav1.GetOptions{})
+		if err == nil && lease.Annotations[shardMembersAnnotation] == "a,b" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("leader did not publish members: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 退出时释放 leader Lease，其他成员无需等待其过期
+	w.cancel()
+	<-done
+	lease, err := leases.Get(context.Background(), shardLeaderLease, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if holder := lease.Spec.HolderIdentity; holder != nil && *holder != "" {
+		t.Errorf("leader lease still held by %q after shutdown", *holder)
+	}
+}
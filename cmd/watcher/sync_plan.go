@@ -0,0 +1,263 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// 变更类型
+const (
+	planAdd    = "add"
+	planUpdate = "update"
+	planDelete = "delete"
+)
+
+// errStalePlan 表示计划生成后集群或 OpenResty 的状态已经变化
+var errStalePlan = errors.New("plan is stale, cluster or OpenResty state has changed since it was computed")
+
+// planChange 是计划中的一项变更。哈希为对象内容哈希，参与计划 ID 的计算。
+type planChange struct {
+	Action     string   `json:"action"`
+	Kind       string   `json:"kind"`
+	Key        string   `json:"key"`
+	Hosts      []string `json:"hosts,omitempty"`
+	LocalHash  string   `json:"localHash,omitempty"`
+	RemoteHash string   `json:"remoteHash,omitempty"`
+}
+
+// syncPlan 是一次 reconcile 将对 OpenResty 做出的变更。ID 由全部变更计算得出，
+// 相同的集群与 OpenResty 状态总是得到相同的 ID，apply 时据此判断计划是否过期。
+type syncPlan struct {
+	ID          string         `json:"id"`
+	GeneratedAt time.Time      `json:"generatedAt"`
+	Summary     map[string]int `json:"summary"`
+	Changes     []planChange   `json:"changes"`
+
+	// objects 为 add/update 对应的集群对象，key 为 kind/namespace/name
+	objects map[string]*unstructured.Unstructured
+}
+
+// planResult 是执行计划的结果
+type planResult struct {
+	PlanID  string   `json:"planId"`
+	Applied int      `json:"applied"`
+	Failed  []string `json:"failed"`
+}
+
+// computeSyncPlan 对比集群中的 route/upstream 与 OpenResty 持有的内容哈希，计算需要的变更但不执行。
+// 变更按 upstream 新增/更新、route 新增/更新、route 删除、upstream 删除的顺序排列，与全量同步一致地避免悬空引用。
+// secret 随 upstream 一起推送，不单独列出。
+func (w *Watcher) computeSyncPlan() (*syncPlan, error) {
+	routes, err := w.listObjectsWithTimeout(routeGVR)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routes: %v", err)
+	}
+	upstreams, err := w.listObjectsWithTimeout(upstreamGVR)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list upstreams: %v", err)
+	}
+
+	remoteRoutes, remoteUpstreams, err := w.fetchAdoptableHashes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch OpenResty state: %v", err)
+	}
+	var heldRouteHosts map[string][]string
+	if err := w.fetchOpenresty("/api/routes/keys", &heldRouteHosts); err != nil {
+		return nil, fmt.Errorf("failed to list routes in OpenResty: %v", err)
+	}
+
+	plan := &syncPlan{
+		GeneratedAt: time.Now().UTC(),
+		Summary:     map[string]int{planAdd: 0, planUpdate: 0, planDelete: 0},
+		Changes:     []planChange{},
+		objects:     make(map[string]*unstructured.Unstructured),
+	}
+
+	plan.addUpserts("OSSProxyUpstream", upstreams, remoteUpstreams)
+	plan.addUpserts("OSSProxyRoute", routes, remoteRoutes)
+	plan.addDeletes("OSSProxyRoute", routes, remoteRoutes, heldRouteHosts)
+	plan.addDeletes("OSSProxyUpstream", upstreams, remoteUpstreams, nil)
+
+	data, err := json.Marshal(plan.Changes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode plan: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	plan.ID = hex.EncodeToString(sum[:8])
+	return plan, nil
+}
+
+// addUpserts 列出集群中存在、但 OpenResty 中不存在或内容不同的对象
+func (p *syncPlan) addUpserts(kind string, objects []unstructured.Unstructured, remote map[string]string) {
+	sort.Slice(objects, func(i, j int) bool { return objectKey(&objects[i]) < objectKey(&objects[j]) })
+	for i := range objects {
+		obj := &objects[i]
+		key := objectKey(obj)
+		localHash := objectHash(obj)
+		remoteHash, held := remote[key]
+
+		change := planChange{Kind: kind, Key: key, LocalHash: localHash, RemoteHash: remoteHash}
+		switch {
+		case !held:
+			change.Action = planAdd
+		case remoteHash != localHash:
+			change.Action = planUpdate
+		default:
+			continue
+		}
+		if kind == "OSSProxyRoute" {
+			change.Hosts, _, _ = unstructured.NestedStringSlice(obj.Object, "spec", "hosts")
+		}
+		p.Changes = append(p.Changes, change)
+		p.Summary[change.Action]++
+		p.objects[kind+"/"+key] = obj
+	}
+}
+
+// addDeletes 列出 OpenResty 中存在、但集群中已没有对应对象的条目
+func (p *syncPlan) addDeletes(kind string, objects []unstructured.Unstructured, remote map[string]string, hosts map[string][]string) {
+	existing := objectKeySet(objects)
+	keys := make([]string, 0, len(remote))
+	for key := range remote {
+		if !existing[key] {
+			keys = append(keys, key)
+		}
+	}
+	// route 可能在 OpenResty 中没有哈希记录，但仍占用域名
+	for key := range hosts {
+		if _, ok := remote[key]; !ok && !existing[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		p.Changes = append(p.Changes, planChange{
+			Action:     planDelete,
+			Kind:       kind,
+			Key:        key,
+			Hosts:      hosts[key],
+			RemoteHash: remote[key],
+		})
+		p.Summary[planDelete]++
+	}
+}
+
+// logSyncPlan 将计划摘要和每项变更输出到日志
+func logSyncPlan(plan *syncPlan) {
+	slog.Info("Sync plan computed", "plan", plan.ID,
+		"add", plan.Summary[planAdd], "update", plan.Summary[planUpdate], "delete", plan.Summary[planDelete])
+	for _, c := range plan.Changes {
+		slog.Info("Sync plan change", append(objectKeyLogAttrs(kindLogResource(c.Kind), c.Key), "plan", plan.ID, "action", c.Action)...)
+	}
+}
+
+// applySyncPlan 重新计算计划并与 planID 比较，一致时执行其中的变更，否则返回 errStalePlan
+func (w *Watcher) applySyncPlan(planID string) (*planResult, error) {
+	w.pending.Add(1)
+	defer w.pending.Add(-1)
+
+	plan, err := w.computeSyncPlan()
+	if err != nil {
+		return nil, err
+	}
+	if plan.ID != planID {
+		return nil, errStalePlan
+	}
+
+	result := &planResult{PlanID: plan.ID, Failed: []string{}}
+	for _, c := range plan.Changes {
+		if err := w.applyPlanChange(plan, c); err != nil {
+			slog.Error("Failed to apply sync plan change", append(objectKeyLogAttrs(kindLogResource(c.Kind), c.Key), "plan", plan.ID, "action", c.Action, "error", err)...)
+			result.Failed = append(result.Failed, c.Kind+"/"+c.Key)
+			continue
+		}
+		result.Applied++
+	}
+
+	slog.Info("Applied sync plan", "plan", plan.ID, "applied", result.Applied, "changes", len(plan.Changes))
+	return result, nil
+}
+
+func (w *Watcher) applyPlanChange(plan *syncPlan, c planChange) error {
+	resourceType := "routes"
+	if c.Kind == "OSSProxyUpstream" {
+		resourceType = "upstreams"
+	}
+
+	if c.Action != planDelete {
+		// 与 watch 事件走同一条路径，upstream 会级联推送其 secret
+		return w.handleEvent(watch.Event{Type: watch.Modified, Object: plan.objects[c.Kind+"/"+c.Key]}, resourceType)
+	}
+
+	stub := newStubObject(c.Kind, c.Key)
+	if c.Kind == "OSSProxyRoute" {
+		// delete_route 按 spec.hosts 删除，使用 OpenResty 中记录的域名
+		hosts := make([]interface{}, 0, len(c.Hosts))
+		for _, host := range c.Hosts {
+			hosts = append(hosts, host)
+		}
+		unstructured.SetNestedSlice(stub.Object, hosts, "spec", "hosts")
+	}
+	return w.notifyOpenresty("POST", "/api/"+resourceType+"/delete", stub)
+}
+
+// handleSyncPlan GET 计算并返回当前的同步计划，不做任何变更
+func (as *AdminServer) handleSyncPlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	plan, err := as.watcher.computeSyncPlan()
+	if err != nil {
+		slog.Error("Failed to compute sync plan", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logSyncPlan(plan)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
+
+// handleSyncApply POST ?plan=<id> 执行之前计算的计划。计划已过期时返回 409，有变更执行失败时返回 500。
+func (as *AdminServer) handleSyncApply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	planID := r.URL.Query().Get("plan")
+	if planID == "" {
+		http.Error(w, "plan must be specified", http.StatusBadRequest)
+		return
+	}
+
+	result, err := as.watcher.applySyncPlan(planID)
+	if errors.Is(err, errStalePlan) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to apply sync plan", "plan", planID, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(result.Failed) > 0 {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSyncPlanChanges(t *testing.T) {
+	route := func(name string, hosts ...string) unstructured.Unstructured {
+		r := testRoute(routeSpec(hosts...))
+		r.SetName(name)
+		return *r
+	}
+	unchanged := route("unchanged", "u.example.com")
+	changed := route("changed", "c.example.com")
+	added := route("added", "a.example.com")
+	routes := []unstructured.Unstructured{added, changed, unchanged}
+
+	remote := map[string]string{
+		"web/unchanged": objectHash(&unchanged),
+		"web/changed":   "stale",
+		"web/gone":      "old",
+	}
+	heldHosts := map[string][]string{"web/gone": {"g.example.com"}, "web/orphan": {"o.example.com"}}
+
+	plan := &syncPlan{
+		Summary: map[string]int{planAdd: 0, planUpdate: 0, planDelete: 0},
+		objects: make(map[string]*unstructured.Unstructured),
+	}
+	plan.addUpserts("OSSProxyRoute", routes, remote)
+	plan.addDeletes("OSSProxyRoute", routes, remote, heldHosts)
+
+	type change struct{ action, key string }
+	var got []change
+	for _, c := range plan.Changes {
+		got = append(got, change{c.Action, c.Key})
+	}
+	want := []change{
+		{planAdd, "web/added"},
+		{planUpdate, "web/changed"},
+		{planDelete, "web/gone"},
+		{planDelete, "web/orphan"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("changes = %v, want %v", got, want)
+	}
+	if want := map[string]int{planAdd: 1, planUpdate: 1, planDelete: 2}; !reflect.DeepEqual(plan.Summary, want) {
+		t.Errorf("summary = %v, want %v", plan.Summary, want)
+	}
+
+	if c := plan.Changes[1]; c.RemoteHash != "stale" || c.LocalHash != objectHash(&changed) || !reflect.DeepEqual(c.Hosts, []string{"c.example.com"}) {
+		t.Errorf("update change = %+v", c)
+	}
+	if c := plan.Changes[3]; c.RemoteHash != "" || !reflect.DeepEqual(c.Hosts, []string{"o.example.com"}) {
+		t.Errorf("delete of a route without a hash = %+v", c)
+	}
+	if _, ok := plan.objects["OSSProxyRoute/web/added"]; !ok || len(plan.objects) != 2 {
+		t.Errorf("objects = %v, want the added and changed routes", plan.objects)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// syncItem 是一次处理失败、等待按退避重试的同步。只记录对象的标识，重试时从 informer 缓存读取最新内容，
+// 避免推送过时的数据。
+type syncItem struct {
+	GVR          schema.GroupVersionResource
+	ResourceType string
+	Namespace    string
+	Name         string
+	Operation    watch.EventType
+}
+
+func (i syncItem) key() string {
+	return i.ResourceType + "/" + i.Namespace + "/" + i.Name
+}
+
+// syncQueue 以指数退避重试处理失败的事件，超过 maxRetries 次后在对象上记录 Warning Event，
+// 并交给 retryQueue 按固定间隔继续重试
+type syncQueue struct {
+	queue      workqueue.RateLimitingInterface
+	maxRetries int
+
+	// deleted 保存等待重试的删除事件的对象，对象已从缓存中移除，无法再读取
+	mu      sync.Mutex
+	deleted map[syncItem]*unstructured.Unstructured
+}
+
+// syncQueueFromEnv 读取 SYNC_MAX_RETRIES（默认 5）、SYNC_RETRY_BASE_DELAY（默认 1s）和 SYNC_RETRY_MAX_DELAY（默认 5m）
+func syncQueueFromEnv() (*syncQueue, error) {
+	maxRetries, err := strconv.Atoi(getEnvOrDefault("SYNC_MAX_RETRIES", "5"))
+	if err != nil || maxRetries < 1 {
+		return nil, fmt.Errorf("invalid SYNC_MAX_RETRIES")
+	}
+	baseDelay, err := time.ParseDuration(getEnvOrDefault("SYNC_RETRY_BASE_DELAY", "1s"))
+	if err != nil || baseDelay <= 0 {
+		return nil, fmt.Errorf("invalid SYNC_RETRY_BASE_DELAY")
+	}
+	maxDelay, err := time.ParseDuration(getEnvOrDefault("SYNC_RETRY_MAX_DELAY", "5m"))
+	if err != nil || maxDelay < baseDelay {
+		return nil, fmt.Errorf("invalid SYNC_RETRY_MAX_DELAY")
+	}
+
+	return &syncQueue{
+		queue: workqueue.NewRateLimitingQueueWithConfig(
+			workqueue.NewItemExponentialFailureRateLimiter(baseDelay, maxDelay),
+			workqueue.RateLimitingQueueConfig{Name: "openresty-sync"},
+		),
+		maxRetries: maxRetries,
+		deleted:    make(map[syncItem]*unstructured.Unstructured),
+	}, nil
+}
+
+// enqueueFailedSync 将处理失败的事件加入退避重试队列
+func (w *Watcher) enqueueFailedSync(resourceType string, eventType watch.EventType, obj *unstructured.Unstructured) {
+	item := syncItem{
+		GVR:          resourceGVR(resourceType),
+		ResourceType: resourceType,
+		Namespace:    obj.GetNamespace(),
+		Name:         obj.GetName(),
+		Operation:    eventType,
+	}
+
+	q := w.syncQueue
+	q.mu.Lock()
+	if eventType == watch.Deleted {
+		q.deleted[item] = obj
+	}
+	q.mu.Unlock()
+	q.queue.AddRateLimited(item)
+}
+
+func resourceGVR(resourceType string) schema.GroupVersionResource {
+	if resourceType == "upstreams" {
+		return upstreamGVR
+	}
+	return routeGVR
+}
+
+// runSyncQueue 处理退避重试队列，直到 ctx 结束
+func (w *Watcher) runSyncQueue() {
+	go func() {
+		<-w.ctx.Done()
+		w.syncQueue.queue.ShutDown()
+	}()
+
+	for w.processNextSync() {
+	}
+}
+
+func (w *Watcher) processNextSync() bool {
+	q := w.syncQueue
+	obj, shutdown := q.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer q.queue.Done(obj)
+	item := obj.(syncItem)
+
+	q.mu.Lock()
+	deleted := q.deleted[item]
+	q.mu.Unlock()
+
+	// 排空期间不再重试，交给 retryQueue 持久化，由新 Pod 继续处理
+	if w.draining.Load() {
+		w.finishSync(item, deleted)
+		obj := deleted
+		if obj == nil {
+			obj = &unstructured.Unstructured{Object: map[string]interface{}{}}
+			obj.SetNamespace(item.Namespace)
+			obj.SetName(item.Name)
+		}
+		w.retryQueue.record(item.ResourceType, item.Operation, obj, fmt.Errorf("retry interrupted by drain"))
+		return true
+	}
+
+	w.pending.Add(1)
+	current, err := w.retrySync(item, deleted)
+	w.pending.Add(-1)
+	if err == nil {
+		w.finishSync(item, deleted)
+		if current != nil {
+			w.retryQueue.done(item.ResourceType, current)
+		}
+		return true
+	}
+
+	// 首次入队即计为一次重试
+	attempts := q.queue.NumRequeues(item)
+	if attempts < q.maxRetries {
+		slog.Warn("Retry failed", append(objectLogAttrs(item.ResourceType, item.Namespace, item.Name),
+			"eventType", string(item.Operation), "attempt", attempts, "maxRetries", q.maxRetries, "error", err)...)
+		q.queue.AddRateLimited(item)
+		return true
+	}
+
+	slog.Error("Giving up after retries", append(objectLogAttrs(item.ResourceType, item.Namespace, item.Name),
+		"eventType", string(item.Operation), "maxRetries", q.maxRetries, "error", err)...)
+	w.finishSync(item, deleted)
+	if current == nil {
+		return true
+	}
+	w.recordWarningEvent(current, syncFailedReason,
+		fmt.Sprintf("Failed to sync to OpenResty after %d retries: %v", q.maxRetries, err))
+	w.retryQueue.record(item.ResourceType, item.Operation, current, err)
+	return true
+}
+
+// finishSync 结束对 item 的退避重试
+func (w *Watcher) finishSync(item syncItem, deleted *unstructured.Unstructured) {
+	q := w.syncQueue
+	q.queue.Forget(item)
+	if deleted != nil {
+		q.mu.Lock()
+		// 等待期间可能有新的删除事件替换了对象
+		if q.deleted[item] == deleted {
+			delete(q.deleted, item)
+		}
+		q.mu.Unlock()
+	}
+}
+
+// retrySync 按对象当前的状态重新处理：对象仍存在时推送最新内容，已被删除时执行删除。
+// 返回用于记录 Event 的对象。
+func (w *Watcher) retrySync(item syncItem, deleted *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	scope := w.informers.scopeFor(item.Namespace)
+	if scope == nil {
+		return deleted, fmt.Errorf("namespace %s is not watched", item.Namespace)
+	}
+	// 同一 GVR 的 informer 是共享的，这里取到的就是 watch 使用的缓存
+	cached, err := scope.factory.ForResource(item.GVR).Lister().ByNamespace(item.Namespace).Get(item.Name)
+	if errors.IsNotFound(err) {
+		if deleted == nil {
+			// 对象已被删除，删除事件会负责清理
+			return nil, nil
+		}
+		return deleted, w.handleEvent(watch.Event{Type: watch.Deleted, Object: deleted.DeepCopy()}, item.ResourceType)
+	}
+	if err != nil {
+		return deleted, err
+	}
+
+	current, ok := cached.(*unstructured.Unstructured)
+	if !ok {
+		return deleted, fmt.Errorf("unexpected object type in cache: %T", cached)
+	}
+	current = current.DeepCopy()
+	return current, w.handleEvent(watch.Event{Type: watch.Modified, Object: current}, item.ResourceType)
+}
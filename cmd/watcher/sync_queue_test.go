@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func newTestSyncQueue(maxRetries int) *syncQueue {
+	return &syncQueue{
+		queue: workqueue.NewRateLimitingQueueWithConfig(
+			workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, 10*time.Millisecond),
+			workqueue.RateLimitingQueueConfig{Name: "test"},
+		),
+		maxRetries: maxRetries,
+		deleted:    make(map[syncItem]*unstructured.Unstructured),
+	}
+}
+
+func TestSyncQueueFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{"defaults", nil, false},
+		{"zero retries", map[string]string{"SYNC_MAX_RETRIES": "0"}, true},
+		{"zero base delay", map[string]string{"SYNC_RETRY_BASE_DELAY": "0s"}, true},
+		{"max below base", map[string]string{"SYNC_RETRY_BASE_DELAY": "10s", "SYNC_RETRY_MAX_DELAY": "1s"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			q, err := syncQueueFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if q != nil {
+				q.queue.ShutDown()
+			}
+		})
+	}
+}
+
+func TestSyncQueueDeleteRetry(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		draining      bool
+		wantPosts     int
+		wantRetryKeys int
+		wantEvent     bool
+	}{
+		{"succeeds", 200, false, 1, 0, false},
+		{"gives up to the retry queue", 503, false, 1, 1, true},
+		{"drain hands over without pushing", 200, true, 0, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newOpenrestyStub()
+			stub.setStatus("/api/routes/delete", tt.status)
+			w := newTestWatcher(t, stub)
+			w.syncQueue = newTestSyncQueue(1)
+			defer w.syncQueue.queue.ShutDown()
+			w.retryQueue = newTestRetryQueue(10)
+			w.draining.Store(tt.draining)
+
+			route := testRoute(routeSpec("a.example.com"))
+			w.enqueueFailedSync("routes", watch.Deleted, route)
+			if !w.processNextSync() {
+				t.Fatal("queue shut down unexpectedly")
+			}
+
+			if n := len(stub.posts()); n != tt.wantPosts {
+				t.Errorf("pushed %d times, want %d", n, tt.wantPosts)
+			}
+			entries := w.retryQueue.snapshot()
+			if len(entries) != tt.wantRetryKeys {
+				t.Fatalf("retry queue = %+v, want %d entries", entries, tt.wantRetryKeys)
+			}
+			if len(entries) == 1 && (!entries[0].Deleted || entries[0].key() != "routes/web/r") {
+				t.Errorf("retry entry = %+v, want the route delete", entries[0])
+			}
+			recorder := w.recorder.(*record.FakeRecorder)
+			if gotEvent := len(recorder.Events) > 0; gotEvent != tt.wantEvent {
+				t.Errorf("Warning Event recorded = %v, want %v", gotEvent, tt.wantEvent)
+			}
+			if n := len(w.syncQueue.deleted); n != 0 {
+				t.Errorf("%d deleted objects left behind", n)
+			}
+			if n := w.syncQueue.queue.Len(); n != 0 {
+				t.Errorf("%d items left in the queue", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/retry"
+)
+
+// reportSyncResult 在推送 route/upstream 后更新 status，并在结果变化时记录 Event。
+// 全量同步会重复推送未变化的对象，结果与 status 中记录的相同时既不写入也不记录 Event。
+// 分片模式下只由负责该对象的 Pod 记录
+func (w *Watcher) reportSyncResult(obj *unstructured.Unstructured, err error) {
+	if !w.ownsObject(obj) || w.syncResultFor(obj, err).recordedIn(obj) {
+		return
+	}
+	w.recordSyncResult(obj, err)
+	w.setSyncStatus(obj, err)
+}
+
+// syncResult 是一次推送结果在 status 中的记录：Synced condition、observedGeneration 以及推送内容的哈希
+type syncResult struct {
+	status, reason, message string
+	generation              int64
+	hash                    string
+}
+
+func (w *Watcher) syncResultFor(obj *unstructured.Unstructured, syncErr error) syncResult {
+	result := syncResult{status: "True", reason: syncedReason, message: "Synced to OpenResty", generation: obj.GetGeneration(), hash: objectHash(obj)}
+	if w.dryRun {
+		// 对象并未真正生效，不能让 kubectl wait 等依赖 Synced=True 的工具误判
+		result.status, result.reason, result.message = "Unknown", dryRunReason, dryRunMessage
+	}
+	if syncErr != nil {
+		result.status, result.reason, result.message = "False", syncFailedReason, syncErr.Error()
+		var oversizeErr *openrestyOversizeError
+		if errors.As(syncErr, &oversizeErr) || w.oversize.rejected(obj) {
+			result.reason = payloadTooLargeReason
+		}
+	}
+	return result
+}
+
+// recordedIn 表示 obj 的 status 已记录了相同的结果。与 mergeCondition 一致，condition 只比较 status 和 reason
+func (r syncResult) recordedIn(obj *unstructured.Unstructured) bool {
+	generation, _, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	hash, _, _ := unstructured.NestedString(obj.Object, "status", "syncedHash")
+	if generation != r.generation || hash != r.hash {
+		return false
+	}
+	existing, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	_, changed := mergeCondition(existing, syncedConditionType, r.status, r.reason, r.message)
+	return !changed
+}
+
+// setSyncStatus 通过 status 子资源写入推送结果：Synced condition、observedGeneration、推送内容的哈希 syncedHash，
+// 成功时还有 lastSyncedTime，供 GitOps 工具和 kubectl wait --for=condition=Synced 判断对象是否已生效。
+// 读取最新对象后 UpdateStatus，resourceVersion 冲突时重试；最新对象已记录相同结果时不写入。
+func (w *Watcher) setSyncStatus(obj *unstructured.Unstructured, syncErr error) {
+	var gvr schema.GroupVersionResource
+	switch obj.GetKind() {
+	case "OSSProxyRoute":
+		gvr = routeGVR
+	case "OSSProxyUpstream":
+		gvr = upstreamGVR
+	default:
+		return
+	}
+
+	result := w.syncResultFor(obj, syncErr)
+	if !w.ownsObject(obj) || result.recordedIn(obj) {
+		return
+	}
+
+	namespace := obj.GetNamespace()
+	if namespace == "" {
+		namespace = "default"
+	}
+	resource := w.client.Resource(gvr).Namespace(namespace)
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	ctx, cancel := w.apiContext()
+	defer cancel()
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := resource.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if result.recordedIn(current) {
+			return nil
+		}
+
+		existing, _, _ := unstructured.NestedSlice(current.Object, "status", "conditions")
+		conditions, _ := mergeCondition(existing, syncedConditionType, result.status, result.reason, result.message)
+		if err := unstructured.SetNestedSlice(current.Object, conditions, "status", "conditions"); err != nil {
+			return err
+		}
+		// 以推送的对象为准：推送期间 spec 再次变化时，新的 generation 还未同步
+		if err := unstructured.SetNestedField(current.Object, result.generation, "status", "observedGeneration"); err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedField(current.Object, result.hash, "status", "syncedHash"); err != nil {
+			return err
+		}
+		if syncErr == nil && !w.dryRun {
+			if err := unstructured.SetNestedField(current.Object, now, "status", "lastSyncedTime"); err != nil {
+				return err
+			}
+		}
+
+		_, err = resource.UpdateStatus(ctx, current, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		slog.Error("Failed to update sync status", append(objectLogAttrs(kindLogResource(obj.GetKind()), obj.GetNamespace(), obj.GetName()), "error", err)...)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestReportSyncResultSkipsUnchangedStatus(t *testing.T) {
+	w := newTestWatcher(t, newOpenrestyStub())
+	client := w.client.(*dynamicfake.FakeDynamicClient)
+	recorder := w.recorder.(*record.FakeRecorder)
+	route := testRoute(routeSpec("a.example.com"))
+	route.SetGeneration(1)
+	createTestObject(t, w, routeGVR, route)
+
+	// latest 返回 informer 随后会交给 watcher 的对象（带 status）
+	latest := func() *unstructured.Unstructured {
+		obj, err := w.client.Resource(routeGVR).Namespace("web").Get(context.Background(), "r", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return obj
+	}
+	pushFailed := errors.New("request failed with status 503")
+	changedSpec := func() *unstructured.Unstructured {
+		obj := latest()
+		unstructured.SetNestedStringSlice(obj.Object, []string{"b.example.com"}, "spec", "hosts")
+		obj.SetGeneration(2)
+		return obj
+	}
+
+	steps := []struct {
+		name       string
+		obj        func() *unstructured.Unstructured
+		err        error
+		wantWrite  bool
+		wantReason string
+	}{
+		{"first sync", latest, nil, true, syncedReason},
+		{"resync of the same object", latest, nil, false, ""},
+		{"push fails", latest, pushFailed, true, syncFailedReason},
+		{"push fails again", latest, pushFailed, false, ""},
+		{"recovers", latest, nil, true, syncedReason},
+		{"spec changes", changedSpec, nil, true, syncedReason},
+	}
+
+	for _, step := range steps {
+		client.ClearActions()
+		w.reportSyncResult(step.obj(), step.err)
+
+		writes := 0
+		for _, action := range client.Actions() {
+			if action.GetVerb() == "update" && action.GetSubresource() == "status" {
+				writes++
+			}
+		}
+		if (writes > 0) != step.wantWrite {
+			t.Errorf("%s: status writes = %d, want write %v", step.name, writes, step.wantWrite)
+		}
+
+		var events []string
+		for len(recorder.Events) > 0 {
+			events = append(events, <-recorder.Events)
+		}
+		if step.wantReason == "" {
+			if len(events) > 0 {
+				t.Errorf("%s: events = %v, want none", step.name, events)
+			}
+		} else if len(events) != 1 || !strings.Contains(events[0], step.wantReason) {
+			t.Errorf("%s: events = %v, want one %s event", step.name, events, step.wantReason)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// startTestWatcher 按 run 的顺序启动 informer 并完成初始全量同步，之后的变更经由 informer 事件推送到 stub
+func startTestWatcher(t *testing.T, w *Watcher) {
+	t.Helper()
+	if w.syncQueue == nil {
+		w.syncQueue = newTestSyncQueue(1)
+		t.Cleanup(w.syncQueue.queue.ShutDown)
+	}
+	if w.retryQueue == nil {
+		w.retryQueue = newTestRetryQueue(10)
+	}
+	// 逐个推送，便于按推送顺序断言
+	w.bulkUnsupported.Store(true)
+	if err := w.setupInformers(); err != nil {
+		t.Fatalf("setupInformers: %v", err)
+	}
+	if err := w.startInformers(); err != nil {
+		t.Fatalf("startInformers: %v", err)
+	}
+	if err := w.syncAll(); err != nil {
+		t.Fatalf("initial sync: %v", err)
+	}
+	close(w.informers.initialSynced)
+}
+
+// pushedKey 描述一次推送：路径与对象的 namespace/name
+func pushedKey(req stubRequest) string {
+	metadata, _ := req.body["metadata"].(map[string]interface{})
+	return fmt.Sprintf("%s %s/%s", req.path, metadata["namespace"], metadata["name"])
+}
+
+// waitForPushes 等待 stub 在 from 之后收到 want 中的推送（按顺序），返回新收到的推送
+func waitForPushes(t *testing.T, stub *openrestyStub, from int, want ...string) []stubRequest {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		posts := stub.posts()[from:]
+		var got []string
+		for _, req := range posts {
+			got = append(got, pushedKey(req))
+		}
+		if containsInOrder(got, want) {
+			return posts
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pushes = %v, want %v in order", got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// toUnstructured 将类型化的对象转换为 fake dynamic client 使用的 unstructured 对象
+func toUnstructured(t *testing.T, obj runtime.Object, apiVersion, kind string) *unstructured.Unstructured {
+	t.Helper()
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &unstructured.Unstructured{Object: content}
+	u.SetAPIVersion(apiVersion)
+	u.SetKind(kind)
+	return u
+}
+
+func TestSyncFlow(t *testing.T) {
+	secret := testSecret("web", "creds", map[string][]byte{"accessKeyId": []byte("id"), "accessKeySecret": []byte("v1")})
+	stub := newOpenrestyStub()
+	w := newTestWatcher(t, stub, secret)
+	ctx := context.Background()
+
+	upstream := testUpstream("web", "u", "", "creds")
+	createTestObject(t, w, upstreamGVR, &upstream)
+	route := testRoute(routeSpec("a.example.com"))
+	unstructured.SetNestedMap(route.Object, map[string]interface{}{"name": "u"}, "spec", "upstreamRef")
+	createTestObject(t, w, routeGVR, route)
+	createTestObject(t, w, secretGVR, toUnstructured(t, secret, "v1", "Secret"))
+
+	// 初始同步：secret、upstream 先于引用它们的 route
+	startTestWatcher(t, w)
+	waitForPushes(t, stub, 0,
+		"/api/secrets/update web/creds",
+		"/api/upstreams/update web/u",
+		"/api/routes/update web/r",
+	)
+
+	routes := w.client.Resource(routeGVR).Namespace("web")
+	t.Run("add", func(t *testing.T) {
+		from := len(stub.posts())
+		added := testRoute(routeSpec("b.example.com"))
+		added.SetName("added")
+		createTestObject(t, w, routeGVR, added)
+		waitForPushes(t, stub, from, "/api/routes/update web/added")
+	})
+
+	t.Run("update", func(t *testing.T) {
+		from := len(stub.posts())
+		current, err := routes.Get(ctx, "r", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		unstructured.SetNestedStringSlice(current.Object, []string{"a.example.com", "c.example.com"}, "spec", "hosts")
+		if _, err := routes.Update(ctx, current, metav1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		posts := waitForPushes(t, stub, from, "/api/routes/update web/r")
+		spec := posts[len(posts)-1].body["spec"].(map[string]interface{})
+		if !reflect.DeepEqual(spec["hosts"], []interface{}{"a.example.com", "c.example.com"}) {
+			t.Errorf("pushed hosts = %v", spec["hosts"])
+		}
+	})
+
+	t.Run("secret cascade", func(t *testing.T) {
+		from := len(stub.posts())
+		rotated := secret.DeepCopy()
+		rotated.Data["accessKeySecret"] = []byte("v2")
+		rotated.ResourceVersion = ""
+		if _, err := w.clientset.CoreV1().Secrets("web").Update(ctx, rotated, metav1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.client.Resource(secretGVR).Namespace("web").Update(ctx, toUnstructured(t, rotated, "v1", "Secret"), metav1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		waitForPushes(t, stub, from, "/api/secrets/update web/creds", "/api/upstreams/update web/u")
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		from := len(stub.posts())
+		if err := routes.Delete(ctx, "added", metav1.DeleteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		posts := waitForPushes(t, stub, from, "/api/routes/delete web/added")
+		if epoch := posts[len(posts)-1].epoch; epoch == "" {
+			t.Error("delete was pushed without X-Sync-Epoch")
+		}
+
+		// route 与 upstream 由不同的 informer 投递，先删除 route 再删除它引用的 upstream
+		from = len(stub.posts())
+		if err := routes.Delete(ctx, "r", metav1.DeleteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		waitForPushes(t, stub, from, "/api/routes/delete web/r")
+		if err := w.client.Resource(upstreamGVR).Namespace("web").Delete(ctx, "u", metav1.DeleteOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		waitForPushes(t, stub, from, "/api/upstreams/delete web/u")
+	})
+}
+
+func TestSyncAllOrder(t *testing.T) {
+	tests := []struct {
+		order string
+		want  []string
+	}{
+		{syncOrderUpstreamsFirst, []string{"/api/upstreams/update web/u", "/api/routes/update web/r"}},
+		{syncOrderRoutesFirst, []string{"/api/routes/update web/r", "/api/upstreams/update web/u"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			stub := newOpenrestyStub()
+			w := newTestWatcher(t, stub)
+			w.syncOrder = tt.order
+
+			upstream := testUpstream("web", "u", "", "")
+			createTestObject(t, w, upstreamGVR, &upstream)
+			createTestObject(t, w, routeGVR, testRoute(routeSpec("a.example.com")))
+
+			startTestWatcher(t, w)
+			var got []string
+			for _, req := range stub.posts() {
+				got = append(got, pushedKey(req))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pushes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
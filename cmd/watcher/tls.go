@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+)
+
+// validateRouteTLS 校验 spec.tls.secretName 引用的证书是否覆盖 route 的所有域名。
+// Secret 尚不存在时只返回 warning，不拒绝请求。
+func (ws *WebhookServer) validateRouteTLS(route *unstructured.Unstructured, hosts []string) ([]string, error) {
+	ctx, cancel := ws.apiContext()
+	defer cancel()
+	warnings, err := checkRouteTLS(ctx, ws.watcher.clientset, route, hosts, ws.watcher.config.tlsSecretNamespaces)
+	return warnings, apiTimeoutError(ctx, err, "getting TLS secret", ws.watcher.config.webhookAPITimeout)
+}
+
+// checkRouteTLS 是 validateRouteTLS 的实现，供 webhook 和全量审计共用。
+// sharedNamespaces 为 route 可以跨命名空间引用 TLS Secret 的命名空间
+func checkRouteTLS(ctx context.Context, clientset kubernetes.Interface, route *unstructured.Unstructured, hosts []string, sharedNamespaces map[string]bool) ([]string, error) {
+	namespace, secretName, found, err := routeTLSSecretRef(route)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, nil
+	}
+	if err := checkTLSSecretNamespace(route, namespace, sharedNamespaces); err != nil {
+		return nil, err
+	}
+
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return []string{fmt.Sprintf("TLS secret %s/%s does not exist yet, certificate hosts were not verified", namespace, secretName)}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get TLS secret %s/%s: %v", namespace, secretName, err)
+	}
+
+	cert, err := parseLeafCertificate(secret.Data[corev1.TLSCertKey])
+	if err != nil {
+		return nil, fmt.Errorf("TLS secret %s/%s: %v", namespace, secretName, err)
+	}
+
+	var uncovered []string
+	for _, host := range hosts {
+		if !certCoversHost(cert.DNSNames, host) {
+			uncovered = append(uncovered, host)
+		}
+	}
+	if len(uncovered) > 0 {
+		return nil, fmt.Errorf("certificate in TLS secret %s/%s does not cover hosts: %s",
+			namespace, secretName, strings.Join(uncovered, ", "))
+	}
+
+	return nil, nil
+}
+
+// parseLeafCertificate 解析 PEM 中的第一个证书（叶子证书）
+func parseLeafCertificate(data []byte) (*x509.Certificate, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("missing %s", corev1.TLSCertKey)
+	}
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("no certificate found in %s", corev1.TLSCertKey)
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %v", err)
+		}
+		return cert, nil
+	}
+}
+
+// certCoversHost 判断证书的 DNS SAN 是否覆盖 host。
+// 通配符 SAN 只匹配一级子域名，例如 *.example.com 匹配 a.example.com，
+// 但不匹配 example.com 或 a.b.example.com。
+func certCoversHost(dnsNames []string, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, name := range dnsNames {
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+		if name == host {
+			return true
+		}
+		if strings.HasPrefix(name, "*.") && !strings.HasPrefix(host, "*.") {
+			label, rest, ok := strings.Cut(host, ".")
+			if ok && label != "" && rest == name[2:] {
+				return true
+			}
+		}
+	}
+	return false
+}
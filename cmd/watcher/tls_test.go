@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testCertificatePEM 生成一个 DNS SAN 为 dnsNames 的自签名证书（PEM）
+func testCertificatePEM(t *testing.T, dnsNames ...string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestCertCoversHost(t *testing.T) {
+	tests := []struct {
+		dnsNames []string
+		host     string
+		want     bool
+	}{
+		{[]string{"example.com"}, "example.com", true},
+		{[]string{"Example.COM."}, "example.com", true},
+		{[]string{"example.com"}, "www.example.com", false},
+		{[]string{"*.example.com"}, "www.example.com", true},
+		{[]string{"*.example.com"}, "example.com", false},
+		{[]string{"*.example.com"}, "a.b.example.com", false},
+		{[]string{"*.example.com"}, "*.example.com", true},
+		{[]string{"*.example.com"}, "*.a.example.com", false},
+		{[]string{"a.example.com", "*.example.org"}, "cdn.example.org", true},
+		{nil, "example.com", false},
+	}
+
+	for _, tt := range tests {
+		if got := certCoversHost(tt.dnsNames, tt.host); got != tt.want {
+			t.Errorf("certCoversHost(%v, %q) = %v, want %v", tt.dnsNames, tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestParseLeafCertificate(t *testing.T) {
+	cert := testCertificatePEM(t, "example.com")
+	key := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte("not used")})
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"certificate", cert, ""},
+		{"skips leading non-certificate blocks", append(key, cert...), ""},
+		{"empty", nil, "missing tls.crt"},
+		{"no certificate", key, "no certificate found"},
+		{"garbage certificate", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("x")}), "failed to parse certificate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseLeafCertificate(tt.data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(parsed.DNSNames) != 1 || parsed.DNSNames[0] != "example.com" {
+				t.Errorf("DNSNames = %v", parsed.DNSNames)
+			}
+		})
+	}
+}
+
+func TestCheckRouteTLS(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "cert", Namespace: "web"},
+		Type:       corev1.SecretTypeTLS,
+		Data:       map[string][]byte{corev1.TLSCertKey: testCertificatePEM(t, "*.example.com")},
+	}
+	shared := secret.DeepCopy()
+	shared.Namespace = "certs"
+	private := secret.DeepCopy()
+	private.Namespace = "other"
+	clientset := fake.NewSimpleClientset(secret, shared, private)
+
+	tests := []struct {
+		name            string
+		secretName      string
+		secretNamespace string
+		hosts           []string
+		wantWarning     bool
+		wantErr         string
+	}{
+		{"no tls", "", "", []string{"a.example.com"}, false, ""},
+		{"covered", "cert", "", []string{"a.example.com", "b.example.com"}, false, ""},
+		{"uncovered", "cert", "", []string{"a.example.com", "example.com"}, false, "does not cover hosts: example.com"},
+		{"secret missing", "absent", "", []string{"a.example.com"}, true, ""},
+		{"own namespace explicitly", "cert", "web", []string{"a.example.com"}, false, ""},
+		{"shared namespace", "cert", "certs", []string{"a.example.com"}, false, ""},
+		{"other namespace", "cert", "other", []string{"example.com"}, false, "spec.tls.namespace 'other' is not allowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := &unstructured.Unstructured{Object: map[string]interface{}{"spec": map[string]interface{}{}}}
+			route.SetNamespace("web")
+			if tt.secretName != "" {
+				unstructured.SetNestedField(route.Object, tt.secretName, "spec", "tls", "secretName")
+			}
+			if tt.secretNamespace != "" {
+				unstructured.SetNestedField(route.Object, tt.secretNamespace, "spec", "tls", "namespace")
+			}
+
+			warnings, err := checkRouteTLS(context.Background(), clientset, route, tt.hosts, map[string]bool{"certs": true})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (len(warnings) > 0) != tt.wantWarning {
+				t.Errorf("warnings = %v, wantWarning %v", warnings, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestCheckRouteTLSSecretUsesInformerCache(t *testing.T) {
+	w := newTestWatcher(t, newOpenrestyStub())
+	w.tlsMissingPolicy = tlsMissingBlock
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "cert", Namespace: "web"},
+		Type:       corev1.SecretTypeTLS,
+	}
+	createTestObject(t, w, secretGVR, toUnstructured(t, secret, "v1", "Secret"))
+
+	scope := w.informers.scopeFor("web")
+	scope.tlsFactory.Start(w.ctx.Done())
+	scope.tlsFactory.WaitForCacheSync(w.ctx.Done())
+
+	for _, tt := range []struct {
+		secretName string
+		want       bool
+	}{
+		{"cert", true},
+		{"absent", false},
+	} {
+		route := testRoute(map[string]interface{}{"tls": map[string]interface{}{"secretName": tt.secretName}})
+		route.SetName(tt.secretName)
+		createTestObject(t, w, routeGVR, route)
+		if got := w.checkRouteTLSSecret(route); got != tt.want {
+			t.Errorf("secret %s: checkRouteTLSSecret = %v, want %v", tt.secretName, got, tt.want)
+		}
+	}
+
+	for _, action := range w.clientset.(*fake.Clientset).Actions() {
+		if action.GetResource().Resource == "secrets" {
+			t.Errorf("unexpected apiserver request %s secrets, want the informer cache to be used", action.GetVerb())
+		}
+	}
+}
+
+func TestCheckRouteTLSSecretFallsBackBeforeCacheSync(t *testing.T) {
+	w := newTestWatcher(t, newOpenrestyStub(),
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "cert", Namespace: "web"}, Type: corev1.SecretTypeTLS},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "opaque", Namespace: "web"}, Type: corev1.SecretTypeOpaque},
+	)
+	w.tlsMissingPolicy = tlsMissingBlock
+
+	for _, tt := range []struct {
+		secretName string
+		want       bool
+	}{
+		{"cert", true},
+		{"opaque", false},
+		{"absent", false},
+	} {
+		route := testRoute(map[string]interface{}{"tls": map[string]interface{}{"secretName": tt.secretName}})
+		route.SetName(tt.secretName)
+		createTestObject(t, w, routeGVR, route)
+		if got := w.checkRouteTLSSecret(route); got != tt.want {
+			t.Errorf("secret %s: checkRouteTLSSecret = %v, want %v", tt.secretName, got, tt.want)
+		}
+	}
+}
+
+func TestCheckRouteTLSSecretOtherNamespace(t *testing.T) {
+	w := newTestWatcher(t, newOpenrestyStub(),
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "cert", Namespace: "other"}, Type: corev1.SecretTypeTLS},
+	)
+	route := testRoute(map[string]interface{}{"tls": map[string]interface{}{"secretName": "cert", "namespace": "other"}})
+	createTestObject(t, w, routeGVR, route)
+
+	w.tlsMissingPolicy = tlsMissingBlock
+	if w.checkRouteTLSSecret(route) {
+		t.Error("route referencing a TLS secret in another namespace was pushed with the block policy")
+	}
+	route, _ = w.client.Resource(routeGVR).Namespace("web").Get(context.Background(), "r", metav1.GetOptions{})
+	if !hasCondition(route, readyConditionType, tlsSecretNotAllowedReason) {
+		t.Errorf("conditions = %v, want Ready=False with reason %s", route.Object["status"], tlsSecretNotAllowedReason)
+	}
+	for _, action := range w.clientset.(*fake.Clientset).Actions() {
+		if action.GetResource().Resource == "secrets" {
+			t.Errorf("unexpected %s secrets in another namespace", action.GetVerb())
+		}
+	}
+
+	w.config.tlsSecretNamespaces = map[string]bool{"other": true}
+	if !w.checkRouteTLSSecret(route) {
+		t.Error("route referencing a TLS secret in a shared namespace was held back")
+	}
+	route, _ = w.client.Resource(routeGVR).Namespace("web").Get(context.Background(), "r", metav1.GetOptions{})
+	if hasCondition(route, readyConditionType, tlsSecretNotAllowedReason) {
+		t.Errorf("conditions = %v, want the TLSSecretNotAllowed condition to be cleared", route.Object["status"])
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OTLP 中的 span kind
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+)
+
+// tracer 记录 watch 事件 → 推送 → OpenResty 响应的 span，并以 OTLP/HTTP JSON 格式批量导出。
+// 只读取标准的 OTEL_* 环境变量，未配置 exporter 地址时为 nil，所有方法都是 no-op。
+// 与 CloudEvents 一样是 best-effort 的：队列满时丢弃 span，导出失败不重试。
+type tracer struct {
+	endpoint    string
+	headers     map[string]string
+	resource    []otlpAttribute
+	queue       chan *span
+	client      *http.Client
+	batchSize   int
+	flushPeriod time.Duration
+	dropped     atomic.Int64
+}
+
+// newTracerFromEnv 按 OTEL_EXPORTER_OTLP_TRACES_ENDPOINT（或 OTEL_EXPORTER_OTLP_ENDPOINT + /v1/traces）创建 tracer，
+// 未配置地址、OTEL_SDK_DISABLED=true 或 OTEL_TRACES_EXPORTER=none 时返回 nil。
+// 只支持 http/json 协议，OTEL_EXPORTER_OTLP_PROTOCOL 为其他值时返回错误，避免静默地发送对方无法解析的数据。
+func newTracerFromEnv() (*tracer, error) {
+	if os.Getenv("OTEL_SDK_DISABLED") == "true" || os.Getenv("OTEL_TRACES_EXPORTER") == "none" {
+		return nil, nil
+	}
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimRight(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" {
+		return nil, nil
+	}
+	if parsed, err := url.Parse(endpoint); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, fmt.Errorf("invalid OTLP traces endpoint %q, must be an http or https URL", endpoint)
+	}
+
+	protocol := getEnvOrDefault("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", getEnvOrDefault("OTEL_EXPORTER_OTLP_PROTOCOL", "http/json"))
+	if protocol != "http/json" {
+		return nil, fmt.Errorf("unsupported OTLP protocol %q, only http/json is supported", protocol)
+	}
+
+	timeout, err := otelTimeoutFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	headers, err := parseOtelKeyValues(getEnvOrDefault("OTEL_EXPORTER_OTLP_TRACES_HEADERS", os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_HEADERS: %v", err)
+	}
+	resourceAttrs, err := parseOtelKeyValues(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTEL_RESOURCE_ATTRIBUTES: %v", err)
+	}
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		resourceAttrs["service.name"] = name
+	} else if _, ok := resourceAttrs["service.name"]; !ok {
+		resourceAttrs["service.name"] = "oss-fe-proxy-watcher"
+	}
+	if podName := os.Getenv("POD_NAME"); podName != "" {
+		if _, ok := resourceAttrs["k8s.pod.name"]; !ok {
+			resourceAttrs["k8s.pod.name"] = podName
+		}
+	}
+
+	t := &tracer{
+		endpoint:    endpoint,
+		headers:     headers,
+		queue:       make(chan *span, 2048),
+		client:      &http.Client{Timeout: timeout},
+		batchSize:   512,
+		flushPeriod: 5 * time.Second,
+	}
+	for k, v := range resourceAttrs {
+		t.resource = append(t.resource, otlpString(k, v))
+	}
+	slog.Info("OpenTelemetry tracing enabled", "endpoint", endpoint)
+	return t, nil
+}
+
+// otelTimeoutFromEnv 读取以毫秒为单位的 OTEL_EXPORTER_OTLP_(TRACES_)TIMEOUT，默认 10s
+func otelTimeoutFromEnv() (time.Duration, error) {
+	value := getEnvOrDefault("OTEL_EXPORTER_OTLP_TRACES_TIMEOUT", getEnvOrDefault("OTEL_EXPORTER_OTLP_TIMEOUT", "10000"))
+	ms, err := strconv.Atoi(value)
+	if err != nil || ms <= 0 {
+		return 0, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_TIMEOUT %q, must be a positive number of milliseconds", value)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// parseOtelKeyValues 解析 OTEL_* 中 key1=value1,key2=value2 形式的列表，值按 URL 编码解码
+func parseOtelKeyValues(value string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("entry %q is not key=value", item)
+		}
+		decoded, err := url.QueryUnescape(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("entry %q: %v", item, err)
+		}
+		out[strings.TrimSpace(k)] = decoded
+	}
+	return out, nil
+}
+
+// span 为一次正在进行的操作，nil 表示未启用 tracing
+type span struct {
+	tracer   *tracer
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	kind     int
+	start    time.Time
+	end      time.Time
+
+	mu    sync.Mutex
+	attrs []otlpAttribute
+	err   error
+}
+
+// start 开始一个 span，parent 为 nil 时开始新的 trace
+func (t *tracer) start(parent *span, name string, kind int) *span {
+	if t == nil {
+		return nil
+	}
+	s := &span{tracer: t, name: name, kind: kind, start: time.Now()}
+	if parent != nil {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	rand.Read(s.spanID[:])
+	return s
+}
+
+// setAttr 设置 string、int 或 bool 类型的属性
+func (s *span) setAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	attr := otlpAttribute{Key: key}
+	switch v := value.(type) {
+	case string:
+		attr.Value.StringValue = &v
+	case int:
+		i := strconv.Itoa(v)
+		attr.Value.IntValue = &i
+	case bool:
+		attr.Value.BoolValue = &v
+	default:
+		str := fmt.Sprint(v)
+		attr.Value.StringValue = &str
+	}
+	s.mu.Lock()
+	s.attrs = append(s.attrs, attr)
+	s.mu.Unlock()
+}
+
+// finish 结束 span 并加入导出队列，err 不为 nil 时 span 状态为 error
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	s.err = err
+	select {
+	case s.tracer.queue <- s:
+	default:
+		if dropped := s.tracer.dropped.Add(1); dropped%100 == 1 {
+			slog.Warn("Trace export queue full, dropping spans", "dropped", dropped)
+		}
+	}
+}
+
+// inject 按 W3C Trace Context 设置 traceparent 请求头，OpenResty 可以在日志中记录它以关联同一次推送
+func (s *span) inject(req *http.Request) {
+	if s == nil {
+		return
+	}
+	req.Header.Set("traceparent", "00-"+hex.EncodeToString(s.traceID[:])+"-"+hex.EncodeToString(s.spanID[:])+"-01")
+}
+
+// run 按批量大小或周期导出 span，stop 关闭时导出剩余的 span 后返回
+func (t *tracer) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(t.flushPeriod)
+	defer ticker.Stop()
+
+	var batch []*span
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.export(batch); err != nil {
+			slog.Error("Failed to export spans", "spans", len(batch), "error", err)
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case <-stop:
+			for {
+				select {
+				case s := <-t.queue:
+					batch = append(batch, s)
+				default:
+					flush()
+					return
+				}
+			}
+		case s := <-t.queue:
+			batch = append(batch, s)
+			if len(batch) >= t.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// OTLP/HTTP JSON 的请求结构，只包含用到的字段。traceId/spanId 为十六进制，64 位整数以字符串表示。
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue *string `json:"stringValue,omitempty"`
+		IntValue    *string `json:"intValue,omitempty"`
+		BoolValue   *bool   `json:"boolValue,omitempty"`
+	} `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func otlpString(key, value string) otlpAttribute {
+	attr := otlpAttribute{Key: key}
+	attr.Value.StringValue = &value
+	return attr
+}
+
+func (t *tracer) export(batch []*span) error {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, s := range batch {
+		out := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Status:            otlpStatus{Code: 1},
+		}
+		if s.parentID != [8]byte{} {
+			out.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		s.mu.Lock()
+		out.Attributes = s.attrs
+		s.mu.Unlock()
+		if s.err != nil {
+			out.Status = otlpStatus{Code: 2, Message: s.err.Error()}
+		}
+		spans = append(spans, out)
+	}
+
+	body := map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": t.resource},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "oss-fe-proxy/watcher"},
+				"spans": spans,
+			}},
+		}},
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal spans: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", t.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned status %d", resp.StatusCode)
+	}
+	return nil
+}
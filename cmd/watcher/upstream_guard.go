@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// forceDeleteAnnotation 为 "true" 时跳过 upstream 删除保护
+	forceDeleteAnnotation = "ossfe.imvictor.tech/force-delete"
+
+	upstreamDeleteBlock = "block"
+	upstreamDeleteWarn  = "warn"
+)
+
+// upstreamDeletePolicyFromEnv 读取 WEBHOOK_UPSTREAM_DELETE_POLICY（默认 block）
+func upstreamDeletePolicyFromEnv() (string, error) {
+	policy := getEnvOrDefault("WEBHOOK_UPSTREAM_DELETE_POLICY", upstreamDeleteBlock)
+	if policy != upstreamDeleteBlock && policy != upstreamDeleteWarn {
+		return "", fmt.Errorf("invalid WEBHOOK_UPSTREAM_DELETE_POLICY %q, must be %q or %q", policy, upstreamDeleteBlock, upstreamDeleteWarn)
+	}
+	return policy, nil
+}
+
+// validateOSSProxyUpstream 在创建、更新 upstream 时校验各字段，删除时检查是否仍有 route 引用它
+func (ws *WebhookServer) validateOSSProxyUpstream(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	if req.Operation != admissionv1.Delete {
+		return ws.validateUpstreamSpec(req)
+	}
+
+	// DELETE 请求中对象内容位于 OldObject
+	var upstream unstructured.Unstructured
+	if err := json.Unmarshal(req.OldObject.Raw, &upstream); err != nil {
+		slog.Error("Failed to unmarshal OSSProxyUpstream", append(objectLogAttrs("upstreams", req.Namespace, req.Name), "error", err)...)
+		return &admissionv1.AdmissionResponse{
+			UID:     req.UID,
+			Allowed: false,
+			Result: &metav1.Status{
+				Message: fmt.Sprintf("Failed to unmarshal OSSProxyUpstream: %v", err),
+			},
+		}
+	}
+	if upstream.GetName() == "" {
+		upstream.SetName(req.Name)
+		upstream.SetNamespace(req.Namespace)
+	}
+
+	if upstream.GetAnnotations()[forceDeleteAnnotation] == "true" {
+		slog.Info("Force deleting upstream, skipping reference check", objectLogAttrs("upstreams", upstream.GetNamespace(), upstream.GetName())...)
+		return &admissionv1.AdmissionResponse{
+			UID:     req.UID,
+			Allowed: true,
+		}
+	}
+
+	ctx, cancel := ws.apiContext()
+	defer cancel()
+	routes, err := ws.watcher.listObjects(ctx, routeGVR)
+	err = apiTimeoutError(ctx, err, "listing routes", ws.watcher.config.webhookAPITimeout)
+	if err != nil {
+		slog.Error("Failed to list routes", append(objectLogAttrs("upstreams", upstream.GetNamespace(), upstream.GetName()), "error", err)...)
+		return &admissionv1.AdmissionResponse{
+			UID:     req.UID,
+			Allowed: false,
+			Result: &metav1.Status{
+				Message: fmt.Sprintf("failed to list existing routes: %v", err),
+			},
+		}
+	}
+
+	referencing := routesReferencingUpstream(routes, objectKey(&upstream))
+	if len(referencing) == 0 {
+		return &admissionv1.AdmissionResponse{
+			UID:     req.UID,
+			Allowed: true,
+		}
+	}
+
+	message := fmt.Sprintf("upstream %s is still referenced by routes: %s", objectKey(&upstream), strings.Join(referencing, ", "))
+	if ws.upstreamDeletePolicy == upstreamDeleteWarn {
+		return &admissionv1.AdmissionResponse{
+			UID:      req.UID,
+			Allowed:  true,
+			Warnings: []string{message},
+		}
+	}
+
+	slog.Info("Upstream deletion rejected, still referenced by routes", append(objectLogAttrs("upstreams", upstream.GetNamespace(), upstream.GetName()), "routes", referencing)...)
+	return &admissionv1.AdmissionResponse{
+		UID:     req.UID,
+		Allowed: false,
+		Result: &metav1.Status{
+			Message: fmt.Sprintf("%s; set annotation %s=true to force deletion", message, forceDeleteAnnotation),
+		},
+	}
+}
+
+// routeUpstreamKey 返回 route 引用的 upstream（namespace/name），upstreamRef.namespace 缺省时为 route 所在命名空间
+func routeUpstreamKey(route *unstructured.Unstructured) (string, bool) {
+	name, found, _ := unstructured.NestedString(route.Object, "spec", "upstreamRef", "name")
+	if !found || name == "" {
+		return "", false
+	}
+	namespace, _, _ := unstructured.NestedString(route.Object, "spec", "upstreamRef", "namespace")
+	if namespace == "" {
+		namespace = route.GetNamespace()
+		if namespace == "" {
+			namespace = "default"
+		}
+	}
+	return namespace + "/" + name, true
+}
+
+// checkUpstreamRef 检查 route 引用的 upstream 是否存在。UPDATE 时 upstreamRef 未变化则跳过检查，
+// 避免每次修改 route 都请求 apiserver；未设置 upstreamRef 的 route 不在此处检查。
+func (ws *WebhookServer) checkUpstreamRef(req *admissionv1.AdmissionRequest, route *unstructured.Unstructured) error {
+	key, ok := routeUpstreamKey(route)
+	if !ok {
+		return nil
+	}
+
+	if req.Operation == admissionv1.Update {
+		var oldRoute unstructured.Unstructured
+		if err := json.Unmarshal(req.OldObject.Raw, &oldRoute); err == nil {
+			if oldKey, ok := routeUpstreamKey(&oldRoute); ok && oldKey == key {
+				return nil
+			}
+		}
+	}
+
+	namespace, name, _ := strings.Cut(key, "/")
+	ctx, cancel := ws.apiContext()
+	defer cancel()
+	_, err := ws.watcher.client.Resource(upstreamGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	err = apiTimeoutError(ctx, err, "getting upstream", ws.watcher.config.webhookAPITimeout)
+	if errors.IsNotFound(err) {
+		return fmt.Errorf("referenced OSSProxyUpstream %s does not exist", key)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get referenced OSSProxyUpstream %s: %v", key, err)
+	}
+	return nil
+}
+
+// routesReferencingUpstream 返回引用了指定 upstream 的 route（namespace/name）
+func routesReferencingUpstream(routes []unstructured.Unstructured, upstreamKey string) []string {
+	var referencing []string
+	for i := range routes {
+		if key, ok := routeUpstreamKey(&routes[i]); ok && key == upstreamKey {
+			referencing = append(referencing, objectKey(&routes[i]))
+		}
+	}
+	sort.Strings(referencing)
+	return referencing
+}
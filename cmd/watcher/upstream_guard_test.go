@@ -0,0 +1,116 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRouteUpstreamKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		ref       map[string]interface{}
+		want      string
+		wantFound bool
+	}{
+		{"no upstreamRef", "web", nil, "", false},
+		{"empty name", "web", map[string]interface{}{"name": ""}, "", false},
+		{"route namespace", "web", map[string]interface{}{"name": "u"}, "web/u", true},
+		{"explicit namespace", "web", map[string]interface{}{"name": "u", "namespace": "shared"}, "shared/u", true},
+		{"default namespace", "", map[string]interface{}{"name": "u"}, "default/u", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := map[string]interface{}{}
+			if tt.ref != nil {
+				spec["upstreamRef"] = tt.ref
+			}
+			route := testRoute(spec)
+			route.SetNamespace(tt.namespace)
+
+			key, found := routeUpstreamKey(route)
+			if key != tt.want || found != tt.wantFound {
+				t.Errorf("routeUpstreamKey = (%q, %v), want (%q, %v)", key, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestRoutesReferencingUpstream(t *testing.T) {
+	route := func(namespace, name string, ref map[string]interface{}) unstructured.Unstructured {
+		r := testRoute(map[string]interface{}{"upstreamRef": ref})
+		r.SetNamespace(namespace)
+		r.SetName(name)
+		return *r
+	}
+	routes := []unstructured.Unstructured{
+		route("web", "b", map[string]interface{}{"name": "u"}),
+		route("web", "a", map[string]interface{}{"name": "u"}),
+		route("other", "c", map[string]interface{}{"name": "u", "namespace": "web"}),
+		route("other", "d", map[string]interface{}{"name": "u"}),
+		route("web", "e", map[string]interface{}{"name": "v"}),
+	}
+
+	tests := []struct {
+		upstream string
+		want     []string
+	}{
+		{"web/u", []string{"other/c", "web/a", "web/b"}},
+		{"other/u", []string{"other/d"}},
+		{"web/missing", nil},
+	}
+	for _, tt := range tests {
+		if got := routesReferencingUpstream(routes, tt.upstream); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("routesReferencingUpstream(%s) = %v, want %v", tt.upstream, got, tt.want)
+		}
+	}
+}
+
+func TestValidateUpstreamDelete(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       string
+		force        bool
+		referenced   bool
+		wantAllowed  bool
+		wantWarnings bool
+	}{
+		{"unreferenced", upstreamDeleteBlock, false, false, true, false},
+		{"referenced", upstreamDeleteBlock, false, true, false, false},
+		{"referenced with warn policy", upstreamDeleteWarn, false, true, true, true},
+		{"referenced with force annotation", upstreamDeleteBlock, true, true, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWatcher(t, newOpenrestyStub())
+			ws := newTestWebhook(w)
+			ws.upstreamDeletePolicy = tt.policy
+
+			if tt.referenced {
+				route := testRoute(map[string]interface{}{"hosts": []interface{}{"a.example.com"}, "upstreamRef": map[string]interface{}{"name": "u"}})
+				createTestObject(t, w, routeGVR, route)
+			}
+			upstream := newStubObject("OSSProxyUpstream", "web/u")
+			if tt.force {
+				upstream.SetAnnotations(map[string]string{forceDeleteAnnotation: "true"})
+			}
+
+			resp := ws.validate(admissionRequest(t, "OSSProxyUpstream", admissionv1.Delete, nil, upstream))
+			if resp.Allowed != tt.wantAllowed {
+				t.Fatalf("Allowed = %v, want %v (%v)", resp.Allowed, tt.wantAllowed, resp.Result)
+			}
+			if (len(resp.Warnings) > 0) != tt.wantWarnings {
+				t.Errorf("Warnings = %v, wantWarnings %v", resp.Warnings, tt.wantWarnings)
+			}
+			if !resp.Allowed && !strings.Contains(resp.Result.Message, "web/r") {
+				t.Errorf("rejection %q does not name the referencing route", resp.Result.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// validateUpstreamHealthCheck 校验 spec.healthCheck：interval、timeout 为正的秒数且 timeout 不超过 interval，
+// path 以 / 开头，expectedStatus 为合法的 HTTP 状态码。该字段由 watcher 原样推送给 OpenResty。
+func validateUpstreamHealthCheck(upstream *unstructured.Unstructured) error {
+	healthCheck, found, err := unstructured.NestedMap(upstream.Object, "spec", "healthCheck")
+	if err != nil {
+		return fmt.Errorf("spec.healthCheck must be an object: %v", err)
+	}
+	if !found {
+		return nil
+	}
+
+	interval, hasInterval, err := unstructured.NestedInt64(healthCheck, "interval")
+	if err != nil {
+		return fmt.Errorf("spec.healthCheck.interval must be an integer number of seconds: %v", err)
+	}
+	if hasInterval && interval <= 0 {
+		return fmt.Errorf("spec.healthCheck.interval %d must be a positive number of seconds", interval)
+	}
+	timeout, hasTimeout, err := unstructured.NestedInt64(healthCheck, "timeout")
+	if err != nil {
+		return fmt.Errorf("spec.healthCheck.timeout must be an integer number of seconds: %v", err)
+	}
+	if hasTimeout && timeout <= 0 {
+		return fmt.Errorf("spec.healthCheck.timeout %d must be a positive number of seconds", timeout)
+	}
+	if hasInterval && hasTimeout && timeout > interval {
+		return fmt.Errorf("spec.healthCheck.timeout %ds must not exceed spec.healthCheck.interval %ds", timeout, interval)
+	}
+
+	path, hasPath, err := unstructured.NestedString(healthCheck, "path")
+	if err != nil {
+		return fmt.Errorf("spec.healthCheck.path must be a string: %v", err)
+	}
+	if hasPath && !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("spec.healthCheck.path '%s' must start with /", path)
+	}
+	if strings.ContainsAny(path, " \t\r\n") {
+		return fmt.Errorf("spec.healthCheck.path '%s' must not contain whitespace", path)
+	}
+
+	status, hasStatus, err := unstructured.NestedInt64(healthCheck, "expectedStatus")
+	if err != nil {
+		return fmt.Errorf("spec.healthCheck.expectedStatus must be an integer: %v", err)
+	}
+	if hasStatus && (status < 100 || status > 599) {
+		return fmt.Errorf("spec.healthCheck.expectedStatus %d is not a valid HTTP status", status)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// secretFailureWarn 时凭据推送失败仍推送 upstream，只将 Ready 置为 False
+	secretFailureWarn = "warn"
+	// secretFailureBlock 时凭据推送失败会暂缓推送 upstream，直到凭据同步成功
+	secretFailureBlock = "block"
+
+	secretSyncFailedReason  = "SecretSyncFailed"
+	credentialsSyncedReason = "CredentialsSynced"
+	anonymousFallbackReason = "AnonymousFallback"
+)
+
+// secretFailurePolicyFromEnv 读取 UPSTREAM_SECRET_FAILURE_POLICY（默认 warn）
+func secretFailurePolicyFromEnv() (string, error) {
+	policy := getEnvOrDefault("UPSTREAM_SECRET_FAILURE_POLICY", secretFailureWarn)
+	if policy != secretFailureWarn && policy != secretFailureBlock {
+		return "", fmt.Errorf("invalid UPSTREAM_SECRET_FAILURE_POLICY %q, must be %q or %q", policy, secretFailureWarn, secretFailureBlock)
+	}
+	return policy, nil
+}
+
+// upstreamAnonymousFallback 判断 upstream 是否声明了 spec.credentials.anonymousFallback，
+// 声明后凭据同步失败时 OpenResty 以匿名方式访问公开对象
+func upstreamAnonymousFallback(upstream *unstructured.Unstructured) bool {
+	fallback, _, _ := unstructured.NestedBool(upstream.Object, "spec", "credentials", "anonymousFallback")
+	return fallback
+}
+
+// holdBackUpstream 判断凭据同步失败时是否应暂缓推送 upstream。
+// 声明了 anonymousFallback 的 upstream 总是推送，以便降级为匿名访问。
+func (w *Watcher) holdBackUpstream(upstream *unstructured.Unstructured, secretErr error) bool {
+	return secretErr != nil && w.secretFailurePolicy == secretFailureBlock && !upstreamAnonymousFallback(upstream)
+}
+
+// setUpstreamReady 根据凭据的同步结果更新 upstream 的 Ready condition。
+// 只有 upstream 已推送且其引用的 secret 也已推送时才为 True，否则签名请求会失败。
+func (w *Watcher) setUpstreamReady(upstream *unstructured.Unstructured, secretErr error) {
+	if secretErr != nil && upstreamAnonymousFallback(upstream) {
+		message := fmt.Sprintf("Credentials are not synced to OpenResty (%v), serving public objects anonymously; authenticated access is not ready", secretErr)
+		// 只在进入降级状态时发出一次事件
+		if !hasCondition(upstream, readyConditionType, anonymousFallbackReason) {
+			w.recordWarningEvent(upstream, anonymousFallbackReason, message)
+		}
+		w.setCondition(upstream, readyConditionType, "False", anonymousFallbackReason, message)
+		return
+	}
+	if secretErr != nil {
+		w.setCondition(upstream, readyConditionType, "False", secretSyncFailedReason,
+			fmt.Sprintf("Credentials are not synced to OpenResty: %v", secretErr))
+		return
+	}
+	w.setCondition(upstream, readyConditionType, "True", credentialsSyncedReason, "Upstream and its credentials are synced to OpenResty")
+}
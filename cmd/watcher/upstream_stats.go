@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// upstreamStatsOther 是超出上限的 upstream 合并后使用的 label
+const upstreamStatsOther = "_other"
+
+// upstreamStats 对应 OpenResty /api/upstreams/stats 返回的单个 upstream 统计，延迟单位为毫秒
+type upstreamStats struct {
+	Requests      float64 `json:"requests"`
+	Errors        float64 `json:"errors"`
+	LatencyMeanMs float64 `json:"latencyMeanMs"`
+	LatencyP50Ms  float64 `json:"latencyP50Ms"`
+	LatencyP99Ms  float64 `json:"latencyP99Ms"`
+}
+
+// upstreamStatsPoller 定期从 OpenResty 采集按 upstream 的统计并以 watcher 指标输出。
+// upstream 名称来自用户创建的资源，maxUpstreams 限制 label 数量。
+type upstreamStatsPoller struct {
+	interval     time.Duration
+	maxUpstreams int
+}
+
+// upstreamStatsPollerFromEnv 读取 OPENRESTY_UPSTREAM_STATS_INTERVAL（默认 0，不采集）和
+// OPENRESTY_UPSTREAM_STATS_MAX_UPSTREAMS（默认 100）
+func upstreamStatsPollerFromEnv() (*upstreamStatsPoller, error) {
+	interval, err := time.ParseDuration(getEnvOrDefault("OPENRESTY_UPSTREAM_STATS_INTERVAL", "0"))
+	if err != nil || interval < 0 {
+		return nil, fmt.Errorf("invalid OPENRESTY_UPSTREAM_STATS_INTERVAL")
+	}
+	if interval == 0 {
+		return nil, nil
+	}
+	maxUpstreams, err := strconv.Atoi(getEnvOrDefault("OPENRESTY_UPSTREAM_STATS_MAX_UPSTREAMS", "100"))
+	if err != nil || maxUpstreams <= 0 {
+		return nil, fmt.Errorf("invalid OPENRESTY_UPSTREAM_STATS_MAX_UPSTREAMS")
+	}
+	return &upstreamStatsPoller{interval: interval, maxUpstreams: maxUpstreams}, nil
+}
+
+// scrapeUpstreamStats 采集一次统计并替换指标。请求量最高的 maxUpstreams 个 upstream 单独输出，
+// 其余的请求数和错误数合并到 _other，延迟不合并。
+func (w *Watcher) scrapeUpstreamStats() error {
+	var stats map[string]upstreamStats
+	if err := w.fetchOpenresty("/api/upstreams/stats", &stats); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(stats))
+	for key := range stats {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if stats[keys[i]].Requests != stats[keys[j]].Requests {
+			return stats[keys[i]].Requests > stats[keys[j]].Requests
+		}
+		return keys[i] < keys[j]
+	})
+
+	requests := make(map[string]float64)
+	errors := make(map[string]float64)
+	mean := make(map[string]float64)
+	p50 := make(map[string]float64)
+	p99 := make(map[string]float64)
+	for i, key := range keys {
+		s := stats[key]
+		if i >= w.upstreamStats.maxUpstreams {
+			requests[upstreamStatsOther] += s.Requests
+			errors[upstreamStatsOther] += s.Errors
+			continue
+		}
+		requests[key] = s.Requests
+		errors[key] = s.Errors
+		mean[key] = s.LatencyMeanMs / 1000
+		p50[key] = s.LatencyP50Ms / 1000
+		p99[key] = s.LatencyP99Ms / 1000
+	}
+
+	w.metrics.upstreamRequests.replace(requests)
+	w.metrics.upstreamErrors.replace(errors)
+	w.metrics.upstreamLatencyMean.replace(mean)
+	w.metrics.upstreamLatencyP50.replace(p50)
+	w.metrics.upstreamLatencyP99.replace(p99)
+	return nil
+}
+
+// pollUpstreamStats 按 interval 采集统计。采集失败只记录日志并保留上一次的值，不影响同步。
+func (w *Watcher) pollUpstreamStats() {
+	ticker := time.NewTicker(w.upstreamStats.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.scrapeUpstreamStats(); err != nil {
+			slog.Error("Failed to scrape upstream stats from OpenResty", "error", err)
+		}
+
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// 支持的对象存储类型，即 spec.provider 的取值
+var upstreamProviders = []string{"s3", "oss", "gcs", "minio"}
+
+// upstreamSpecValidator 是对 upstream spec 中单个字段的格式校验
+type upstreamSpecValidator struct {
+	name     string
+	validate func(*unstructured.Unstructured) error
+}
+
+var upstreamSpecValidators = []upstreamSpecValidator{
+	{"provider", validateUpstreamProvider},
+	{"endpoint", validateUpstreamEndpoint},
+	{"healthCheck", validateUpstreamHealthCheck},
+	{"credentials.secretRef.keys", validateSecretRefKeys},
+}
+
+// validateUpstreamSpec 在 CREATE/UPDATE 时校验 upstream 的各字段，收集所有失败后一次性拒绝
+func (ws *WebhookServer) validateUpstreamSpec(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	ws.metrics.admissions.inc(string(req.Operation))
+
+	var upstream unstructured.Unstructured
+	if err := json.Unmarshal(req.Object.Raw, &upstream); err != nil {
+		slog.Error("Failed to unmarshal OSSProxyUpstream", append(objectLogAttrs("upstreams", req.Namespace, req.Name), "error", err)...)
+		ws.metrics.rejections.inc(rejectFormat)
+		return &admissionv1.AdmissionResponse{
+			UID:     req.UID,
+			Allowed: false,
+			Result: &metav1.Status{
+				Message: fmt.Sprintf("Failed to unmarshal OSSProxyUpstream: %v", err),
+			},
+		}
+	}
+
+	var violations []routeViolation
+	for _, v := range upstreamSpecValidators {
+		if err := v.validate(&upstream); err != nil {
+			violations = append(violations, routeViolation{"spec." + v.name, err.Error(), rejectFormat})
+		}
+	}
+
+	// 检查引用的 secret 是否存在，按 WEBHOOK_SECRET_REF_CHECK 拒绝或只给出 warning
+	var warnings []string
+	if err := ws.checkSecretRef(req, &upstream); err != nil {
+		if ws.watcher.config.webhookSecretRefCheck == ruleEnforce {
+			violations = append(violations, routeViolation{"spec.credentials.secretRef", err.Error(), rejectSecret})
+		} else {
+			warnings = append(warnings, err.Error())
+		}
+	}
+
+	if len(violations) > 0 {
+		return ws.rejectObject(req, &upstream, violations)
+	}
+
+	return &admissionv1.AdmissionResponse{
+		UID:      req.UID,
+		Allowed:  true,
+		Warnings: warnings,
+	}
+}
+
+// checkSecretRef 检查 spec.credentials.secretRef 引用的 secret 是否存在，命名空间的默认规则与 syncUpstreamSecrets 相同。
+// UPDATE 时 secretRef 未变化则不再检查；只有确认 secret 不存在时才返回错误，查询 apiserver 失败时只记录日志
+func (ws *WebhookServer) checkSecretRef(req *admissionv1.AdmissionRequest, upstream *unstructured.Unstructured) error {
+	if ws.watcher.config.webhookSecretRefCheck == ruleOff {
+		return nil
+	}
+	if upstream.GetNamespace() == "" {
+		upstream.SetNamespace(req.Namespace)
+	}
+	namespace, name, found, err := upstreamSecretRef(upstream)
+	if err != nil || !found {
+		return nil
+	}
+
+	if req.Operation == admissionv1.Update {
+		var oldUpstream unstructured.Unstructured
+		if err := json.Unmarshal(req.OldObject.Raw, &oldUpstream); err == nil {
+			if oldUpstream.GetNamespace() == "" {
+				oldUpstream.SetNamespace(req.Namespace)
+			}
+			if oldNamespace, oldName, ok, _ := upstreamSecretRef(&oldUpstream); ok && oldNamespace == namespace && oldName == name {
+				return nil
+			}
+		}
+	}
+
+	ctx, cancel := ws.apiContext()
+	defer cancel()
+	_, err = ws.watcher.clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	err = apiTimeoutError(ctx, err, "getting secret", ws.watcher.config.webhookAPITimeout)
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("referenced secret %s/%s not found", namespace, name)
+	}
+	if err != nil {
+		slog.Error("Failed to check referenced secret", append(objectLogAttrs("upstreams", upstream.GetNamespace(), upstream.GetName()), "secret", namespace+"/"+name, "error", err)...)
+	}
+	return nil
+}
+
+// validateSecretRefKeys 校验 spec.credentials.secretRef.keys：每一项都是合法的 secret key，
+// 且必须包含 accessKeyIdKey 和 secretAccessKeyKey，否则 OpenResty 收不到签名所需的凭据
+func validateSecretRefKeys(upstream *unstructured.Unstructured) error {
+	secretRef, found, err := unstructured.NestedMap(upstream.Object, "spec", "credentials", "secretRef")
+	if err != nil || !found {
+		return nil
+	}
+	if _, found := secretRef["keys"]; !found {
+		return nil
+	}
+	keys, _, err := unstructured.NestedStringSlice(secretRef, "keys")
+	if err != nil {
+		return fmt.Errorf("spec.credentials.secretRef.keys must be a list of strings: %v", err)
+	}
+
+	listed := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+			return fmt.Errorf("spec.credentials.secretRef.keys: '%s' is not a valid secret key: %s", key, strings.Join(errs, "; "))
+		}
+		listed[key] = true
+	}
+	for _, ref := range [][2]string{{"accessKeyIdKey", "access-key-id"}, {"secretAccessKeyKey", "secret-access-key"}} {
+		key, _, _ := unstructured.NestedString(secretRef, ref[0])
+		if key == "" {
+			key = ref[1]
+		}
+		if !listed[key] {
+			return fmt.Errorf("spec.credentials.secretRef.keys must include '%s' (secretRef.%s)", key, ref[0])
+		}
+	}
+	return nil
+}
+
+// validateUpstreamProvider 校验 spec.provider 必须是支持的对象存储类型之一
+func validateUpstreamProvider(upstream *unstructured.Unstructured) error {
+	provider, found, err := unstructured.NestedString(upstream.Object, "spec", "provider")
+	if err != nil {
+		return fmt.Errorf("spec.provider must be a string: %v", err)
+	}
+	if !found || provider == "" {
+		return fmt.Errorf("spec.provider is required, must be one of %s", strings.Join(upstreamProviders, ", "))
+	}
+	for _, p := range upstreamProviders {
+		if provider == p {
+			return nil
+		}
+	}
+	return fmt.Errorf("spec.provider '%s' must be one of %s", provider, strings.Join(upstreamProviders, ", "))
+}
+
+// validateUpstreamEndpoint 校验 spec.endpoint：可以是 host[:port]，也可以是带 http/https scheme 的 URL，
+// 但不能包含路径、查询参数或用户信息。带 scheme 时以 scheme 为准，忽略 spec.useHTTPS。
+func validateUpstreamEndpoint(upstream *unstructured.Unstructured) error {
+	endpoint, found, err := unstructured.NestedString(upstream.Object, "spec", "endpoint")
+	if err != nil {
+		return fmt.Errorf("spec.endpoint must be a string: %v", err)
+	}
+	if !found || endpoint == "" {
+		return fmt.Errorf("spec.endpoint is required")
+	}
+
+	raw := endpoint
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("spec.endpoint '%s' is not a valid URL: %v", endpoint, err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("spec.endpoint '%s' has unsupported scheme '%s', must be http or https", endpoint, parsed.Scheme)
+	}
+	if parsed.User != nil || (parsed.Path != "" && parsed.Path != "/") || parsed.RawQuery != "" || parsed.Fragment != "" {
+		return fmt.Errorf("spec.endpoint '%s' must only contain a scheme, host and port", endpoint)
+	}
+	host := parsed.Hostname()
+	if host == "" {
+		return fmt.Errorf("spec.endpoint '%s' must specify a host", endpoint)
+	}
+	if port := parsed.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+			return fmt.Errorf("spec.endpoint '%s' has invalid port '%s'", endpoint, port)
+		}
+	}
+	if net.ParseIP(host) == nil && len(validation.IsDNS1123Subdomain(strings.ToLower(host))) > 0 {
+		return fmt.Errorf("spec.endpoint '%s' has invalid host '%s'", endpoint, host)
+	}
+	return nil
+}
+
+// s3BucketPattern 为 S3 bucket 命名规则：3-63 个字符，只含小写字母、数字、. 和 -，以字母或数字开头和结尾
+var s3BucketPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// validateBucket 按 S3 命名规则校验 route 的 spec.bucket，各对象存储的规则都不比它宽松太多
+func validateBucket(route *unstructured.Unstructured) error {
+	bucket, found, err := unstructured.NestedString(route.Object, "spec", "bucket")
+	if err != nil {
+		return fmt.Errorf("spec.bucket must be a string: %v", err)
+	}
+	if !found || bucket == "" {
+		return fmt.Errorf("spec.bucket is required")
+	}
+	if !s3BucketPattern.MatchString(bucket) {
+		return fmt.Errorf("spec.bucket '%s' must be 3-63 characters of lowercase letters, digits, '.' and '-', starting and ending with a letter or digit", bucket)
+	}
+	if strings.Contains(bucket, "..") {
+		return fmt.Errorf("spec.bucket '%s' must not contain consecutive dots", bucket)
+	}
+	if net.ParseIP(bucket) != nil {
+		return fmt.Errorf("spec.bucket '%s' must not be formatted as an IP address", bucket)
+	}
+	return nil
+}
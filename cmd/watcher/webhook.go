@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"math"
 	"net/http"
+	"sort"
 	"strings"
+	"time"
 
 	admissionv1 "k8s.io/api/admission/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -19,18 +22,48 @@ type WebhookServer struct {
 	watcher  *Watcher
 	certPath string
 	keyPath  string
+	policies *policyStore
+	schemas  *routeSchemaStore
+	metrics  *webhookMetrics
+
+	// upstreamDeletePolicy 为 block 时拒绝删除仍被引用的 upstream，为 warn 时只返回 warning
+	upstreamDeletePolicy string
+	// createLimiter 限制每个命名空间创建 route 的速率，未配置时为 nil
+	createLimiter *namespaceRateLimiter
+	// ignoreTerminatingRoutes 为 true 时，正在删除（已设置 deletionTimestamp）的 route 不参与域名重复检查
+	ignoreTerminatingRoutes bool
+	// unhandledKinds 对收到的无关资源类型按类型采样输出警告
+	unhandledKinds *sampledLogger
+	// admitted 为最近放行、informer 缓存中可能还看不到的 route，参与域名重复检查
+	admitted *admittedRoutes
 }
 
-func NewWebhookServer(watcher *Watcher, port int, certPath, keyPath string) *WebhookServer {
+func NewWebhookServer(watcher *Watcher, port int, certPath, keyPath string, policies *policyStore, schemas *routeSchemaStore, createLimiter *namespaceRateLimiter) *WebhookServer {
 	mux := http.NewServeMux()
 	ws := &WebhookServer{
 		watcher:  watcher,
 		certPath: certPath,
 		keyPath:  keyPath,
+		policies: policies,
+		schemas:  schemas,
+		metrics:  newWebhookMetrics(),
+
+		createLimiter:           createLimiter,
+		upstreamDeletePolicy:    watcher.config.webhookUpstreamDeletePolicy,
+		ignoreTerminatingRoutes: watcher.config.webhookIgnoreTerminatingRoutes,
+		unhandledKinds:          newSampledLogger(time.Minute),
+		admitted:                newAdmittedRoutes(watcher.config.webhookAdmittedTTL),
 	}
 
 	mux.HandleFunc("/validate", ws.handleValidate)
+	mux.HandleFunc("/mutate", ws.handleMutate)
 	mux.HandleFunc("/health", ws.handleHealth)
+	mux.HandleFunc("/health/detail", ws.handleHealthDetail)
+	collectors := append(ws.metrics.collectors(), watcher.metrics.collectors()...)
+	if createLimiter != nil {
+		collectors = append(collectors, createLimiter)
+	}
+	mux.HandleFunc("/metrics", metricsHandler(collectors...))
 
 	ws.server = &http.Server{
 		Addr:    fmt.Sprintf(":%d", port),
@@ -41,7 +74,7 @@ func NewWebhookServer(watcher *Watcher, port int, certPath, keyPath string) *Web
 }
 
 func (ws *WebhookServer) Start() error {
-	log.Printf("Starting webhook server on %s", ws.server.Addr)
+	slog.Info("Starting webhook server", "addr", ws.server.Addr)
 
 	if ws.certPath != "" && ws.keyPath != "" {
 		// HTTPS
@@ -56,48 +89,63 @@ func (ws *WebhookServer) Stop() error {
 	return ws.server.Shutdown(context.Background())
 }
 
-func (ws *WebhookServer) handleHealth(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+func (ws *WebhookServer) handleValidate(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("Received validation request", "remoteAddr", r.RemoteAddr)
+	ws.serveAdmission(w, r, ws.validate)
 }
 
-func (ws *WebhookServer) handleValidate(w http.ResponseWriter, r *http.Request) {
-	log.Printf("Received validation request from %s", r.RemoteAddr)
+// validate 按资源类型分发 ValidatingWebhook 请求
+func (ws *WebhookServer) validate(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	gvk := req.Kind.Group + "/" + req.Kind.Version + "/" + req.Kind.Kind
+	ws.metrics.requestsByKind.inc(gvk)
+
+	switch {
+	case req.Kind.Group == "ossfe.imvictor.tech" && req.Kind.Kind == "OSSProxyUpstream":
+		return ws.validateOSSProxyUpstream(req)
+	case req.Kind.Group == "ossfe.imvictor.tech" && req.Kind.Kind == "OSSProxyRoute":
+		return ws.validateOSSProxyRoute(req)
+	default:
+		// 无关的资源类型直接放行，但说明 ValidatingWebhookConfiguration 的 rules 配置过宽
+		ws.unhandledKinds.warn(gvk, "Webhook received request for unhandled kind, check the ValidatingWebhookConfiguration rules",
+			"operation", req.Operation, "kind", gvk, "namespace", req.Namespace, "name", req.Name)
+		return &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+	}
+}
 
+// serveAdmission 解析 AdmissionReview 请求，交给 review 处理后写回响应，/validate 与 /mutate 共用
+func (ws *WebhookServer) serveAdmission(w http.ResponseWriter, r *http.Request, review func(*admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Printf("Failed to read request body: %v", err)
+		slog.Error("Failed to read request body", "remoteAddr", r.RemoteAddr, "error", err)
 		http.Error(w, "Failed to read request body", http.StatusBadRequest)
 		return
 	}
 
 	var admissionReview admissionv1.AdmissionReview
 	if err := json.Unmarshal(body, &admissionReview); err != nil {
-		log.Printf("Failed to unmarshal admission review: %v", err)
+		slog.Error("Failed to unmarshal admission review", "remoteAddr", r.RemoteAddr, "error", err)
 		http.Error(w, "Failed to unmarshal admission review", http.StatusBadRequest)
 		return
 	}
 
 	req := admissionReview.Request
 	if req == nil {
-		log.Printf("Admission review request is nil")
+		slog.Error("Admission review request is nil", "remoteAddr", r.RemoteAddr)
 		http.Error(w, "Admission review request is nil", http.StatusBadRequest)
 		return
 	}
 
-	response := ws.validateOSSProxyRoute(req)
-
 	admissionResponse := &admissionv1.AdmissionReview{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "admission.k8s.io/v1",
 			Kind:       "AdmissionReview",
 		},
-		Response: response,
+		Response: review(req),
 	}
 
 	respBytes, err := json.Marshal(admissionResponse)
 	if err != nil {
-		log.Printf("Failed to marshal admission response: %v", err)
+		slog.Error("Failed to marshal admission response", append(objectLogAttrs(kindLogResource(req.Kind.Kind), req.Namespace, req.Name), "error", err)...)
 		http.Error(w, "Failed to marshal admission response", http.StatusInternalServerError)
 		return
 	}
@@ -106,6 +154,88 @@ func (ws *WebhookServer) handleValidate(w http.ResponseWriter, r *http.Request)
 	w.Write(respBytes)
 }
 
+// routeSpecValidator 是对 route spec 中单个字段的格式校验，webhook 和全量审计共用
+type routeSpecValidator struct {
+	name     string
+	validate func(*unstructured.Unstructured) error
+}
+
+var routeSpecValidators = []routeSpecValidator{
+	{"bucket", validateBucket},
+	{"ipFilter", validateIPFilter},
+	{"contentTypeOverrides", validateContentTypeOverrides},
+	{"caseInsensitiveKeys", validateCaseInsensitiveKeys},
+	{"notFoundBehavior", validateNotFoundBehavior},
+	{"collapseRequests", validateCollapseRequests},
+	{"upstreamPathPrefix", validateUpstreamPathPrefix},
+	{"trailingSlash", validateTrailingSlash},
+	{"compression", validateCompression},
+	{"cacheVaryQuery", validateCacheVaryQuery},
+	{"paths", validatePaths},
+}
+
+// routeViolation 为 route 的一条校验失败，reason 用于 rejections 指标
+type routeViolation struct {
+	field   string
+	message string
+	reason  string
+}
+
+// rejectObject 将 route/upstream 的所有校验失败合并为一个拒绝响应，每条失败对应 Status.Details.Causes 中的一项。
+// rejections 指标按第一条失败的原因计数，每个被拒绝的请求只计一次。
+func (ws *WebhookServer) rejectObject(req *admissionv1.AdmissionRequest, obj *unstructured.Unstructured, violations []routeViolation) *admissionv1.AdmissionResponse {
+	messages := make([]string, 0, len(violations))
+	causes := make([]metav1.StatusCause, 0, len(violations))
+	for _, v := range violations {
+		slog.Info("Validation failed", append(objectLogAttrs(kindLogResource(req.Kind.Kind), obj.GetNamespace(), obj.GetName()), "field", v.field, "reason", v.message)...)
+		messages = append(messages, v.message)
+		causes = append(causes, metav1.StatusCause{
+			Type:    metav1.CauseTypeFieldValueInvalid,
+			Field:   v.field,
+			Message: v.message,
+		})
+	}
+	ws.metrics.rejections.inc(violations[0].reason)
+
+	return &admissionv1.AdmissionResponse{
+		UID:     req.UID,
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: strings.Join(messages, "; "),
+			Reason:  metav1.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
+			Details: &metav1.StatusDetails{
+				Name:   obj.GetName(),
+				Group:  req.Kind.Group,
+				Kind:   req.Kind.Kind,
+				Causes: causes,
+			},
+		},
+	}
+}
+
+// rateLimited 返回可重试的拒绝响应，RetryAfterSeconds 为令牌补充所需的时间
+func (ws *WebhookServer) rateLimited(req *admissionv1.AdmissionRequest, namespace string, wait time.Duration) *admissionv1.AdmissionResponse {
+	ws.metrics.rateLimited.inc(namespace)
+	retryAfter := int32(math.Ceil(wait.Seconds()))
+	slog.Info("Route creation rate limited", append(objectLogAttrs("routes", namespace, req.Name), "retryAfterSeconds", retryAfter)...)
+
+	return &admissionv1.AdmissionResponse{
+		UID:     req.UID,
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: fmt.Sprintf("too many OSSProxyRoute creations in namespace %s, retry after %d seconds", namespace, retryAfter),
+			Reason:  metav1.StatusReasonTooManyRequests,
+			Code:    http.StatusTooManyRequests,
+			Details: &metav1.StatusDetails{
+				RetryAfterSeconds: retryAfter,
+			},
+		},
+	}
+}
+
 func (ws *WebhookServer) validateOSSProxyRoute(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
 	// 只处理 OSSProxyRoute 资源
 	if req.Kind.Group != "ossfe.imvictor.tech" || req.Kind.Kind != "OSSProxyRoute" {
@@ -115,9 +245,12 @@ func (ws *WebhookServer) validateOSSProxyRoute(req *admissionv1.AdmissionRequest
 		}
 	}
 
+	ws.metrics.admissions.inc(string(req.Operation))
+
 	var route unstructured.Unstructured
 	if err := json.Unmarshal(req.Object.Raw, &route); err != nil {
-		log.Printf("Failed to unmarshal OSSProxyRoute: %v", err)
+		slog.Error("Failed to unmarshal OSSProxyRoute", append(objectLogAttrs("routes", req.Namespace, req.Name), "error", err)...)
+		ws.metrics.rejections.inc(rejectFormat)
 		return &admissionv1.AdmissionResponse{
 			UID:     req.UID,
 			Allowed: false,
@@ -127,81 +260,141 @@ func (ws *WebhookServer) validateOSSProxyRoute(req *admissionv1.AdmissionRequest
 		}
 	}
 
+	// 正在删除的 route 和只修改 finalizer 等元数据的更新（watcher 自己加上或移除 finalizer）不再校验，
+	// 否则已存在问题的 route 会因为校验失败而无法完成删除
+	if req.Operation == admissionv1.Update && (route.GetDeletionTimestamp() != nil || routeContentUnchanged(req, &route)) {
+		return &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+	}
+
+	// 按命名空间限制创建速率，超出时返回 429，客户端稍后重试即可成功
+	if req.Operation == admissionv1.Create && ws.createLimiter != nil {
+		if ok, wait := ws.createLimiter.allow(req.Namespace); !ok {
+			return ws.rateLimited(req, req.Namespace, wait)
+		}
+	}
+
+	// 收集所有校验失败后一次性返回：先是格式错误，再是域名策略，最后是依赖其他资源的检查
+	var violations []routeViolation
+
 	// 提取域名列表
 	hosts, found, err := unstructured.NestedStringSlice(route.Object, "spec", "hosts")
 	if err != nil {
-		log.Printf("Failed to get hosts from OSSProxyRoute: %v", err)
-		return &admissionv1.AdmissionResponse{
-			UID:     req.UID,
-			Allowed: false,
-			Result: &metav1.Status{
-				Message: fmt.Sprintf("Failed to get hosts: %v", err),
-			},
+		violations = append(violations, routeViolation{"spec.hosts", fmt.Sprintf("Failed to get hosts: %v", err), rejectFormat})
+	} else if !found || len(hosts) == 0 {
+		violations = append(violations, routeViolation{"spec.hosts", "OSSProxyRoute must specify at least one host", rejectFormat})
+	} else {
+		ws.metrics.hostsPerRoute.observe(float64(len(hosts)))
+	}
+
+	// 检查各字段的格式（IP 访问控制、Content-Type 覆盖、路径前缀等）
+	for _, v := range routeSpecValidators {
+		if err := v.validate(&route); err != nil {
+			violations = append(violations, routeViolation{"spec." + v.name, err.Error(), rejectFormat})
 		}
 	}
 
-	if !found || len(hosts) == 0 {
-		return &admissionv1.AdmissionResponse{
-			UID:     req.UID,
-			Allowed: false,
-			Result: &metav1.Status{
-				Message: "OSSProxyRoute must specify at least one host",
-			},
+	// 按运维人员提供的 JSON Schema 校验整个对象
+	if schema := ws.schemas.get(); schema != nil {
+		for _, e := range schema.validate(route.Object) {
+			violations = append(violations, routeViolation{e.field, e.message, rejectSchema})
 		}
 	}
 
-	// 检查域名重复
-	if err := ws.checkDuplicateHosts(hosts, route.GetName(), route.GetNamespace(), req.Operation); err != nil {
-		log.Printf("Host validation failed: %v", err)
-		return &admissionv1.AdmissionResponse{
-			UID:     req.UID,
-			Allowed: false,
-			Result: &metav1.Status{
-				Message: err.Error(),
-			},
+	// 检查域名策略（保留域名、后缀授权、正则白名单）
+	if policy := ws.policies.get(); policy != nil {
+		if err := policy.checkHosts(hosts, route.GetNamespace()); err != nil {
+			violations = append(violations, routeViolation{"spec.hosts", err.Error(), rejectPolicy})
 		}
 	}
 
-	return &admissionv1.AdmissionResponse{
-		UID:     req.UID,
-		Allowed: true,
+	// 检查域名重复
+	if err := ws.checkDuplicateHosts(&route, hosts, req.Operation); err != nil {
+		violations = append(violations, routeViolation{"spec.hosts", err.Error(), rejectDuplicate})
+	}
+
+	// 检查 route 内部的路径重复
+	if err := checkDuplicatePaths(&route); err != nil {
+		violations = append(violations, routeViolation{"spec.paths", err.Error(), rejectDuplicate})
+	}
+
+	// 检查引用的 upstream 是否存在
+	if err := ws.checkUpstreamRef(req, &route); err != nil {
+		violations = append(violations, routeViolation{"spec.upstreamRef", err.Error(), rejectUpstream})
 	}
-}
 
-func (ws *WebhookServer) checkDuplicateHosts(hosts []string, routeName, routeNamespace string, operation admissionv1.Operation) error {
-	// 获取所有现有的 OSSProxyRoute
-	routes, err := ws.watcher.client.Resource(routeGVR).List(context.Background(), metav1.ListOptions{})
+	// 检查 TLS 证书是否覆盖所有域名
+	warnings, err := ws.validateRouteTLS(&route, hosts)
 	if err != nil {
-		return fmt.Errorf("failed to list existing routes: %v", err)
+		violations = append(violations, routeViolation{"spec.tls", err.Error(), rejectTLS})
 	}
 
-	// 收集所有现有域名及其所属的 route
-	existingHosts := make(map[string]string) // host -> route_name/namespace
+	if len(violations) > 0 {
+		return ws.rejectObject(req, &route, violations)
+	}
 
-	for _, existingRoute := range routes.Items {
-		// 跳过当前正在创建/更新的 route（对于 UPDATE 操作）
-		if operation == admissionv1.Update &&
-			existingRoute.GetName() == routeName &&
-			existingRoute.GetNamespace() == routeNamespace {
-			continue
-		}
+	// 缓存配置可能无效时只给出 warning
+	warnings = append(warnings, ws.cacheWarnings(&route)...)
 
-		existingHostList, found, err := unstructured.NestedStringSlice(existingRoute.Object, "spec", "hosts")
-		if err != nil || !found {
-			continue
+	// 对象接近或超过 OpenResty 可接受的大小时提前给出 warning。
+	// 推送时的对象还会带上 managedFields 等服务端字段，因此在达到上限的 80% 时就提示。
+	if limit := ws.watcher.maxPayloadBytes; len(req.Object.Raw) > limit*8/10 {
+		warnings = append(warnings, fmt.Sprintf("OSSProxyRoute is %d bytes, close to or above the %d byte limit accepted by OpenResty; it may fail to sync with reason %s",
+			len(req.Object.Raw), limit, payloadTooLargeReason))
+	}
+
+	ws.admitted.record(req, &route)
+
+	return &admissionv1.AdmissionResponse{
+		UID:      req.UID,
+		Allowed:  true,
+		Warnings: warnings,
+	}
+}
+
+// checkDuplicateHosts 按 route key 检查冲突：host 模式下即域名重叠，host+label 模式下不同租户可以共用域名。
+// 域名比较时忽略大小写和末尾的点，通配符 *.domain 与其覆盖的域名或通配符也视为冲突。
+func (ws *WebhookServer) checkDuplicateHosts(route *unstructured.Unstructured, hosts []string, operation admissionv1.Operation) error {
+	// 获取所有现有的 OSSProxyRoute，informer 缓存就绪后从缓存读取，不再每次请求 apiserver。
+	// 不在 LABEL_SELECTOR/FIELD_SELECTOR 范围内的 route 由其他 watcher 管理，只检查 route 内部的重复
+	var routes []unstructured.Unstructured
+	if ws.watcher.informers.selector.matches(route) {
+		var err error
+		routes, err = ws.existingRoutes()
+		if err != nil {
+			return fmt.Errorf("failed to list existing routes: %v", err)
 		}
+	}
 
-		routeKey := fmt.Sprintf("%s/%s", existingRoute.GetNamespace(), existingRoute.GetName())
-		for _, host := range existingHostList {
-			existingHosts[host] = routeKey
+	// 收集所有现有域名及其所属的 route，跳过当前正在更新的 route；
+	// 启用 ignoreTerminatingRoutes 时同时跳过正在删除的 route，避免“先删旧 route 再建新 route”时被误判为重复
+	keyConfig := ws.watcher.routeKeys
+	existingKeys := collectRouteKeys(routes, keyConfig, func(existingRoute *unstructured.Unstructured) bool {
+		if ws.ignoreTerminatingRoutes && existingRoute.GetDeletionTimestamp() != nil {
+			return true
 		}
+		return operation == admissionv1.Update &&
+			existingRoute.GetName() == route.GetName() &&
+			existingRoute.GetNamespace() == route.GetNamespace()
+	})
+	existing := make([]string, 0, len(existingKeys))
+	for key := range existingKeys {
+		existing = append(existing, key)
 	}
+	sort.Strings(existing)
 
-	// 检查新的域名是否有重复
+	// 检查新的 route key 是否与现有的重复或重叠，每一对冲突单独列出
 	var conflicts []string
-	for _, host := range hosts {
-		if existingRoute, exists := existingHosts[host]; exists {
-			conflicts = append(conflicts, fmt.Sprintf("host '%s' already used by route %s", host, existingRoute))
+	for _, key := range keyConfig.keys(route) {
+		for _, existingKey := range existing {
+			if !routeKeysOverlap(key, existingKey) {
+				continue
+			}
+			owners := strings.Join(existingKeys[existingKey], ", ")
+			if normalizeRouteKey(key) == normalizeRouteKey(existingKey) {
+				conflicts = append(conflicts, fmt.Sprintf("%s already used by route %s", describeRouteKey(key), owners))
+			} else {
+				conflicts = append(conflicts, fmt.Sprintf("%s overlaps %s of route %s", describeRouteKey(key), describeRouteKey(existingKey), owners))
+			}
 		}
 	}
 
@@ -210,13 +403,70 @@ func (ws *WebhookServer) checkDuplicateHosts(hosts []string, routeName, routeNam
 	}
 
 	// 检查当前 route 内部是否有重复域名
+	if dups := duplicateHostsWithin(hosts); len(dups) > 0 {
+		return fmt.Errorf("duplicate host '%s' within the same route", dups[0])
+	}
+
+	return nil
+}
+
+// normalizeRouteKey 规范化 route key 中的域名部分
+func normalizeRouteKey(key string) string {
+	host, tenant, ok := strings.Cut(key, routeKeySeparator)
+	if !ok {
+		return normalizeHost(key)
+	}
+	return normalizeHost(host) + routeKeySeparator + tenant
+}
+
+// existingRoutes 返回监听范围内（WATCH_NAMESPACES）的全部 route，其他命名空间的 route 由其他 watcher 实例负责，不参与冲突检查。
+// informer 缓存尚未完成首次列出时（例如 watcher 刚启动）直接请求 apiserver。
+// 两种情况下都会叠加最近放行但尚未出现在结果中的 route，见 admittedRoutes。
+func (ws *WebhookServer) existingRoutes() ([]unstructured.Unstructured, error) {
+	var routes []unstructured.Unstructured
+	var err error
+	if ws.watcher.informers.routesSynced() {
+		routes, err = ws.watcher.informers.cachedRoutes()
+	} else {
+		ctx, cancel := ws.apiContext()
+		defer cancel()
+		routes, err = ws.watcher.listObjects(ctx, routeGVR)
+		err = apiTimeoutError(ctx, err, "listing routes", ws.watcher.config.webhookAPITimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ws.admitted.overlay(routes), nil
+}
+
+// collectRouteKeys 收集 route 列表中的 route key 及其所属 route（route key -> namespace/name 列表），
+// skip 返回 true 的 route 不参与统计
+func collectRouteKeys(routes []unstructured.Unstructured, keyConfig *routeKeyConfig, skip func(*unstructured.Unstructured) bool) map[string][]string {
+	keys := make(map[string][]string)
+	for i := range routes {
+		route := &routes[i]
+		if skip != nil && skip(route) {
+			continue
+		}
+
+		owner := fmt.Sprintf("%s/%s", route.GetNamespace(), route.GetName())
+		for _, key := range keyConfig.keys(route) {
+			keys[key] = append(keys[key], owner)
+		}
+	}
+	return keys
+}
+
+// duplicateHostsWithin 返回同一个 route 内重复出现的域名，比较时忽略大小写和末尾的点
+func duplicateHostsWithin(hosts []string) []string {
+	var dups []string
 	hostSet := make(map[string]bool)
 	for _, host := range hosts {
-		if hostSet[host] {
-			return fmt.Errorf("duplicate host '%s' within the same route", host)
+		normalized := normalizeHost(host)
+		if hostSet[normalized] {
+			dups = append(dups, host)
 		}
-		hostSet[host] = true
+		hostSet[normalized] = true
 	}
-
-	return nil
+	return dups
 }
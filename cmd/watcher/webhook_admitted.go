@@ -0,0 +1,95 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// admittedRoutes 记录 webhook 最近放行、但 informer 缓存中可能还看不到的 route。
+// 域名重复检查从 informer 缓存读取，批量 kubectl apply 时前一个 route 刚被放行、尚未通过 watch 到达缓存，
+// 后一个使用相同域名的 route 就会漏检；检查时把这些 route 叠加到缓存结果上即可发现冲突。
+//
+// 放行不代表一定写入成功（例如被其他 webhook 拒绝），因此记录只保留 ttl，到期或缓存中出现对应版本后删除。
+type admittedRoutes struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]admittedRoute
+}
+
+type admittedRoute struct {
+	route *unstructured.Unstructured
+	// oldResourceVersion 为 UPDATE 时旧对象的版本，缓存中的版本不同即说明更新已到达缓存；CREATE 时为空
+	oldResourceVersion string
+	expires            time.Time
+}
+
+func newAdmittedRoutes(ttl time.Duration) *admittedRoutes {
+	return &admittedRoutes{ttl: ttl, entries: make(map[string]admittedRoute)}
+}
+
+// record 记录一次放行的 CREATE 或 UPDATE，dry-run 请求和未指定名称（generateName）的请求不记录
+func (a *admittedRoutes) record(req *admissionv1.AdmissionRequest, route *unstructured.Unstructured) {
+	if req.DryRun != nil && *req.DryRun {
+		return
+	}
+	if req.Name == "" || (req.Operation != admissionv1.Create && req.Operation != admissionv1.Update) {
+		return
+	}
+
+	entry := admittedRoute{route: route.DeepCopy(), expires: time.Now().Add(a.ttl)}
+	entry.route.SetNamespace(req.Namespace)
+	entry.route.SetName(req.Name)
+	if req.Operation == admissionv1.Update {
+		var old unstructured.Unstructured
+		if err := old.UnmarshalJSON(req.OldObject.Raw); err == nil {
+			entry.oldResourceVersion = old.GetResourceVersion()
+		}
+	}
+
+	a.mu.Lock()
+	a.entries[req.Namespace+"/"+req.Name] = entry
+	a.mu.Unlock()
+}
+
+// overlay 用尚未到达缓存的放行结果替换或补充 routes，并清理已到达缓存或已过期的记录
+func (a *admittedRoutes) overlay(routes []unstructured.Unstructured) []unstructured.Unstructured {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.entries) == 0 {
+		return routes
+	}
+
+	index := make(map[string]int, len(routes))
+	for i := range routes {
+		index[routes[i].GetNamespace()+"/"+routes[i].GetName()] = i
+	}
+
+	now := time.Now()
+	for key, entry := range a.entries {
+		if now.After(entry.expires) {
+			delete(a.entries, key)
+			continue
+		}
+		i, cached := index[key]
+		if cached && (entry.oldResourceVersion == "" || routes[i].GetResourceVersion() != entry.oldResourceVersion) {
+			delete(a.entries, key)
+			continue
+		}
+		if cached {
+			routes[i] = *entry.route.DeepCopy()
+		} else {
+			routes = append(routes, *entry.route.DeepCopy())
+		}
+	}
+	return routes
+}
+
+// forget 删除 route 的记录，route 被删除后不应再参与冲突检查
+func (a *admittedRoutes) forget(namespace, name string) {
+	a.mu.Lock()
+	delete(a.entries, namespace+"/"+name)
+	a.mu.Unlock()
+}
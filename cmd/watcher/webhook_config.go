@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// 规则的生效方式
+const (
+	ruleEnforce = "enforce" // 不满足时拒绝请求
+	ruleWarn    = "warn"    // 不满足时只返回 warning
+	ruleOff     = "off"     // 未启用
+)
+
+type webhookRule struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Operation string `json:"operation"`
+	Mode      string `json:"mode"`
+}
+
+type webhookPolicyDump struct {
+	File              string              `json:"file"`
+	ReservedHosts     []string            `json:"reservedHosts"`
+	DelegatedSuffixes map[string][]string `json:"delegatedSuffixes"`
+	HostAllowPatterns []string            `json:"hostAllowPatterns"`
+}
+
+type webhookSchemaDump struct {
+	File string `json:"file"`
+}
+
+// webhookConfigDump 描述 webhook 当前实际执行的校验，是“现在会拒绝什么”的唯一依据
+type webhookConfigDump struct {
+	Enabled bool               `json:"enabled"`
+	Rules   []webhookRule      `json:"rules"`
+	Policy  *webhookPolicyDump `json:"policy"`
+	Schema  *webhookSchemaDump `json:"schema"`
+}
+
+// effectiveConfig 按 validateOSSProxyRoute / validateOSSProxyUpstream 的检查顺序列出规则及其当前状态
+func (ws *WebhookServer) effectiveConfig() webhookConfigDump {
+	dump := webhookConfigDump{Enabled: true}
+
+	route := func(name, mode string) {
+		dump.Rules = append(dump.Rules, webhookRule{Name: name, Kind: "OSSProxyRoute", Operation: "CREATE,UPDATE", Mode: mode})
+	}
+
+	rateLimitMode := ruleOff
+	if ws.createLimiter != nil {
+		rateLimitMode = ruleEnforce
+	}
+	dump.Rules = append(dump.Rules, webhookRule{Name: "createRateLimit", Kind: "OSSProxyRoute", Operation: "CREATE", Mode: rateLimitMode})
+	route("hosts", ruleEnforce)
+	for _, v := range routeSpecValidators {
+		route(v.name, ruleEnforce)
+	}
+
+	if ws.schemas.get() != nil {
+		route("routeSchema", ruleEnforce)
+		dump.Schema = &webhookSchemaDump{File: ws.schemas.path}
+	} else {
+		route("routeSchema", ruleOff)
+	}
+
+	policy := ws.policies.get()
+	if policy != nil {
+		route("hostPolicy", ruleEnforce)
+		dump.Policy = &webhookPolicyDump{
+			File:              ws.policies.path,
+			ReservedHosts:     policy.ReservedHosts,
+			DelegatedSuffixes: policy.DelegatedSuffixes,
+			HostAllowPatterns: policy.HostAllowPatterns,
+		}
+	} else {
+		route("hostPolicy", ruleOff)
+	}
+
+	route("duplicateHosts", ruleEnforce)
+	route("upstreamExists", ruleEnforce)
+	route("tlsCertificate", ruleEnforce)
+	route("cacheEffectiveness", ruleWarn)
+	route("payloadSize", ruleWarn)
+
+	for _, v := range upstreamSpecValidators {
+		dump.Rules = append(dump.Rules, webhookRule{Name: v.name, Kind: "OSSProxyUpstream", Operation: "CREATE,UPDATE", Mode: ruleEnforce})
+	}
+
+	dump.Rules = append(dump.Rules, webhookRule{Name: "secretExists", Kind: "OSSProxyUpstream", Operation: "CREATE,UPDATE", Mode: ws.watcher.config.webhookSecretRefCheck})
+
+	upstreamDeleteMode := ruleEnforce
+	if ws.upstreamDeletePolicy == upstreamDeleteWarn {
+		upstreamDeleteMode = ruleWarn
+	}
+	dump.Rules = append(dump.Rules, webhookRule{Name: "upstreamInUse", Kind: "OSSProxyUpstream", Operation: "DELETE", Mode: upstreamDeleteMode})
+
+	return dump
+}
+
+// handleWebhookConfig 输出 webhook 当前生效的校验规则和域名策略
+func (as *AdminServer) handleWebhookConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dump := webhookConfigDump{Enabled: false, Rules: []webhookRule{}}
+	if webhook := as.watcher.webhook; webhook != nil {
+		dump = webhook.effectiveConfig()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dump)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestValidateRouteAggregatesViolations(t *testing.T) {
+	tests := []struct {
+		name       string
+		spec       map[string]interface{}
+		wantFields []string
+	}{
+		{
+			name:       "valid",
+			spec:       routeSpec("a.example.com"),
+			wantFields: nil,
+		},
+		{
+			name:       "missing hosts",
+			spec:       map[string]interface{}{"bucket": "assets"},
+			wantFields: []string{"spec.hosts"},
+		},
+		{
+			name: "several invalid fields",
+			spec: map[string]interface{}{
+				"bucket":             "assets",
+				"hosts":              []interface{}{"a.example.com", "A.example.com"},
+				"trailingSlash":      "remove",
+				"upstreamPathPrefix": "/abs",
+				"upstreamRef":        map[string]interface{}{"name": "missing"},
+			},
+			wantFields: []string{"spec.upstreamPathPrefix", "spec.trailingSlash", "spec.hosts", "spec.upstreamRef"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWatcher(t, newOpenrestyStub())
+			ws := newTestWebhook(w)
+
+			resp := ws.validate(admissionRequest(t, "OSSProxyRoute", admissionv1.Create, testRoute(tt.spec), nil))
+			if len(tt.wantFields) == 0 {
+				if !resp.Allowed {
+					t.Fatalf("rejected: %s", resp.Result.Message)
+				}
+				return
+			}
+			if resp.Allowed {
+				t.Fatal("expected the route to be rejected")
+			}
+			if resp.Result.Code != http.StatusUnprocessableEntity {
+				t.Errorf("Code = %d, want 422", resp.Result.Code)
+			}
+
+			var fields []string
+			for _, cause := range resp.Result.Details.Causes {
+				fields = append(fields, cause.Field)
+			}
+			if !containsInOrder(fields, tt.wantFields) {
+				t.Errorf("cause fields = %v, want %v in order", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+// containsInOrder 判断 want 中的每一项都按顺序出现在 got 中
+func containsInOrder(got, want []string) bool {
+	i := 0
+	for _, g := range got {
+		if i < len(want) && g == want[i] {
+			i++
+		}
+	}
+	return i == len(want)
+}
+
+func TestValidateRouteDuplicateHosts(t *testing.T) {
+	w := newTestWatcher(t, newOpenrestyStub())
+	ws := newTestWebhook(w)
+	existing := testRoute(routeSpec("a.example.com"))
+	existing.SetName("existing")
+	createTestObject(t, w, routeGVR, existing)
+
+	tests := []struct {
+		name        string
+		operation   admissionv1.Operation
+		routeName   string
+		hosts       []string
+		wantAllowed bool
+	}{
+		{"new host", admissionv1.Create, "r", []string{"b.example.com"}, true},
+		{"taken host", admissionv1.Create, "r", []string{"A.example.com."}, false},
+		{"wildcard overlap", admissionv1.Create, "r", []string{"*.example.com"}, false},
+		{"update of the owner", admissionv1.Update, "existing", []string{"a.example.com", "c.example.com"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := testRoute(routeSpec(tt.hosts...))
+			route.SetName(tt.routeName)
+			var old *unstructured.Unstructured
+			if tt.operation == admissionv1.Update {
+				old = existing
+			}
+			resp := ws.validate(admissionRequest(t, "OSSProxyRoute", tt.operation, route, old))
+			if resp.Allowed != tt.wantAllowed {
+				t.Fatalf("Allowed = %v, want %v (%v)", resp.Allowed, tt.wantAllowed, resp.Result)
+			}
+		})
+	}
+}
+
+func TestValidateRouteRateLimit(t *testing.T) {
+	w := newTestWatcher(t, newOpenrestyStub())
+	ws := newTestWebhook(w)
+	ws.createLimiter = &namespaceRateLimiter{rate: 1.0 / 60, burst: 2, buckets: make(map[string]*tokenBucket)}
+
+	create := func(namespace, name string) *admissionv1.AdmissionResponse {
+		route := testRoute(routeSpec(name + ".example.com"))
+		route.SetNamespace(namespace)
+		route.SetName(name)
+		return ws.validate(admissionRequest(t, "OSSProxyRoute", admissionv1.Create, route, nil))
+	}
+
+	var allowed []bool
+	for _, name := range []string{"a", "b", "c"} {
+		allowed = append(allowed, create("web", name).Allowed)
+	}
+	if want := []bool{true, true, false}; !reflect.DeepEqual(allowed, want) {
+		t.Fatalf("allowed = %v, want %v", allowed, want)
+	}
+
+	resp := create("web", "d")
+	if resp.Result.Code != http.StatusTooManyRequests || resp.Result.Details.RetryAfterSeconds <= 0 {
+		t.Errorf("rate limited response = %+v", resp.Result)
+	}
+	if !create("other", "e").Allowed {
+		t.Error("other namespaces must have their own bucket")
+	}
+}
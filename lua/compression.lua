@@ -0,0 +1,182 @@
+local ffi = require "ffi"
+
+local _M = {}
+
+ffi.cdef[[
+typedef struct z_stream_s {
+    const unsigned char *next_in;
+    unsigned int avail_in;
+    unsigned long total_in;
+    unsigned char *next_out;
+    unsigned int avail_out;
+    unsigned long total_out;
+    const char *msg;
+    void *state;
+    void *zalloc;
+    void *zfree;
+    void *opaque;
+    int data_type;
+    unsigned long adler;
+    unsigned long reserved;
+} z_stream;
+
+const char *zlibVersion(void);
+int deflateInit2_(z_stream *strm, int level, int method, int windowBits, int memLevel, int strategy, const char *version, int stream_size);
+int deflate(z_stream *strm, int flush);
+int deflateEnd(z_stream *strm);
+unsigned long deflateBound(z_stream *strm, unsigned long sourceLen);
+
+size_t BrotliEncoderMaxCompressedSize(size_t input_size);
+int BrotliEncoderCompress(int quality, int lgwin, int mode, size_t input_size, const uint8_t *input_buffer, size_t *encoded_size, uint8_t *encoded_buffer);
+]]
+
+-- 系统库不存在时对应算法不可用，协商时跳过
+local zlib_ok, zlib = pcall(ffi.load, "libz.so.1")
+local brotli_ok, brotli = pcall(ffi.load, "libbrotlienc.so.1")
+if not zlib_ok then
+    ngx.log(ngx.WARN, "[compression] libz 不可用，gzip 压缩已禁用")
+end
+if not brotli_ok then
+    ngx.log(ngx.WARN, "[compression] libbrotlienc 不可用，br 压缩已禁用")
+end
+
+local Z_FINISH = 4
+local Z_STREAM_END = 1
+local Z_DEFLATED = 8
+local GZIP_WINDOW_BITS = 31 -- 15 + 16 输出 gzip 格式
+local GZIP_LEVEL = 6
+local BROTLI_QUALITY = 5
+local BROTLI_LGWIN = 22
+
+local DEFAULT_MIN_SIZE = 1024
+local DEFAULT_TYPES = {
+    "text/html", "text/css", "text/plain", "text/javascript",
+    "application/javascript", "application/json", "image/svg+xml",
+}
+
+local function gzip(body)
+    local stream = ffi.new("z_stream")
+    if zlib.deflateInit2_(stream, GZIP_LEVEL, Z_DEFLATED, GZIP_WINDOW_BITS, 8, 0,
+            zlib.zlibVersion(), ffi.sizeof(stream)) ~= 0 then
+        return nil
+    end
+
+    local bound = tonumber(zlib.deflateBound(stream, #body))
+    local out = ffi.new("unsigned char[?]", bound)
+    stream.next_in = ffi.cast("const unsigned char *", body)
+    stream.avail_in = #body
+    stream.next_out = out
+    stream.avail_out = bound
+
+    local rc = zlib.deflate(stream, Z_FINISH)
+    local size = tonumber(stream.total_out)
+    zlib.deflateEnd(stream)
+    if rc ~= Z_STREAM_END then
+        return nil
+    end
+    return ffi.string(out, size)
+end
+
+local function br(body)
+    local bound = tonumber(brotli.BrotliEncoderMaxCompressedSize(#body))
+    if bound == 0 then
+        return nil
+    end
+    local out = ffi.new("uint8_t[?]", bound)
+    local size = ffi.new("size_t[1]", bound)
+    if brotli.BrotliEncoderCompress(BROTLI_QUALITY, BROTLI_LGWIN, 0, #body, ffi.cast("const uint8_t *", body), size, out) == 0 then
+        return nil
+    end
+    return ffi.string(out, tonumber(size[0]))
+end
+
+local encoders = {}
+if zlib_ok then
+    encoders.gzip = gzip
+end
+if brotli_ok then
+    encoders.br = br
+end
+
+-- 解析 Accept-Encoding，返回 q 值大于 0 的编码集合
+local function accepted_encodings()
+    local header = ngx.var.http_accept_encoding
+    local accepted = {}
+    if not header then
+        return accepted
+    end
+    for item in string.gmatch(header, "[^,]+") do
+        local name, params = item:match("^%s*([^;%s]+)%s*(.*)$")
+        if name then
+            local q = tonumber(params:match("q%s*=%s*([%d%.]+)") or "1")
+            if q and q > 0 then
+                accepted[name:lower()] = true
+            end
+        end
+    end
+    return accepted
+end
+
+-- 判断 Content-Type 是否在 types 中，支持 text/* 形式的通配
+local function type_matches(types, content_type)
+    local media_type = (content_type or ""):match("^%s*([^;%s]+)")
+    if not media_type then
+        return false
+    end
+    media_type = media_type:lower()
+    for _, t in ipairs(types) do
+        t = t:lower()
+        if t == media_type then
+            return true
+        end
+        local prefix = t:match("^(.+/)%*$")
+        if prefix and media_type:sub(1, #prefix) == prefix then
+            return true
+        end
+    end
+    return false
+end
+
+-- 按 route 的 spec.compression 压缩响应体。满足条件时设置 Content-Encoding 等响应头并返回压缩后的内容，
+-- 否则返回 nil，调用方原样输出。算法按 algorithms 的顺序优先选择客户端接受的第一个。
+function _M.apply(config, content_type, body)
+    if not config or not config.enabled or not body then
+        return nil
+    end
+    if not type_matches(config.types or DEFAULT_TYPES, content_type) then
+        return nil
+    end
+
+    -- 类型匹配时无论是否压缩都要告知缓存按 Accept-Encoding 区分
+    ngx.header["Vary"] = "Accept-Encoding"
+
+    -- upstream 已经压缩过的对象不再处理
+    if ngx.header["Content-Encoding"] then
+        return nil
+    end
+    if #body < (config.minSize or DEFAULT_MIN_SIZE) then
+        return nil
+    end
+
+    local accepted = accepted_encodings()
+    for _, algorithm in ipairs(config.algorithms or { "gzip" }) do
+        local encode = encoders[algorithm]
+        if encode and accepted[algorithm] then
+            local compressed = encode(body)
+            if compressed then
+                ngx.header["Content-Encoding"] = algorithm
+                ngx.header["Content-Length"] = #compressed
+                -- 压缩后内容与原对象不再逐字节一致，强 ETag 降级为弱 ETag
+                local etag = ngx.header["ETag"]
+                if etag and not etag:find("^W/") then
+                    ngx.header["ETag"] = "W/" .. etag
+                end
+                return compressed
+            end
+            ngx.log(ngx.WARN, "[compression] ", algorithm, " 压缩失败，返回未压缩内容")
+        end
+    end
+    return nil
+end
+
+return _M
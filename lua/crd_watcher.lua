@@ -1,4 +1,5 @@
 local json = require "cjson"
+local resty_lock = require "resty.lock"
 
 local _M = {}
 
@@ -17,6 +18,9 @@ local function init_shared_state()
         crd_cache:set("last_sync", 0)
         ngx.log(ngx.INFO, "[crd_watcher] 初始化共享状态")
     end
+    -- 实例 ID 只在共享字典为空（即 OpenResty 启动）时生成，reload 后保持不变，供 watcher 检测重启
+    ngx.update_time()
+    crd_cache:add("instance", string.format("%d-%d", ngx.now() * 1000, ngx.worker.pid()))
 end
 
 -- 检查是否应该设置为 ready 状态
@@ -49,8 +53,71 @@ local function update_ready_status()
     end
 end
 
--- 更新路由缓存
-function _M.update_route(route_data)
+-- 记录/删除对象内容哈希（由 watcher 计算并随推送携带），用于 watcher 重启时 adopt 已有状态
+local function set_object_hash(dict_key, object_key, hash)
+    local hashes = {}
+    local hashes_json = crd_cache:get(dict_key)
+    if hashes_json then
+        hashes = json.decode(hashes_json) or {}
+    end
+    hashes[object_key] = hash
+    crd_cache:set(dict_key, json.encode(hashes))
+end
+
+local function get_object_hashes(dict_key)
+    local hashes_json = crd_cache:get(dict_key)
+    if not hashes_json then
+        return {}
+    end
+    local hashes = json.decode(hashes_json)
+    if not hashes or type(hashes) ~= "table" then
+        return {}
+    end
+    return hashes
+end
+
+local function metadata_key(data)
+    return (data.metadata.namespace or "default") .. "/" .. data.metadata.name
+end
+
+-- 判断推送的对象是否早于已持有的版本。resourceVersion 在 Kubernetes 中是不透明的字符串，
+-- 这里只在两者都是数字（etcd 的实现如此）时比较，否则不做检查
+local function is_stale(existing, incoming)
+    if type(existing) ~= "table" or type(existing.metadata) ~= "table" or type(incoming.metadata) ~= "table" then
+        return false
+    end
+    local held = tonumber(existing.metadata.resourceVersion)
+    local pushed = tonumber(incoming.metadata.resourceVersion)
+    return held ~= nil and pushed ~= nil and pushed < held
+end
+
+local function stale_error(key, existing, incoming)
+    return string.format("conflict: %s already at resourceVersion %s, got %s",
+        key, existing.metadata.resourceVersion, incoming.metadata.resourceVersion)
+end
+
+-- 路由表的 key 由 watcher 按 ROUTE_KEY_MODE 计算并通过 X-Route-Keys 传入（逗号分隔），
+-- 形如 host 或 host|tenant；未传入时退回使用 spec.hosts
+local function route_keys(route_data, keys_header)
+    if not keys_header or keys_header == "" then
+        return route_data.spec.hosts
+    end
+    local keys = {}
+    for key in string.gmatch(keys_header, "[^,]+") do
+        table.insert(keys, key)
+    end
+    return keys
+end
+
+-- 请求选择租户所用的请求头，仅在 ROUTE_KEY_MODE=host+label 时设置
+local tenant_header = os.getenv("ROUTE_TENANT_HEADER")
+if tenant_header == "" then
+    tenant_header = nil
+end
+
+-- 更新路由缓存，keys_header 为 watcher 计算的路由 key。
+-- 推送的版本早于已持有的版本时不做修改，第三个返回值为 true，由调用方返回 409
+function _M.update_route(route_data, hash, keys_header)
     if not route_data or not route_data.spec or not route_data.spec.hosts then
         return false, "invalid route data"
     end
@@ -62,13 +129,38 @@ function _M.update_route(route_data)
         routes = json.decode(routes_json) or {}
     end
     
+    -- 移除该 route 此前占用、但已不在新 key 中的条目（域名或租户 label 被修改）
+    local keys = route_keys(route_data, keys_header)
+    local wanted = {}
+    for _, key in ipairs(keys) do
+        wanted[key] = true
+    end
+    if route_data.metadata and route_data.metadata.name then
+        local owner = metadata_key(route_data)
+        for _, existing in pairs(routes) do
+            if type(existing) == "table" and existing.metadata and existing.metadata.name
+                and metadata_key(existing) == owner and is_stale(existing, route_data) then
+                return false, stale_error(owner, existing, route_data), true
+            end
+        end
+        for key, existing in pairs(routes) do
+            if not wanted[key] and type(existing) == "table" and existing.metadata
+                and existing.metadata.name and metadata_key(existing) == owner then
+                routes[key] = nil
+            end
+        end
+    end
+
     -- 更新路由
-    for _, host in ipairs(route_data.spec.hosts) do
-        routes[host] = route_data
+    for _, key in ipairs(keys) do
+        routes[key] = route_data
     end
     
     -- 写回共享字典
     crd_cache:set("routes", json.encode(routes))
+    if route_data.metadata and route_data.metadata.name then
+        set_object_hash("route_hashes", metadata_key(route_data), hash)
+    end
     crd_cache:set("version", route_data.metadata and route_data.metadata.resourceVersion or crd_cache:get("version"))
     crd_cache:set("last_sync", ngx.now())
     
@@ -79,8 +171,8 @@ function _M.update_route(route_data)
     return true, nil
 end
 
--- 删除路由缓存
-function _M.delete_route(route_data)
+-- 删除路由缓存，第三个返回值表示删除前是否存在该路由
+function _M.delete_route(route_data, keys_header)
     if not route_data or not route_data.spec or not route_data.spec.hosts then
         return false, "invalid route data"
     end
@@ -93,12 +185,19 @@ function _M.delete_route(route_data)
     end
     
     -- 删除路由
-    for _, host in ipairs(route_data.spec.hosts) do
-        routes[host] = nil
+    local existed = false
+    for _, key in ipairs(route_keys(route_data, keys_header)) do
+        if routes[key] ~= nil then
+            existed = true
+        end
+        routes[key] = nil
     end
     
     -- 写回共享字典
     crd_cache:set("routes", json.encode(routes))
+    if route_data.metadata and route_data.metadata.name then
+        set_object_hash("route_hashes", metadata_key(route_data), nil)
+    end
     crd_cache:set("version", route_data.metadata and route_data.metadata.resourceVersion or crd_cache:get("version"))
     crd_cache:set("last_sync", ngx.now())
     
@@ -106,11 +205,11 @@ function _M.delete_route(route_data)
     update_ready_status()
     
     ngx.log(ngx.INFO, "[crd_watcher] 删除路由: ", table.concat(route_data.spec.hosts, ", "))
-    return true, nil
+    return true, nil, existed
 end
 
--- 更新 upstream 缓存
-function _M.update_upstream(upstream_data)
+-- 更新 upstream 缓存，返回值与 update_route 相同
+function _M.update_upstream(upstream_data, hash)
     if not upstream_data or not upstream_data.metadata then
         return false, "invalid upstream data"
     end
@@ -124,11 +223,16 @@ function _M.update_upstream(upstream_data)
         upstreams = json.decode(upstreams_json) or {}
     end
     
+    if is_stale(upstreams[key], upstream_data) then
+        return false, stale_error(key, upstreams[key], upstream_data), true
+    end
+
     -- 更新 upstream
     upstreams[key] = upstream_data
     
     -- 写回共享字典
     crd_cache:set("upstreams", json.encode(upstreams))
+    set_object_hash("upstream_hashes", key, hash)
     crd_cache:set("last_sync", ngx.now())
     
     -- 更新 ready 状态（上游更新不影响 ready 状态，因为主要依赖路由）
@@ -138,7 +242,29 @@ function _M.update_upstream(upstream_data)
     return true, nil
 end
 
--- 删除 upstream 缓存
+-- 批量更新 route 或 upstream，items 中每一项形如 {object, hash, routeKeys}，
+-- 返回与 items 一一对应的处理结果，单项失败不影响其余项
+function _M.bulk_update(resource, items)
+    local results = {}
+    for i, item in ipairs(items) do
+        local success, err
+        if type(item) ~= "table" or type(item.object) ~= "table" then
+            success, err = false, "invalid item"
+        elseif resource == "routes" then
+            local keys = item.routeKeys
+            if type(keys) ~= "string" then
+                keys = nil
+            end
+            success, err = _M.update_route(item.object, item.hash, keys)
+        else
+            success, err = _M.update_upstream(item.object, item.hash)
+        end
+        results[i] = { ok = success and true or false, error = err }
+    end
+    return results
+end
+
+-- 删除 upstream 缓存，第三个返回值表示删除前是否存在该 upstream
 function _M.delete_upstream(upstream_data)
     if not upstream_data or not upstream_data.metadata then
         return false, "invalid upstream data"
@@ -154,17 +280,19 @@ function _M.delete_upstream(upstream_data)
     end
     
     -- 删除 upstream
+    local existed = upstreams[key] ~= nil
     upstreams[key] = nil
     
     -- 写回共享字典
     crd_cache:set("upstreams", json.encode(upstreams))
+    set_object_hash("upstream_hashes", key, nil)
     crd_cache:set("last_sync", ngx.now())
     
     -- 更新 ready 状态
     update_ready_status()
     
     ngx.log(ngx.INFO, "[crd_watcher] 删除upstream: ", key)
-    return true, nil
+    return true, nil, existed
 end
 
 -- 更新 secret 缓存
@@ -174,6 +302,21 @@ function _M.update_secret(secret_data)
     end
     
     local key = (secret_data.metadata.namespace or "default") .. "/" .. secret_data.metadata.name
+
+    -- watcher 以 base64 发送 data 中的值（dataEncoding = "base64"），以便二进制值经 JSON 传输不被破坏，
+    -- 这里解码后保存原始字节，读取凭据的代码无需关心编码
+    if secret_data.dataEncoding == "base64" then
+        local decoded = {}
+        for name, value in pairs(secret_data.data or {}) do
+            local raw = type(value) == "string" and ngx.decode_base64(value)
+            if not raw then
+                return false, "invalid base64 value for secret key " .. tostring(name)
+            end
+            decoded[name] = raw
+        end
+        secret_data.data = decoded
+        secret_data.dataEncoding = nil
+    end
     
     -- 读取现有 secrets
     local secrets = {}
@@ -193,7 +336,7 @@ function _M.update_secret(secret_data)
     return true, nil
 end
 
--- 删除 secret 缓存
+-- 删除 secret 缓存，第三个返回值表示删除前是否存在该 secret
 function _M.delete_secret(secret_data)
     if not secret_data or not secret_data.metadata then
         return false, "invalid secret data"
@@ -209,6 +352,7 @@ function _M.delete_secret(secret_data)
     end
     
     -- 删除 secret
+    local existed = secrets[key] ~= nil
     secrets[key] = nil
     
     -- 写回共享字典
@@ -216,7 +360,119 @@ function _M.delete_secret(secret_data)
     crd_cache:set("last_sync", ngx.now())
     
     ngx.log(ngx.INFO, "[crd_watcher] 删除secret: ", key)
-    return true, nil
+    return true, nil, existed
+end
+
+-- 记录 watcher 推送携带的 epoch（只增不减）。
+-- 多个 worker 会同时处理推送，读取与写入之间持有锁，否则较小的 epoch 可能覆盖已记录的较大值，
+-- watcher 随后会误判推送丢失而关闭 readiness
+function _M.record_epoch(epoch)
+    local n = tonumber(epoch)
+    if not n then
+        return
+    end
+
+    local lock, err = resty_lock:new("crd_locks", { timeout = 1, exptime = 5 })
+    if not lock then
+        ngx.log(ngx.ERR, "[crd_watcher] 创建 epoch 锁失败: ", err)
+        return
+    end
+    local elapsed, lock_err = lock:lock("epoch")
+    if not elapsed then
+        ngx.log(ngx.ERR, "[crd_watcher] 获取 epoch 锁失败: ", lock_err)
+        return
+    end
+
+    local current = crd_cache:get("epoch") or 0
+    if n > current then
+        crd_cache:set("epoch", n)
+    end
+    lock:unlock()
+end
+
+-- 获取已应用的 epoch 及 readiness 状态
+function _M.get_epoch_status()
+    ngx.update_time()
+    return {
+        epoch = crd_cache:get("epoch") or 0,
+        ready = _M.is_ready() and true or false,
+        now = ngx.now(),
+        instance = crd_cache:get("instance") or ""
+    }
+end
+
+-- 由 watcher 打开/关闭 readiness gate（epoch 不一致时关闭）
+function _M.set_readiness_gate(ready)
+    crd_cache:set("gate_closed", not ready)
+    if ready then
+        ngx.log(ngx.INFO, "[crd_watcher] readiness gate 已打开")
+    else
+        ngx.log(ngx.WARN, "[crd_watcher] readiness gate 已关闭（epoch 不一致）")
+    end
+end
+
+-- 列出 route 的内容哈希（namespace/name -> hash）
+function _M.list_route_hashes()
+    return get_object_hashes("route_hashes")
+end
+
+-- 列出 upstream 的内容哈希（namespace/name -> hash）
+function _M.list_upstream_hashes()
+    return get_object_hashes("upstream_hashes")
+end
+
+-- 列出当前缓存中所有 route（namespace/name -> hosts），用于清理已没有对应 CR 的路由
+function _M.list_route_keys()
+    local keys = {}
+    local routes_json = crd_cache:get("routes")
+    if routes_json then
+        local routes = json.decode(routes_json)
+        if routes and type(routes) == "table" then
+            for host, route_data in pairs(routes) do
+                if type(route_data) == "table" and route_data.metadata and route_data.metadata.name then
+                    local key = metadata_key(route_data)
+                    keys[key] = keys[key] or {}
+                    table.insert(keys[key], host)
+                end
+            end
+        end
+    end
+    for _, hosts in pairs(keys) do
+        table.sort(hosts)
+    end
+    return keys
+end
+
+-- 列出当前缓存中所有 upstream 的 key（namespace/name）
+function _M.list_upstream_keys()
+    local keys = {}
+    local upstreams_json = crd_cache:get("upstreams")
+    if upstreams_json then
+        local upstreams = json.decode(upstreams_json)
+        if upstreams and type(upstreams) == "table" then
+            for key in pairs(upstreams) do
+                table.insert(keys, key)
+            end
+        end
+    end
+    table.sort(keys)
+    return keys
+end
+
+-- 列出当前缓存中所有 secret 的 key（namespace/name），不包含 secret 内容
+function _M.list_secret_keys()
+    local keys = {}
+    local secrets_json = crd_cache:get("secrets")
+    if secrets_json then
+        local secrets = json.decode(secrets_json)
+        if secrets and type(secrets) == "table" then
+            for key in pairs(secrets) do
+                table.insert(keys, key)
+            end
+        end
+    end
+    table.sort(keys)
+    return keys
 end
 
 -- 获取缓存状态
@@ -284,7 +540,18 @@ function _M.find_route_by_host(host)
         return nil, nil
     end
     
-    local route = routes[host]
+    -- 按租户请求头优先匹配 host|tenant，未匹配时使用不带租户的默认路由
+    local route
+    if tenant_header then
+        local tenant = ngx.req.get_headers()[tenant_header]
+        if type(tenant) == "table" then
+            tenant = tenant[1]
+        end
+        if tenant and tenant ~= "" then
+            route = routes[host .. "|" .. tenant]
+        end
+    end
+    route = route or routes[host]
     if not route then
         return nil, nil
     end
@@ -315,7 +582,13 @@ function _M.get_upstream(name, namespace)
         local secret_ref = up.spec.credentials.secretRef
         local secret, secret_err = _M.get_secret(secret_ref.name, secret_ref.namespace or namespace)
         if secret_err then
-            ngx.log(ngx.WARN, "获取Secret失败: ", secret_err)
+            -- 凭据未同步时，只有声明了 anonymousFallback 的 upstream 才以匿名方式访问公开对象
+            if up.spec.credentials.anonymousFallback then
+                ngx.log(ngx.WARN, "获取Secret失败，upstream ", key, " 降级为匿名访问: ", secret_err)
+            else
+                ngx.log(ngx.WARN, "获取Secret失败: ", secret_err)
+                up.spec.credentials.unavailable = true
+            end
         else
             if secret.data then
                 local access_key_id = secret.data[secret_ref.accessKeyIdKey] or ""
@@ -380,10 +653,12 @@ function _M.is_ready()
         end
     end
     
-    ngx.log(ngx.INFO, string.format("[crd_watcher] is_ready() 调用: ready=%s, synced_once=%s, route_count=%d", 
-        tostring(ready), tostring(synced_once), route_count))
+    local gate_closed = crd_cache:get("gate_closed")
+    
+    ngx.log(ngx.INFO, string.format("[crd_watcher] is_ready() 调用: ready=%s, synced_once=%s, gate_closed=%s, route_count=%d", 
+        tostring(ready), tostring(synced_once), tostring(gate_closed), route_count))
     
-    return ready
+    return ready and not gate_closed
 end
 
 -- 获取所有路由数据（用于指标收集）
@@ -0,0 +1,185 @@
+local bit = require "bit"
+
+local _M = {}
+
+-- 解析 IPv4 地址为 4 字节数组
+local function parse_ipv4(ip)
+    local a, b, c, d = ip:match("^(%d+)%.(%d+)%.(%d+)%.(%d+)$")
+    if not a then
+        return nil
+    end
+    local bytes = { tonumber(a), tonumber(b), tonumber(c), tonumber(d) }
+    for _, v in ipairs(bytes) do
+        if v > 255 then
+            return nil
+        end
+    end
+    return bytes
+end
+
+-- 解析 IPv6 地址为 16 字节数组（支持 :: 缩写和内嵌 IPv4）
+local function parse_ipv6(ip)
+    if not ip:find(":", 1, true) then
+        return nil
+    end
+
+    -- 处理内嵌的 IPv4 后缀，例如 ::ffff:10.0.0.1
+    local tail_bytes = {}
+    local v4 = ip:match(":(%d+%.%d+%.%d+%.%d+)$")
+    if v4 then
+        local b4 = parse_ipv4(v4)
+        if not b4 then
+            return nil
+        end
+        tail_bytes = b4
+        ip = ip:sub(1, #ip - #v4) .. "0:0"
+    end
+
+    local head, tail = ip, nil
+    local pos = ip:find("::", 1, true)
+    if pos then
+        head = ip:sub(1, pos - 1)
+        tail = ip:sub(pos + 2)
+        if tail:find("::", 1, true) then
+            return nil
+        end
+    end
+
+    local function split_groups(s)
+        local groups = {}
+        if s == "" then
+            return groups
+        end
+        for g in (s .. ":"):gmatch("([^:]*):") do
+            if not g:match("^%x%x?%x?%x?$") then
+                return nil
+            end
+            table.insert(groups, tonumber(g, 16))
+        end
+        return groups
+    end
+
+    local head_groups = split_groups(head)
+    local tail_groups = tail and split_groups(tail) or {}
+    if not head_groups or not tail_groups then
+        return nil
+    end
+
+    local groups = {}
+    if tail then
+        local missing = 8 - #head_groups - #tail_groups
+        if missing < 1 then
+            return nil
+        end
+        for _, g in ipairs(head_groups) do table.insert(groups, g) end
+        for _ = 1, missing do table.insert(groups, 0) end
+        for _, g in ipairs(tail_groups) do table.insert(groups, g) end
+    else
+        if #head_groups ~= 8 then
+            return nil
+        end
+        groups = head_groups
+    end
+
+    local bytes = {}
+    for _, g in ipairs(groups) do
+        table.insert(bytes, bit.rshift(g, 8))
+        table.insert(bytes, bit.band(g, 0xff))
+    end
+
+    if #tail_bytes == 4 then
+        for i = 1, 4 do
+            bytes[12 + i] = tail_bytes[i]
+        end
+    end
+    return bytes
+end
+
+local function parse_ip(ip)
+    return parse_ipv4(ip) or parse_ipv6(ip)
+end
+
+-- 解析 CIDR（或单个 IP）为 { bytes, prefix }
+local function parse_cidr(cidr)
+    local ip, prefix = cidr:match("^([^/]+)/(%d+)$")
+    if not ip then
+        ip = cidr
+    end
+    local bytes = parse_ip(ip)
+    if not bytes then
+        return nil
+    end
+    local max_prefix = #bytes * 8
+    prefix = prefix and tonumber(prefix) or max_prefix
+    if prefix > max_prefix then
+        return nil
+    end
+    return { bytes = bytes, prefix = prefix }
+end
+
+-- 判断 IP 字节数组是否落在 CIDR 内（地址族不同则不匹配）
+local function cidr_contains(net, bytes)
+    if #net.bytes ~= #bytes then
+        return false
+    end
+    local remaining = net.prefix
+    for i = 1, #bytes do
+        if remaining <= 0 then
+            return true
+        end
+        if remaining >= 8 then
+            if net.bytes[i] ~= bytes[i] then
+                return false
+            end
+        else
+            local mask = bit.band(bit.lshift(0xff, 8 - remaining), 0xff)
+            if bit.band(net.bytes[i], mask) ~= bit.band(bytes[i], mask) then
+                return false
+            end
+        end
+        remaining = remaining - 8
+    end
+    return true
+end
+
+local function match_any(list, bytes)
+    for _, cidr in ipairs(list or {}) do
+        local net = parse_cidr(cidr)
+        if net and cidr_contains(net, bytes) then
+            return true
+        end
+    end
+    return false
+end
+
+-- 检查客户端 IP 是否被允许访问
+-- 优先级：deny 优先于 allow；allow 非空时仅放行命中 allow 的地址
+function _M.is_allowed(ip_filter, client_ip)
+    if not ip_filter then
+        return true
+    end
+
+    local deny = ip_filter.deny or {}
+    local allow = ip_filter.allow or {}
+    if #deny == 0 and #allow == 0 then
+        return true
+    end
+
+    local bytes = client_ip and parse_ip(client_ip)
+    if not bytes then
+        -- 无法解析的客户端地址：配置了 allow 时拒绝，否则放行
+        return #allow == 0
+    end
+
+    if match_any(deny, bytes) then
+        return false
+    end
+
+    if #allow > 0 then
+        return match_any(allow, bytes)
+    end
+
+    return true
+end
+
+return _M
@@ -249,6 +249,7 @@ function _M.get_metrics(resource_type, namespace, name)
     return {
         -- 计数
         cnt = total_count,
+        errcnt = total_errors,
         
         -- 吞吐量 (requests per minute)
         m1 = m1_stats.throughput,
@@ -280,6 +281,25 @@ function _M.get_metrics(resource_type, namespace, name)
     }
 end
 
+-- 获取给定 upstream（namespace/name）的请求量、错误数和延迟，供 watcher 采集
+function _M.get_upstream_stats(keys)
+    local result = {}
+    for _, key in ipairs(keys) do
+        local namespace, name = key:match("^([^/]+)/(.+)$")
+        if namespace then
+            local m = _M.get_metrics("upstream", namespace, name)
+            result[key] = {
+                requests = m.cnt,
+                errors = m.errcnt or 0,
+                latencyMeanMs = m.mean,
+                latencyP50Ms = m.p50,
+                latencyP99Ms = m.p99
+            }
+        end
+    end
+    return result
+end
+
 -- 获取所有资源的指标
 function _M.get_all_metrics()
     local result = {
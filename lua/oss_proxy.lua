@@ -2,7 +2,10 @@ local crd_watcher = require "crd_watcher"
 local http = require "resty.http"
 local str = require "resty.string"
 local aws_signature = require "aws_signature"
+local ip_filter = require "ip_filter"
 local json = require "cjson"
+local resty_lock = require "resty.lock"
+local compression = require "compression"
 
 local _M = {}
 
@@ -11,6 +14,13 @@ local function build_oss_request_params(upstream_spec, bucket, object_key)
     local protocol = upstream_spec.useHTTPS and "https" or "http"
     local endpoint = upstream_spec.endpoint
 
+    -- endpoint 带 scheme 时以 scheme 为准
+    local scheme, rest = endpoint:match("^(https?)://(.-)/?$")
+    if scheme then
+        protocol = scheme
+        endpoint = rest
+    end
+
     local host = ""
     local uri = ""
     
@@ -34,6 +44,120 @@ local function build_oss_request_params(upstream_spec, bucket, object_key)
     return protocol, host, uri
 end
 
+-- 根据对象键的扩展名查找 Content-Type 覆盖配置，多个扩展名匹配时取最长的（例如 tar.gz 优先于 gz）
+local function find_content_type_override(overrides, object_key)
+    if not overrides then
+        return nil
+    end
+
+    local path = string.lower(object_key:match("^([^?]*)") or object_key)
+    local best, best_len = nil, 0
+    for ext, mime_type in pairs(overrides) do
+        local normalized = string.lower(ext):gsub("^%.", "")
+        local suffix = "." .. normalized
+        if #suffix > best_len and string.sub(path, -#suffix) == suffix then
+            best, best_len = mime_type, #suffix
+        end
+    end
+    return best
+end
+
+-- 按 spec.trailingSlash 规范化请求路径末尾的 /，只处理路径部分，查询参数保持不变。
+-- strip 去掉末尾的 /；add 为最后一段不含扩展名的路径补上 /（如 /docs -> /docs/，/app.js 不变）；
+-- preserve（默认）原样使用。根路径 / 已在此前替换为 indexFile，不受影响。
+local function normalize_trailing_slash(mode, uri)
+    if not mode or mode == "preserve" then
+        return uri
+    end
+
+    local path, query = uri:match("^([^?]*)(.*)$")
+    if mode == "strip" then
+        local stripped = path:gsub("/+$", "")
+        if stripped ~= "" then
+            path = stripped
+        end
+    elseif mode == "add" then
+        local last_segment = path:match("([^/]*)$")
+        if last_segment ~= "" and not last_segment:find(".", 1, true) then
+            path = path .. "/"
+        end
+    end
+    return path .. query
+end
+
+-- 按 spec.cache.varyQuery 只保留允许的查询参数，并按参数名排序，使参数顺序不同的请求得到相同的缓存 key。
+-- 列表为空时去掉全部查询参数；未设置时原样返回。被丢弃的参数不会发往 upstream，保证缓存内容与 key 一致。
+local function apply_vary_query(cache_spec, uri)
+    local vary_query = cache_spec and cache_spec.varyQuery
+    if vary_query == nil or vary_query == ngx.null then
+        return uri
+    end
+
+    local path, query = uri:match("^([^?]*)%??(.*)$")
+    if query == "" then
+        return path
+    end
+
+    local allowed = {}
+    for _, name in ipairs(vary_query) do
+        allowed[name] = true
+    end
+
+    local kept = {}
+    for pair in query:gmatch("[^&]+") do
+        local name = pair:match("^([^=]*)")
+        if allowed[name] then
+            table.insert(kept, pair)
+        end
+    end
+    if #kept == 0 then
+        return path
+    end
+
+    -- 同名参数保持原有的相对顺序
+    for i, pair in ipairs(kept) do
+        kept[i] = { name = pair:match("^([^=]*)"), pair = pair, index = i }
+    end
+    table.sort(kept, function(a, b)
+        if a.name ~= b.name then
+            return a.name < b.name
+        end
+        return a.index < b.index
+    end)
+    for i, item in ipairs(kept) do
+        kept[i] = item.pair
+    end
+    return path .. "?" .. table.concat(kept, "&")
+end
+
+-- 请求路径是否命中 spec.paths 中的任一 prefix，按路径段匹配；未配置 paths 时总是命中
+local function path_allowed(paths, uri)
+    if not paths or #paths == 0 then
+        return true
+    end
+    local path = uri:match("^[^?]*")
+    for _, item in ipairs(paths) do
+        local prefix = item.prefix
+        if prefix == "/" then
+            return true
+        end
+        prefix = prefix:gsub("/+$", "")
+        if path == prefix or path:sub(1, #prefix + 1) == prefix .. "/" then
+            return true
+        end
+    end
+    return false
+end
+
+-- 在发往 upstream 的路径（以 / 开头）前加上 spec.upstreamPathPrefix
+local function apply_upstream_path_prefix(route_spec, path)
+    local prefix = route_spec.upstreamPathPrefix
+    if not prefix or prefix == "" then
+        return path
+    end
+    return "/" .. (prefix:gsub("/+$", "")) .. path
+end
+
 -- 发起 OSS 请求
 local function oss_request(protocol, host, uri, headers, upstream_spec, bucket)
     local httpc = http.new()
@@ -43,6 +167,9 @@ local function oss_request(protocol, host, uri, headers, upstream_spec, bucket)
     httpc:set_timeout((timeout.connect or 10) * 1000)
     
     local creds = upstream_spec.credentials
+    if creds.unavailable then
+        return nil, "upstream 凭据尚未同步，且未启用 anonymousFallback"
+    end
     if creds.accessKeyId and creds.secretAccessKey then
         local signed_headers = aws_signature.aws_get_headers(host, uri, upstream_spec.region, creds.accessKeyId, creds.secretAccessKey)
         headers = headers or {}
@@ -67,6 +194,114 @@ local function oss_request(protocol, host, uri, headers, upstream_spec, bucket)
     return res, err
 end
 
+-- 合并请求的结果保留时间（秒），只需覆盖等待锁的请求读取结果的窗口
+local COLLAPSE_RESULT_TTL = 1
+
+-- 按 spec.collapseRequests 合并对同一对象的并发请求：只有持有锁的请求访问 upstream，
+-- 其他请求等待锁释放后直接使用其结果。等待超过 lockTimeout 时放弃合并，自行访问 upstream。
+local function collapsed_request(collapse, cache_key, fetch)
+    if not collapse or not collapse.enabled then
+        return fetch()
+    end
+
+    local results = ngx.shared.collapse_results
+    local function cached_result()
+        local cached = results:get(cache_key)
+        if cached then
+            local ok, decoded = pcall(json.decode, cached)
+            if ok then
+                -- JSON 往返后 headers 变为普通 table，恢复大小写不敏感的查找
+                local headers = {}
+                for name, value in pairs(decoded.headers or {}) do
+                    headers[string.lower(name)] = value
+                end
+                decoded.headers = setmetatable(headers, {
+                    __index = function(t, name) return rawget(t, string.lower(name)) end
+                })
+                return decoded
+            end
+        end
+        return nil
+    end
+
+    local res = cached_result()
+    if res then
+        return res
+    end
+
+    local lock_timeout = collapse.lockTimeout or 5
+    local lock, lock_err = resty_lock:new("collapse_locks", { timeout = lock_timeout, exptime = lock_timeout + 30 })
+    if not lock then
+        ngx.log(ngx.ERR, "[oss_proxy] 创建合并请求锁失败: ", lock_err)
+        return fetch()
+    end
+
+    local elapsed, err = lock:lock(cache_key)
+    if not elapsed then
+        ngx.log(ngx.WARN, "[oss_proxy] 等待合并请求锁失败，直接请求 upstream: ", err)
+        return fetch()
+    end
+
+    -- 等待期间持有锁的请求可能已经写入了结果
+    res = cached_result()
+    if res then
+        lock:unlock()
+        return res
+    end
+
+    local request_err
+    res, request_err = fetch()
+    if res and (res.status == 200 or res.status == 404) then
+        local ok, encoded = pcall(json.encode, { status = res.status, headers = res.headers, body = res.body })
+        if ok then
+            local set_ok, set_err = results:set(cache_key, encoded, COLLAPSE_RESULT_TTL)
+            if not set_ok then
+                ngx.log(ngx.WARN, "[oss_proxy] 缓存合并请求结果失败: ", set_err)
+            end
+        end
+    end
+    lock:unlock()
+    return res, request_err
+end
+
+-- 按 spec.notFoundBehavior 响应对象不存在的请求，返回最终状态码
+local function respond_not_found(behavior, res, route_spec, upstream_spec, protocol, oss_host)
+    -- 原样返回 upstream 的响应
+    if behavior.passThrough then
+        if res.headers and res.headers["Content-Type"] then
+            ngx.header["Content-Type"] = res.headers["Content-Type"]
+        end
+        ngx.status = res.status
+        ngx.print(res.body or "")
+        return res.status
+    end
+
+    if behavior.redirect then
+        local status = behavior.status or 302
+        ngx.header["Location"] = behavior.redirect
+        ngx.status = status
+        return status
+    end
+
+    local status = behavior.status or 404
+    if behavior.document then
+        local document_key = (route_spec.prefix or "") .. behavior.document
+        local doc_res = oss_request(protocol, oss_host, apply_upstream_path_prefix(route_spec, "/" .. document_key), {}, upstream_spec, route_spec.bucket)
+        if doc_res and doc_res.status == 200 then
+            ngx.header["Content-Type"] = (doc_res.headers and doc_res.headers["Content-Type"]) or "text/html; charset=utf-8"
+            ngx.status = status
+            ngx.print(doc_res.body)
+            return status
+        end
+        ngx.log(ngx.WARN, "notFoundBehavior.document 不存在: ", document_key)
+    end
+
+    ngx.header["Content-Type"] = "text/plain; charset=utf-8"
+    ngx.status = status
+    ngx.say(behavior.body or "页面未找到")
+    return status
+end
+
 -- 处理静态文件请求
 function _M.handle_request()
     local host = ngx.var.http_host or ngx.var.host
@@ -114,10 +349,37 @@ function _M.handle_request()
         ngx.log(ngx.ERR, "Failed to load metrics module in oss_proxy: " .. (metrics or "unknown error"))
     end
     
+    -- IP 访问控制（deny 优先于 allow）
+    if route_spec.ipFilter and not ip_filter.is_allowed(route_spec.ipFilter, ngx.var.remote_addr) then
+        ngx.log(ngx.INFO, "IP 访问被拒绝: ", ngx.var.remote_addr, " -> ", host)
+        ngx.status = 403
+        ngx.header["Content-Type"] = "text/plain; charset=utf-8"
+        ngx.say("禁止访问")
+
+        if metrics_ok and metrics and route_namespace and route_name then
+            metrics.record_request_end("route", route_namespace, route_name, 403, start_time)
+        end
+        return
+    end
+
+    -- 只处理 spec.paths 中的路径
+    if not path_allowed(route_spec.paths, uri) then
+        ngx.status = 404
+        ngx.header["Content-Type"] = "text/plain; charset=utf-8"
+        ngx.say("未找到匹配的路径: " .. host .. uri:match("^[^?]*"))
+
+        if metrics_ok and metrics and route_namespace and route_name then
+            metrics.record_request_end("route", route_namespace, route_name, 404, start_time)
+        end
+        return
+    end
+
     -- 处理根路径
     if uri == "/" then
         uri = "/" .. (route_spec.indexFile or "index.html")
     end
+    uri = normalize_trailing_slash(route_spec.trailingSlash, uri)
+    uri = apply_vary_query(route_spec.cache, uri)
     
     -- 构建对象键
     local object_key = (route_spec.prefix or "") .. string.sub(uri, 2) -- 去掉开头的 /
@@ -126,7 +388,23 @@ function _M.handle_request()
     local protocol, oss_host, oss_uri = build_oss_request_params(upstream_spec, route_spec.bucket, object_key)
     
     -- 发起请求 - 使用与AWS签名相同的URI格式
-    local res, request_err = oss_request(protocol, oss_host, uri, {}, upstream_spec, route_spec.bucket)
+    local upstream_uri = apply_upstream_path_prefix(route_spec, uri)
+    local res, request_err = collapsed_request(route_spec.collapseRequests, protocol .. "://" .. oss_host .. upstream_uri, function()
+        return oss_request(protocol, oss_host, upstream_uri, {}, upstream_spec, route_spec.bucket)
+    end)
+    
+    -- 大小写不敏感模式：原样查找未命中时，再用全小写的对象键查找一次
+    if res and res.status == 404 and route_spec.caseInsensitiveKeys then
+        local lower_uri = string.lower(uri)
+        if lower_uri ~= uri then
+            local lower_res, lower_err = oss_request(protocol, oss_host, apply_upstream_path_prefix(route_spec, lower_uri), {}, upstream_spec, route_spec.bucket)
+            if lower_res and lower_res.status ~= 404 then
+                res, request_err = lower_res, lower_err
+                uri = lower_uri
+                object_key = string.lower(object_key)
+            end
+        end
+    end
     
     if not res then
         ngx.log(ngx.ERR, "OSS 请求失败: ", request_err)
@@ -145,11 +423,23 @@ function _M.handle_request()
     
     -- 处理 404 情况
     if res.status == 404 then
+        -- 显式配置的 notFoundBehavior 优先于 errorPages
+        if route_spec.notFoundBehavior then
+            local status = respond_not_found(route_spec.notFoundBehavior, res, route_spec, upstream_spec, protocol, oss_host)
+            if metrics_ok and metrics and route_namespace and route_name then
+                metrics.record_request_end("route", route_namespace, route_name, status, start_time)
+            end
+            if metrics_ok and metrics and upstream_namespace and upstream_name then
+                metrics.record_request_end("upstream", upstream_namespace, upstream_name, status, start_time)
+            end
+            return
+        end
+        
         if route_spec.spaApp then
             -- SPA 模式：返回 index 文件
             local index_key = (route_spec.prefix or "") .. (route_spec.indexFile or "index.html")
             local protocol, oss_host, oss_uri = build_oss_request_params(upstream_spec, route_spec.bucket, index_key)
-            local index_res, index_err = oss_request(protocol, oss_host, "/" .. index_key, {}, upstream_spec, route_spec.bucket)
+            local index_res, index_err = oss_request(protocol, oss_host, apply_upstream_path_prefix(route_spec, "/" .. index_key), {}, upstream_spec, route_spec.bucket)
             
             if index_res and index_res.status == 200 then
                 -- 设置正确的 Content-Type
@@ -163,7 +453,12 @@ function _M.handle_request()
                 end
                 
                 ngx.status = 200
-                ngx.say(index_res.body)
+                local compressed = compression.apply(route_spec.compression, ngx.header["Content-Type"], index_res.body)
+                if compressed then
+                    ngx.print(compressed)
+                else
+                    ngx.say(index_res.body)
+                end
                 
                 -- 记录SPA重定向的指标（状态码200，因为成功返回了index文件）
                 if metrics_ok and metrics and route_namespace and route_name then
@@ -179,7 +474,7 @@ function _M.handle_request()
             if route_spec.errorPages and route_spec.errorPages["404"] then
                 local error_key = (route_spec.prefix or "") .. route_spec.errorPages["404"]
                 local protocol, oss_host, oss_uri = build_oss_request_params(upstream_spec, route_spec.bucket, error_key)
-                local error_res, error_err = oss_request(protocol, oss_host, "/" .. error_key, {}, upstream_spec, route_spec.bucket)
+                local error_res, error_err = oss_request(protocol, oss_host, apply_upstream_path_prefix(route_spec, "/" .. error_key), {}, upstream_spec, route_spec.bucket)
                 
                 if error_res and error_res.status == 200 then
                     ngx.header["Content-Type"] = "text/html; charset=utf-8"
@@ -235,13 +530,20 @@ function _M.handle_request()
         end
     end
     
+    -- 按扩展名覆盖 Content-Type
+    local content_type = res.headers["content-type"] or ""
+    local override = find_content_type_override(route_spec.contentTypeOverrides, object_key)
+    if override then
+        ngx.header["Content-Type"] = override
+        content_type = override
+    end
+    
     -- 设置缓存头
     local cache_config = route_spec.cache or {}
     if cache_config.enabled ~= false then
         local max_age = cache_config.maxAge or 3600
         
         -- 根据文件类型设置不同的缓存时间
-        local content_type = res.headers["content-type"] or ""
         if string.match(content_type, "text/html") then
             max_age = cache_config.htmlMaxAge or 300
         elseif string.match(uri, "%.(js|css|png|jpg|jpeg|gif|ico|svg|woff|woff2|ttf|eot)$") then
@@ -249,11 +551,22 @@ function _M.handle_request()
         end
         
         ngx.header["Cache-Control"] = "public, max-age=" .. max_age
+        
+        -- 丢弃 upstream 返回的与缓存策略冲突的响应头
+        if cache_config.ignoreUpstreamHeaders then
+            ngx.header["Expires"] = nil
+            ngx.header["Pragma"] = nil
+        end
     end
     
-    -- 输出响应体
+    -- 输出响应体，按 spec.compression 压缩
     ngx.status = res.status
-    ngx.say(res.body)
+    local compressed = res.status == 200 and compression.apply(route_spec.compression, content_type, res.body)
+    if compressed then
+        ngx.print(compressed)
+    else
+        ngx.say(res.body)
+    end
     
     -- 记录指标（在响应完成后）
     if metrics_ok and metrics and route_namespace and route_name then